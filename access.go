@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// tokenKind is what an API token was issued for.
+type tokenKind int
+
+const (
+	tokenUnknown   tokenKind = iota // the probe couldn't tell
+	tokenAdminKey                   // an admin API key, which may do anything
+	tokenTenantKey                  // an API key of one tenant, which can't list tenants
+	tokenUser                       // a user's token, with the user's permissions
+)
+
+// tokenAccess is what the token of a connection may do, see probeAccess.
+type tokenAccess struct {
+	kind  tokenKind
+	admin bool // a global admin, who may do anything
+
+	// The tenants of a user, and whether the user may change devices in
+	// each: admins of the tenant and device admins may
+	writable map[string]bool
+}
+
+// errTenantKey explains why a tenant API key can't go on without --tenant.
+var errTenantKey = errors.New("this API key belongs to a tenant and can't list tenants; start with --tenant and the ID of its tenant")
+
+// probeAccess finds out what the token in ctx may do. Only users have a
+// profile, which lists their tenants and permissions in each; of API keys,
+// only admin ones may list the admin keys. An invalid token is an error; a
+// probe that fails otherwise leaves the kind unknown, and the token is then
+// trusted with everything.
+func probeAccess(ctx context.Context, internal api.InternalServiceClient) (tokenAccess, error) {
+	if p, err := internal.Profile(ctx, &emptypb.Empty{}); err == nil && p.User != nil {
+		a := tokenAccess{kind: tokenUser, admin: p.User.IsAdmin, writable: make(map[string]bool)}
+		for _, t := range p.Tenants {
+			a.writable[t.TenantId] = t.IsAdmin || t.IsDeviceAdmin
+		}
+		return a, nil
+	}
+
+	_, err := internal.ListApiKeys(ctx, &api.ListApiKeysRequest{IsAdmin: true})
+	switch status.Code(err) {
+	case codes.OK:
+		return tokenAccess{kind: tokenAdminKey, admin: true}, nil
+	case codes.PermissionDenied:
+		return tokenAccess{kind: tokenTenantKey}, nil
+	case codes.Unauthenticated:
+		return tokenAccess{}, err
+	}
+	return tokenAccess{}, nil
+}
+
+// readOnly reports whether the token may only read the devices of tenant
+// tenantID, which is only known of users.
+func (a tokenAccess) readOnly(tenantID string) bool {
+	return a.kind == tokenUser && !a.admin && !a.writable[tenantID]
+}
+
+// writeAccess checks that the token may run mode md over the devices of
+// application appID in tenant tenantID, and says what it can't do
+// otherwise. Users' permissions are known from their profile. For the modes
+// that create devices, a device without a DevEUI is also sent: the server
+// checks the permission before the device, so it refuses the create either
+// as denied or as invalid, never creating anything. That probe isn't
+// recorded in the audit log.
+func (a tokenAccess) writeAccess(ctx context.Context, devices api.DeviceServiceClient, md importer.Mode, appID, tenantID string) error {
+	if md.ReadOnly() {
+		return nil
+	}
+	if a.readOnly(tenantID) {
+		return fmt.Errorf("this token can list but not change the devices of this tenant, so it can't %s them", md.Verb())
+	}
+	if !md.Creates() {
+		return nil
+	}
+	_, err := devices.Create(importer.Probing(ctx), &api.CreateDeviceRequest{Device: &api.Device{ApplicationId: appID}})
+	if c := status.Code(err); c == codes.PermissionDenied || c == codes.Unauthenticated {
+		return errors.New("this token can list but not create devices in this application")
+	}
+	return nil
+}
+
+// Messages of the token probes
+type (
+	accessMsg struct{ access tokenAccess }
+	// accessCheckedMsg says why the token can't run the confirmed run, nil
+	// if nothing is known to stop it.
+	accessCheckedMsg struct{ err error }
+)
+
+func (m model) probeAccess() tea.Cmd {
+	return func() tea.Msg {
+		a, err := probeAccess(importer.AuthContext(context.Background(), m.apiToken), m.internalClient)
+		if err != nil {
+			return loadFailedMsg{err}
+		}
+		return accessMsg{access: a}
+	}
+}
+
+// checkAccess checks that the token may run the import about to be
+// confirmed; see writeAccess.
+func (m model) checkAccess() tea.Cmd {
+	if m.cfg.dryRun || m.cfg.Gateways {
+		return nil
+	}
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		return accessCheckedMsg{m.access.writeAccess(ctx, m.deviceClient, m.cfg.Mode, m.selectedApp, m.selectedTenant)}
+	}
+}
+
+// loadTenantOfKey lists the one tenant of a tenant API key, given by
+// --tenant or the last one selected, as if tenants had been listed.
+func (m model) loadTenantOfKey() tea.Cmd {
+	id := m.cfg.tenantID
+	if id == "" {
+		id = m.history.TenantID
+	}
+	return func() tea.Msg {
+		if id == "" {
+			return loadFailedMsg{errTenantKey}
+		}
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		resp, err := m.tenantClient.Get(ctx, &api.GetTenantRequest{Id: id})
+		if err != nil {
+			return loadFailedMsg{fmt.Errorf("looking up tenant %s of the API key: %w", id, err)}
+		}
+		t := resp.Tenant
+		desc := tenantDescription(ctx, m.internalClient, &api.TenantListItem{Id: t.Id, Name: t.Name, MaxDeviceCount: t.MaxDeviceCount, MaxGatewayCount: t.MaxGatewayCount})
+		return tenantsLoadedMsg{[]item{{title: t.Name, desc: desc, id: t.Id}}, 1}
+	}
+}
+
+// readOnlyToken reports whether the token may only read the devices of the
+// selected tenant, in which case only the read-only modes are offered.
+// Gateways are left to the server.
+func (m model) readOnlyToken() bool {
+	return !m.cfg.Gateways && m.access.readOnly(m.selectedTenant)
+}
+
+// deniedView says what the token can't do, for the confirmation.
+func (m model) deniedView() string {
+	if m.denied == nil {
+		return ""
+	}
+	return m.theme.warning.Render("⚠ Can't start: "+m.denied.Error()) + "\n\n"
+}
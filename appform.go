@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// newApplicationItem is the first entry of the application list, opening
+// the form to create one.
+var newApplicationItem = item{
+	title:  "➕ Create new application…",
+	desc:   "Create an application in this tenant and import into it",
+	create: true,
+}
+
+// applicationForm asks for the name and description of a new application.
+type applicationForm struct {
+	inputs  []textinput.Model // name, description
+	focus   int
+	pending bool   // waiting for the server
+	status  string // why the last attempt failed
+}
+
+func newApplicationForm() *applicationForm {
+	name := textinput.New()
+	name.Placeholder = "Application name"
+	name.CharLimit = 100
+	name.Width = 50
+	name.Focus()
+
+	desc := textinput.New()
+	desc.Placeholder = "Description (optional)"
+	desc.CharLimit = 200
+	desc.Width = 50
+
+	return &applicationForm{inputs: []textinput.Model{name, desc}}
+}
+
+// Messages for the outcome of creating an application. The error is wrapped
+// in a struct, as a type switch would match it as any other error message.
+type (
+	applicationCreatedMsg item
+	applicationFailedMsg  struct{ err error }
+)
+
+// updateAppForm handles keys on the create-application form.
+func (m model) updateAppForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := m.appForm
+	if f.pending {
+		if keyForceQuit.matches(m, msg) {
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyFormBack.matches(m, msg):
+		m.appForm = nil
+		m.state = stateApplicationSelect
+		return m, nil
+	case keyNextField.matches(m, msg):
+		f.inputs[f.focus].Blur()
+		f.focus = (f.focus + 1) % len(f.inputs)
+		return m, f.inputs[f.focus].Focus()
+	case keyCreateApp.matches(m, msg):
+		name := strings.TrimSpace(f.inputs[0].Value())
+		if name == "" {
+			f.status = "Enter a name for the application"
+			return m, nil
+		}
+		f.status = ""
+		f.pending = true
+		return m, tea.Batch(m.spinner.Tick, m.createApplication(name, strings.TrimSpace(f.inputs[1].Value())))
+	}
+
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return m, cmd
+}
+
+// createApplication creates an application in the selected tenant.
+func (m model) createApplication(name, description string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+
+		resp, err := m.appClient.Create(ctx, &api.CreateApplicationRequest{
+			Application: &api.Application{
+				Name:        name,
+				Description: description,
+				TenantId:    m.selectedTenant,
+			},
+		})
+		if err != nil {
+			return applicationFailedMsg{err}
+		}
+		return applicationCreatedMsg(item{title: name, desc: description, id: resp.Id})
+	}
+}
+
+func (m model) appFormView() string {
+	f := m.appForm
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "New application in tenant %s\n\n", m.tenantName)
+	fmt.Fprintf(&b, "Name:        %s\n", f.inputs[0].View())
+	fmt.Fprintf(&b, "Description: %s\n", f.inputs[1].View())
+
+	if f.pending {
+		b.WriteString("\n" + m.spinner.View() + " Creating application…\n")
+	} else if f.status != "" {
+		b.WriteString("\n" + m.theme.status.Render(f.status) + "\n")
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s",
+		m.header("Create Application"),
+		b.String(),
+		m.helpView(),
+	)
+}
+
+// createErrorMessage returns the server's message for err without the gRPC
+// status prefix, e.g. "Object already exists".
+func createErrorMessage(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Message()
+	}
+	return err.Error()
+}
@@ -0,0 +1,21 @@
+package main
+
+import "path/filepath"
+
+// defaultAuditFile returns where the audit log goes unless --audit-log is
+// given.
+func defaultAuditFile() string {
+	dir, err := dataDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "audit.jsonl")
+}
+
+// auditView names the audit log on the summary.
+func (m model) auditView() string {
+	if m.cfg.audit == nil {
+		return ""
+	}
+	return "\n" + m.theme.help.Render("Audit log: "+m.cfg.audit.Path)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Selection screens that are skipped when they have a single choice, by the
+// names --no-auto-select takes
+var autoSelectSteps = map[string]state{
+	"tenant":      stateTenantSelect,
+	"application": stateApplicationSelect,
+	"profile":     stateDeviceProfileSelect,
+}
+
+// noAutoSelect is the set of selection screens --no-auto-select keeps even
+// with a single choice. The flag alone keeps all of them.
+type noAutoSelect map[state]bool
+
+func (n noAutoSelect) String() string {
+	var steps []string
+	for _, name := range slices.Sorted(maps.Keys(autoSelectSteps)) {
+		if n[autoSelectSteps[name]] {
+			steps = append(steps, name)
+		}
+	}
+	return strings.Join(steps, ",")
+}
+
+func (n noAutoSelect) Set(s string) error {
+	switch s {
+	case "true":
+		for _, st := range autoSelectSteps {
+			n[st] = true
+		}
+		return nil
+	case "false":
+		clear(n)
+		return nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		st, ok := autoSelectSteps[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown step %q, use tenant, application or profile", name)
+		}
+		n[st] = true
+	}
+	return nil
+}
+
+func (n noAutoSelect) IsBoolFlag() bool { return true }
+
+// autoSelect chooses the only entry of the selection list just loaded, as if
+// it was selected, unless the list offers a choice or --no-auto-select keeps
+// the step. The list is still built, so going back to it after a failure
+// further on shows the entry that was chosen.
+func (m model) autoSelect() (tea.Model, tea.Cmd) {
+	l := m.currentList()
+	if l == nil || m.cfg.noAutoSelect[m.state] {
+		return m, nil
+	}
+	if s := m.currentSearch(); s != nil && s.partial() {
+		return m, nil
+	}
+
+	only := -1
+	for i, li := range l.Items() {
+		if it, ok := li.(item); ok && !it.create {
+			if only >= 0 {
+				return m, nil
+			}
+			only = i
+		}
+	}
+	if only < 0 {
+		return m, nil
+	}
+	l.Select(only)
+	return m.handleEnter()
+}
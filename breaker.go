@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/status"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// defaultBreakerThreshold is how many rows in a row have to fail with the
+// same status for the breaker to pause an import, unless --breaker says
+// otherwise.
+const defaultBreakerThreshold = 10
+
+// probeInterval is how often a paused import checks whether the server is
+// back, with --breaker-probe.
+const probeInterval = 30 * time.Second
+
+// Messages of the breaker in the interactive UI
+type (
+	breakerTrippedMsg importer.Tripped
+	probeTickMsg      struct{}
+	probedMsg         struct{ err error }
+)
+
+// tripBreaker pauses the import in progress after the burst of failures t.
+func (m model) tripBreaker(t importer.Tripped) (tea.Model, tea.Cmd) {
+	m.tripped = &t
+	m.probeErr = nil
+	if !m.paused {
+		m.paused = true
+		m.clock.pause(time.Now())
+	}
+	cmds := []tea.Cmd{waitForEvent(m.events)}
+	if m.cfg.breakerProbe {
+		cmds = append(cmds, probeTick())
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func probeTick() tea.Cmd {
+	return tea.Tick(probeInterval, func(time.Time) tea.Msg { return probeTickMsg{} })
+}
+
+// probeServer checks whether the server is back, for an import the breaker
+// paused.
+func (m model) probeServer() tea.Cmd {
+	if m.tripped == nil || m.state != stateProcessing {
+		return nil
+	}
+	imp := importer.Importer{Apps: m.appClient, Token: m.apiToken, ApplicationID: m.selectedApp}
+	return func() tea.Msg {
+		return probedMsg{imp.Probe(context.Background())}
+	}
+}
+
+// probed resumes the import once a probe got through, or waits for the
+// next one.
+func (m model) probed(msg probedMsg) (tea.Model, tea.Cmd) {
+	if m.tripped == nil || m.state != stateProcessing {
+		return m, nil
+	}
+	if msg.err != nil {
+		m.probeErr = msg.err
+		return m, probeTick()
+	}
+	m.tripped, m.probeErr = nil, nil
+	if m.paused {
+		return m.togglePause()
+	}
+	return m, nil
+}
+
+// cancelTripped stops an import the breaker paused, keeping what it did,
+// as if it had reached its failure limit. The rows not attempted aren't
+// counted as failed.
+func (m model) cancelTripped() (tea.Model, tea.Cmd) {
+	m.stopRun(&importer.Aborted{Failed: m.tripped.Streak, Last: m.tripped.Last})
+	m.tripped, m.paused = nil, false
+	m.clock.resume(time.Now())
+	return m, nil
+}
+
+// trippedView explains why the breaker paused the import.
+func (m model) trippedView() string {
+	t := m.tripped
+	if t == nil {
+		return ""
+	}
+	view := m.theme.warning.Render(fmt.Sprintf("⚠ Paused: %d rows in a row failed with %s", t.Streak, status.Code(t.Last))) + "\n" +
+		m.theme.status.Render("  "+importer.DescribeError(t.Last)) + "\n"
+	switch {
+	case m.cfg.breakerProbe && m.probeErr != nil:
+		view += m.theme.help.Render(fmt.Sprintf("The server is still failing (%s); trying again every %s", status.Code(m.probeErr), probeInterval)) + "\n"
+	case m.cfg.breakerProbe:
+		view += m.theme.help.Render(fmt.Sprintf("Resumes on its own once the server answers; trying every %s", probeInterval)) + "\n"
+	}
+	return view + "\n"
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// browseAhead is how close to the end of the loaded devices the cursor of
+// the browser gets before the next page is fetched.
+const browseAhead = 10
+
+// deviceBrowser pages through the devices of an application, read-only.
+// Pages are fetched as the cursor nears the end of those loaded; an
+// application with more devices than a page is searched on the server,
+// like the tenant and application lists.
+type deviceBrowser struct {
+	appID, appName string
+	list           list.Model
+	search         listSearch
+	count          int  // devices matching the query on the server
+	loading        bool // a page is on its way
+
+	profiles map[string]string // device profile names by DevEUI
+	detail   *deviceDetailMsg  // the device opened, nil while it loads
+}
+
+// Messages of the device browser
+type (
+	browsePageMsg struct {
+		query    string
+		offset   int
+		items    []item
+		profiles map[string]string // device profile names by DevEUI
+		total    int
+		err      error
+	}
+	deviceDetailMsg struct {
+		device     *api.GetDeviceResponse
+		activation *api.DeviceActivation // nil if the device hasn't joined
+		err        error
+	}
+)
+
+// openBrowser shows the devices of the highlighted application.
+func (m model) openBrowser() (tea.Model, tea.Cmd) {
+	it := m.appList.SelectedItem().(item)
+	l := list.New(nil, list.NewDefaultDelegate(), m.width-4, m.height-8)
+	l.Title = "Devices of " + it.title
+	l.SetShowHelp(false) // see helpView
+	m.browser = &deviceBrowser{appID: it.id, appName: it.title, list: l, loading: true, profiles: make(map[string]string)}
+	m.state = stateBrowse
+	return m, m.fetchDevicePage("", 0)
+}
+
+// fetchDevicePage lists the devices matching query from offset.
+func (m model) fetchDevicePage(query string, offset int) tea.Cmd {
+	appID := m.browser.appID
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		resp, err := m.deviceClient.List(ctx, &api.ListDevicesRequest{
+			ApplicationId: appID,
+			Limit:         importer.ListPageSize,
+			Offset:        uint32(offset),
+			Search:        query,
+		})
+		if err != nil {
+			return browsePageMsg{query: query, offset: offset, err: err}
+		}
+		items := make([]item, len(resp.Result))
+		profiles := make(map[string]string, len(resp.Result))
+		for i, d := range resp.Result {
+			items[i] = item{title: d.Name, desc: d.DevEui + " • " + seenAgo(d.LastSeenAt, time.Now()), id: d.DevEui}
+			profiles[d.DevEui] = d.DeviceProfileName
+		}
+		return browsePageMsg{query: query, offset: offset, items: items, profiles: profiles, total: int(resp.TotalCount)}
+	}
+}
+
+// seenAgo describes when a device was last seen, e.g. "seen 3h ago".
+func seenAgo(t *timestamppb.Timestamp, now time.Time) string {
+	if t == nil {
+		return "never seen"
+	}
+	d := now.Sub(t.AsTime())
+	switch {
+	case d < time.Minute:
+		return "seen just now"
+	case d < time.Hour:
+		return fmt.Sprintf("seen %dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("seen %dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("seen %dd ago", int(d.Hours()/24))
+}
+
+// updateBrowsePage adds a page of devices to the browser, or replaces them
+// with the first page of a new query. Pages of a query that has since
+// changed are dropped.
+func (m model) updateBrowsePage(msg browsePageMsg) (tea.Model, tea.Cmd) {
+	b := m.browser
+	if b == nil || msg.query != b.search.query {
+		return m, nil
+	}
+	b.loading = false
+	if msg.err != nil {
+		return m, b.list.NewStatusMessage("Listing devices failed: " + importer.DescribeError(msg.err))
+	}
+	if msg.query == "" {
+		b.search.total = msg.total
+	}
+	b.count = msg.total
+	maps.Copy(b.profiles, msg.profiles)
+
+	var items []list.Item
+	if msg.offset > 0 {
+		items = b.list.Items()
+	}
+	for _, it := range msg.items {
+		items = append(items, it)
+	}
+	b.list.Title = fmt.Sprintf("Devices of %s (%d of %d)", b.appName, len(items), b.count)
+	if b.search.partial() {
+		b.list.Title += ", / searches the server"
+	}
+	return m, tea.Batch(b.list.SetItems(items), m.fetchMore())
+}
+
+// fetchMore fetches the next page once the cursor is near the end of the
+// devices loaded.
+func (m model) fetchMore() tea.Cmd {
+	b := m.browser
+	loaded := len(b.list.Items())
+	if b.loading || loaded >= b.count || b.list.Index() < len(b.list.VisibleItems())-browseAhead {
+		return nil
+	}
+	b.loading = true
+	return m.fetchDevicePage(b.search.query, loaded)
+}
+
+// openDevice fetches the details of the highlighted device.
+func (m model) openDevice() (tea.Model, tea.Cmd) {
+	it, ok := m.browser.list.SelectedItem().(item)
+	if !ok {
+		return m, nil
+	}
+	m.browser.detail = nil
+	m.state = stateDeviceDetail
+	return m, func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		resp, err := m.deviceClient.Get(ctx, &api.GetDeviceRequest{DevEui: it.id})
+		if err != nil {
+			return deviceDetailMsg{err: err}
+		}
+		act, err := m.deviceClient.GetActivation(ctx, &api.GetDeviceActivationRequest{DevEui: it.id})
+		if err != nil && status.Code(err) != codes.NotFound {
+			return deviceDetailMsg{err: err}
+		}
+		return deviceDetailMsg{device: resp, activation: act.GetDeviceActivation()}
+	}
+}
+
+func (m model) browseView() string {
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("ChirpStack Device Manager"),
+		m.browser.list.View(),
+		m.helpView(),
+	)
+}
+
+func (m model) deviceDetailView() string {
+	var body string
+	switch d := m.browser.detail; {
+	case d == nil:
+		body = "Loading device…"
+	case d.err != nil:
+		body = m.theme.status.Render("Loading the device failed: " + importer.DescribeError(d.err))
+	default:
+		body = m.deviceFields(d)
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("Device"),
+		body,
+		m.helpView(),
+	)
+}
+
+// deviceFields renders the details of a device, leaving out its keys and
+// variables, which may hold secrets.
+func (m model) deviceFields(d *deviceDetailMsg) string {
+	dev := d.device.Device
+	fields := [][2]string{
+		{"Name", dev.Name},
+		{"DevEUI", dev.DevEui},
+		{"Description", dev.Description},
+		{"Device profile", strings.TrimSpace(m.browser.profiles[dev.DevEui] + " (" + dev.DeviceProfileId + ")")},
+		{"Join EUI", dev.JoinEui},
+	}
+
+	var tags []string
+	for _, k := range slices.Sorted(maps.Keys(dev.Tags)) {
+		tags = append(tags, k+"="+dev.Tags[k])
+	}
+	fields = append(fields, [2]string{"Tags", strings.Join(tags, ", ")})
+
+	state := "enabled"
+	if dev.IsDisabled {
+		state = "disabled"
+	}
+	fields = append(fields,
+		[2]string{"State", state},
+		[2]string{"Class", d.device.ClassEnabled.String()},
+		[2]string{"Last seen", strings.TrimSpace(formatTimestamp(d.device.LastSeenAt) + " (" + seenAgo(d.device.LastSeenAt, time.Now()) + ")")})
+
+	activation := "not activated"
+	if a := d.activation; a != nil && a.DevAddr != "" {
+		activation = fmt.Sprintf("activated, DevAddr %s, FCnt up %d", a.DevAddr, a.FCntUp)
+	}
+	fields = append(fields, [2]string{"Activation", activation})
+
+	if s := d.device.DeviceStatus; s != nil {
+		battery := "not available"
+		switch {
+		case s.ExternalPowerSource:
+			battery = "external power"
+		case s.BatteryLevel >= 0:
+			battery = fmt.Sprintf("%.0f%%", s.BatteryLevel)
+		}
+		fields = append(fields,
+			[2]string{"Battery", battery},
+			[2]string{"Margin", fmt.Sprintf("%d dB", s.Margin)})
+	}
+
+	var b strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%-16s%s\n", f[0]+":", f[1])
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// defaultChunkSize is how many rows make a chunk unless --chunk-size says
+// otherwise.
+const defaultChunkSize = 100
+
+// chunkSummary describes how long the chunks took, e.g. "12 chunks of 100
+// rows, 3.1s to 7.8s each, median 4.2s, first 3.2s, last 7.8s", so that a
+// server slowing down under the load stands out. It is empty for an import
+// of a single chunk.
+func chunkSummary(chunks []importer.ChunkTiming, size int) string {
+	if len(chunks) < 2 {
+		return ""
+	}
+	times := make([]time.Duration, len(chunks))
+	for i, c := range chunks {
+		times[i] = c.Elapsed
+	}
+	slices.Sort(times)
+	round := func(d time.Duration) time.Duration { return d.Round(100 * time.Millisecond) }
+	return fmt.Sprintf("%d chunks of %d rows, %s to %s each, median %s, first %s, last %s",
+		len(chunks), size, round(times[0]), round(times[len(times)-1]), round(times[len(times)/2]),
+		round(chunks[0].Elapsed), round(chunks[len(chunks)-1].Elapsed))
+}
+
+// chunkView renders the chunk the import is on for the processing screen,
+// e.g. " · chunk 4/12 (last 3.9s)", or nothing before the first has finished.
+func (m model) chunkView() string {
+	n := len(m.chunks)
+	if n == 0 || m.cfg.chunkSize == 0 {
+		return ""
+	}
+	total := (m.total + m.cfg.chunkSize - 1) / m.cfg.chunkSize
+	return fmt.Sprintf(" · chunk %d/%d (last %s)", min(n+1, total), total, m.chunks[n-1].Elapsed.Round(100*time.Millisecond))
+}
+
+// chunksView renders the chunk timing of the last import for the summary.
+func (m model) chunksView() string {
+	if s := chunkSummary(m.chunks, m.cfg.chunkSize); s != "" {
+		return "\n" + m.theme.help.Render("Chunks: "+s)
+	}
+	return ""
+}
+
+// chunkSeconds returns the elapsed time of each chunk in seconds, for the
+// record of a run.
+func chunkSeconds(chunks []importer.ChunkTiming) []float64 {
+	secs := make([]float64, len(chunks))
+	for i, c := range chunks {
+		secs[i] = c.Elapsed.Round(time.Millisecond).Seconds()
+	}
+	return secs
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// How a listed device compares with the devices of the application, in the
+// order the comparison screen lists them
+const (
+	compareExists  = "exists"
+	compareMissing = "missing"
+	compareDiffers = "differs"
+)
+
+var compareStatuses = []string{compareExists, compareMissing, compareDiffers}
+
+// compareEntry is one listed device in a comparison report.
+type compareEntry struct {
+	DevEUI        string   `json:"dev_eui"`
+	Status        string   `json:"status"`
+	Name          string   `json:"name,omitempty"`
+	ServerName    string   `json:"server_name,omitempty"`
+	ServerProfile string   `json:"server_profile,omitempty"`
+	Differences   []string `json:"differences,omitempty"` // e.g. `name: "a" → "b"`
+}
+
+// comparison is how the rows of device lists compare with the devices of an
+// application. Making it only lists devices, so it is safe with a read-only
+// API key.
+type comparison struct {
+	ApplicationID string         `json:"application_id"`
+	Devices       []compareEntry `json:"devices"`
+}
+
+// compareRow compares row with d, the device of the same DevEUI. The name is
+// compared unless the row has none or it came from the name template, and
+// the profile when the row names one or profile, the default, is set.
+func compareRow(d *api.DeviceListItem, row importer.Row, profile string) compareEntry {
+	e := compareEntry{
+		DevEUI:        row.DevEUI,
+		Status:        compareExists,
+		Name:          row.Name,
+		ServerName:    d.Name,
+		ServerProfile: d.DeviceProfileName,
+	}
+	if row.Name != "" && !row.NameGenerated && row.Name != d.Name {
+		e.Differences = append(e.Differences, fmt.Sprintf("name: %q → %q", d.Name, row.Name))
+	}
+
+	if row.Profile != "" {
+		profile = row.Profile
+	}
+	server := d.DeviceProfileName
+	if importer.LooksLikeUUID(profile) {
+		server = d.DeviceProfileId
+	}
+	if profile != "" && profile != server {
+		e.Differences = append(e.Differences, fmt.Sprintf("device_profile: %q → %q", server, profile))
+	}
+
+	if len(e.Differences) > 0 {
+		e.Status = compareDiffers
+	}
+	return e
+}
+
+// compareDevices compares the rows of inputs with the devices of an
+// application. profile is the device profile, by name or ID, that rows
+// without their own are expected to have; empty to not compare them.
+func compareDevices(ctx context.Context, client api.DeviceServiceClient, applicationID, profile string, inputs []*importer.Input, cfg config) (*comparison, error) {
+	devices, err := importer.ListDevices(ctx, client, applicationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing devices: %w", err)
+	}
+	existing := make(map[string]*api.DeviceListItem, len(devices))
+	for _, d := range devices {
+		existing[strings.ToLower(d.DevEui)] = d
+	}
+
+	c := &comparison{ApplicationID: applicationID}
+	b := importer.NewBatch(cfg.ListOptions, inputs)
+	for _, in := range inputs {
+		err := b.Scan(ctx, in, func(row importer.Row) error {
+			if d, ok := existing[row.DevEUI]; ok {
+				c.Devices = append(c.Devices, compareRow(d, row, profile))
+			} else {
+				c.Devices = append(c.Devices, compareEntry{DevEUI: row.DevEUI, Status: compareMissing, Name: row.Name})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", in.Source, err)
+		}
+	}
+	return c, nil
+}
+
+// with returns the entries of c with the given status.
+func (c *comparison) with(status string) []compareEntry {
+	var entries []compareEntry
+	for _, e := range c.Devices {
+		if e.Status == status {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// lines lists the entries of c with the given status, one per line.
+func (c *comparison) lines(status string) []string {
+	var lines []string
+	for _, e := range c.with(status) {
+		line := e.DevEUI + " " + e.Name
+		if len(e.Differences) > 0 {
+			line = e.DevEUI + " " + strings.Join(e.Differences, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// writeComparisonCSV writes c as CSV, one row per listed device.
+func writeComparisonCSV(w io.Writer, c *comparison) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"dev_eui", "status", "name", "server_name", "server_profile", "differences"})
+	for _, e := range c.Devices {
+		cw.Write([]string{e.DevEUI, e.Status, e.Name, e.ServerName, e.ServerProfile, strings.Join(e.Differences, "; ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// saveComparison writes c to path, as JSON if the name ends in .json and as
+// CSV otherwise, refusing to overwrite an existing file.
+func saveComparison(path string, c *comparison) error {
+	return createFile(path, func(w io.Writer) error {
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(c)
+		}
+		return writeComparisonCSV(w, c)
+	})
+}
+
+// comparedMsg carries the comparison of the previewed inputs.
+type comparedMsg *comparison
+
+// loadComparison compares the previewed inputs with the devices of the
+// selected application.
+func (m model) loadComparison() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		c, err := compareDevices(ctx, m.deviceClient, m.selectedApp, m.selectedProfile, m.inputs, m.cfg)
+		if err != nil {
+			return loadFailedMsg{err}
+		}
+		return comparedMsg(c)
+	}
+}
+
+// updateCompare handles keys on the comparison screen, which shares the
+// category keys of the sync plan.
+func (m model) updateCompare(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyPlanMove.matches(m, msg):
+		n := len(compareStatuses)
+		if msg.String() == "up" || msg.String() == "k" {
+			m.planCursor = (m.planCursor + n - 1) % n
+		} else {
+			m.planCursor = (m.planCursor + 1) % n
+		}
+	case keyPlanOpen.matches(m, msg):
+		m.planDetail = viewport.New(m.width-4, max(m.height-10, 5))
+		m.planDetail.SetContent(strings.Join(m.comparison.lines(compareStatuses[m.planCursor]), "\n"))
+		m.planOpen = true
+	case keyPlanClose.matches(m, msg):
+		m.planOpen = false
+	case keyReportCSV.matches(m, msg), keyReportJSON.matches(m, msg):
+		ext := ".csv"
+		if keyReportJSON.matches(m, msg) {
+			ext = ".json"
+		}
+		path := filepath.Join(m.filepicker.dir, appFileName(m.appName, "comparison", ext, time.Now()))
+		if err := saveComparison(path, m.comparison); err != nil {
+			m.status = fmt.Sprintf("Writing report failed: %v", err)
+		} else {
+			m.status = "Report written to " + path
+		}
+	case keyPlanBack.matches(m, msg):
+		m.comparison = nil
+		m.status = ""
+		m.state = statePreview
+	case m.planOpen:
+		var cmd tea.Cmd
+		m.planDetail, cmd = m.planDetail.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m model) compareView() string {
+	c := m.comparison
+	names := map[string]string{
+		compareExists:  "exist and match",
+		compareMissing: "missing from " + m.appName,
+		compareDiffers: "exist with a different name or profile",
+	}
+
+	if m.planOpen {
+		status := compareStatuses[m.planCursor]
+		return fmt.Sprintf(
+			"%s\n\n%d devices %s\n\n%s\n\n%s",
+			m.header("Comparison"),
+			len(c.with(status)),
+			names[status],
+			m.planDetail.View(),
+			m.helpView(),
+		)
+	}
+
+	var b strings.Builder
+	for i, status := range compareStatuses {
+		cursor := "  "
+		if i == m.planCursor {
+			cursor = "> "
+		}
+		fmt.Fprintf(&b, "%s%6d %s\n", cursor, len(c.with(status)), names[status])
+	}
+
+	var status string
+	if m.status != "" {
+		status = "\n" + m.theme.status.Render(m.status) + "\n"
+	}
+	return fmt.Sprintf(
+		"%s\n\nThe list compared with the devices of %s, nothing was changed:\n\n%s%s\n%s",
+		m.header("Comparison"),
+		m.appName,
+		b.String(),
+		status,
+		m.helpView(),
+	)
+}
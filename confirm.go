@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// Choices on the confirmation screen
+const (
+	confirmBack = iota
+	confirmStart
+	confirmTruncate // import only as many devices as the tenant has room for
+)
+
+// destructive reports whether the confirmation has to be typed out rather
+// than chosen, because devices are about to be deleted or have their keys
+// replaced.
+func (m model) destructive() bool {
+	return (m.deleteCount() > 0 || m.rekeyCount() > 0) && !m.cfg.dryRun
+}
+
+// rekeyCount returns how many rows have keys that replace those of their
+// device if it exists already, with --overwrite-keys, or how many devices
+// have their keys rotated.
+func (m model) rekeyCount() int {
+	if m.cfg.Mode == importer.ModeRotate {
+		return m.previewTotal()
+	}
+	if !m.cfg.overwriteKeys || !m.cfg.Mode.Creates() || m.cfg.Gateways {
+		return 0
+	}
+	n := 0
+	for _, in := range m.inputs {
+		n += in.Count - in.Keyless
+	}
+	return n
+}
+
+// destruction describes what the run destroys, for the typed confirmation.
+func (m model) destruction() string {
+	var parts []string
+	if n := m.deleteCount(); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d devices will be deleted", n))
+	}
+	if n := m.rekeyCount(); n > 0 && m.cfg.Mode == importer.ModeRotate {
+		parts = append(parts, fmt.Sprintf("the root keys of %d devices will be replaced by new ones, so that they can't join again until they are re-provisioned", n))
+	} else if n > 0 {
+		parts = append(parts, fmt.Sprintf("the keys of any existing devices among %d rows with keys will be replaced, cutting off those that joined with the old ones", n))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// deleteCount returns how many devices the run will delete.
+func (m model) deleteCount() int {
+	switch {
+	case m.cfg.Mode == importer.ModeDelete:
+		return m.previewTotal()
+	case m.cfg.Mode == importer.ModeSync && m.cfg.syncDelete && m.plan != nil:
+		return len(m.plan.remove)
+	}
+	return 0
+}
+
+// confirm shows the confirmation screen for the previewed inputs.
+func (m model) confirm() (tea.Model, tea.Cmd) {
+	m.state = stateConfirm
+	m.confirmChoice = confirmBack
+	m.lockHeld = nil
+	m.typed, m.consent = nil, nil
+	m.denied = nil
+	if m.destructive() {
+		m.typed = newTypedConfirm(m.destruction(), fmt.Sprintf("%s (%s)", m.appName, m.selectedApp), m.serverAddr, confirmPhrase(m.appName))
+		return m, tea.Batch(textinput.Blink, m.checkAccess())
+	}
+	return m, m.checkAccess()
+}
+
+// beforeConfirm returns the screen the confirmation goes back to.
+func (m model) beforeConfirm() state {
+	if m.plan != nil {
+		return stateSyncPlan
+	}
+	return statePreview
+}
+
+// updateConfirm handles keys on the confirmation screen. Nothing is written
+// to the server until "Start import" is chosen; the cursor starts on "Back"
+// so that a stray enter doesn't start an import. Deleting devices or
+// replacing keys takes typing the phrase of m.typed instead.
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.typed != nil {
+		return m.updateTypedConfirm(msg)
+	}
+
+	switch {
+	case keyQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyChoose.matches(m, msg):
+		choices := 2
+		if m.truncatable() {
+			choices = 3
+		}
+		if msg.String() == "left" || msg.String() == "h" || msg.String() == "shift+tab" {
+			m.confirmChoice = (m.confirmChoice + choices - 1) % choices
+		} else {
+			m.confirmChoice = (m.confirmChoice + 1) % choices
+		}
+	case keyEditTags.matches(m, msg):
+		return m.editTags()
+	case keyBreakLock.matches(m, msg):
+		return m.breakStaleLock()
+	case keyFailureLimit.matches(m, msg):
+		m.cfg.maxFailures = m.cfg.maxFailures.Next()
+	case keyStart.matches(m, msg):
+		m.createLimit = 0
+		return m.startCreate()
+	case keyConfirmBack.matches(m, msg):
+		m.state = m.beforeConfirm()
+	case keyConfirm.matches(m, msg):
+		switch m.confirmChoice {
+		case confirmStart:
+			m.createLimit = 0
+			return m.startCreate()
+		case confirmTruncate:
+			m.createLimit = m.quota.remaining()
+			return m.startCreate()
+		}
+		m.state = m.beforeConfirm()
+	}
+	return m, nil
+}
+
+func (m model) updateTypedConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyBreakLock.matches(m, msg):
+		if m.consent = m.typed.confirm(); m.consent == nil {
+			return m, nil
+		}
+		return m.breakStaleLock()
+	case keyTypedBack.matches(m, msg):
+		m.typed = nil
+		m.state = m.beforeConfirm()
+		return m, nil
+	case keyTypedStart.matches(m, msg):
+		if m.consent = m.typed.confirm(); m.consent == nil {
+			return m, nil
+		}
+		return m.startCreate()
+	}
+	return m, m.typed.update(msg)
+}
+
+// confirmView lays out everything the import is about to do.
+func (m model) confirmView() string {
+	var sources []string
+	var keyless, withKey, invalid int
+	for _, in := range m.inputs {
+		sources = append(sources, in.Source)
+		keyless += in.Keyless
+		withKey += in.Count - in.Keyless
+		invalid += len(in.Invalid)
+	}
+	total := m.previewTotal()
+
+	keys := "none provisioned"
+	switch {
+	case m.cfg.GenerateKeys && keyless > 0:
+		keys = fmt.Sprintf("%d from the file, %d generated and saved next to the input", withKey, keyless)
+	case withKey > 0:
+		keys = fmt.Sprintf("%d from the file, %d devices without keys", withKey, keyless)
+	}
+
+	rows := fmt.Sprintf("%d %s to %s", total, m.noun(), m.cfg.Mode.Verb())
+	if p := m.plan; m.cfg.Mode == importer.ModeSync && p != nil {
+		rows = fmt.Sprintf("%d to create, %d to update, %d unchanged", len(p.create), len(p.update), p.unchanged)
+		if m.cfg.syncDelete {
+			rows += fmt.Sprintf(", %d to delete", len(p.remove))
+		}
+	}
+	if invalid > 0 {
+		rows += fmt.Sprintf(" (%d invalid rows skipped)", invalid)
+	}
+	if n := m.existingRows(); n > 0 {
+		rows += fmt.Sprintf(" (%d existing devices skipped)", n)
+	}
+
+	fields := [][2]string{
+		{"Server", m.serverAddr},
+		{"Tenant", fmt.Sprintf("%s (%s)", m.tenantName, m.selectedTenant)},
+	}
+	if !m.cfg.Gateways {
+		fields = append(fields,
+			[2]string{"Application", fmt.Sprintf("%s (%s)", m.appName, m.selectedApp)},
+			[2]string{"Device profile", fmt.Sprintf("%s (%s)", m.profileName, m.selectedProfile)})
+	}
+	switch {
+	case m.newGroup != nil && m.cfg.Mode.Creates():
+		g := m.newGroup
+		fields = append(fields, [2]string{"Multicast group", fmt.Sprintf("%s (new: %s class %s, %s MHz, DR%d; created when the import starts)",
+			g.Name, g.Region, strings.TrimPrefix(g.GroupType.String(), "CLASS_"), formatMHz(g.Frequency), g.Dr)})
+	case m.selectedGroup != "" && m.cfg.Mode.Creates():
+		fields = append(fields, [2]string{"Multicast group", fmt.Sprintf("%s (%s)", m.groupName, m.selectedGroup)})
+	}
+	fields = append(fields,
+		[2]string{"Input", m.inputDescription(sources)},
+		[2]string{"Rows", rows},
+		[2]string{"Mode", m.modeDescription()},
+		[2]string{"Concurrency", m.concurrencyDescription()},
+		[2]string{"On failures", m.cfg.maxFailures.String()})
+	if m.cfg.LoRaWAN11 {
+		keys += "; LoRaWAN 1.1 profile, nwk_key and app_key are provisioned separately"
+	}
+	if m.cfg.Mode.Creates() && !m.cfg.Gateways {
+		fields = append(fields, m.defaultsFields()...)
+	}
+	if m.cfg.Mode.NeedsProfile() && !m.cfg.Gateways {
+		fields = append(fields, [2]string{"Keys", keys})
+		if desc := m.downlinkDescription(); desc != "" {
+			fields = append(fields, [2]string{"Downlink", desc})
+		}
+	}
+
+	// Long values wrap under themselves.
+	const labelWidth = 16
+	var b strings.Builder
+	for _, f := range fields {
+		value := ansi.Wordwrap(f[1], max(m.width-labelWidth, 20), " ")
+		value = strings.ReplaceAll(value, "\n", "\n"+strings.Repeat(" ", labelWidth))
+		fmt.Fprintf(&b, "%-*s%s\n", labelWidth, f[0]+":", value)
+	}
+
+	if m.typed != nil {
+		return fmt.Sprintf(
+			"%s\n\n%s\n%s%s\n\n%s",
+			m.header("Confirm "+m.cfg.Mode.Title()),
+			b.String(),
+			m.lockView()+m.deniedView(),
+			m.typed.view(m.theme),
+			m.helpView(),
+		)
+	}
+
+	label := "Start " + m.cfg.Mode.String()
+	if m.cfg.dryRun {
+		label = "Start dry run"
+	}
+	labels := []string{"Back", label}
+	if m.overQuota() > 0 {
+		labels[confirmStart] = label + " anyway"
+		if m.truncatable() {
+			labels = append(labels, fmt.Sprintf("Import first %d", m.quota.remaining()))
+		}
+	}
+	var buttons []string
+	for i, l := range labels {
+		style := m.theme.choice
+		if i == m.confirmChoice {
+			style = m.theme.selected
+		}
+		buttons = append(buttons, style.Render(l), " ")
+	}
+
+	var warning string
+	if m.overQuota() > 0 {
+		warning = m.theme.warning.Render(m.quotaWarning()) + "\n\n"
+	}
+	if m.cfg.Mode == importer.ModeMove {
+		warning += m.theme.warning.Render("⚠ "+moveWarning) + "\n\n"
+	}
+	if m.cfg.Mode == importer.ModeRotate && !m.cfg.dryRun {
+		warning += m.theme.warning.Render("⚠ "+rotateWarning) + "\n\n"
+	}
+	warning += m.lockView()
+	warning += m.deniedView()
+	if m.editingTags {
+		prompt := "Tags for every device, key=value separated by commas:\n" + m.tagsInput.View()
+		if m.status != "" {
+			prompt += "\n\n" + m.theme.status.Render(m.status)
+		}
+		return fmt.Sprintf(
+			"%s\n\n%s\n%s\n\n%s",
+			m.header("Confirm "+m.cfg.Mode.Title()),
+			b.String(),
+			prompt,
+			m.helpView(),
+		)
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s%s\n\n%s",
+		m.header("Confirm "+m.cfg.Mode.Title()),
+		b.String(),
+		warning,
+		lipgloss.JoinHorizontal(lipgloss.Top, buttons...),
+		m.helpView(),
+	)
+}
+
+// inputDescription names the previewed inputs, or says how the devices of
+// the application were selected.
+func (m model) inputDescription(sources []string) string {
+	switch {
+	case m.selection == nil:
+		return strings.Join(sources, ", ")
+	case m.selection.prefix:
+		return fmt.Sprintf("devices of %s with %s (* marks a value prefix)", m.appName, m.selection)
+	}
+	return fmt.Sprintf("devices of %s with %s", m.appName, m.selection)
+}
+
+// modeDescription explains what the run will do with each device.
+func (m model) modeDescription() string {
+	var desc string
+	switch m.cfg.Mode {
+	case importer.ModeDelete:
+		desc = "delete (devices of other applications are reported as failures, missing ones as already absent)"
+	case importer.ModeMove:
+		desc = "move to the application of each row's target_application"
+		if m.cfg.TargetApplication != "" {
+			desc += ", or " + m.cfg.TargetApplication
+		}
+		desc += " (frame counters and history are kept; devices already there are skipped, missing ones and those of other applications are reported as failures)"
+	case importer.ModeRotate:
+		desc = "replace the root keys with newly generated ones, saved to a keys file next to the input (devices without keys are skipped, missing ones and those of other applications are reported as failures)"
+		if m.cfg.dryRun {
+			desc = "list the devices whose root keys would be replaced; no keys are generated or saved"
+		}
+	case importer.ModeUpdate:
+		desc = "update the fields the list has values for (empty cells keep the server's values, \"-\" clears them; devices that already match are unchanged)"
+	case importer.ModeToggle:
+		desc = "enable or disable as each row's is_disabled says"
+		if m.cfg.Disable != nil {
+			desc += ", " + importer.StateName(*m.cfg.Disable) + " without one"
+		}
+		desc += " (only the state changes; devices already in it are skipped, missing ones and those of other applications are reported as failures)"
+	case importer.ModeSync:
+		desc = "sync (create missing devices, update names, descriptions and tags; empty cells keep the server's values)"
+		if !m.cfg.syncDelete {
+			desc += ", devices not in the list are kept"
+		}
+	default:
+		desc = "create (existing gateways are reported as failures)"
+		if !m.cfg.Gateways {
+			desc = "create (existing devices are reported as failures, unless the row has keys and the device has none)"
+		}
+		if !m.cfg.Gateways && m.cfg.overwriteKeys {
+			desc = "create (existing devices are reported as failures, unless the row has keys: those replace the device's keys)"
+		}
+	}
+	if m.cfg.dryRun {
+		desc = "dry run, nothing is changed; " + desc
+	}
+	return desc
+}
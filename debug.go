@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// attemptKey carries which attempt at a call a context is for, see
+// link.interceptor; the first when it's missing.
+type attemptKey struct{}
+
+func attempt(ctx context.Context) int {
+	if n, ok := ctx.Value(attemptKey{}).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// debugInterceptor logs every call at debug level, each attempt of it as a
+// record of its own:
+//
+//	level=DEBUG msg=grpc rpc=/api.DeviceService/Create attempt=1 duration=12.3ms code=OK metadata=authorization request={...} response={...}
+//
+// The fields are always in this order. Metadata is listed by key only, and
+// the messages are JSON with their fields sorted and secrets masked; the
+// response is left out of failed calls.
+func debugInterceptor(logger *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		var keys []string
+		if md, ok := metadata.FromOutgoingContext(ctx); ok {
+			for k := range md {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+		}
+		attrs := []slog.Attr{
+			slog.String("rpc", method),
+			slog.Int("attempt", attempt(ctx)),
+			slog.Duration("duration", time.Since(start).Round(time.Microsecond)),
+			slog.String("code", status.Code(err).String()),
+			slog.String("metadata", strings.Join(keys, ",")),
+			slog.String("request", debugMessage(req)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+		} else {
+			attrs = append(attrs, slog.String("response", debugMessage(reply)))
+		}
+		logger.LogAttrs(ctx, slog.LevelDebug, "grpc", attrs...)
+		return err
+	}
+}
+
+// debugMessage renders m as compact JSON with sorted fields and the values
+// of fields named like secrets masked, see redact.Field.
+func debugMessage(m any) string {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return "{}"
+	}
+	b, err := protojson.Marshal(pm)
+	if err != nil {
+		return strconv.Quote(err.Error())
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return strconv.Quote(err.Error())
+	}
+	b, err = json.Marshal(redactJSON("", v))
+	if err != nil {
+		return strconv.Quote(err.Error())
+	}
+	return string(b)
+}
+
+// redactJSON masks the secrets in v, a decoded JSON value found under the
+// field name.
+func redactJSON(name string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = redactJSON(k, e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSON(name, e)
+		}
+	case string:
+		return redact.Field(name, v)
+	}
+	return v
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// defaultsFields describes the global tags and the default description on
+// the confirmation screen.
+func (m model) defaultsFields() [][2]string {
+	var fields [][2]string
+	if len(m.cfg.Tags) > 0 {
+		fields = append(fields, [2]string{"Tags", formatTags(m.cfg.Tags) + " (a row's own values win)"})
+	}
+	if m.cfg.Description != "" {
+		fields = append(fields, [2]string{"Description", fmt.Sprintf("%q for rows without one", string(m.cfg.Description))})
+	}
+	return fields
+}
+
+// taggable reports whether the global tags can be edited on the
+// confirmation screen.
+func (m model) taggable() bool {
+	return m.choosing() && m.cfg.Mode.Creates() && !m.cfg.Gateways
+}
+
+// editTags opens the input for the global tags.
+func (m model) editTags() (tea.Model, tea.Cmd) {
+	m.editingTags = true
+	m.status = ""
+	m.tagsInput.SetValue(formatTags(m.cfg.Tags))
+	m.tagsInput.CursorEnd()
+	return m, m.tagsInput.Focus()
+}
+
+// updateTagsInput handles keys while the global tags are edited.
+func (m model) updateTagsInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyTagsCancel.matches(m, msg):
+		m.editingTags = false
+		m.status = ""
+		m.tagsInput.Blur()
+		return m, nil
+	case keyTagsSave.matches(m, msg):
+		tags, err := importer.ParseTags([]string{m.tagsInput.Value()})
+		if err != nil {
+			m.status = err.Error()
+			return m, nil
+		}
+		m.cfg.Tags = tags
+		m.editingTags = false
+		m.status = ""
+		m.tagsInput.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.tagsInput, cmd = m.tagsInput.Update(msg)
+	return m, cmd
+}
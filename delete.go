@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// summaryRemoved is how many removed devices the summary lists; the log file
+// has all of them.
+const summaryRemoved = 20
+
+// deleteSummaryView renders the outcome of the last delete, listing the
+// devices that were removed.
+func (m model) deleteSummaryView() string {
+	var removed []importer.Row
+	var absent, failed, invalid int
+	var details []string
+	for _, fr := range m.results {
+		removed = append(removed, fr.Result.Removed...)
+		absent += fr.Result.Absent
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+		}
+		for i, msg := range fr.Input.Invalid {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more invalid rows", prefix, len(fr.Input.Invalid)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render("✗ "+prefix+msg))
+		}
+		if fr.FailuresFile != "" {
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%d devices failed, see %s", prefix, len(fr.Result.Failures), fr.FailuresFile)))
+		}
+	}
+
+	status := fmt.Sprintf("Deleted %d devices", len(removed))
+	if m.cfg.dryRun {
+		status = fmt.Sprintf("Dry run: %d devices would be deleted", len(removed))
+	}
+	status += fmt.Sprintf(" • %d already absent", absent)
+	if failed > 0 || invalid > 0 {
+		status += fmt.Sprintf(" • %d failed • %d invalid", failed, invalid)
+	}
+
+	var lines []string
+	for i, row := range removed {
+		if i == summaryRemoved {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(removed)-i))
+			break
+		}
+		lines = append(lines, "- "+row.DevEUI+" "+row.Name)
+	}
+
+	view := m.theme.status.Render(status)
+	if len(lines) > 0 {
+		view += "\n\n" + strings.Join(lines, "\n")
+	}
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
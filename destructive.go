@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// deletePhrase must be typed to confirm when there is no application name
+// to type instead.
+const deletePhrase = "DELETE"
+
+// maxPhrase is the longest application name that is asked for; longer ones
+// ask for deletePhrase.
+const maxPhrase = 32
+
+// confirmPhrase returns what has to be typed to confirm destroying devices
+// of application: its name, so that the wrong application stands out, or
+// deletePhrase for one without a usable name.
+func confirmPhrase(application string) string {
+	if application == "" || len(application) > maxPhrase {
+		return deletePhrase
+	}
+	return application
+}
+
+// yesDestructive returns the consent of --yes-destructive, or nil without
+// it.
+func (cfg config) yesDestructive() *importer.Consent {
+	if !cfg.destructiveOK {
+		return nil
+	}
+	return &importer.Consent{}
+}
+
+// destructiveUsage explains that what needs --yes-destructive in headless
+// mode, pointing out that --yes isn't enough.
+func destructiveUsage(cfg config, what string) int {
+	msg := what + " needs --yes-destructive (or --dry-run to see what it would do)"
+	if cfg.yes {
+		msg += "; --yes alone isn't enough"
+	}
+	return usageError(msg)
+}
+
+// typedConfirm asks for a phrase to be typed before something that can't be
+// undone, after showing exactly what that is. Enter does nothing until the
+// phrase is right; esc backs out, as bound by the screen it is on.
+type typedConfirm struct {
+	action      string // what will be destroyed, e.g. "12 devices will be deleted"
+	application string
+	server      string
+	phrase      string
+	input       textinput.Model
+	wrong       bool // enter was pressed before the phrase was typed
+}
+
+func newTypedConfirm(action, application, server, phrase string) *typedConfirm {
+	in := textinput.New()
+	in.Placeholder = phrase
+	in.CharLimit = len(phrase)
+	in.Width = len(phrase) + 1
+	in.Focus()
+	return &typedConfirm{action: action, application: application, server: server, phrase: phrase, input: in}
+}
+
+// confirm returns the consent once the phrase has been typed, or nil and
+// marks the attempt as wrong.
+func (c *typedConfirm) confirm() *importer.Consent {
+	if c.input.Value() != c.phrase {
+		c.wrong = true
+		return nil
+	}
+	c.input.Blur()
+	return &importer.Consent{}
+}
+
+// update passes a key to the input.
+func (c *typedConfirm) update(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	c.input, cmd = c.input.Update(msg)
+	c.wrong = false
+	return cmd
+}
+
+func (c *typedConfirm) view(th theme) string {
+	view := th.warning.Render("⚠ "+c.action) + "\n" +
+		fmt.Sprintf("Application: %s\nServer:      %s\n\n", c.application, c.server) +
+		fmt.Sprintf("This can't be undone. Type %s to confirm: %s", c.phrase, c.input.View())
+	if c.wrong {
+		view += "\n\n" + th.status.Render(fmt.Sprintf("Type %s exactly to go on, or esc to go back", c.phrase))
+	}
+	return view
+}
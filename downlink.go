@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// enqueuedTotals sums the downlink outcome of results.
+func enqueuedTotals(results []importer.FileResult) (enqueued int, failures []importer.RowFailure) {
+	for _, fr := range results {
+		enqueued += fr.Result.Enqueued
+		failures = append(failures, fr.Result.EnqueueFailures...)
+	}
+	return enqueued, failures
+}
+
+// downlinkSummary renders how many downlinks were enqueued and which failed
+// to be, or nothing if there were none to enqueue.
+func (m model) downlinkSummary() string {
+	enqueued, failures := enqueuedTotals(m.results)
+	if enqueued == 0 && len(failures) == 0 {
+		return ""
+	}
+
+	line := fmt.Sprintf("Enqueued %d downlinks", enqueued)
+	if len(failures) > 0 {
+		line += fmt.Sprintf(" • %d failed to enqueue, the devices were created", len(failures))
+	}
+	lines := []string{m.theme.status.Render(line)}
+	for i, f := range failures {
+		if i == 10 {
+			lines = append(lines, m.theme.help.Render(fmt.Sprintf("✗ …and %d more", len(failures)-i)))
+			break
+		}
+		lines = append(lines, m.theme.help.Render("✗ "+f.Row.DevEUI+" "+importer.DescribeError(f.Err)))
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
+
+// printEnqueueFailures prints the downlink outcome of a headless run and
+// returns how many downlinks failed to be enqueued.
+func printEnqueueFailures(results []importer.FileResult) int {
+	enqueued, failures := enqueuedTotals(results)
+	if enqueued == 0 && len(failures) == 0 {
+		return 0
+	}
+
+	fmt.Printf("Downlinks: enqueued %d, failed %d\n", enqueued, len(failures))
+	for _, f := range failures {
+		fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+	}
+	return len(failures)
+}
+
+// downlinkDescription describes the downlink of the confirmation screen, or
+// returns "" if none is enqueued.
+func (m model) downlinkDescription() string {
+	var perRow int
+	for _, in := range m.inputs {
+		perRow += in.Downlinks
+	}
+	d := m.cfg.downlink
+
+	var desc string
+	switch {
+	case d.Data != nil:
+		desc = fmt.Sprintf("%X on FPort %d to every created device", d.Data, d.FPort)
+		if perRow > 0 {
+			desc += fmt.Sprintf(", %d rows with their own", perRow)
+		}
+	case perRow > 0:
+		desc = fmt.Sprintf("%d rows with a downlink_payload, on FPort %d unless they set downlink_fport", perRow, d.FPort)
+	default:
+		return ""
+	}
+	if d.Confirmed {
+		desc += ", confirmed"
+	}
+	return desc
+}
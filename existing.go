@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// prefetch is a listing of the devices of the selected application running
+// in the background, see startPrefetch.
+type prefetch struct {
+	events chan tea.Msg
+	done   <-chan struct{} // closed once cancelled
+	cancel context.CancelFunc
+}
+
+// next waits for the next message of the prefetch, or none if it is
+// cancelled first.
+func (p *prefetch) next() tea.Msg {
+	select {
+	case msg := <-p.events:
+		return msg
+	case <-p.done:
+		return nil
+	}
+}
+
+// Messages for the progress and outcome of a prefetch
+type (
+	prefetchProgressMsg struct{ done, total int }
+	prefetchedMsg       []*api.DeviceListItem
+)
+
+// serverDevices maps the DevEUIs of devices to the devices.
+func serverDevices(devices []*api.DeviceListItem) map[string]*api.DeviceListItem {
+	byEUI := make(map[string]*api.DeviceListItem, len(devices))
+	for _, d := range devices {
+		byEUI[strings.ToLower(d.DevEui)] = d
+	}
+	return byEUI
+}
+
+// prefetching reports whether the devices of the application are yet to be
+// listed for --skip-existing.
+func (m model) prefetching() bool {
+	return m.cfg.SkipExisting && m.cfg.Mode == importer.ModeImport && !m.cfg.Gateways && m.cfg.ServerDevices == nil && !m.cfg.ValidateOnly
+}
+
+// skippable reports whether the preview can turn on --skip-existing.
+func (m model) skippable() bool {
+	return m.state == statePreview && m.cfg.Mode == importer.ModeImport && !m.cfg.Gateways && !m.cfg.SkipExisting && !m.cfg.ValidateOnly
+}
+
+// startPrefetch lists every device of the selected application, page by
+// page with the progress on the loading screen, to skip the rows of those
+// that exist already. Large applications take a while, so esc cancels it.
+func (m model) startPrefetch() (tea.Model, tea.Cmd) {
+	ctx, cancel := context.WithCancel(importer.AuthContext(context.Background(), m.apiToken))
+	p := &prefetch{events: make(chan tea.Msg), done: ctx.Done(), cancel: cancel}
+	m.prefetch = p
+
+	send := func(msg tea.Msg) {
+		select {
+		case p.events <- msg:
+		case <-ctx.Done():
+		}
+	}
+	list := func() tea.Msg {
+		go func() {
+			devices, err := importer.ListDevices(ctx, m.deviceClient, m.selectedApp, func(done, total int) {
+				send(prefetchProgressMsg{done: done, total: total})
+			})
+			if err != nil {
+				send(loadFailedMsg{fmt.Errorf("listing the devices of %s: %w", m.appName, err)})
+				return
+			}
+			send(prefetchedMsg(devices))
+		}()
+		return p.next()
+	}
+	return m.startLoading(fmt.Sprintf("Listing the devices of %s…", m.appName), list)
+}
+
+// cancelPrefetch stops the listing and goes back to the preview, which
+// then doesn't skip existing devices.
+func (m model) cancelPrefetch() (tea.Model, tea.Cmd) {
+	m.prefetch.cancel()
+	m.prefetch = nil
+	m.cfg.SkipExisting = false
+	m.state = m.loadFrom
+	return m, nil
+}
+
+// updatePrefetch handles the progress and outcome of startPrefetch. A
+// cancelled prefetch may still report, which is ignored.
+func (m model) updatePrefetch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.prefetch == nil || m.state != stateLoading {
+		return m, nil
+	}
+	switch msg := msg.(type) {
+	case prefetchProgressMsg:
+		m.loading = fmt.Sprintf("Listing the devices of %s: %d/%d…", m.appName, msg.done, msg.total)
+		return m, m.prefetch.next
+	case prefetchedMsg:
+		m.prefetch.cancel()
+		m.prefetch = nil
+		m.cfg.ServerDevices = serverDevices(msg)
+		if m.cfg.ServerNames == nil {
+			m.cfg.ServerNames = deviceNames(msg)
+		}
+		return m.readPaths(m.inputPaths())
+	}
+	return m, nil
+}
+
+// existingRows returns how many rows of the preview are of devices that exist
+// already.
+func (m model) existingRows() int {
+	n := 0
+	for _, in := range m.inputs {
+		n += len(in.Exists)
+	}
+	return n
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// writeDeviceExport writes devices as CSV in the importer's own format, so
+// the file can be imported elsewhere as it is. Every tag found on any device
+// gets a tag: column. The timestamps are informational; the importer ignores
+// them.
+func writeDeviceExport(w io.Writer, devices []*api.DeviceListItem) error {
+	var tagKeys []string
+	for _, d := range devices {
+		for k := range d.Tags {
+			if !slices.Contains(tagKeys, k) {
+				tagKeys = append(tagKeys, k)
+			}
+		}
+	}
+	slices.Sort(tagKeys)
+
+	header := []string{"dev_eui", "name", "description", "device_profile"}
+	for _, k := range tagKeys {
+		header = append(header, importer.TagPrefix+k)
+	}
+	header = append(header, "created_at", "last_seen_at")
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, d := range devices {
+		record := []string{d.DevEui, d.Name, d.Description, d.DeviceProfileName}
+		for _, k := range tagKeys {
+			record = append(record, d.Tags[k])
+		}
+		record = append(record, formatTimestamp(d.CreatedAt), formatTimestamp(d.LastSeenAt))
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatTimestamp formats t as RFC 3339 in UTC, or returns an empty string
+// for a device that was never seen.
+func formatTimestamp(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return t.AsTime().UTC().Format(time.RFC3339)
+}
+
+// saveDeviceExport writes the export to path, refusing to overwrite an
+// existing file.
+func saveDeviceExport(path string, devices []*api.DeviceListItem) error {
+	return createFile(path, func(w io.Writer) error {
+		return writeDeviceExport(w, devices)
+	})
+}
+
+// createFile creates path with what write writes, refusing to overwrite an
+// existing file. Nothing is left behind if writing fails.
+func createFile(path string, write func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// exportFileName suggests a file name for exporting the named application,
+// e.g. "water-meters-devices-20240131.csv".
+func exportFileName(appName string, now time.Time) string {
+	return appFileName(appName, "devices", ".csv", now)
+}
+
+// appFileName suggests a file name for something about the named
+// application, e.g. "water-meters-<what>-20240131<ext>".
+func appFileName(appName, what, ext string, now time.Time) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(strings.ToLower(appName), "-"), "-")
+	if name == "" {
+		name = "application"
+	}
+	return fmt.Sprintf("%s-%s-%s%s", name, what, now.Format("20060102"), ext)
+}
+
+// exportScreen asks where to export the devices of an application, then
+// shows the progress and outcome of the export. The same screen writes the
+// report of the devices missing keys, and exports the gateways of a tenant.
+type exportScreen struct {
+	id, name string // of the application, or of the tenant for gateways
+	keyless  bool   // export the devices missing keys, see findKeyless
+	gateways bool   // export the gateways of a tenant
+	input    textinput.Model
+
+	running     bool
+	checking    bool // reading the keys of the listed devices
+	done, total int
+	path        string // where the devices were written, once finished
+	count       int
+	status      string // why the last attempt failed
+}
+
+func newExportScreen(appID, appName, dir string, keyless bool) *exportScreen {
+	name := exportFileName(appName, time.Now())
+	if keyless {
+		name = keylessFileName(appName, time.Now())
+	}
+	return &exportScreen{id: appID, name: appName, keyless: keyless, input: exportInput(filepath.Join(dir, name))}
+}
+
+// newGatewayExportScreen asks where to export the gateways of a tenant.
+func newGatewayExportScreen(tenantID, tenantName, dir string) *exportScreen {
+	path := filepath.Join(dir, appFileName(tenantName, "gateways", ".csv", time.Now()))
+	return &exportScreen{id: tenantID, name: tenantName, gateways: true, input: exportInput(path)}
+}
+
+// exportInput returns the input for the file to export to, starting with
+// path.
+func exportInput(path string) textinput.Model {
+	ti := textinput.New()
+	ti.CharLimit = 4096
+	ti.Width = 60
+	ti.SetValue(path)
+	ti.CursorEnd()
+	ti.Focus()
+	return ti
+}
+
+// editing reports whether the path is still being entered.
+func (ex *exportScreen) editing() bool {
+	return !ex.running && ex.path == ""
+}
+
+// Messages for the progress and outcome of an export
+type (
+	exportProgressMsg struct {
+		done, total int
+		checking    bool
+	}
+	exportDoneMsg struct {
+		path  string
+		count int
+	}
+	exportFailedMsg struct{ err error } // not an error, or errorMsg would match its case
+)
+
+// updateExport handles keys on the export screen.
+func (m model) updateExport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	ex := m.export
+
+	switch {
+	case keyForceQuit.matches(m, msg), keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyExportBack.matches(m, msg), keyExportDone.matches(m, msg):
+		m.state = stateApplicationSelect
+		if ex.gateways {
+			m.state = stateTenantSelect
+		}
+		m.export = nil
+		return m, nil
+	case keyExportStart.matches(m, msg):
+		path := expandHome(strings.TrimSpace(ex.input.Value()))
+		if path == "" {
+			ex.status = "Enter the file to export to"
+			return m, nil
+		}
+		if _, err := os.Stat(path); err == nil {
+			ex.status = path + " already exists"
+			return m, nil
+		}
+		ex.status = ""
+		ex.running = true
+		ex.input.Blur()
+		m.events = make(chan tea.Msg)
+		if ex.gateways {
+			go m.exportGateways(ex.id, path, m.events)
+		} else {
+			go m.exportDevices(ex.id, path, ex.keyless, m.events)
+		}
+		return m, waitForEvent(m.events)
+	}
+
+	if !ex.editing() {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	ex.input, cmd = ex.input.Update(msg)
+	return m, cmd
+}
+
+// exportDevices fetches the devices of an application and writes them to
+// path, or only those missing keys if keyless is set, reporting progress
+// through events.
+func (m model) exportDevices(appID, path string, keyless bool, events chan<- tea.Msg) {
+	ctx := importer.AuthContext(context.Background(), m.apiToken)
+	devices, err := importer.ListDevices(ctx, m.deviceClient, appID, func(done, total int) {
+		events <- exportProgressMsg{done, total, false}
+	})
+	switch {
+	case err != nil:
+	case keyless:
+		devices, err = findKeyless(ctx, m.deviceClient, devices, func(done, total int) {
+			events <- exportProgressMsg{done, total, true}
+		})
+		if err == nil {
+			err = saveKeylessReport(path, devices)
+		}
+	default:
+		err = saveDeviceExport(path, devices)
+	}
+	if err != nil {
+		events <- exportFailedMsg{err}
+		return
+	}
+	events <- exportDoneMsg{path, len(devices)}
+}
+
+// exportGateways fetches the gateways of a tenant and writes them to path,
+// reporting progress through events.
+func (m model) exportGateways(tenantID, path string, events chan<- tea.Msg) {
+	ctx := importer.AuthContext(context.Background(), m.apiToken)
+	gateways, err := importer.ListGateways(ctx, api.NewGatewayServiceClient(m.client), tenantID, func(done, total int) {
+		events <- exportProgressMsg{done, total, false}
+	})
+	if err == nil {
+		err = saveGatewayExport(path, gateways)
+	}
+	if err != nil {
+		events <- exportFailedMsg{err}
+		return
+	}
+	events <- exportDoneMsg{path, len(gateways)}
+}
+
+func (m model) exportView() string {
+	ex := m.export
+
+	title, what, noun := "Export Devices", "the devices of "+ex.name, "devices"
+	switch {
+	case ex.keyless:
+		title, what = "Missing Keys Report", "the devices of "+ex.name+" that have no keys and have never joined"
+	case ex.gateways:
+		title, what, noun = "Export Gateways", "the gateways of "+ex.name+", including those that have never been seen", "gateways"
+	}
+
+	var body string
+	switch {
+	case ex.path != "" && ex.keyless:
+		body = m.theme.status.Render(fmt.Sprintf("%d devices have no keys and have never joined, written to %s", ex.count, ex.path))
+	case ex.path != "":
+		body = m.theme.status.Render(fmt.Sprintf("Exported %d %s to %s", ex.count, noun, ex.path))
+	case ex.running:
+		percent := 0.0
+		if ex.total > 0 {
+			percent = float64(ex.done) / float64(ex.total)
+		}
+		label := "Fetching " + noun
+		if ex.checking {
+			label = "Checking keys"
+		}
+		body = fmt.Sprintf("%s\n\n%s", m.progress.ViewAs(percent),
+			m.theme.status.Render(fmt.Sprintf("%s: %d/%d", label, ex.done, ex.total)))
+	default:
+		body = fmt.Sprintf("Export %s to:\n\n%s", what, ex.input.View())
+		if ex.status != "" {
+			body += "\n\n" + m.theme.status.Render(ex.status)
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header(title),
+		body,
+		m.helpView(),
+	)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// abortedBy returns why the last import was aborted, or nil if it wasn't.
+func (m model) abortedBy() *importer.Aborted {
+	for _, fr := range m.results {
+		var a *importer.Aborted
+		if errors.As(fr.Stopped, &a) {
+			return a
+		}
+	}
+	return nil
+}
+
+// abortView highlights why the last import was aborted at the top of its
+// summary.
+func (m model) abortView() string {
+	a := m.abortedBy()
+	if a == nil {
+		return ""
+	}
+	return m.theme.warning.Render(fmt.Sprintf("⚠ The %s was %s. The last one:", m.cfg.Mode, a.After())) + "\n" +
+		m.theme.status.Render("  "+importer.DescribeError(a.Last)) + "\n\n"
+}
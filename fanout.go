@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// target is a server to import into, with the token used on it.
+type target struct {
+	server string
+	token  string
+}
+
+// parseTargets pairs the --server and --token flags given, falling back on
+// server and token when there are none. A single server takes a single
+// token; several need a token each, in the same order, and every server
+// after the first is returned as a mirror.
+func parseTargets(server, token string, servers, tokens []string) (string, string, []target, error) {
+	if len(servers) > 0 {
+		server = servers[0]
+	}
+	if len(servers) <= 1 {
+		if len(tokens) > 1 {
+			return "", "", nil, fmt.Errorf("%d --token given for a single --server", len(tokens))
+		}
+		if len(tokens) == 1 {
+			token = tokens[0]
+		}
+		return server, token, nil, nil
+	}
+
+	if len(tokens) != len(servers) {
+		return "", "", nil, fmt.Errorf("%d --server given with %d --token: give a --token for each --server, in the same order", len(servers), len(tokens))
+	}
+	seen := map[string]bool{server: true}
+	var mirrors []target
+	for i, s := range servers[1:] {
+		if seen[s] {
+			return "", "", nil, fmt.Errorf("--server %s is given twice", s)
+		}
+		seen[s] = true
+		mirrors = append(mirrors, target{server: s, token: tokens[i+1]})
+	}
+	return server, tokens[0], mirrors, nil
+}
+
+// mirrorPath names the server of a run in path, a file written next to a
+// list such as its failed rows, so that the runs of an import into several
+// servers don't overwrite each other's: "list.failures.csv" becomes
+// "list.failures.staging.example.com_8080.csv". Without a server, path is
+// returned as is.
+func mirrorPath(path, server string) string {
+	if path == "" || server == "" {
+		return path
+	}
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, server)
+	path = strings.TrimRight(path, `/\`)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + label + ext
+}
+
+// mirrorNames are the names of the tenant, application and device profile
+// of an import on the first server, by which they are found on the others.
+type mirrorNames struct {
+	tenant, application, profile string
+}
+
+// lookupNames returns the names of the application and device profile of
+// cfg, and of the application's tenant.
+func lookupNames(ctx context.Context, conn *grpc.ClientConn, cfg config) (mirrorNames, error) {
+	var names mirrorNames
+	app, err := api.NewApplicationServiceClient(conn).Get(ctx, &api.GetApplicationRequest{Id: cfg.applicationID})
+	if err != nil {
+		return names, fmt.Errorf("looking up application %s: %w", cfg.applicationID, err)
+	}
+	names.application = app.Application.Name
+	tenant, err := api.NewTenantServiceClient(conn).Get(ctx, &api.GetTenantRequest{Id: app.Application.TenantId})
+	if err != nil {
+		return names, fmt.Errorf("looking up tenant %s: %w", app.Application.TenantId, err)
+	}
+	names.tenant = tenant.Tenant.Name
+	if cfg.profileID != "" {
+		profile, err := api.NewDeviceProfileServiceClient(conn).Get(ctx, &api.GetDeviceProfileRequest{Id: cfg.profileID})
+		if err != nil {
+			return names, fmt.Errorf("looking up device profile %s: %w", cfg.profileID, err)
+		}
+		names.profile = profile.DeviceProfile.Name
+	}
+	return names, nil
+}
+
+// resolveNames finds the application and device profile named by names on
+// the server of conn, in the tenant of the same name, and returns their IDs.
+func resolveNames(ctx context.Context, conn *grpc.ClientConn, names mirrorNames) (string, string, error) {
+	tenantID, err := findByName("tenant", names.tenant, func(offset uint32) ([]string, []string, error) {
+		resp, err := api.NewTenantServiceClient(conn).List(ctx, &api.ListTenantsRequest{Limit: importer.ListPageSize, Offset: offset, Search: names.tenant})
+		if err != nil {
+			return nil, nil, err
+		}
+		var ids, found []string
+		for _, t := range resp.Result {
+			ids, found = append(ids, t.Id), append(found, t.Name)
+		}
+		return ids, found, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	appID, err := findByName("application", names.application, func(offset uint32) ([]string, []string, error) {
+		resp, err := api.NewApplicationServiceClient(conn).List(ctx, &api.ListApplicationsRequest{TenantId: tenantID, Limit: importer.ListPageSize, Offset: offset, Search: names.application})
+		if err != nil {
+			return nil, nil, err
+		}
+		var ids, found []string
+		for _, a := range resp.Result {
+			ids, found = append(ids, a.Id), append(found, a.Name)
+		}
+		return ids, found, nil
+	})
+	if err != nil || names.profile == "" {
+		return appID, "", err
+	}
+
+	profileID, err := findByName("device profile", names.profile, func(offset uint32) ([]string, []string, error) {
+		resp, err := api.NewDeviceProfileServiceClient(conn).List(ctx, &api.ListDeviceProfilesRequest{TenantId: tenantID, Limit: importer.ListPageSize, Offset: offset, Search: names.profile})
+		if err != nil {
+			return nil, nil, err
+		}
+		var ids, found []string
+		for _, p := range resp.Result {
+			ids, found = append(ids, p.Id), append(found, p.Name)
+		}
+		return ids, found, nil
+	})
+	return appID, profileID, err
+}
+
+// findByName pages through list, which returns the IDs and names of a page
+// of objects, and returns the ID of the one object called name. The search
+// of the List APIs matches parts of names, so the name is compared here.
+func findByName(what, name string, list func(offset uint32) ([]string, []string, error)) (string, error) {
+	var matches []string
+	for offset := uint32(0); ; offset += importer.ListPageSize {
+		ids, names, err := list(offset)
+		if err != nil {
+			return "", fmt.Errorf("listing %ss: %w", what, err)
+		}
+		for i, n := range names {
+			if n == name {
+				matches = append(matches, ids[i])
+			}
+		}
+		if len(ids) < importer.ListPageSize {
+			break
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s named %q", what, name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%d %ss are named %q", len(matches), what, name)
+}
+
+// runMirrored imports the list of cfg into its server and then into each of
+// its mirrors, one after the other, as runHeadless would into one. The
+// application and device profile, given by ID on the first server, are
+// found by name on the others, in the tenant of the same name. A server that
+// fails doesn't stop the others; a breakdown by server follows their
+// reports, and the exit code is the worst of theirs.
+func runMirrored(ctx context.Context, cfg config) int {
+	switch {
+	case cfg.Gateways:
+		return usageError("gateways can't be imported into several servers")
+	case cfg.Mode != importer.ModeImport:
+		return usageError("several --server can only be used with --mode import")
+	case cfg.migrate.server != "" || cfg.selection != nil:
+		return usageError("several --server can only be used with --csv")
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required in headless mode")
+	case cfg.applicationID == "":
+		return usageError("--application is required in headless mode")
+	case cfg.GenerateKeys:
+		return usageError("--generate-keys can't be used with several --server, as each server would get other keys")
+	case importer.LooksLikeUUID(cfg.multicastGroup):
+		return usageError("give --multicast-group by name to import into several servers")
+	}
+
+	conn, err := dial(cfg.server, nil, nil, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	names, err := lookupNames(importer.AuthContext(ctx, cfg.token), conn, cfg)
+	conn.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %s\n", cfg.server, redact.Secrets(err.Error()))
+		return 1
+	}
+
+	targets := append([]target{{server: cfg.server, token: cfg.token}}, cfg.mirrors...)
+	outcomes := make([]string, len(targets))
+	code := 0
+	for i, t := range targets {
+		if ctx.Err() != nil {
+			outcomes[i] = "not run, the import was stopped"
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("== %s ==\n", t.server)
+
+		run := cfg
+		run.server, run.token, run.mirrors, run.mirror = t.server, t.token, nil, t.server
+		if i > 0 {
+			conn, err := dial(t.server, nil, nil, cfg.debug)
+			if err == nil {
+				run.applicationID, run.profileID, err = resolveNames(importer.AuthContext(ctx, t.token), conn, names)
+				conn.Close()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %s\n", t.server, redact.Secrets(err.Error()))
+				outcomes[i] = "failed: " + redact.Secrets(err.Error())
+				code = max(code, 1)
+				continue
+			}
+		}
+
+		c := runHeadless(ctx, run)
+		switch c {
+		case 0:
+			outcomes[i] = "succeeded"
+		case 1:
+			outcomes[i] = "failed, see its report"
+		default:
+			outcomes[i] = fmt.Sprintf("failed with exit code %d", c)
+		}
+		code = max(code, c)
+	}
+
+	fmt.Printf("\nServers (application %s", names.application)
+	if names.profile != "" {
+		fmt.Printf(", device profile %s", names.profile)
+	}
+	fmt.Println("):")
+	for i, t := range targets {
+		fmt.Printf("  %s: %s\n", t.server, outcomes[i])
+	}
+	return code
+}
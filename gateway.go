@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// writeGatewayExport writes gateways as CSV with the columns of a gateway
+// list, so the file can be imported elsewhere as it is, followed by when
+// each gateway was last seen and its state. Gateways that have never
+// reported are included, with an empty last_seen_at and the state
+// "never_seen".
+func writeGatewayExport(w io.Writer, gateways []*api.GatewayListItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"gateway_id", "name", "description", "latitude", "longitude", "altitude", "last_seen_at", "state"})
+	for _, gw := range gateways {
+		lat, lon, alt := importer.FormatLocation(gw.Location)
+		cw.Write([]string{gw.GatewayId, gw.Name, gw.Description, lat, lon, alt,
+			formatTimestamp(gw.LastSeenAt), strings.ToLower(gw.State.String())})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// saveGatewayExport writes the export to path, refusing to overwrite an
+// existing file.
+func saveGatewayExport(path string, gateways []*api.GatewayListItem) error {
+	return createFile(path, func(w io.Writer) error {
+		return writeGatewayExport(w, gateways)
+	})
+}
+
+// newGatewayPreviewTable builds a table of the first rows of gateway lists,
+// like newPreviewTable does for devices.
+func newGatewayPreviewTable(inputs []*importer.Input, width, height int) table.Model {
+	multi := len(inputs) > 1
+
+	columns := []table.Column{
+		{Title: "Line", Width: 6},
+		{Title: "Gateway ID", Width: 16},
+		{Title: "Name", Width: 20},
+		{Title: "Description", Width: 24},
+		{Title: "Location", Width: 28},
+	}
+	if multi {
+		columns = append([]table.Column{{Title: "File", Width: 16}}, columns...)
+	}
+
+	var rows []table.Row
+collect:
+	for _, in := range inputs {
+		for _, r := range in.Gateways {
+			if len(rows) == previewRows {
+				break collect
+			}
+
+			location := "none"
+			if loc := r.Location; loc != nil {
+				location = fmt.Sprintf("%.5f, %.5f, %gm", loc.Latitude, loc.Longitude, loc.Altitude)
+			}
+			row := table.Row{fmt.Sprint(r.Pos.Line), r.GatewayID, r.Name, r.Description, location}
+			if multi {
+				row = append(table.Row{filepath.Base(in.Source)}, row...)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithHeight(max(height-12, 5)),
+		table.WithWidth(width-4),
+	)
+}
+
+// noun returns what is being imported, for messages such as "3 gateways
+// failed".
+func (m model) noun() string {
+	if m.cfg.Gateways {
+		return "gateways"
+	}
+	return "devices"
+}
+
+// tenantTitle returns the title of the tenant list, which says what will be
+// imported into the tenant.
+func (m model) tenantTitle() string {
+	if m.cfg.Gateways {
+		return "Select Tenant for Gateways" + m.tenantSearch.titleHint()
+	}
+	return "Select Tenant" + m.tenantSearch.titleHint()
+}
+
+func (m model) gatewaysHelp() (string, string) {
+	if m.cfg.Gateways {
+		return "tab", "switch to devices"
+	}
+	return "tab", "switch to gateways"
+}
+
+// createGateways imports gateway lists into the selected tenant, sending
+// progress and the final result to events like createDevices.
+func (m model) createGateways(ctx context.Context, inputs []*importer.Input, events chan<- tea.Msg) {
+	total := 0
+	for _, in := range inputs {
+		total += in.Count
+	}
+	events <- importProgressMsg{total: total}
+
+	done := 0
+	gi := &importer.GatewayImporter{
+		Gateways: api.NewGatewayServiceClient(m.client),
+		Token:    m.apiToken,
+		TenantID: m.selectedTenant,
+		DryRun:   m.cfg.dryRun,
+		Audit:    m.cfg.audit,
+		Pause:    m.pause,
+
+		MaxFailures: m.cfg.maxFailures,
+		OnRow: func(source string, row importer.GatewayRow, err error) {
+			done++
+			if err == nil && !m.cfg.dryRun {
+				slog.Info("Created the gateway", "gateway_id", row.GatewayID, "name", row.Name, "source", source)
+			}
+			events <- importProgressMsg{done: done, total: total, current: source,
+				row: &rowLog{source: source, pos: row.Pos, devEUI: row.GatewayID, name: row.Name, err: err}}
+		},
+	}
+	results, err := gi.ImportFiles(ctx, inputs, m.cfg.ListOptions, func(source string) string {
+		if path := failuresPath(source, m.cfg.failuresFile); path != "" {
+			return path
+		}
+		if importer.IsURL(source) {
+			return "download.failures.csv"
+		}
+		return "stdin.failures.csv"
+	})
+	if err != nil {
+		events <- errorMsg(err)
+		return
+	}
+	events <- devicesCreatedMsg{results: results}
+}
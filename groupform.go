@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// newGroupItem is the last entry of the multicast group list, opening the
+// form to create a group for the import.
+var newGroupItem = item{
+	title:  "➕ Create new multicast group…",
+	desc:   "Create a group in this application when the import starts and add the imported devices to it",
+	create: true,
+}
+
+// Fields of the multicast group form
+const (
+	groupFieldName = iota
+	groupFieldRegion
+	groupFieldAddress
+	groupFieldNwkSKey
+	groupFieldAppSKey
+	groupFieldFrequency
+	groupFieldDR
+)
+
+// groupForm asks for the settings of a new multicast group. Focus past the
+// text inputs is on the class B/C toggle. The group isn't created by the
+// form: it is checked here and created when the import starts, see
+// createGroup.
+type groupForm struct {
+	inputs []textinput.Model // see the groupField* constants
+	classB bool              // a class B group rather than class C
+	focus  int
+	status string // why the settings were rejected
+}
+
+func newGroupForm(region string) *groupForm {
+	input := func(placeholder string, limit int) textinput.Model {
+		in := textinput.New()
+		in.Placeholder = placeholder
+		in.CharLimit = limit
+		in.Width = 50
+		return in
+	}
+	f := &groupForm{inputs: []textinput.Model{
+		groupFieldName:      input("Group name", 100),
+		groupFieldRegion:    input("Region, e.g. EU868", 10),
+		groupFieldAddress:   input("Multicast address, 8 hex characters", 8),
+		groupFieldNwkSKey:   input("Network session key, 32 hex characters", 32),
+		groupFieldAppSKey:   input("Application session key, 32 hex characters", 32),
+		groupFieldFrequency: input("Hz or MHz, e.g. 869.525", 12),
+		groupFieldDR:        input("Data rate, e.g. 0", 2),
+	}}
+	f.inputs[groupFieldRegion].SetValue(region)
+	f.inputs[groupFieldName].Focus()
+	return f
+}
+
+// togglingClass reports whether the class toggle of the multicast group form
+// has the focus.
+func (m model) togglingClass() bool {
+	return m.state == stateCreateMulticast && m.groupForm.focus == len(m.groupForm.inputs)
+}
+
+// regionBands are the frequencies, in Hz, a multicast group of each region
+// can use: the band of the region, or the widest of its variants.
+var regionBands = map[common.Region][2]uint32{
+	common.Region_EU868:   {863000000, 870000000},
+	common.Region_US915:   {902000000, 928000000},
+	common.Region_CN779:   {779000000, 787000000},
+	common.Region_EU433:   {433050000, 434790000},
+	common.Region_AU915:   {915000000, 928000000},
+	common.Region_CN470:   {470000000, 510000000},
+	common.Region_AS923:   {915000000, 928000000},
+	common.Region_AS923_2: {915000000, 928000000},
+	common.Region_AS923_3: {915000000, 928000000},
+	common.Region_AS923_4: {915000000, 928000000},
+	common.Region_KR920:   {920900000, 923300000},
+	common.Region_IN865:   {865000000, 867000000},
+	common.Region_RU864:   {864000000, 870000000},
+	common.Region_ISM2400: {2400000000, 2500000000},
+}
+
+// parseFrequency reads a frequency in Hz, or in MHz for values small enough
+// to be meant that way, e.g. "869.525".
+func parseFrequency(s string) (uint32, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%q is not a frequency", s)
+	}
+	if f < 1e5 {
+		f *= 1e6
+	}
+	if f > math.MaxUint32 {
+		return 0, fmt.Errorf("%q is not a frequency", s)
+	}
+	return uint32(math.Round(f)), nil
+}
+
+// group checks the settings of the form and returns the multicast group to
+// create in applicationID, or what is wrong with them.
+func (f *groupForm) group(applicationID string) (*api.MulticastGroup, string) {
+	value := func(field int) string { return strings.TrimSpace(f.inputs[field].Value()) }
+
+	g := &api.MulticastGroup{
+		Name:          value(groupFieldName),
+		ApplicationId: applicationID,
+		McAddr:        strings.ToLower(value(groupFieldAddress)),
+		McNwkSKey:     strings.ToLower(value(groupFieldNwkSKey)),
+		McAppSKey:     strings.ToLower(value(groupFieldAppSKey)),
+		GroupType:     api.MulticastGroupType_CLASS_C,
+	}
+	if f.classB {
+		g.GroupType = api.MulticastGroupType_CLASS_B
+	}
+	if g.Name == "" {
+		return nil, "Enter a name for the group"
+	}
+	region, ok := common.Region_value[strings.ToUpper(value(groupFieldRegion))]
+	if !ok {
+		return nil, fmt.Sprintf("%q is not a region, e.g. EU868 or US915", value(groupFieldRegion))
+	}
+	g.Region = common.Region(region)
+	for _, h := range []struct {
+		field int
+		name  string
+		value string
+		n     int
+	}{
+		{groupFieldAddress, "Multicast address", g.McAddr, 8},
+		{groupFieldNwkSKey, "Network session key", g.McNwkSKey, 32},
+		{groupFieldAppSKey, "Application session key", g.McAppSKey, 32},
+	} {
+		if p := lorakey.HexProblem(h.value, h.n); p != "" {
+			return nil, h.name + " " + p
+		}
+	}
+
+	freq, err := parseFrequency(value(groupFieldFrequency))
+	if err != nil {
+		return nil, err.Error()
+	}
+	if band, ok := regionBands[g.Region]; ok && (freq < band[0] || freq > band[1]) {
+		return nil, fmt.Sprintf("%s MHz is outside %s, which is %s to %s MHz",
+			formatMHz(freq), g.Region, formatMHz(band[0]), formatMHz(band[1]))
+	}
+	g.Frequency = freq
+
+	dr, err := strconv.ParseUint(value(groupFieldDR), 10, 32)
+	if err != nil || dr > 15 {
+		return nil, fmt.Sprintf("%q is not a data rate, from 0 to 15", value(groupFieldDR))
+	}
+	g.Dr = uint32(dr)
+	return g, ""
+}
+
+// formatMHz formats a frequency in Hz as MHz, e.g. "869.525".
+func formatMHz(hz uint32) string {
+	return strconv.FormatFloat(float64(hz)/1e6, 'f', -1, 64)
+}
+
+// updateGroupForm handles keys on the multicast group form. A valid group
+// is kept for the import, which creates it, and the file picker follows.
+func (m model) updateGroupForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := m.groupForm
+
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyFormBack.matches(m, msg):
+		m.groupForm = nil
+		m.state = stateMulticastSelect
+		return m, nil
+	case keyNextField.matches(m, msg):
+		if f.focus < len(f.inputs) {
+			f.inputs[f.focus].Blur()
+		}
+		if msg.String() == "shift+tab" || msg.String() == "up" {
+			f.focus = (f.focus + len(f.inputs)) % (len(f.inputs) + 1)
+		} else {
+			f.focus = (f.focus + 1) % (len(f.inputs) + 1)
+		}
+		if f.focus < len(f.inputs) {
+			return m, f.inputs[f.focus].Focus()
+		}
+		return m, nil
+	case keyToggleClass.matches(m, msg):
+		f.classB = !f.classB
+		return m, nil
+	case keyUseGroup.matches(m, msg):
+		g, problem := f.group(m.selectedApp)
+		if g == nil {
+			f.status = problem
+			return m, nil
+		}
+		m.groupForm = nil
+		m.newGroup = g
+		m.selectedGroup, m.groupName = "", g.Name
+		return m.chooseFiles()
+	}
+
+	if f.focus == len(f.inputs) {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return m, cmd
+}
+
+func (m model) groupFormView() string {
+	f := m.groupForm
+
+	class := "( ) class B  (•) class C"
+	if f.classB {
+		class = "(•) class B  ( ) class C"
+	}
+	if m.togglingClass() {
+		class = "> " + class
+	} else {
+		class = "  " + class
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "New multicast group in application %s, created when the import starts\n\n", m.appName)
+	for i, label := range []string{"Name", "Region", "Address", "NwkSKey", "AppSKey", "Frequency", "Data rate"} {
+		fmt.Fprintf(&b, "%-12s %s\n", label+":", f.inputs[i].View())
+	}
+	fmt.Fprintf(&b, "%-12s %s\n", "Group type:", class)
+
+	if f.status != "" {
+		b.WriteString("\n" + m.theme.status.Render(f.status) + "\n")
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s",
+		m.header("Create Multicast Group"),
+		b.String(),
+		m.helpView(),
+	)
+}
+
+// Messages for the outcome of creating the multicast group of an import, see
+// applicationFailedMsg
+type (
+	groupCreatedMsg item
+	groupFailedMsg  struct {
+		name string
+		err  error
+	}
+)
+
+// createGroup creates the multicast group of the form, if there is one,
+// before the devices are imported, and returns its ID for them to join. A
+// group that can't be created is reported and the import goes on without
+// it: the devices matter more than their membership, which can be added
+// later. A dry run only records what would be created.
+func (m model) createGroup(ctx context.Context, events chan<- tea.Msg) string {
+	if m.newGroup == nil {
+		return m.selectedGroup
+	}
+	req := &api.CreateMulticastGroupRequest{MulticastGroup: m.newGroup}
+	if m.cfg.dryRun {
+		m.cfg.audit.DryRun(ctx, api.MulticastGroupService_Create_FullMethodName, req, nil)
+		return ""
+	}
+
+	resp, err := m.multicastClient.Create(importer.AuthContext(ctx, m.apiToken), req)
+	if err != nil {
+		slog.Error("Failed to create the multicast group, the devices are imported without it", "group", m.newGroup.Name, "err", err)
+		events <- groupFailedMsg{m.newGroup.Name, err}
+		return ""
+	}
+	slog.Info("Created the multicast group", "group", m.newGroup.Name, "id", resp.Id)
+	events <- groupCreatedMsg(item{title: m.newGroup.Name, id: resp.Id})
+	return resp.Id
+}
@@ -0,0 +1,949 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// runHeadless imports, deletes, syncs or compares the devices of cfg.input
+// without the TUI and returns the process exit code: 0 when every row
+// succeeded, 1 otherwise. Cancelling ctx stops the import after the row in
+// flight; what was done is reported as usual. However the run ends, it is
+// announced as --notify and --notify-url ask. An import into several
+// servers is run by runMirrored, once for each.
+func runHeadless(ctx context.Context, cfg config) (code int) {
+	if cfg.ValidateOnly {
+		return runValidation(ctx, cfg)
+	}
+	if len(cfg.mirrors) > 0 {
+		return runMirrored(ctx, cfg)
+	}
+	if cfg.Gateways {
+		return runGateways(ctx, cfg)
+	}
+	if cfg.Mode == importer.ModeQR {
+		return runQRCodes(ctx, cfg)
+	}
+
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required in headless mode")
+	case cfg.applicationID == "" && cfg.Mode != importer.ModeStatus:
+		return usageError("--application is required in headless mode")
+	case cfg.migrate.server != "" && (cfg.migrate.token == "" || cfg.migrate.applicationID == ""):
+		return usageError("--migrate-token (or CHIRPSTACK_SOURCE_API_TOKEN) and --migrate-application are required to migrate")
+	case cfg.migrate.server != "" && (cfg.Mode != importer.ModeImport || cfg.input != ""):
+		return usageError("--migrate-from can't be used with --mode or --csv")
+	case cfg.profileID == "" && cfg.Mode.NeedsProfile() && cfg.migrate.server == "":
+		return usageError(fmt.Sprintf("--profile is required to %s in headless mode", cfg.Mode))
+	case cfg.selection != nil && cfg.input != "":
+		return usageError("--all-devices and --select-tag can't be used with --csv")
+	case cfg.selection != nil && cfg.Mode == importer.ModeToggle && cfg.Disable == nil:
+		return usageError("toggling devices selected by tag needs --enable or --disable")
+	case cfg.selection != nil && cfg.Mode == importer.ModeMove && cfg.TargetApplication == "":
+		return usageError("moving devices selected by tag needs --to-application")
+	case cfg.input == "" && cfg.migrate.server == "" && cfg.selection == nil:
+		return usageError("--csv is required in headless mode")
+	case cfg.Mode == importer.ModeDelete && !cfg.dryRun && !cfg.destructiveOK:
+		return destructiveUsage(cfg, "deleting devices in headless mode")
+	case cfg.Mode == importer.ModeRotate && !cfg.dryRun && !cfg.destructiveOK:
+		return destructiveUsage(cfg, "rotating keys in headless mode")
+	case cfg.overwriteKeys && cfg.Mode.Creates() && !cfg.dryRun && !cfg.destructiveOK:
+		return destructiveUsage(cfg, "replacing the keys of existing devices with --overwrite-keys")
+	case cfg.qrCodes != "" && cfg.Mode != importer.ModeImport:
+		return usageError("--qr-codes needs --mode import or qr")
+	case cfg.report != "" && cfg.Mode != importer.ModeCompare && cfg.Mode != importer.ModeStatus:
+		return usageError("--report needs --mode compare or status")
+	case cfg.overQuota != "abort" && cfg.overQuota != "proceed" && cfg.overQuota != "truncate":
+		return usageError("--over-quota must be abort, proceed or truncate")
+	case cfg.overQuota == "truncate" && cfg.Mode != importer.ModeImport:
+		return usageError("--over-quota truncate can only be used to import")
+	}
+
+	var paths []string
+	if cfg.migrate.server == "" && cfg.selection == nil {
+		var err error
+		if paths, err = importer.ExpandInput(cfg.input, cfg.Extensions()); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+	}
+
+	if len(paths) > 1 && cfg.failuresFile != "" {
+		return usageError("--failures can only be used with a single input file")
+	}
+
+	notice := runNotice{Mode: cfg.Mode.String(), DryRun: cfg.dryRun, Server: cfg.server, Application: cfg.applicationID, Rows: make(map[string]int)}
+	for _, p := range paths {
+		notice.Files = append(notice.Files, filepath.Base(p))
+	}
+	begun := time.Now()
+	runID := newRunID(begun)
+	defer func() {
+		switch {
+		case ctx.Err() != nil:
+			notice.Event = eventCancelled
+		case notice.Event == "" && notice.Error == "":
+			notice.Event, notice.Error = eventFailed, fmt.Sprintf("stopped with exit code %d", code)
+		case notice.Event == "":
+			notice.Event = eventFailed
+		}
+		notice.Seconds = time.Since(begun).Seconds()
+		announce(cfg.notify, notice, os.Stderr, cfg.HTTPTimeout)
+	}()
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	// Fields the server is too old for are left out, see importer.unsupported.
+	server, err := serverVersion(importer.AuthContext(ctx, cfg.token), api.NewInternalServiceClient(conn))
+	if w := versionWarning(server, err); w != "" {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	access, err := probeAccess(importer.AuthContext(ctx, cfg.token), api.NewInternalServiceClient(conn))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(importer.DescribeError(err)))
+		return 1
+	}
+
+	// Where the keys go depends on the MAC version of the profile.
+	profiles := api.NewDeviceProfileServiceClient(conn)
+	if cfg.Mode.Creates() && cfg.profileID != "" {
+		resp, err := profiles.Get(importer.AuthContext(ctx, cfg.token), &api.GetDeviceProfileRequest{Id: cfg.profileID})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: looking up device profile %s: %s\n", cfg.profileID, redact.Secrets(err.Error()))
+			return 1
+		}
+		cfg.LoRaWAN11 = importer.IsLoRaWAN11(resp.DeviceProfile.MacVersion)
+
+		// Per-row profiles are checked against the region of this one.
+		list, err := importer.ListDeviceProfiles(importer.AuthContext(ctx, cfg.token), profiles, resp.DeviceProfile.TenantId)
+		if err == nil {
+			cfg.ProfileRegions = profileRegions(list)
+			cfg.ProfileRegion = resp.DeviceProfile.Region.String()
+		}
+	}
+
+	if cfg.SkipExisting && cfg.Mode == importer.ModeImport {
+		devices, err := importer.ListDevices(importer.AuthContext(ctx, cfg.token), api.NewDeviceServiceClient(conn), cfg.applicationID, func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rListing the devices of %s: %d/%d", cfg.applicationID, done, total)
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: listing the devices of %s: %s\n", cfg.applicationID, redact.Secrets(err.Error()))
+			return 1
+		}
+		cfg.ServerDevices = serverDevices(devices)
+		cfg.ServerNames = deviceNames(devices)
+	}
+
+	if cfg.checkServerNames && cfg.ServerNames == nil && cfg.Mode.Creates() && cfg.DuplicateNames != importer.NamesAllow {
+		devices, err := importer.ListDevices(importer.AuthContext(ctx, cfg.token), api.NewDeviceServiceClient(conn), cfg.applicationID, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: listing the devices of %s: %s\n", cfg.applicationID, redact.Secrets(err.Error()))
+			return 1
+		}
+		cfg.ServerNames = deviceNames(devices)
+	}
+
+	// Validate everything before writing anything, then read the inputs a
+	// second time to import them, so that memory use doesn't grow with the
+	// size of the lists.
+	inputs := importer.NewInputs(paths)
+	if cfg.migrate.server != "" {
+		in, err := migrationInput(ctx, cfg, conn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+		inputs = []*importer.Input{in}
+	}
+	if cfg.selection != nil {
+		in, err := applicationInput(importer.AuthContext(ctx, cfg.token), api.NewDeviceServiceClient(conn), cfg.applicationID, cfg.applicationID, cfg.Mode, *cfg.selection, func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rListing the devices of %s: %d/%d", cfg.applicationID, done, total)
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+		inputs = []*importer.Input{in}
+		notice.Files = []string{in.Source}
+	}
+	if err := importer.ReadInputs(ctx, inputs, cfg.ListOptions, 0, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	for _, in := range inputs {
+		for _, w := range in.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", in.Source, w)
+		}
+		for _, msg := range in.Invalid {
+			fmt.Fprintf(os.Stderr, "invalid: %s: %s\n", in.Source, msg)
+		}
+	}
+
+	if cfg.Mode == importer.ModeMove {
+		fmt.Fprintln(os.Stderr, "warning:", moveWarning)
+	}
+	if cfg.Mode == importer.ModeRotate && !cfg.dryRun {
+		fmt.Fprintln(os.Stderr, "warning:", rotateWarning)
+	}
+
+	if cfg.Mode == importer.ModeCompare {
+		notice.Event = eventCompleted
+		return runCompare(cfg, api.NewDeviceServiceClient(conn), inputs)
+	}
+	if cfg.Mode == importer.ModeStatus {
+		notice.Event = eventCompleted
+		return runStatus(ctx, cfg, api.NewDeviceServiceClient(conn), inputs)
+	}
+
+	imp := &importer.Importer{
+		Log:               slog.With("run", runID),
+		Devices:           api.NewDeviceServiceClient(conn),
+		Apps:              api.NewApplicationServiceClient(conn),
+		Profiles:          profiles,
+		Server:            server,
+		Multicast:         api.NewMulticastGroupServiceClient(conn),
+		Token:             cfg.token,
+		ApplicationID:     cfg.applicationID,
+		ProfileID:         cfg.profileID,
+		MulticastGroup:    cfg.multicastGroup,
+		Downlink:          cfg.downlink,
+		GenerateKeys:      cfg.GenerateKeys,
+		OverwriteKeys:     cfg.overwriteKeys,
+		TargetApplication: cfg.TargetApplication,
+		Mode:              cfg.Mode,
+		DryRun:            cfg.dryRun,
+		Audit:             cfg.audit,
+		MaxFailures:       cfg.maxFailures,
+		ChunkSize:         cfg.chunkSize,
+		Breaker:           importer.NewBreaker(cfg.breakerThreshold),
+		Consent:           cfg.yesDestructive(),
+		Pause:             &importer.PauseGate{},
+		Pool:              importer.NewWorkerPool(cfg.concurrency),
+		Pace:              importer.NewPacer(cfg.rate),
+	}
+
+	var plan *syncPlan
+	if cfg.Mode == importer.ModeSync {
+		plan, err = planSync(importer.AuthContext(ctx, cfg.token), imp.Devices, cfg.applicationID, inputs, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+		fmt.Printf("Plan: create %d, update %d, unchanged %d, not in the list %d\n",
+			len(plan.create), len(plan.update), plan.unchanged, len(plan.remove))
+		if cfg.syncDelete && len(plan.remove) > 0 && !cfg.dryRun && !cfg.destructiveOK {
+			return destructiveUsage(cfg, fmt.Sprintf("deleting the %d devices not in the list with --sync-delete", len(plan.remove)))
+		}
+		imp.Existing = plan.existing
+	}
+
+	// One refusal up front rather than the same error for every row
+	if !cfg.dryRun {
+		actx := importer.AuthContext(ctx, cfg.token)
+		tenantID, err := imp.Tenant(actx)
+		if err == nil {
+			err = access.writeAccess(actx, imp.Devices, cfg.Mode, cfg.applicationID, tenantID)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+	}
+
+	if cfg.Mode.Creates() && !cfg.dryRun {
+		n := 0
+		if plan != nil {
+			n = len(plan.create)
+		} else {
+			for _, in := range inputs {
+				n += in.Count
+			}
+		}
+		if code, ok := checkQuota(ctx, cfg, imp, api.NewTenantServiceClient(conn), api.NewInternalServiceClient(conn), n); !ok {
+			return code
+		}
+	}
+
+	if !cfg.dryRun {
+		lock, err := lockApplication(cfg.server, cfg.applicationID, cfg.lockTTL)
+		var held *lockHeld
+		if errors.As(err, &held) && held.stale != "" && cfg.breakLock {
+			fmt.Fprintln(os.Stderr, "warning: breaking the lock:", held)
+			lock, err = breakLock(held, cfg.lockTTL)
+		}
+		switch {
+		case errors.As(err, &held) && held.stale != "":
+			fmt.Fprintf(os.Stderr, "error: %v; break it with --break-lock\n", held)
+			return 1
+		case errors.As(err, &held):
+			fmt.Fprintf(os.Stderr, "error: %v; wait for that import to end\n", held)
+			return 1
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "warning: not locking the application:", err)
+		}
+		defer lock.release()
+	}
+
+	if cfg.Mode.Creates() && !cfg.dryRun {
+		j, err := createJournal(runID, cfg.server, cfg.applicationID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning: the import can't be undone:", err)
+		}
+		imp.Journal = j
+		defer j.Close()
+	}
+
+	rows, start := 0, time.Now()
+	imp.OnRow = func(source string, row importer.Row, err error) {
+		rows++
+		notice.Rows[rowStatus(rowLog{err: err})]++
+	}
+	listed := 0
+	for _, in := range inputs {
+		listed += in.Count
+	}
+	imp.OnTrip = func(ctx context.Context, t importer.Tripped) error {
+		if !cfg.breakerProbe {
+			return &importer.Aborted{Failed: t.Streak, Last: t.Last}
+		}
+		fmt.Fprintf(os.Stderr, "paused: %d rows in a row failed with %s; checking the server every %s\n", t.Streak, status.Code(t.Last), probeInterval)
+		// Hold the other workers back until the server is back.
+		imp.Pause.Pause()
+		defer imp.Pause.Resume()
+		for {
+			select {
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			case <-time.After(probeInterval):
+			}
+			if err := imp.Probe(ctx); err == nil {
+				fmt.Fprintln(os.Stderr, "resumed: the server answers again")
+				return nil
+			}
+		}
+	}
+	imp.OnChunk = func(c importer.ChunkTiming) {
+		fmt.Fprintf(os.Stderr, "%d/%d rows, chunk %d took %s\n", c.Done, listed, c.Count, c.Elapsed.Round(100*time.Millisecond))
+	}
+	results, err := imp.ImportFiles(ctx, inputs, importer.NewBatch(cfg.ListOptions, inputs).Scan, func(source string) string {
+		return mirrorPath(failuresPath(source, cfg.failuresFile), cfg.mirror)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		notice.Error = redact.Secrets(err.Error())
+		return 1
+	}
+	notice.Event = eventCompleted
+	for _, fr := range results {
+		notice.Rows["invalid"] += len(fr.Input.Invalid)
+		notice.Rows["skipped"] += len(fr.Input.Exists)
+		var a *importer.Aborted
+		if errors.As(fr.Stopped, &a) {
+			notice.Event, notice.Error = eventFailed, redact.Secrets(a.Error())
+		}
+	}
+	if cfg.verify && !cfg.dryRun && cfg.Mode.Creates() {
+		imp.Verify(ctx, results, func(done, total int) {
+			if done == 0 {
+				fmt.Fprintf(os.Stderr, "Verifying %d devices…\n", total)
+			}
+		})
+	}
+	if !cfg.noHistory {
+		report := reportLogs(imp.Report(), results)
+		for _, fr := range results {
+			for _, f := range fr.Input.Rejected {
+				report = append(report, rowLog{source: fr.Input.Source, pos: f.Row.Pos, devEUI: f.Row.DevEUI, name: f.Row.Name, err: f.Err})
+			}
+			for _, row := range fr.Input.Exists {
+				report = append(report, rowLog{source: fr.Input.Source, pos: row.Pos, devEUI: row.DevEUI, name: row.Name, err: importer.ExistsNote})
+			}
+		}
+		markMismatches(report, results)
+		run := newRunHeader(runID, begun, cfg.server, cfg.applicationID, "", cfg, inputs)
+		run.Seconds = time.Since(begun).Seconds()
+		run.Chunks = chunkSeconds(imp.Chunks)
+		if err := saveRun(run, report, cfg.historyLimit); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: saving the run to the history:", err)
+		}
+	}
+	// After the report, which the return statements below print.
+	defer func() {
+		printTiming(rows, time.Since(start))
+		if s := chunkSummary(imp.Chunks, cfg.chunkSize); s != "" {
+			fmt.Printf("Chunks: %s\n", s)
+		}
+	}()
+
+	switch cfg.Mode {
+	case importer.ModeDelete:
+		return reportDeletes(cfg, results)
+	case importer.ModeToggle:
+		return reportToggles(cfg, results)
+	case importer.ModeUpdate:
+		return reportUpdates(cfg, results)
+	case importer.ModeMove:
+		return reportMoves(cfg, results)
+	case importer.ModeRotate:
+		return reportRotations(cfg, results)
+	case importer.ModeSync:
+		var unlisted importer.Result
+		if cfg.syncDelete && ctx.Err() == nil {
+			unlisted, err = imp.RemoveUnlisted(ctx, plan.remove)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+				return 1
+			} else if err != nil {
+				fmt.Fprintln(os.Stderr, "warning: deleting the unlisted devices stopped early:", redact.Secrets(err.Error()))
+			}
+		}
+		return reportSync(cfg, results, unlisted)
+	}
+
+	created := "created"
+	if cfg.dryRun {
+		created = "would create"
+	}
+	var total, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, created, fr.Result.Created, len(fr.Result.Failures), len(fr.Input.Invalid))
+		if cfg.dryRun {
+			// Nothing is written on a dry run, not even the failed rows.
+			for _, f := range fr.Result.Failures {
+				fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+			}
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %s\n", redact.Secrets(fr.Stopped.Error()))
+		}
+		if n := len(fr.Input.Exists); n > 0 {
+			fmt.Printf("  skipped %d devices that exist already\n", n)
+		}
+		if n := fr.Result.KeysUpdated; n > 0 {
+			fmt.Printf("  keys set for %d existing devices\n", n)
+		}
+		for _, f := range fr.Result.Skipped {
+			fmt.Fprintf(os.Stderr, "warning: %s: skipped %s: %s\n", fr.Input.Source, f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		if fr.KeysFile != "" {
+			fmt.Fprintf(os.Stderr, "warning: %d generated AppKeys written to %s; this file contains secrets\n",
+				len(fr.Result.Keys), fr.KeysFile)
+		}
+		total += fr.Result.Created
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, failed %d, invalid %d\n", created, total, failed, invalid)
+	}
+	printDegraded(results)
+	failed += printGroupFailures(results, cfg.dryRun)
+	failed += printEnqueueFailures(results)
+	failed += printVerification(results)
+
+	if cfg.qrCodes != "" && !cfg.dryRun {
+		skipped, err := writeHeadlessQRCodes(mirrorPath(cfg.qrCodes, cfg.mirror), createdRows(results))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		failed += skipped
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkQuota compares the n devices a headless run creates with the device
+// limit of the tenant and applies --over-quota, limiting imp when truncating.
+// It returns the exit code and false when the run mustn't go ahead. Tokens
+// that can't read the limit get a warning.
+func checkQuota(ctx context.Context, cfg config, imp *importer.Importer, tenants api.TenantServiceClient, internal api.InternalServiceClient, n int) (int, bool) {
+	ctx = importer.AuthContext(ctx, cfg.token)
+	tenantID, err := imp.Tenant(ctx)
+	var q tenantQuota
+	if err == nil {
+		q, err = loadQuota(ctx, tenants, internal, tenantID)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: can't check the device limit of the tenant:", redact.Secrets(err.Error()))
+		return 0, true
+	}
+
+	over := q.over(n)
+	if over == 0 {
+		return 0, true
+	}
+	msg := fmt.Sprintf("this %s would exceed the tenant's device limit by %d devices (%d of %d used)", cfg.Mode, over, q.used, q.max)
+	switch cfg.overQuota {
+	case "proceed":
+		fmt.Fprintln(os.Stderr, "warning:", msg)
+	case "truncate":
+		if q.remaining() == 0 {
+			fmt.Fprintln(os.Stderr, "error: the tenant has reached its device limit")
+			return 1, false
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s; importing only the first %d\n", msg, q.remaining())
+		imp.Limit = q.remaining()
+	default:
+		return usageError(msg + "; use --over-quota proceed or truncate to import anyway"), false
+	}
+	return 0, true
+}
+
+// runGateways imports the gateways of cfg.input into cfg.tenantID without
+// the TUI and returns the process exit code.
+func runGateways(ctx context.Context, cfg config) int {
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required in headless mode")
+	case cfg.tenantID == "":
+		return usageError("--tenant is required to import gateways in headless mode")
+	case cfg.input == "":
+		return usageError("--csv is required in headless mode")
+	case cfg.Mode != importer.ModeImport:
+		return usageError("gateways can only be imported, not " + cfg.Mode.String())
+	}
+
+	paths, err := importer.ExpandInput(cfg.input, cfg.Extensions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	if len(paths) > 1 && cfg.failuresFile != "" {
+		return usageError("--failures can only be used with a single input file")
+	}
+
+	inputs := importer.NewInputs(paths)
+	if err := importer.ReadGatewayInputs(ctx, inputs, cfg.ListOptions, 0); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	for _, in := range inputs {
+		for _, w := range in.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", in.Source, w)
+		}
+		for _, msg := range in.Invalid {
+			fmt.Fprintf(os.Stderr, "invalid: %s: %s\n", in.Source, msg)
+		}
+	}
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	gi := &importer.GatewayImporter{
+		Gateways: api.NewGatewayServiceClient(conn),
+		Token:    cfg.token,
+		TenantID: cfg.tenantID,
+		DryRun:   cfg.dryRun,
+		Audit:    cfg.audit,
+
+		MaxFailures: cfg.maxFailures,
+	}
+	rows, start := 0, time.Now()
+	gi.OnRow = func(string, importer.GatewayRow, error) { rows++ }
+	results, err := gi.ImportFiles(ctx, inputs, cfg.ListOptions, func(source string) string {
+		return failuresPath(source, cfg.failuresFile)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer func() { printTiming(rows, time.Since(start)) }()
+
+	created := "created"
+	if cfg.dryRun {
+		created = "would create"
+	}
+	var total, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, created, fr.Result.Created, len(fr.Result.Failures), len(fr.Input.Invalid))
+		if cfg.dryRun {
+			for _, f := range fr.Result.Failures {
+				fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+			}
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %s\n", redact.Secrets(fr.Stopped.Error()))
+		}
+		total += fr.Result.Created
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, failed %d, invalid %d\n", created, total, failed, invalid)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportDeletes prints the outcome of a delete, listing every device that
+// was removed, and returns the exit code.
+func reportDeletes(cfg config, results []importer.FileResult) int {
+	deleted := "deleted"
+	if cfg.dryRun {
+		deleted = "would delete"
+	}
+	var removed, absent, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, already absent %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, deleted, len(fr.Result.Removed), fr.Result.Absent,
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		for _, row := range fr.Result.Removed {
+			fmt.Printf("  %s %s\n", row.DevEUI, row.Name)
+		}
+		if cfg.dryRun {
+			for _, f := range fr.Result.Failures {
+				fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+			}
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %s\n", redact.Secrets(fr.Stopped.Error()))
+		}
+		removed += len(fr.Result.Removed)
+		absent += fr.Result.Absent
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, already absent %d, failed %d, invalid %d\n", deleted, removed, absent, failed, invalid)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportSync prints the outcome of a sync and returns the exit code.
+// unlisted holds the devices deleted because no list has them.
+func reportSync(cfg config, results []importer.FileResult, unlisted importer.Result) int {
+	var created, updated, unchanged, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): created %d, updated %d, unchanged %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, fr.Result.Created, fr.Result.Updated, fr.Result.Unchanged,
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		if cfg.dryRun {
+			for _, f := range fr.Result.Failures {
+				fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+			}
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %s\n", redact.Secrets(fr.Stopped.Error()))
+		}
+		if fr.KeysFile != "" {
+			fmt.Fprintf(os.Stderr, "warning: %d generated AppKeys written to %s; this file contains secrets\n",
+				len(fr.Result.Keys), fr.KeysFile)
+		}
+		created += fr.Result.Created
+		updated += fr.Result.Updated
+		unchanged += fr.Result.Unchanged
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if cfg.syncDelete {
+		fmt.Printf("%s: deleted %d, already absent %d, failed %d\n",
+			importer.UnlistedSource, len(unlisted.Removed), unlisted.Absent, len(unlisted.Failures))
+		for _, row := range unlisted.Removed {
+			fmt.Printf("  %s %s\n", row.DevEUI, row.Name)
+		}
+		for _, f := range unlisted.Failures {
+			fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		failed += len(unlisted.Failures)
+	}
+	fmt.Printf("Total: created %d, updated %d, unchanged %d, deleted %d, failed %d, invalid %d\n",
+		created, updated, unchanged, len(unlisted.Removed), failed, invalid)
+	printDegraded(results)
+	failed += printGroupFailures(results, cfg.dryRun)
+	failed += printEnqueueFailures(results)
+	failed += printVerification(results)
+	if cfg.dryRun {
+		fmt.Println("Dry run: nothing was changed")
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runCompare prints how the rows of inputs compare with the devices of
+// cfg.applicationID, writing the report to cfg.report if set. Nothing is
+// written to the server. The exit code is 0 only if every device exists and
+// matches.
+func runCompare(cfg config, client api.DeviceServiceClient, inputs []*importer.Input) int {
+	c, err := compareDevices(importer.AuthContext(context.Background(), cfg.token), client, cfg.applicationID, cfg.profileID, inputs, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	for _, status := range []string{compareMissing, compareDiffers} {
+		for _, line := range c.lines(status) {
+			fmt.Printf("%s: %s\n", status, line)
+		}
+	}
+	exists, missing, differs := len(c.with(compareExists)), len(c.with(compareMissing)), len(c.with(compareDiffers))
+	fmt.Printf("Total: exists %d, missing %d, differs %d\n", exists, missing, differs)
+
+	if cfg.report != "" {
+		if err := saveComparison(cfg.report, c); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+		fmt.Printf("Report written to %s\n", cfg.report)
+	}
+
+	invalid := 0
+	for _, in := range inputs {
+		invalid += len(in.Invalid)
+	}
+	if missing > 0 || differs > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runStatus reports the status of the listed devices without the TUI and
+// returns the process exit code: 0 if they all exist and have joined. The
+// report is printed as JSON, for scripts, unless --report writes it to a
+// file.
+func runStatus(ctx context.Context, cfg config, client api.DeviceServiceClient, inputs []*importer.Input) int {
+	r, err := checkStatus(importer.AuthContext(ctx, cfg.token), client, inputs, cfg, importer.NewWorkerPool(cfg.concurrency), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	exists, joined, failed := r.counts()
+	if cfg.report != "" {
+		if err := saveStatus(cfg.report, r); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+			return 1
+		}
+		fmt.Printf("Total: %d, exist %d, joined %d, failed %d\n", len(r.Devices), exists, joined, failed)
+		fmt.Printf("Report written to %s\n", cfg.report)
+	} else if err := writeStatusJSON(os.Stdout, r); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	invalid := 0
+	for _, in := range inputs {
+		invalid += len(in.Invalid)
+	}
+	if joined < len(r.Devices) || failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runUndo deletes the devices created by the last import without the TUI
+// and returns the process exit code.
+func runUndo(cfg config, force bool) int {
+	uj, err := loadJournal("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	if err := uj.checkTarget(cfg.server); err != nil {
+		return usageError(err.Error() + "; pass --server " + uj.Server)
+	}
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required with --undo")
+	case cfg.applicationID != "" && cfg.applicationID != uj.ApplicationID:
+		return usageError(fmt.Sprintf("the last import went to application %s, not %s", uj.ApplicationID, cfg.applicationID))
+	case !cfg.dryRun && !cfg.destructiveOK:
+		return destructiveUsage(cfg, fmt.Sprintf("undoing the last import, which deletes its %d devices,", len(uj.devices)))
+	}
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx := importer.AuthContext(context.Background(), cfg.token)
+	res, err := undoImport(ctx, api.NewDeviceServiceClient(conn), uj, force, cfg.dryRun, cfg.yesDestructive(), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	deleted := "deleted"
+	if cfg.dryRun {
+		deleted = "would delete"
+	}
+	for _, row := range res.Removed {
+		fmt.Printf("  %s %s\n", row.DevEUI, row.Name)
+	}
+	for _, row := range res.Kept {
+		fmt.Printf("  kept %s %s: seen since the import, --force deletes it\n", row.DevEUI, row.Name)
+	}
+	for _, f := range res.Failures {
+		fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+	}
+	fmt.Printf("Undo of the import started %s: %s %d, kept %d, already absent %d, failed %d\n",
+		uj.StartedAt.Local().Format("2006-01-02 15:04"), deleted, len(res.Removed), len(res.Kept), res.Absent, len(res.Failures))
+
+	if cfg.dryRun {
+		return 0
+	}
+	if len(res.Failures) > 0 || len(res.Kept) > 0 {
+		return 1
+	}
+	if err := uj.discard(); err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+	return 0
+}
+
+// runExport writes the devices of cfg.applicationID to path without the TUI
+// and returns the process exit code.
+func runExport(cfg config, path string) int {
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required with --export")
+	case cfg.applicationID == "":
+		return usageError("--application is required with --export")
+	}
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx := importer.AuthContext(context.Background(), cfg.token)
+	devices, err := importer.ListDevices(ctx, api.NewDeviceServiceClient(conn), cfg.applicationID, nil)
+	if err == nil {
+		err = saveDeviceExport(path, devices)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	fmt.Printf("Exported %d devices to %s\n", len(devices), path)
+	return 0
+}
+
+// runGatewayExport writes the gateways of cfg.tenantID to path without the
+// TUI and returns the process exit code.
+func runGatewayExport(cfg config, path string) int {
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required with --export-gateways")
+	case cfg.tenantID == "":
+		return usageError("--tenant is required with --export-gateways")
+	}
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx := importer.AuthContext(context.Background(), cfg.token)
+	gateways, err := importer.ListGateways(ctx, api.NewGatewayServiceClient(conn), cfg.tenantID, nil)
+	if err == nil {
+		err = saveGatewayExport(path, gateways)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	fmt.Printf("Exported %d gateways to %s\n", len(gateways), path)
+	return 0
+}
+
+func usageError(msg string) int {
+	fmt.Fprintln(os.Stderr, "error:", msg)
+	return 2
+}
+
+// runKeylessReport writes the devices of cfg.applicationID that are missing
+// keys to path without the TUI and returns the process exit code.
+func runKeylessReport(cfg config, path string) int {
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required with --missing-keys")
+	case cfg.applicationID == "":
+		return usageError("--application is required with --missing-keys")
+	}
+
+	conn, err := dial(cfg.server, cfg.audit, cfg.link, cfg.debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx := importer.AuthContext(context.Background(), cfg.token)
+	client := api.NewDeviceServiceClient(conn)
+	devices, err := importer.ListDevices(ctx, client, cfg.applicationID, nil)
+	var missing []*api.DeviceListItem
+	if err == nil {
+		missing, err = findKeyless(ctx, client, devices, nil)
+	}
+	if err == nil {
+		err = saveKeylessReport(path, missing)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	fmt.Printf("%d of %d devices have no keys and have never joined, written to %s\n", len(missing), len(devices), path)
+	return 0
+}
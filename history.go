@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// maxRecentFiles is how many recently imported files are remembered.
+const maxRecentFiles = 5
+
+// history is what the TUI remembers between runs, so that a daily import
+// into the same application starts where the last one left off.
+type history struct {
+	Server        string   `json:"server,omitempty"`
+	TenantID      string   `json:"tenant_id,omitempty"`
+	ApplicationID string   `json:"application_id,omitempty"`
+	ProfileID     string   `json:"device_profile_id,omitempty"`
+	RecentFiles   []string `json:"recent_files,omitempty"` // most recent first
+	NewestFirst   bool     `json:"newest_first,omitempty"` // file picker sorts files by modification time
+	Concurrency   int      `json:"concurrency,omitempty"`  // workers of the last import, as adjusted while it ran
+	Rate          float64  `json:"rate,omitempty"`         // rate limit of the last import in rows per second, 0 for none
+}
+
+// addRecent moves paths to the front of the recent files. Only local files
+// are remembered; URLs may carry credentials and stdin can't be replayed.
+func (h *history) addRecent(paths []string) {
+	for _, path := range slices.Backward(paths) {
+		if path == "-" || importer.IsURL(path) {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if i := slices.Index(h.RecentFiles, path); i >= 0 {
+			h.RecentFiles = slices.Delete(h.RecentFiles, i, i+1)
+		}
+		h.RecentFiles = append([]string{path}, h.RecentFiles...)
+	}
+	if len(h.RecentFiles) > maxRecentFiles {
+		h.RecentFiles = h.RecentFiles[:maxRecentFiles]
+	}
+}
+
+// lastDirectory returns the directory of the most recent file that still
+// exists, or an empty string.
+func (h history) lastDirectory() string {
+	for _, path := range h.RecentFiles {
+		dir := filepath.Dir(path)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// dataDir returns the tool's directory under the XDG data directory,
+// ~/.local/share unless $XDG_DATA_HOME is set.
+func dataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+func historyPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
+
+// loadHistory reads the saved history. A missing file is not an error.
+func loadHistory() (history, error) {
+	var h history
+
+	path, err := historyPath()
+	if err != nil {
+		return h, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(data, &h); err != nil {
+		return history{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// saveHistory replaces the saved history with h.
+func saveHistory(h history) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
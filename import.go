@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// dial connects to the ChirpStack gRPC API at addr, host:port or a Unix
+// socket, see routeTo. Whichever the route, the credentials and
+// interceptors are the same. With debug, every attempt at a call is logged
+// to it.
+func dial(addr string, audit *importer.AuditLog, l *link, debug *slog.Logger) (*grpc.ClientConn, error) {
+	r, err := routeTo(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ChirpStack at %s: %v", addr, err)
+	}
+	// Insecure connection, as per the ChirpStack docker-compose config
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(r.dial),
+	}, l.dialOptions()...)
+	if debug != nil {
+		// Inside the retries of l, to log each attempt
+		opts = append(opts, grpc.WithChainUnaryInterceptor(debugInterceptor(debug)))
+	}
+	if audit != nil {
+		// Outside the retries of l, so that a call sent again is recorded once
+		opts = append(opts, grpc.WithUnaryInterceptor(audit.Interceptor))
+		audit.Connected(addr)
+	}
+	conn, err := grpc.Dial(r.target(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ChirpStack %s: %v\nMake sure ChirpStack gRPC API is running on this address", r, err)
+	}
+	return conn, nil
+}
+
+// failuresPath returns where the failed rows of an import from source are
+// written: next to the source file, or override when set. It is empty for
+// stdin and downloads without an override.
+func failuresPath(source, override string) string {
+	if override != "" || source == "" || source == "-" || importer.IsURL(source) {
+		return override
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".failures.csv"
+}
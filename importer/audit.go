@@ -0,0 +1,239 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// auditEntry is one line of the audit log: a write to the server, or one a
+// dry run would have made. Only identifiers are taken from the request, so
+// keys and other secrets never reach the file; those quoted in errors are
+// masked.
+type auditEntry struct {
+	Time             time.Time `json:"time"`
+	Server           string    `json:"server"`
+	Operator         string    `json:"operator"`
+	Operation        string    `json:"operation"` // gRPC method, e.g. "api.DeviceService/Create"
+	DryRun           bool      `json:"dry_run,omitempty"`
+	TenantID         string    `json:"tenant_id,omitempty"`
+	ApplicationID    string    `json:"application_id,omitempty"`
+	DevEUI           string    `json:"dev_eui,omitempty"`
+	GatewayID        string    `json:"gateway_id,omitempty"`
+	MulticastGroupID string    `json:"multicast_group_id,omitempty"`
+	Outcome          string    `json:"outcome"` // "ok" or "error"
+	Error            string    `json:"error,omitempty"`
+}
+
+// auditFields maps the request fields copied into an entry to where they go.
+var auditFields = map[protoreflect.Name]func(e *auditEntry, v string){
+	"tenant_id":          func(e *auditEntry, v string) { e.TenantID = v },
+	"application_id":     func(e *auditEntry, v string) { e.ApplicationID = v },
+	"dev_eui":            func(e *auditEntry, v string) { e.DevEUI = v },
+	"gateway_id":         func(e *auditEntry, v string) { e.GatewayID = v },
+	"multicast_group_id": func(e *auditEntry, v string) { e.MulticastGroupID = v },
+}
+
+// writePrefixes are the method names of the API that change something.
+var writePrefixes = []string{"Create", "Update", "Delete", "Activate", "Deactivate", "Enqueue", "Flush", "Add", "Remove"}
+
+// AuditLog appends a JSON line for every write to the server. A nil
+// *AuditLog records nothing.
+type AuditLog struct {
+	Path     string
+	operator string // from --operator; otherwise looked up from the token
+
+	mu     sync.Mutex
+	f      *os.File
+	server string            // set by dial
+	names  map[string]string // API key ID -> name of the operator
+}
+
+// OpenAudit opens the audit log at path for appending, creating it if
+// needed. An empty path disables the audit log.
+func OpenAudit(path, operator string) (*AuditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{Path: path, operator: operator, f: f, names: make(map[string]string)}, nil
+}
+
+// Connected records the server the following calls go to.
+func (a *AuditLog) Connected(server string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.server = server
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// Interceptor records the writes made over a connection.
+func (a *AuditLog) Interceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if isWrite(method) && ctx.Value(probeKey{}) == nil {
+		a.record(a.operatorFor(ctx, cc), method, req, false, err)
+	}
+	return err
+}
+
+// probeKey marks the context of a write that only probes a permission and
+// can't change anything, which isn't recorded.
+type probeKey struct{}
+
+// Probing marks ctx as that of a probe, see probeKey.
+func Probing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+// DryRun records a write that a dry run checked instead of making: what
+// req would have done, and err if it would have failed. ctx carries the
+// token, as for the call itself.
+func (a *AuditLog) DryRun(ctx context.Context, method string, req proto.Message, err error) {
+	if a == nil {
+		return
+	}
+	a.record(a.operatorFor(ctx, nil), method, req, true, err)
+}
+
+// record appends the entry of a call to method with req that ended with err.
+func (a *AuditLog) record(operator, method string, req any, dryRun bool, err error) {
+	e := auditEntry{
+		Time:      time.Now().UTC(),
+		Operator:  operator,
+		Operation: strings.TrimPrefix(method, "/"),
+		DryRun:    dryRun,
+		Outcome:   "ok",
+	}
+	if m, ok := req.(proto.Message); ok {
+		copyAuditFields(&e, m.ProtoReflect())
+	}
+	if err != nil {
+		e.Outcome = "error"
+		e.Error = redact.Secrets(status.Convert(err).Message())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.Server = a.server
+	if err := json.NewEncoder(a.f).Encode(e); err != nil {
+		slog.Error("Failed to write the audit log", "err", err)
+	}
+}
+
+// copyAuditFields copies the identifiers of m, and of the messages it
+// holds such as the device of a CreateDeviceRequest, into e.
+func copyAuditFields(e *auditEntry, m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap():
+			copyAuditFields(e, v.Message())
+		case fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap():
+			if set, ok := auditFields[fd.Name()]; ok {
+				set(e, v.String())
+			}
+		}
+		return true
+	})
+}
+
+// isWrite reports whether method, e.g. "/api.DeviceService/CreateKeys",
+// changes something on the server.
+func isWrite(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, p := range writePrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// operatorFor names whoever makes the calls with the token in ctx: the
+// --operator flag, else the name of the API key. The key's ID is in its
+// token, but its name can only be looked up over cc, and only by admin
+// keys; otherwise the ID has to do.
+func (a *AuditLog) operatorFor(ctx context.Context, cc *grpc.ClientConn) string {
+	if a.operator != "" {
+		return a.operator
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keyID := apiKeyID(strings.TrimPrefix(strings.Join(md.Get("authorization"), ""), "Bearer "))
+	if keyID == "" {
+		return "unknown"
+	}
+
+	a.mu.Lock()
+	name, ok := a.names[keyID]
+	a.mu.Unlock()
+	if ok {
+		return name
+	}
+	name = "api key " + keyID
+	if cc == nil {
+		return name
+	}
+	resp, err := api.NewInternalServiceClient(cc).ListApiKeys(ctx, &api.ListApiKeysRequest{IsAdmin: true, Limit: 1000})
+	if err == nil {
+		for _, k := range resp.Result {
+			if k.Id == keyID {
+				name = k.Name
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.names[keyID] = name
+	return name
+}
+
+// apiKeyID returns the ID of the ChirpStack API key a token was issued for,
+// the subject of the JWT, or "" if token isn't one.
+func apiKeyID(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+	return claims.Sub
+}
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// Breaker pauses an import once enough rows in a row have failed with the
+// same gRPC status, e.g. when the server's database has gone away and every
+// remaining row would fail as fast as it's sent. Errors about the row itself
+// don't count, nor do those that didn't come from the server. A nil
+// *Breaker never trips.
+type Breaker struct {
+	threshold int
+	code      codes.Code // of the failures so far
+	streak    int        // consecutive failures with code
+}
+
+// rowCodes are the statuses of failures caused by the row rather than the
+// server, which don't trip the breaker however many there are.
+var rowCodes = map[codes.Code]bool{codes.InvalidArgument: true, codes.NotFound: true, codes.AlreadyExists: true}
+
+// Tripped is a burst of identical failures that paused an import.
+type Tripped struct {
+	Streak int
+	Last   error
+}
+
+func NewBreaker(threshold int) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Breaker{threshold: threshold}
+}
+
+// record counts the outcome of a row and reports whether it trips the
+// breaker, which then starts counting afresh.
+func (b *Breaker) record(err error) bool {
+	if b == nil {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if err == nil || !ok || !countsAsFailure(err) || rowCodes[s.Code()] {
+		b.streak = 0
+		return false
+	}
+	if s.Code() != b.code {
+		b.code, b.streak = s.Code(), 0
+	}
+	b.streak++
+	if b.streak < b.threshold {
+		return false
+	}
+	b.streak = 0
+	return true
+}
+
+// Probe makes a cheap call to see whether the server is back.
+func (imp *Importer) Probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(AuthContext(ctx, imp.Token), 10*time.Second)
+	defer cancel()
+	_, err := imp.Apps.Get(ctx, &api.GetApplicationRequest{Id: imp.ApplicationID})
+	return err
+}
@@ -0,0 +1,93 @@
+package importer
+
+import "time"
+
+// chunkDrain is how long a cancelled import goes on to finish its chunk, so
+// that it stops on a chunk boundary when the server keeps up; well within
+// shutdownGrace.
+const chunkDrain = 2 * time.Second
+
+// ChunkTiming is a chunk of rows an import has finished. The undo journal,
+// the audit log, the generated keys and the failed rows are on disk up to
+// its end.
+type ChunkTiming struct {
+	Count   int // 1-based
+	rows    int // fewer than the chunk size for the last chunk
+	Done    int // rows of the import processed by its end
+	Elapsed time.Duration
+
+	start  time.Time
+	paused time.Duration // left out of elapsed
+}
+
+func newChunk(now time.Time) ChunkTiming {
+	return ChunkTiming{start: now}
+}
+
+// endChunk flushes the records of the rows imported so far to disk, those
+// of the file fr among them, and reports c.
+func (imp *Importer) endChunk(c ChunkTiming, fr *FileResult, failuresPath func(source string) string) {
+	c.Elapsed = time.Since(c.start) - c.paused
+	c.Count = len(imp.Chunks) + 1
+	c.Done = c.rows
+	if n := len(imp.Chunks); n > 0 {
+		c.Done += imp.Chunks[n-1].Done
+	}
+	imp.Chunks = append(imp.Chunks, c)
+
+	if err := imp.Journal.sync(); err != nil {
+		imp.logger().Error("Failed to write the undo journal", "err", err)
+	}
+	if err := imp.Audit.sync(); err != nil {
+		imp.logger().Error("Failed to write the audit log", "err", err)
+	}
+	// The keys are appended as they come, so that those of devices created
+	// before a crash aren't lost with it.
+	if err := fr.flushKeys(); err != nil {
+		imp.logger().Error("Failed to write the generated keys", "err", err)
+	}
+	// The failures file is written in full once it's done; this is the
+	// copy that survives a crash. Failures that go to stderr are only
+	// written then, rather than again with every chunk.
+	if len(fr.Result.Failures) > 0 && !imp.DryRun && failuresPath != nil {
+		if path := failuresPath(fr.Input.Source); path != "" {
+			if err := SaveFailures(path, fr.Result.Failures); err != nil {
+				imp.logger().Error("Failed to write the failed rows", "err", err)
+			}
+		}
+	}
+	if imp.OnChunk != nil {
+		imp.OnChunk(c)
+	}
+	imp.Events.Emit(ChunkCommitted(c))
+}
+
+// held reports whether the import is paused. A nil *PauseGate never is.
+func (g *PauseGate) held() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// sync commits the journal to disk.
+func (j *Journal) sync() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Sync()
+}
+
+// sync commits the audit log to disk.
+func (a *AuditLog) sync() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.f.Sync()
+}
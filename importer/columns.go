@@ -0,0 +1,443 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// ColumnDef describes a device field that can be read from a tabular file.
+// The same table drives header mapping and the generated template, so the two
+// can't drift apart.
+type ColumnDef struct {
+	Name     string    // canonical header name
+	aliases  []string  // alternative header names, in normalized form
+	Required bool      // whether every row must have a value
+	examples [2]string // values for the two example rows of the template
+	set      func(row *Row, value string) error
+}
+
+// ColumnDefs lists the fields recognized in header rows, in template order.
+var ColumnDefs = []ColumnDef{
+	{
+		Name: "dev_eui", aliases: []string{"deveui", "eui", "deviceeui"}, Required: true,
+		examples: [2]string{"70b3d57ed0000001", "70b3d57ed0000002"},
+		set:      func(r *Row, v string) error { r.DevEUI = v; return nil },
+	},
+	{
+		Name: "name", aliases: []string{"devicename"}, Required: true,
+		examples: [2]string{"meter-0001", "meter-0002"},
+		set:      func(r *Row, v string) error { r.Name = v; return nil },
+	},
+	{
+		Name: "description", aliases: []string{"desc"},
+		examples: [2]string{"Basement, building A", ""},
+		set:      func(r *Row, v string) error { r.Description = v; return nil },
+	},
+	{
+		Name: "join_eui", aliases: []string{"joineui", "appeui", "applicationeui"},
+		examples: [2]string{"70b3d57ed0000000", ""},
+		set:      func(r *Row, v string) error { r.JoinEUI = v; return nil },
+	},
+	{
+		Name: "app_key", aliases: []string{"appkey", "applicationkey"},
+		examples: [2]string{"2b7e151628aed2a6abf7158809cf4f3c", ""},
+		set:      func(r *Row, v string) error { r.AppKey = v; return nil },
+	},
+	{
+		Name: "nwk_key", aliases: []string{"nwkkey", "networkkey"},
+		examples: [2]string{"", ""},
+		set:      func(r *Row, v string) error { r.nwkKey = v; return nil },
+	},
+	{
+		Name: "dev_addr", aliases: []string{"devaddr", "deviceaddress"},
+		examples: [2]string{"", ""},
+		set:      func(r *Row, v string) error { r.devAddr = v; return nil },
+	},
+	{
+		Name: "nwk_s_key", aliases: []string{"nwkskey", "networksessionkey"},
+		examples: [2]string{"", ""},
+		set:      func(r *Row, v string) error { r.nwkSKey = v; return nil },
+	},
+	{
+		Name: "app_s_key", aliases: []string{"appskey", "applicationsessionkey"},
+		examples: [2]string{"", ""},
+		set:      func(r *Row, v string) error { r.appSKey = v; return nil },
+	},
+	{
+		Name: "device_profile", aliases: []string{"deviceprofile", "profile", "deviceprofileid", "deviceprofilename"},
+		examples: [2]string{"", "LSE01-EU868"},
+		set:      func(r *Row, v string) error { r.Profile = v; return nil },
+	},
+	{
+		Name: "application", aliases: []string{"app", "applicationid", "applicationname"},
+		examples: [2]string{"", "Water Meters"},
+		set:      func(r *Row, v string) error { r.application = v; return nil },
+	},
+	{
+		Name: "target_application", aliases: []string{"targetapplication", "targetapp", "toapplication", "moveto"},
+		examples: [2]string{"", ""},
+		set:      func(r *Row, v string) error { r.targetApplication = strings.TrimSpace(v); return nil },
+	},
+	{
+		Name: "multicast_group", aliases: []string{"multicastgroup", "multicast", "multicastgroupid"},
+		examples: [2]string{"", "Firmware Updates"},
+		set:      func(r *Row, v string) error { r.multicastGroup = v; return nil },
+	},
+	{
+		Name: "vendor_id", aliases: []string{"vendorid", "loravendorid"},
+		examples: [2]string{"", "0a1b"},
+		set:      func(r *Row, v string) error { r.VendorID = v; return nil },
+	},
+	{
+		Name: "vendor_profile_id", aliases: []string{"vendorprofileid", "modelid"},
+		examples: [2]string{"", "0002"},
+		set:      func(r *Row, v string) error { r.VendorProfileID = v; return nil },
+	},
+	{
+		Name: "downlink_payload", aliases: []string{"downlinkpayload", "downlink"},
+		examples: [2]string{"", "0100003c"},
+		set:      func(r *Row, v string) error { r.downlinkPayload = strings.TrimSpace(v); return nil },
+	},
+	{
+		Name: "downlink_fport", aliases: []string{"downlinkfport", "fport"},
+		examples: [2]string{"", "10"},
+		set:      func(r *Row, v string) (err error) { r.downlinkFPort, err = parseFPort(v); return err },
+	},
+	{
+		Name: "is_disabled", aliases: []string{"isdisabled", "disabled"},
+		examples: [2]string{"false", "true"},
+		set: func(r *Row, v string) (err error) {
+			r.isDisabled, err = parseBool(v)
+			r.disabledSet = strings.TrimSpace(v) != ""
+			return err
+		},
+	},
+	{
+		Name: "skip_fcnt_check", aliases: []string{"skipfcntcheck", "skipfcnt"},
+		examples: [2]string{"false", "false"},
+		set:      func(r *Row, v string) (err error) { r.skipFCntCheck, err = parseBool(v); return err },
+	},
+}
+
+// parseBool accepts the spellings of a boolean commonly found in
+// spreadsheets. An empty cell is false.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "no", "n", "0":
+		return false, nil
+	case "true", "yes", "y", "1":
+		return true, nil
+	}
+	return false, fmt.Errorf("expected true or false, got %q", s)
+}
+
+// Header prefixes mapping a column to a device tag or variable.
+const (
+	TagPrefix = "tag:"
+	VarPrefix = "var:"
+)
+
+// headerColumn is the mapping of one column of a tabular file.
+type headerColumn struct {
+	Name string // canonical field name, for messages
+	Set  func(row *Row, value string) error
+}
+
+// HeaderMap assigns a setter to each column of a tabular file. Columns that
+// don't map to a known field have a nil setter and are ignored.
+type HeaderMap []headerColumn
+
+// NormalizeHeader lower-cases h and drops everything but letters and digits,
+// so that "Dev EUI", "dev_eui" and "DevEUI" compare equal.
+func NormalizeHeader(h string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(h) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// lookupColumn returns the definition matching header h, or nil.
+func lookupColumn(h string) *ColumnDef {
+	n := NormalizeHeader(h)
+	for i := range ColumnDefs {
+		if NormalizeHeader(ColumnDefs[i].Name) == n {
+			return &ColumnDefs[i]
+		}
+		for _, alias := range ColumnDefs[i].aliases {
+			if alias == n {
+				return &ColumnDefs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// mapHeader builds a HeaderMap for the given header row. ok is false when the
+// header has no DevEUI column, in which case the file can't be read by name.
+func mapHeader(header []string) (m HeaderMap, ok bool) {
+	m = make(HeaderMap, len(header))
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		lower := strings.ToLower(h)
+
+		switch {
+		case strings.HasPrefix(lower, TagPrefix):
+			key := strings.TrimSpace(h[len(TagPrefix):])
+			m[i] = headerColumn{h, func(r *Row, v string) error { setMapValue(&r.Tags, key, v); return nil }}
+		case strings.HasPrefix(lower, VarPrefix):
+			key := strings.TrimSpace(h[len(VarPrefix):])
+			m[i] = headerColumn{h, func(r *Row, v string) error { setMapValue(&r.variables, key, v); return nil }}
+		default:
+			if def := lookupColumn(h); def != nil {
+				m[i] = headerColumn{def.Name, def.set}
+				ok = ok || def.Name == "dev_eui"
+			}
+		}
+	}
+	fromV3(header, m)
+	return m, ok
+}
+
+// fromV3 adapts m to the device lists exported from ChirpStack v3, whose
+// deviceProfileID and applicationID columns hold v3 IDs that don't exist
+// on a v4 server. The deviceProfileName column next to them is used for
+// the profile instead, and numeric application IDs are ignored, so that
+// the devices go into the selected application. The official import
+// format's columns are UUIDs and names, which are kept as they are.
+func fromV3(header []string, m HeaderMap) {
+	byName := slices.ContainsFunc(header, func(h string) bool { return NormalizeHeader(h) == "deviceprofilename" })
+	for i, h := range header {
+		switch NormalizeHeader(h) {
+		case "deviceprofileid":
+			if byName {
+				m[i].Set = nil
+			}
+		case "applicationid":
+			set := m[i].Set
+			m[i].Set = func(r *Row, v string) error {
+				if _, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64); err == nil {
+					return nil
+				}
+				return set(r, v)
+			}
+		}
+	}
+}
+
+func setMapValue(m *map[string]string, key, value string) {
+	if value == "" {
+		return
+	}
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[key] = value
+}
+
+// recordReader returns the next record of a tabular file and the line it
+// started on, or io.EOF.
+type recordReader func() (record []string, line int, err error)
+
+// trimRecords wraps next to trim every field of the records it returns and
+// to skip those left empty, such as the blank rows at the end of a sheet.
+func trimRecords(next recordReader) recordReader {
+	return func() ([]string, int, error) {
+		for {
+			record, line, err := next()
+			if err != nil {
+				return nil, 0, err
+			}
+			blank := true
+			for i, v := range record {
+				record[i] = strings.TrimSpace(v)
+				blank = blank && record[i] == ""
+			}
+			if !blank {
+				return record, line, nil
+			}
+		}
+	}
+}
+
+// rowsFromRecords converts the records of a tabular file into device rows.
+// A file whose first field is an EUI has no header and its columns are
+// positional: dev_eui, name and an optional description. Otherwise the first
+// record is a header, mapped by column name or by a saved mapping with the
+// same signature; a *HeaderError is returned when neither finds a DevEUI
+// column.
+func rowsFromRecords(next recordReader, s *scanner) error {
+	next = trimRecords(next)
+	first, line, err := next()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if lorakey.IsHex(lorakey.NormalizeEUI(first[0])) {
+		return rowsByPosition(first, line, next, s)
+	}
+
+	header, mapping, ok := FindHeader(first, s.batch.cfg.Mappings, s.batch.cfg.Mapping)
+	s.mapping = mapping
+	if !ok && s.batch.cfg.Mapping != nil {
+		return fmt.Errorf("mapping %q assigns no column of the header to dev_eui (%s)", mapping, strings.Join(first, ", "))
+	}
+	if !ok {
+		hErr := &HeaderError{Header: first}
+		if sample, _, err := next(); err == nil {
+			hErr.Sample = sample
+		}
+		return hErr
+	}
+	// A saved mapping leaves out the columns it was made to leave out.
+	if cfg := s.batch.cfg; mapping == "" && !cfg.Lenient {
+		if unknown := unknownColumns(first, header, cfg.IgnoreColumns); len(unknown) > 0 {
+			return fmt.Errorf("unknown columns in header: %s; rename them, skip them with --ignore-column or read the file with --lenient",
+				strings.Join(unknown, ", "))
+		}
+	}
+
+records:
+	for {
+		record, line, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		row := Row{Pos: RowPos{Line: line}}
+		for col, value := range record {
+			if col >= len(header) || header[col].Set == nil {
+				continue
+			}
+			if err := header[col].Set(&row, value); err != nil {
+				s.reject(fmt.Sprintf("%s: %v", row.Pos.Field(header[col].Name), err))
+				continue records
+			}
+		}
+		if err := s.add(row); err != nil {
+			return err
+		}
+	}
+}
+
+// reportColumns are the columns of the lists this tool writes, such as the
+// failed rows and exports, that explain rows rather than describe devices.
+// They map to no field but aren't unknown, so that the lists can be
+// imported again.
+var reportColumns = []string{"error", "remedy", "createdat", "lastseenat"}
+
+// unknownColumns lists the columns of header that m maps to no field,
+// except empty ones and those in ignored, with the closest known name where
+// one is close, e.g. `"devui" (did you mean dev_eui?)`.
+func unknownColumns(header []string, m HeaderMap, ignored []string) []string {
+	var unknown []string
+	for i, h := range header {
+		n := NormalizeHeader(h)
+		if h == "" || m[i].Set != nil || lookupColumn(h) != nil || slices.Contains(reportColumns, n) || slices.Contains(ignored, n) {
+			continue
+		}
+		desc := fmt.Sprintf("%q", h)
+		if name := closestColumn(h); name != "" {
+			desc += " (did you mean " + name + "?)"
+		}
+		unknown = append(unknown, desc)
+	}
+	return unknown
+}
+
+// closestColumn returns the name of the known column whose name or alias
+// is closest to h, if any is within a couple of edits of it.
+func closestColumn(h string) string {
+	n := NormalizeHeader(h)
+	best, bestDist := "", max(2, len(n)/4)+1
+	for _, def := range ColumnDefs {
+		for _, name := range append([]string{NormalizeHeader(def.Name)}, def.aliases...) {
+			if d := editDistance(n, name); d < bestDist {
+				best, bestDist = def.Name, d
+			}
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// FindHeader maps the columns of header with the mapping chosen for every
+// file, if any, or the first of mappings made for a header of the same
+// signature, whose name is returned. Otherwise the columns are mapped by
+// name.
+func FindHeader(header []string, mappings []ColumnMapping, chosen *ColumnMapping) (m HeaderMap, mapping string, ok bool) {
+	if chosen != nil {
+		m, ok = chosen.headerMap(header)
+		return m, chosen.Name, ok
+	}
+	sig := HeaderSignature(header)
+	for _, cm := range mappings {
+		if cm.Signature == sig {
+			if m, ok = cm.headerMap(header); ok {
+				return m, cm.Name, true
+			}
+		}
+	}
+	m, ok = mapHeader(header)
+	return m, "", ok
+}
+
+// rowsByPosition reads a headerless file, starting with the record already
+// read by rowsFromRecords.
+func rowsByPosition(record []string, line int, next recordReader, s *scanner) error {
+	for {
+		// A missing name is caught by validation unless a name template
+		// fills it in.
+		row := Row{
+			Pos:    RowPos{Line: line},
+			DevEUI: record[0],
+		}
+		if len(record) > 1 {
+			row.Name = record[1]
+		}
+		if len(record) > 2 {
+			row.Description = record[2]
+		}
+		if err := s.add(row); err != nil {
+			return err
+		}
+
+		var err error
+		if record, line, err = next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fixtureHeader returns the header row of the device list testdata/name.
+func fixtureHeader(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// mappedNames returns the field each column of m is read into, "" for the
+// ignored ones.
+func mappedNames(m HeaderMap) []string {
+	names := make([]string, len(m))
+	for i, c := range m {
+		if c.Set != nil {
+			names[i] = c.Name
+		}
+	}
+	return names
+}
+
+func TestMapHeaderV3Export(t *testing.T) {
+	m, ok := mapHeader(fixtureHeader(t, "v3-export.csv"))
+	if !ok {
+		t.Fatal("mapHeader found no dev_eui column")
+	}
+	// The v3 deviceProfileID gives way to deviceProfileName.
+	want := []string{"dev_eui", "name", "description", "application", "", "device_profile", "app_key", "skip_fcnt_check", "is_disabled"}
+	if got := mappedNames(m); !slices.Equal(got, want) {
+		t.Errorf("mapped columns = %q, want %q", got, want)
+	}
+
+	in := readList(t, filepath.Join("testdata", "v3-export.csv"), ListOptions{})
+	if in.Count != 2 || len(in.Invalid) != 0 {
+		t.Fatalf("Count = %d, Invalid = %q; want 2 valid rows", in.Count, in.Invalid)
+	}
+	r := in.Rows[1]
+	if r.Profile != "LSE01-EU868" || r.application != "" || r.AppKey != "ffeeddccbbaa99887766554433221100" || !r.skipFCntCheck {
+		t.Errorf("second row = %+v, want the profile by name and no numeric application", r)
+	}
+}
+
+func TestMapHeaderChirpStackImport(t *testing.T) {
+	m, ok := mapHeader(fixtureHeader(t, "chirpstack-import.csv"))
+	if !ok {
+		t.Fatal("mapHeader found no dev_eui column")
+	}
+	want := []string{"dev_eui", "join_eui", "application", "device_profile", "name", "description", "nwk_key"}
+	if got := mappedNames(m); !slices.Equal(got, want) {
+		t.Errorf("mapped columns = %q, want %q", got, want)
+	}
+
+	in := readList(t, filepath.Join("testdata", "chirpstack-import.csv"), ListOptions{})
+	if in.Count != 2 || len(in.Invalid) != 0 {
+		t.Fatalf("Count = %d, Invalid = %q; want 2 valid rows", in.Count, in.Invalid)
+	}
+	r := in.Rows[0]
+	if r.application != "5e3e4d1c-6a0f-4d3b-9e0a-3c2f9d2f8a11" || r.Profile != "b7a1c9d4-2f3e-4a5b-8c6d-7e8f9a0b1c2d" || r.JoinEUI != "0000000000000000" {
+		t.Errorf("first row = %+v, want the application and device profile IDs kept", r)
+	}
+}
+
+func TestReadHeaderlessWithSeparators(t *testing.T) {
+	path := writeList(t, "devices.csv", "70-B3-D5-7E-D0-00-00-01,sensor 1\n0x70b3d57ed0000002,sensor 2\n")
+	in := readList(t, path, ListOptions{})
+	if in.Count != 2 || len(in.Invalid) != 0 {
+		t.Fatalf("Count = %d, Invalid = %q; want both rows read without a header", in.Count, in.Invalid)
+	}
+	if in.Rows[0].DevEUI != "70b3d57ed0000001" || in.Rows[0].Name != "sensor 1" {
+		t.Errorf("first row = %+v", in.Rows[0])
+	}
+}
@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// utf8BOM is prepended to CSV files by Excel on Windows.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Delimiters we are willing to guess when no --delimiter is given, in order
+// of preference when counts are tied.
+var candidateDelimiters = []rune{',', ';', '\t', '|'}
+
+// CSVFormat describes how an input file was interpreted.
+type CSVFormat struct {
+	Delimiter rune
+	columns   int
+}
+
+func (f CSVFormat) String() string {
+	return fmt.Sprintf("%s-delimited, %d columns", delimiterName(f.Delimiter), f.columns)
+}
+
+// ParseDelimiter converts the --delimiter flag value to a rune. An empty
+// value means the delimiter should be sniffed from the file.
+func ParseDelimiter(s string) (rune, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return 0, nil
+	case ",", "comma":
+		return ',', nil
+	case ";", "semicolon":
+		return ';', nil
+	case "\t", `\t`, "tab":
+		return '\t', nil
+	case "|", "pipe":
+		return '|', nil
+	}
+	return 0, fmt.Errorf("unsupported delimiter %q (use comma, semicolon, tab or pipe)", s)
+}
+
+// ParseEncoding converts the --encoding flag value to a decoder. A nil
+// encoding means the input is read as UTF-8.
+func ParseEncoding(s string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.ReplaceAll(s, "_", "-")) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	case "latin-1", "latin1", "iso-8859-1":
+		return charmap.ISO8859_1, nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q (use utf-8, latin-1 or windows-1252)", s)
+}
+
+func delimiterName(r rune) string {
+	switch r {
+	case ',':
+		return "comma"
+	case ';':
+		return "semicolon"
+	case '\t':
+		return "tab"
+	case '|':
+		return "pipe"
+	}
+	return fmt.Sprintf("%q", r)
+}
+
+// sniffDelimiter peeks at the first non-empty line of br and returns the
+// candidate delimiter occurring most often outside of quoted fields. It falls
+// back to a comma when the line contains none of the candidates.
+func sniffDelimiter(br *bufio.Reader) rune {
+	line := firstNonEmptyLine(br)
+
+	best, bestCount := ',', 0
+	for _, d := range candidateDelimiters {
+		if n := countUnquoted(line, d); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
+
+// firstNonEmptyLine returns the first line of br containing anything other
+// than whitespace or a comment without consuming any input. Only the buffered
+// prefix of the file is inspected, which is plenty for a header or first
+// record.
+func firstNonEmptyLine(br *bufio.Reader) string {
+	buf, _ := br.Peek(br.Size())
+	for _, line := range strings.Split(string(buf), "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+func countUnquoted(line string, d rune) int {
+	n, quoted := 0, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// readDelimited reads a delimited device list one record at a time. The
+// input is decoded according to the configured encoding and a leading byte
+// order mark is stripped. Lines that are not valid UTF-8 are reported as
+// warnings rather than errors so that the rest of the file can still be
+// imported.
+func readDelimited(r io.Reader, s *scanner) error {
+	reader, format := NewDelimitedReader(r, s.batch.cfg)
+
+	var badLines []int
+	err := rowsFromRecords(func() ([]string, int, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if format.columns == 0 {
+			format.columns = len(record)
+		}
+		for _, field := range record {
+			if !utf8.ValidString(field) {
+				badLines = append(badLines, line)
+				break
+			}
+		}
+		return record, line, nil
+	}, s)
+	if err != nil {
+		return err
+	}
+
+	s.setFormat(format.String())
+	if len(badLines) > 0 {
+		s.in.Warnings = append(s.in.Warnings, fmt.Sprintf(
+			"%s not valid UTF-8; re-run with --encoding windows-1252 if the file was exported from Excel",
+			describeLines(badLines)))
+	}
+	return nil
+}
+
+// NewDelimitedReader returns a CSV reader for r, decoding it according to
+// the configured encoding, stripping a byte order mark and sniffing the
+// delimiter unless one is configured.
+func NewDelimitedReader(r io.Reader, cfg ListOptions) (*csv.Reader, CSVFormat) {
+	if cfg.Encoding != nil {
+		r = cfg.Encoding.NewDecoder().Reader(r)
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	if prefix, _ := br.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	format := CSVFormat{Delimiter: cfg.Delimiter}
+	if format.Delimiter == 0 {
+		format.Delimiter = sniffDelimiter(br)
+	}
+
+	reader := csv.NewReader(br)
+	reader.Comma = format.Delimiter
+	reader.Comment = '#'
+	// Rows may have fewer or more fields than the header, as spreadsheets
+	// drop empty trailing cells; missing ones are empty.
+	reader.FieldsPerRecord = -1
+	return reader, format
+}
+
+// describeLines formats a list of line numbers for a warning, eliding the
+// tail of long lists.
+func describeLines(lines []int) string {
+	const max = 10
+
+	parts := make([]string, 0, max)
+	for i, l := range lines {
+		if i == max {
+			parts = append(parts, fmt.Sprintf("and %d more", len(lines)-max))
+			break
+		}
+		parts = append(parts, fmt.Sprint(l))
+	}
+
+	if len(lines) == 1 {
+		return "line " + parts[0] + " is"
+	}
+	return "lines " + strings.Join(parts, ", ") + " are"
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	for in, want := range map[string]rune{"": 0, ",": ',', "Semicolon": ';', `\t`: '\t', "tab": '\t', "|": '|'} {
+		got, err := ParseDelimiter(in)
+		if err != nil || got != want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseDelimiter(":"); err == nil {
+		t.Error(`ParseDelimiter(":") succeeded`)
+	}
+}
+
+func TestNewDelimitedReader(t *testing.T) {
+	for _, tc := range []struct {
+		name, in string
+		want     rune
+	}{
+		{"comma", "dev_eui,name\n70b3d57ed0000001,a\n", ','},
+		{"semicolon", "dev_eui;name\n70b3d57ed0000001;a, b\n", ';'},
+		{"tab", "dev_eui\tname\n70b3d57ed0000001\ta\n", '\t'},
+		{"pipe", "dev_eui|name\n70b3d57ed0000001|a\n", '|'},
+		{"quoted commas", "dev_eui;name\n70b3d57ed0000001;\"a,b,c\"\n", ';'},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, format := NewDelimitedReader(strings.NewReader(tc.in), ListOptions{})
+			if format.Delimiter != tc.want {
+				t.Errorf("delimiter = %q, want %q", format.Delimiter, tc.want)
+			}
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 || len(records[1]) != 2 {
+				t.Errorf("records = %q", records)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags([]string{"site=hall 1, floor = 2", "batch=7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 3 || tags["site"] != "hall 1" || tags["floor"] != "2" || tags["batch"] != "7" {
+		t.Errorf("ParseTags = %v", tags)
+	}
+	if _, err := ParseTags([]string{"site"}); err == nil {
+		t.Error(`ParseTags("site") succeeded`)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, md := range []Mode{ModeImport, ModeDelete, ModeUpdate, ModeSync, ModeMove, ModeRotate, ModeToggle} {
+		got, err := ParseMode(md.String())
+		if err != nil || got != md {
+			t.Errorf("ParseMode(%q) = %v, %v", md.String(), got, err)
+		}
+	}
+	if got, err := ParseMode(""); err != nil || got != ModeImport {
+		t.Errorf(`ParseMode("") = %v, %v; want import`, got, err)
+	}
+	if _, err := ParseMode("purge"); err == nil {
+		t.Error(`ParseMode("purge") succeeded`)
+	}
+}
@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ParseTags reads global tags, "key=value", given once per --tag or
+// separated by commas as on the confirmation screen.
+func ParseTags(list []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, s := range list {
+		for _, pair := range strings.Split(s, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			k = strings.TrimSpace(k)
+			if !ok || k == "" {
+				return nil, fmt.Errorf("tag %q must be key=value", pair)
+			}
+			tags[k] = strings.TrimSpace(v)
+		}
+	}
+	return tags, nil
+}
+
+// DescriptionTemplate is the description of rows without one, e.g.
+// "PO 2024-117, imported {date} from {filename}".
+type DescriptionTemplate string
+
+// ParseDescriptionTemplate checks that every placeholder in s is known.
+func ParseDescriptionTemplate(s string) (DescriptionTemplate, error) {
+	for _, m := range namePlaceholder.FindAllStringSubmatch(s, -1) {
+		if (m[1] != "date" && m[1] != "filename") || m[2] != "" {
+			return "", fmt.Errorf("description template: unknown placeholder %s (use {date} or {filename})", m[0])
+		}
+	}
+	return DescriptionTemplate(s), nil
+}
+
+// expand returns the description of a device imported on day from source.
+func (t DescriptionTemplate) expand(source string, day time.Time) string {
+	return namePlaceholder.ReplaceAllStringFunc(string(t), func(p string) string {
+		switch p {
+		case "{date}":
+			return day.Format(time.DateOnly)
+		case "{filename}":
+			return sourceName(source)
+		}
+		return p
+	})
+}
+
+// sourceName returns the file name of a device list, which for a download
+// is the last element of its URL path.
+func sourceName(source string) string {
+	switch {
+	case source == "-":
+		return "stdin"
+	case IsURL(source):
+		if u, err := url.Parse(source); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+	return filepath.Base(source)
+}
+
+// applyDefaults merges the global tags into those of row, whose own values
+// win, and gives it the default description if it has none. Only rows of
+// devices to create or sync get them. Rows to enable or disable without an
+// is_disabled value get the state of --enable or --disable.
+func (s *scanner) applyDefaults(row *Row) {
+	cfg := s.batch.cfg
+	if cfg.Mode == ModeToggle && !row.disabledSet && cfg.Disable != nil {
+		row.isDisabled, row.disabledSet = *cfg.Disable, true
+	}
+	if !cfg.Mode.Creates() {
+		return
+	}
+	if len(cfg.Tags) > 0 {
+		tags := maps.Clone(cfg.Tags)
+		maps.Copy(tags, row.Tags)
+		row.Tags = tags
+	}
+	if row.Description == "" && cfg.Description != "" {
+		row.Description = cfg.Description.expand(s.in.Source, s.batch.started)
+	}
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// Mode is what is done with the devices of a device list.
+type Mode int
+
+const (
+	ModeImport  Mode = iota // create the devices
+	ModeDelete              // delete the devices
+	ModeSync                // make the application match the list
+	ModeCompare             // report how the list differs, without changing anything
+	ModeToggle              // enable or disable the devices
+	ModeUpdate              // change the fields the list has values for
+	ModeMove                // move the devices to another application
+	ModeStatus              // report whether the devices are alive, without changing anything
+	ModeRotate              // replace the root keys of the devices with new ones
+	ModeQR                  // write the QR codes of the devices, without the server
+)
+
+var modeNames = []string{"import", "delete", "sync", "compare", "toggle", "update", "move", "status", "rotate", "qr"}
+
+func (md Mode) String() string {
+	return modeNames[md]
+}
+
+// Title returns the name of md for headings, e.g. "Sync".
+func (md Mode) Title() string {
+	if md == ModeQR {
+		return "QR codes"
+	}
+	name := md.String()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// Next returns the mode after md, for switching modes in the file picker.
+func (md Mode) Next() Mode {
+	return (md + 1) % Mode(len(modeNames))
+}
+
+// Creates reports whether devices may be created in mode md.
+func (md Mode) Creates() bool {
+	return md == ModeImport || md == ModeSync
+}
+
+// ReadOnly reports whether mode md changes nothing on the server, reporting
+// on the list rather than running it.
+func (md Mode) ReadOnly() bool {
+	return md == ModeCompare || md == ModeStatus || md == ModeQR
+}
+
+// NeedsProfile reports whether mode md needs a device profile, which is the
+// case when it creates devices.
+func (md Mode) NeedsProfile() bool {
+	return md.Creates()
+}
+
+// Verb returns what is done to each device, for messages such as "3 devices
+// to delete".
+func (md Mode) Verb() string {
+	switch md {
+	case ModeDelete:
+		return "delete"
+	case ModeSync:
+		return "sync"
+	case ModeCompare:
+		return "compare"
+	case ModeToggle:
+		return "enable or disable"
+	case ModeUpdate:
+		return "update"
+	case ModeMove:
+		return "move"
+	case ModeStatus:
+		return "check"
+	case ModeRotate:
+		return "rotate the keys of"
+	case ModeQR:
+		return "write QR codes for"
+	}
+	return "create"
+}
+
+// PastTense returns what was done to a device, e.g. "Deleted".
+func (md Mode) PastTense() string {
+	switch md {
+	case ModeDelete:
+		return "Deleted"
+	case ModeSync:
+		return "Synced"
+	case ModeCompare:
+		return "Compared"
+	case ModeToggle:
+		return "Toggled"
+	case ModeUpdate:
+		return "Updated"
+	case ModeMove:
+		return "Moved"
+	case ModeStatus:
+		return "Checked"
+	case ModeRotate:
+		return "Rotated"
+	case ModeQR:
+		return "Encoded"
+	}
+	return "Created"
+}
+
+// Gerund returns what is being done to the devices, e.g. "Deleting".
+func (md Mode) Gerund() string {
+	switch md {
+	case ModeDelete:
+		return "Deleting"
+	case ModeSync:
+		return "Syncing"
+	case ModeCompare:
+		return "Comparing"
+	case ModeToggle:
+		return "Toggling"
+	case ModeUpdate:
+		return "Updating"
+	case ModeMove:
+		return "Moving"
+	case ModeStatus:
+		return "Checking"
+	case ModeRotate:
+		return "Rotating"
+	case ModeQR:
+		return "Encoding"
+	}
+	return "Creating"
+}
+
+// ParseMode parses the --mode flag.
+func ParseMode(s string) (Mode, error) {
+	if s == "" {
+		return ModeImport, nil
+	}
+	if i := slices.Index(modeNames, s); i >= 0 {
+		return Mode(i), nil
+	}
+	return 0, fmt.Errorf("unknown mode %q, expected one of %s", s, strings.Join(modeNames, ", "))
+}
+
+// deleteRow deletes the device of row and records the outcome in res. A
+// device that doesn't exist is counted as already absent rather than failed.
+func (imp *Importer) deleteRow(ctx context.Context, row Row, res *Result) error {
+	err := imp.remove(ctx, row)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		res.Absent++
+		return nil
+	case err != nil:
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+		return err
+	}
+	res.Removed = append(res.Removed, row)
+	return nil
+}
+
+// remove deletes the device of row, after making sure that it belongs to the
+// application the row would be imported into: a DevEUI typed into the wrong
+// list mustn't take out a device of another application. On a dry run the
+// device is only looked up.
+func (imp *Importer) remove(ctx context.Context, row Row) error {
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return err
+	}
+
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	if err == nil && resp.Device.GetApplicationId() != appID {
+		err = fmt.Errorf("device belongs to application %s, not %s", resp.Device.GetApplicationId(), appID)
+	}
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_Delete_FullMethodName, &api.DeleteDeviceRequest{DevEui: row.DevEUI}, err)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := imp.Devices.Delete(ctx, &api.DeleteDeviceRequest{DevEui: row.DevEUI}); err != nil {
+		imp.logRow(row).Error("Failed to delete the device", "rpc", api.DeviceService_Delete_FullMethodName, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Selectable reports whether mode md can run over the devices of the
+// application that match a tagFilter, rather than over a device list.
+func (md Mode) Selectable() bool {
+	return md == ModeDelete || md == ModeToggle || md == ModeMove || md == ModeRotate
+}
@@ -0,0 +1,19 @@
+package importer
+
+import "errors"
+
+// Consent is the go-ahead for something that can't be undone: deleting
+// devices or replacing their keys. It comes from typing the phrase of a
+// typedConfirm, or from --yes-destructive in headless mode. The importer and
+// undoImport refuse to go on without one, so that no screen can forget to
+// ask.
+type Consent struct{}
+
+// ErrUnconfirmed is returned for a destructive run without consent.
+var ErrUnconfirmed = errors.New("deleting devices or replacing keys needs to be confirmed first")
+
+// destroys reports whether imp deletes devices or replaces the keys of
+// existing ones, including by rotating them.
+func (imp *Importer) destroys() bool {
+	return !imp.DryRun && (imp.Mode == ModeDelete || imp.Mode == ModeRotate || imp.Mode.Creates() && imp.OverwriteKeys)
+}
@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// Range of the application FPorts a downlink can be sent on
+const (
+	minFPort = 1
+	maxFPort = 223
+)
+
+// Downlink is the payload enqueued for every created device, e.g. a
+// configuration command. Rows can bring their own in the downlink_payload
+// and downlink_fport columns.
+type Downlink struct {
+	Data      []byte // nil to enqueue nothing for rows without a payload
+	FPort     uint32
+	Confirmed bool
+}
+
+// ParseDownlink converts the --downlink flags. An empty payload enqueues
+// nothing unless a row has its own.
+func ParseDownlink(payload string, fPort uint, confirmed bool) (Downlink, error) {
+	d := Downlink{FPort: uint32(fPort), Confirmed: confirmed}
+	if fPort < minFPort || fPort > maxFPort {
+		return d, fmt.Errorf("--downlink-fport must be between %d and %d", minFPort, maxFPort)
+	}
+	if payload == "" {
+		return d, nil
+	}
+	data, err := decodePayload(payload)
+	if err != nil {
+		return d, fmt.Errorf("--downlink: %w", err)
+	}
+	d.Data = data
+	return d, nil
+}
+
+// decodePayload decodes a hex payload, allowing a 0x prefix and spaces
+// between the bytes.
+func decodePayload(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(s), " ", ""), "0x")
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("must be an even number of hex characters")
+	}
+	return data, nil
+}
+
+// parseFPort reads a downlink_fport cell. An empty cell means the default
+// FPort.
+func parseFPort(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n < minFPort || n > maxFPort {
+		return 0, fmt.Errorf("must be a number between %d and %d", minFPort, maxFPort)
+	}
+	return uint32(n), nil
+}
+
+// downlinkFor returns the queue item for a device created from row: its own
+// payload, or the one of every device. ok is false when there is none.
+func (imp *Importer) downlinkFor(row Row) (item *api.DeviceQueueItem, ok bool) {
+	data := imp.Downlink.Data
+	if row.downlinkPayload != "" {
+		// Checked by ValidateRow already.
+		data, _ = decodePayload(row.downlinkPayload)
+	}
+	if data == nil {
+		return nil, false
+	}
+
+	fPort := imp.Downlink.FPort
+	if row.downlinkFPort != 0 {
+		fPort = row.downlinkFPort
+	}
+	return &api.DeviceQueueItem{
+		DevEui:    row.DevEUI,
+		Confirmed: imp.Downlink.Confirmed,
+		FPort:     fPort,
+		Data:      data,
+	}, true
+}
+
+// enqueue queues the downlink of a device just created from row, if it has
+// one, and records the outcome in res.
+func (imp *Importer) enqueue(ctx context.Context, row Row, res *Result) {
+	item, ok := imp.downlinkFor(row)
+	if !ok {
+		return
+	}
+	if _, err := imp.Devices.Enqueue(ctx, &api.EnqueueDeviceQueueItemRequest{QueueItem: item}); err != nil {
+		imp.logRow(row).Error("Failed to enqueue the downlink", "rpc", api.DeviceService_Enqueue_FullMethodName, "err", err)
+		res.EnqueueFailures = append(res.EnqueueFailures, RowFailure{Row: row, Err: err})
+		return
+	}
+	res.Enqueued++
+}
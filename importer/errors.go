@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// explanation is a failed row described for the people running the import
+// rather than for whoever debugs it, e.g. "already registered (maybe under
+// another application or tenant)". The log file keeps the raw error.
+type explanation struct {
+	text   string
+	remedy string // what to do about it, if anything helps
+}
+
+// String joins the text and the remedy.
+func (e explanation) String() string {
+	if e.remedy == "" {
+		return e.text
+	}
+	return e.text + " – " + e.remedy
+}
+
+// explainError classifies err by its gRPC status code and the messages
+// ChirpStack is known to send. The server reports some problems with a code
+// that doesn't match, e.g. "object already exists" as InvalidArgument, so
+// the message is checked first. Errors it doesn't recognise are shortened to
+// their code and message.
+func explainError(err error) explanation {
+	s, ok := status.FromError(err)
+	if !ok {
+		return explanation{text: err.Error()}
+	}
+	msg := strings.ToLower(s.Message())
+
+	switch {
+	case isQuotaError(err):
+		return explanation{"the tenant has reached its device limit",
+			"ask an administrator to raise it, or delete unused devices"}
+	case s.Code() == codes.AlreadyExists || strings.Contains(msg, "already exists"):
+		return explanation{"already registered (maybe under another application or tenant)",
+			"delete it first, or run a sync to update it"}
+	case s.Code() == codes.InvalidArgument && strings.Contains(msg, "eui"):
+		return explanation{"EUI is not 16 hex characters", "fix the EUI in the list"}
+	case s.Code() == codes.InvalidArgument && strings.Contains(msg, "key"):
+		return explanation{"key is not 32 hex characters", "fix the key in the list"}
+	case s.Code() == codes.NotFound && strings.Contains(msg, "device profile"):
+		return explanation{"the device profile doesn't exist", "check the device profile name or ID"}
+	case s.Code() == codes.NotFound && strings.Contains(msg, "application"):
+		return explanation{"the application doesn't exist", "check the application name or ID"}
+	case s.Code() == codes.NotFound:
+		return explanation{"not found on the server", ""}
+	case s.Code() == codes.PermissionDenied:
+		return explanation{"token lacks device-write permission for this tenant",
+			"use a tenant or admin API key with write access"}
+	case s.Code() == codes.Unauthenticated:
+		return explanation{"the API token is invalid or has expired", "create a new API key"}
+	case s.Code() == codes.Unavailable:
+		text := "the server can't be reached"
+		if _, how, ok := strings.Cut(s.Message(), "while dialing: "); ok {
+			// How it was tried, see route.dial
+			text += " (" + strings.TrimSuffix(how, `"`) + ")"
+		}
+		return explanation{text, "check the connection and --server"}
+	case s.Code() == codes.DeadlineExceeded:
+		return explanation{"the server took too long to answer", "try again later"}
+	case s.Code() == codes.Canceled:
+		return explanation{"cancelled", ""}
+	}
+	return explanation{text: s.Code().String() + ": " + s.Message()}
+}
+
+// DescribeError explains err for display, with any secrets it quotes
+// masked; see explainError.
+func DescribeError(err error) string {
+	return redact.Secrets(explainError(err).String())
+}
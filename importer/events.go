@@ -0,0 +1,196 @@
+package importer
+
+import "sync"
+
+// Event is something that happened during an import, reported in
+// order through an EventStream: RunStarted first, then RowFinished,
+// ChunkCommitted and RunPaused as they happen, and RunFinished last.
+type Event interface {
+	// progressOnly reports whether the event can be dropped when the
+	// consumer falls behind, as a later one makes up for it.
+	progressOnly() bool
+}
+
+// RunStarted starts an import of total rows.
+type RunStarted struct {
+	Total int
+}
+
+// RowFinished is a row that has been processed, with what became of it and
+// the error that made it fail or be skipped, if any. Done counts the rows
+// finished so far, this one included, whether or not the events of the
+// others were dropped.
+type RowFinished struct {
+	Source string
+	Row    Row
+	Status RowStatus
+	Err    error
+	Done   int
+}
+
+// RowStatus is what became of a row.
+type RowStatus int
+
+const (
+	StatusCreated   RowStatus = iota // its device was created
+	StatusUpdated                    // its device was changed, e.g. given its keys, moved or rotated
+	StatusSkipped                    // it was left alone with a warning
+	StatusUnchanged                  // its device already was as the row asks
+	StatusFailed                     // it failed
+	StatusRemoved                    // its device was deleted
+)
+
+var statusNames = []string{"created", "updated", "skipped", "unchanged", "failed", "removed"}
+
+func (s RowStatus) String() string {
+	return statusNames[s]
+}
+
+// ChunkCommitted is a chunk whose records have been flushed to disk, see
+// Importer.endChunk.
+type ChunkCommitted ChunkTiming
+
+// RunPaused reports that the import stopped starting rows for a pause, or
+// went on once Held turns false. The rows in flight finish in either case.
+type RunPaused struct {
+	Held bool
+}
+
+// RunFinished ends an import with its outcome, and the error that stopped
+// it early, if any: a run can stop with some of its rows done. Report has
+// every row, those of dropped events included. Unlisted is what a sync did
+// to the devices no list has. Dropped counts the events the consumer fell
+// too far behind to get; the stream sets it.
+type RunFinished struct {
+	Results  []FileResult
+	Report   Report
+	Unlisted Result
+	Err      error
+	Dropped  int
+}
+
+func (RunStarted) progressOnly() bool     { return false }
+func (RowFinished) progressOnly() bool    { return true }
+func (ChunkCommitted) progressOnly() bool { return true }
+func (RunPaused) progressOnly() bool      { return false }
+func (RunFinished) progressOnly() bool    { return false }
+
+// EventStream passes the events of an import on to deliver, one at a time
+// and in order, without ever holding up the import: events wait in a buffer
+// of the given size while deliver is busy. When the buffer is full the
+// oldest progress-only event is dropped to make room; the others are kept
+// even beyond its size. A nil *EventStream drops everything.
+type EventStream struct {
+	deliver func(Event)
+	size    int
+
+	mu         sync.Mutex
+	changed    *sync.Cond // signalled on every change to the fields below
+	queue      []Event
+	delivering bool // deliver is running
+	closed     bool // no more events will be emitted
+	stopped    bool // every event has been delivered after closing
+	rows       int  // RowFinished events emitted, for their Done count
+	dropped    int
+}
+
+// NewEventStream starts delivering the events emitted to deliver, buffering
+// up to size of them.
+func NewEventStream(size int, deliver func(Event)) *EventStream {
+	s := &EventStream{deliver: deliver, size: max(size, 1)}
+	s.changed = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+func (s *EventStream) run() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for len(s.queue) == 0 && !s.closed {
+			s.changed.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.stopped = true
+			s.changed.Broadcast()
+			return
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		s.delivering = true
+		s.mu.Unlock()
+		s.deliver(e)
+		s.mu.Lock()
+		s.delivering = false
+		s.changed.Broadcast()
+	}
+}
+
+// Emit queues e for delivery. It never blocks for long, however far behind
+// deliver is.
+func (s *EventStream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.push(e)
+}
+
+// push queues e, making room for it first if the buffer is full. The caller
+// holds s.mu.
+func (s *EventStream) push(e Event) {
+	if s.closed {
+		return
+	}
+	if len(s.queue) >= s.size {
+		for i, q := range s.queue {
+			if q.progressOnly() {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				s.dropped++
+				break
+			}
+		}
+	}
+	switch e := e.(type) {
+	case RowFinished:
+		s.rows++
+		e.Done = s.rows
+		s.queue = append(s.queue, e)
+	case RunFinished:
+		e.Dropped = s.dropped
+		s.queue = append(s.queue, e)
+	default:
+		s.queue = append(s.queue, e)
+	}
+	s.changed.Broadcast()
+}
+
+// Flush waits until the events emitted so far have been delivered, e.g.
+// before sending the consumer something else that has to come after them.
+func (s *EventStream) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) > 0 || s.delivering {
+		s.changed.Wait()
+	}
+}
+
+// Finish emits r, the last event, and waits until it has been delivered.
+// Events emitted later are dropped.
+func (s *EventStream) Finish(r RunFinished) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.push(r)
+	s.closed = true
+	s.changed.Broadcast()
+	for !s.stopped {
+		s.changed.Wait()
+	}
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"sync"
+	"testing"
+)
+
+// collect returns a stream of the given size, a lock that holds its
+// deliveries back while held, and a function returning the events
+// delivered so far.
+func collect(size int) (*EventStream, *sync.Mutex, func() []Event) {
+	var mu sync.Mutex
+	var gate sync.Mutex
+	var got []Event
+	s := NewEventStream(size, func(e Event) {
+		gate.Lock()
+		gate.Unlock()
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, e)
+	})
+	return s, &gate, func() []Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Event(nil), got...)
+	}
+}
+
+func TestEventStreamOrder(t *testing.T) {
+	s, _, events := collect(16)
+	s.Emit(RunStarted{Total: 3})
+	for _, eui := range []string{"01", "02", "03"} {
+		s.Emit(RowFinished{Source: "a.csv", Row: Row{DevEUI: eui}})
+	}
+	s.Emit(RunPaused{Held: true})
+	s.Flush()
+	if n := len(events()); n != 5 {
+		t.Fatalf("Flush returned with %d events delivered, want 5", n)
+	}
+	s.Finish(RunFinished{})
+	s.Emit(RowFinished{}) // after the end, dropped
+
+	got := events()
+	if len(got) != 6 {
+		t.Fatalf("delivered %d events, want 6: %+v", len(got), got)
+	}
+	if _, ok := got[0].(RunStarted); !ok {
+		t.Errorf("first event = %T, want RunStarted", got[0])
+	}
+	for i := 1; i <= 3; i++ {
+		r, ok := got[i].(RowFinished)
+		if !ok || r.Done != i {
+			t.Errorf("event %d = %+v, want RowFinished with Done %d", i, got[i], i)
+		}
+	}
+	if p, ok := got[4].(RunPaused); !ok || !p.Held {
+		t.Errorf("event 4 = %+v, want RunPaused{Held: true}", got[4])
+	}
+	if f, ok := got[5].(RunFinished); !ok || f.Dropped != 0 {
+		t.Errorf("last event = %+v, want RunFinished with nothing dropped", got[5])
+	}
+}
+
+func TestEventStreamDropsProgress(t *testing.T) {
+	s, gate, events := collect(4)
+	gate.Lock()
+	s.Emit(RunStarted{Total: 20})
+	for i := 0; i < 10; i++ {
+		s.Emit(RowFinished{})
+	}
+	s.Emit(RunPaused{Held: true})
+	for i := 0; i < 10; i++ {
+		s.Emit(RowFinished{})
+	}
+	gate.Unlock()
+	s.Finish(RunFinished{})
+
+	got := events()
+	rows, paused, last := 0, 0, 0
+	for _, e := range got {
+		switch e := e.(type) {
+		case RowFinished:
+			rows++
+			if e.Done <= last {
+				t.Errorf("Done went from %d to %d", last, e.Done)
+			}
+			last = e.Done
+		case RunPaused:
+			paused++
+		}
+	}
+	if _, ok := got[0].(RunStarted); !ok {
+		t.Errorf("first event = %T, want RunStarted", got[0])
+	}
+	if paused != 1 {
+		t.Errorf("delivered %d RunPaused, want 1", paused)
+	}
+	if last != 20 {
+		t.Errorf("last Done = %d, want 20", last)
+	}
+	f, ok := got[len(got)-1].(RunFinished)
+	if !ok {
+		t.Fatalf("last event = %T, want RunFinished", got[len(got)-1])
+	}
+	if f.Dropped == 0 || rows+f.Dropped != 20 {
+		t.Errorf("delivered %d rows and dropped %d, want 20 in all with some dropped", rows, f.Dropped)
+	}
+}
+
+func TestEventStreamNil(t *testing.T) {
+	var s *EventStream
+	s.Emit(RunStarted{})
+	s.Flush()
+	s.Finish(RunFinished{})
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FailureLimit stops an import once so many rows have failed that the rest
+// would most likely fail too, e.g. when the token lacks permission. The zero
+// value never stops.
+type FailureLimit struct {
+	Count   int     // failures to stop after
+	percent float64 // of the rows, instead of count
+}
+
+// failureLimits are the choices the confirmation screen cycles through.
+var failureLimits = []FailureLimit{{}, {Count: 1}, {Count: 20}, {percent: 10}}
+
+// ParseFailureLimit reads --max-failures: a number of failures, or a
+// percentage of the rows such as "5%". Empty or 0 means no limit.
+func ParseFailureLimit(s string) (FailureLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return FailureLimit{}, nil
+	}
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		n, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || n <= 0 || n > 100 {
+			return FailureLimit{}, fmt.Errorf("--max-failures: %q is not a percentage between 0 and 100", s)
+		}
+		return FailureLimit{percent: n}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return FailureLimit{}, fmt.Errorf("--max-failures: %q is not a number of failures or a percentage", s)
+	}
+	return FailureLimit{Count: n}, nil
+}
+
+// reached reports whether failed failures out of rows rows trip the limit.
+func (l FailureLimit) reached(failed, rows int) bool {
+	switch {
+	case l.Count > 0:
+		return failed >= l.Count
+	case l.percent > 0:
+		return failed >= max(int(math.Ceil(l.percent*float64(rows)/100)), 1)
+	}
+	return false
+}
+
+// String describes the limit for the confirmation screen.
+func (l FailureLimit) String() string {
+	switch {
+	case l.Count == 1:
+		return "stop on the first failure"
+	case l.Count > 0:
+		return fmt.Sprintf("stop after %d failures", l.Count)
+	case l.percent > 0:
+		return fmt.Sprintf("stop once %s%% of the rows have failed", strconv.FormatFloat(l.percent, 'f', -1, 64))
+	}
+	return "keep going"
+}
+
+// Next returns the choice of failureLimits after l.
+func (l FailureLimit) Next() FailureLimit {
+	for i, c := range failureLimits {
+		if c == l {
+			return failureLimits[(i+1)%len(failureLimits)]
+		}
+	}
+	return failureLimits[0]
+}
+
+// countsAsFailure reports whether err counts towards the failure limit.
+// Rows skipped with a warning and devices that exist already don't: they
+// say nothing about whether the rest of the import can succeed.
+func countsAsFailure(err error) bool {
+	var note RowNote
+	return err != nil && !errors.As(err, &note) && status.Code(err) != codes.AlreadyExists
+}
+
+// Aborted is why an import stopped at its failure limit.
+type Aborted struct {
+	Failed int
+	Last   error // the failure that tripped the limit
+}
+
+func (a *Aborted) Error() string {
+	return fmt.Sprintf("%s; the last: %s", a.After(), DescribeError(a.Last))
+}
+
+// After says when the import was aborted, e.g. "aborted after 20 failures".
+func (a *Aborted) After() string {
+	if a.Failed == 1 {
+		return "aborted at the first failure"
+	}
+	return fmt.Sprintf("aborted after %d failures", a.Failed)
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxDownloadSize caps how much of a remote device list is read into memory.
+const maxDownloadSize = 64 << 20
+
+// DefaultHTTPTimeout is how long a download may take unless
+// ListOptions.HTTPTimeout says otherwise.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// contentTypeExtensions maps the media types accepted for downloaded device
+// lists to the extension whose parser handles them. Types mapped to "" are
+// accepted but parsed according to the URL's extension.
+var contentTypeExtensions = map[string]string{
+	"text/csv":                  ".csv",
+	"text/plain":                "",
+	"text/tab-separated-values": ".tsv",
+	"application/json":          ".json",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+	"application/octet-stream": "",
+}
+
+// IsURL reports whether s names an HTTP(S) resource rather than a local path.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fetchInput downloads the device list at in.Source into in.Data. The body is
+// held in memory only; nothing is written to disk. Credentials can be given in
+// the URL's userinfo or as extra headers in cfg.HTTPHeaders, and are removed
+// from in.Source once the download succeeds. Cancelling ctx aborts it.
+func fetchInput(ctx context.Context, in *Input, cfg ListOptions) error {
+	u, err := url.Parse(in.Source)
+	if err != nil {
+		return err
+	}
+
+	timeout := cfg.HTTPTimeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+	for _, h := range cfg.HTTPHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	// Don't echo credentials back in error messages.
+	display := u.Redacted()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", display, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: HTTP %s", display, resp.Status)
+	}
+	if resp.ContentLength > maxDownloadSize {
+		return fmt.Errorf("downloading %s: file is %d bytes, the limit is %d", display, resp.ContentLength, maxDownloadSize)
+	}
+
+	ext := path.Ext(u.Path)
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("downloading %s: invalid Content-Type %q", display, ct)
+		}
+		typeExt, ok := contentTypeExtensions[mediaType]
+		if !ok {
+			return fmt.Errorf("downloading %s: unexpected Content-Type %q", display, mediaType)
+		}
+		if typeExt != "" {
+			ext = typeExt
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", display, err)
+	}
+	if len(body) > maxDownloadSize {
+		return fmt.Errorf("downloading %s: file exceeds the %d byte limit", display, maxDownloadSize)
+	}
+
+	in.Source, in.Name, in.Data = display, "download"+ext, body
+	return nil
+}
@@ -0,0 +1,461 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// gatewayStatsInterval is the statistics interval, in seconds, of imported
+// gateways; the default of the ChirpStack UI.
+const gatewayStatsInterval = 30
+
+// GatewayRow is a single gateway to import.
+type GatewayRow struct {
+	Pos RowPos
+
+	GatewayID   string
+	Name        string
+	Description string
+	Location    *common.Location // nil when the row has no coordinates
+}
+
+// gatewayFailure is a gateway the server rejected.
+type gatewayFailure struct {
+	row GatewayRow
+	err error
+}
+
+// gatewayColumns are the columns of a gateway list, in the order of a list
+// without a header row, with the normalized header names each is known by.
+var gatewayColumns = []struct {
+	name    string
+	aliases []string
+}{
+	{"gateway_id", []string{"gatewayid", "gatewayeui", "eui", "id"}},
+	{"name", []string{"gatewayname"}},
+	{"description", []string{"desc"}},
+	{"latitude", []string{"lat"}},
+	{"longitude", []string{"lon", "lng", "long"}},
+	{"altitude", []string{"alt", "elevation"}},
+}
+
+// Indexes into gatewayColumns
+const (
+	gwID = iota
+	gwName
+	gwDescription
+	gwLatitude
+	gwLongitude
+	gwAltitude
+)
+
+// mapGatewayHeader returns the column of each of gatewayColumns in header,
+// -1 for a missing one.
+func mapGatewayHeader(header []string) []int {
+	cols := make([]int, len(gatewayColumns))
+	for i := range cols {
+		cols[i] = -1
+	}
+	for col, h := range header {
+		n := NormalizeHeader(h)
+		for i, gc := range gatewayColumns {
+			if cols[i] < 0 && (n == NormalizeHeader(gc.name) || slices.Contains(gc.aliases, n)) {
+				cols[i] = col
+			}
+		}
+	}
+	return cols
+}
+
+// parseGatewayRow builds a gateway from the values of its columns, placed
+// at def if it has no coordinates of its own, and returns why the row is
+// invalid, if it is. A row with some of the coordinates but not a latitude
+// and a longitude is rejected rather than placed somewhere wrong.
+func parseGatewayRow(pos RowPos, values []string, def *common.Location) (row GatewayRow, invalid string) {
+	row = GatewayRow{
+		Pos:         pos,
+		GatewayID:   lorakey.NormalizeEUI(values[gwID]),
+		Name:        strings.TrimSpace(values[gwName]),
+		Description: values[gwDescription],
+	}
+	switch {
+	case len(row.GatewayID) != 16 || !lorakey.IsHex(row.GatewayID):
+		return row, pos.Field("gateway_id") + ": must be 16 hex characters"
+	case row.Name == "":
+		return row, pos.Field("name") + ": must not be empty"
+	}
+
+	lat, lon, alt := strings.TrimSpace(values[gwLatitude]), strings.TrimSpace(values[gwLongitude]), strings.TrimSpace(values[gwAltitude])
+	switch {
+	case lat == "" && lon == "" && alt == "":
+		if def != nil {
+			row.Location = &common.Location{Latitude: def.Latitude, Longitude: def.Longitude, Altitude: def.Altitude, Source: def.Source}
+		}
+		return row, ""
+	case lat == "" && lon == "":
+		return row, pos.Field("altitude") + ": needs a latitude and longitude too"
+	case lon == "":
+		return row, pos.Field("longitude") + ": must be set along with the latitude"
+	case lat == "":
+		return row, pos.Field("latitude") + ": must be set along with the longitude"
+	}
+
+	loc, problem := parseCoordinates(lat, lon, alt)
+	if problem != "" {
+		return row, pos.Field(problem)
+	}
+	row.Location = loc
+	return row, ""
+}
+
+// parseCoordinates parses a latitude, longitude and optional altitude in
+// metres into a location set in the configuration. A problem is returned as
+// the name of the coordinate followed by what is wrong with it, e.g.
+// "latitude: must be between -90 and 90".
+func parseCoordinates(lat, lon, alt string) (*common.Location, string) {
+	loc := &common.Location{Source: common.LocationSource_CONFIG}
+	coords := []struct {
+		name     string
+		value    string
+		dst      *float64
+		min, max float64
+	}{
+		{"latitude", lat, &loc.Latitude, -90, 90},
+		{"longitude", lon, &loc.Longitude, -180, 180},
+		{"altitude", alt, &loc.Altitude, math.Inf(-1), math.Inf(1)},
+	}
+	for _, c := range coords {
+		if c.value == "" {
+			continue // only the altitude can be empty here
+		}
+		// Spreadsheets in many locales write a decimal comma.
+		f, err := strconv.ParseFloat(strings.ReplaceAll(c.value, ",", "."), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Sprintf("%s: %q is not a number", c.name, c.value)
+		}
+		if f < c.min || f > c.max {
+			return nil, fmt.Sprintf("%s: must be between %g and %g", c.name, c.min, c.max)
+		}
+		*c.dst = f
+	}
+	return loc, ""
+}
+
+// ParseDefaultLocation parses --default-location: a latitude, longitude and
+// optional altitude separated by commas, or by semicolons when they are
+// written with a decimal comma.
+func ParseDefaultLocation(s string) (*common.Location, error) {
+	if s == "" {
+		return nil, nil
+	}
+	sep := ","
+	if strings.Contains(s, ";") {
+		sep = ";"
+	}
+	parts := strings.Split(s, sep)
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("--default-location must be latitude,longitude or latitude,longitude,altitude, not %q", s)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	alt := ""
+	if len(parts) == 3 {
+		alt = parts[2]
+	}
+	if parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("--default-location needs both a latitude and a longitude, not %q", s)
+	}
+	loc, problem := parseCoordinates(parts[0], parts[1], alt)
+	if problem != "" {
+		return nil, fmt.Errorf("--default-location %s", problem)
+	}
+	return loc, nil
+}
+
+// gatewayBatch reads the gateway lists of one import, rejecting gateway IDs
+// that already appeared earlier in the batch like batch does for DevEUIs.
+type gatewayBatch struct {
+	cfg   ListOptions
+	multi bool
+	seen  map[string]string // gateway ID -> where it was first seen
+}
+
+func newGatewayBatch(cfg ListOptions, inputs []*Input) *gatewayBatch {
+	return &gatewayBatch{cfg: cfg, multi: len(inputs) > 1, seen: make(map[string]string)}
+}
+
+// scan reads the gateway list in from the start and passes each valid row
+// to emit. The counts, warnings and invalid rows of in are replaced.
+func (b *gatewayBatch) scan(ctx context.Context, in *Input, emit func(row GatewayRow) error) error {
+	cfg := b.cfg
+	if ext := strings.ToLower(filepath.Ext(in.Name)); ext == ".json" || ext == ".xlsx" {
+		return fmt.Errorf("gateway lists must be CSV, not %s", ext)
+	}
+
+	r, err := in.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	in.Count = 0
+	in.Warnings, in.Invalid = nil, nil
+
+	reader, format := NewDelimitedReader(r, cfg)
+	reader.FieldsPerRecord = -1
+
+	var cols []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if cols == nil {
+			format.columns = len(record)
+			if lorakey.IsHex(lorakey.NormalizeEUI(record[0])) {
+				// No header: the columns are in the order of gatewayColumns.
+				cols = []int{0, 1, 2, 3, 4, 5}
+			} else {
+				if cols = mapGatewayHeader(record); cols[gwID] < 0 {
+					return fmt.Errorf("the header has no gateway_id column")
+				}
+				continue
+			}
+		}
+
+		values := make([]string, len(gatewayColumns))
+		for i, col := range cols {
+			if col >= 0 && col < len(record) {
+				values[i] = record[col]
+			}
+		}
+		row, invalid := parseGatewayRow(RowPos{Line: line}, values, cfg.DefaultLocation)
+		if invalid == "" {
+			invalid = b.check(in, row)
+		}
+		if invalid != "" {
+			in.Invalid = append(in.Invalid, invalid)
+			continue
+		}
+		in.Count++
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+
+	in.Format = "gateways, " + format.String()
+	return nil
+}
+
+// check returns why row duplicates an earlier row of the batch, or an empty
+// string.
+func (b *gatewayBatch) check(in *Input, row GatewayRow) string {
+	where := row.Pos.Field("gateway_id")
+	if first, ok := b.seen[row.GatewayID]; ok {
+		return fmt.Sprintf("%s: %s duplicates %s", where, row.GatewayID, first)
+	}
+	if b.multi {
+		where = filepath.Base(in.Source) + " " + where
+	}
+	b.seen[row.GatewayID] = where
+	return ""
+}
+
+// ReadGatewayInputs reads each of inputs once to validate it, keeping its
+// first keep rows for display.
+func ReadGatewayInputs(ctx context.Context, inputs []*Input, cfg ListOptions, keep int) error {
+	b := newGatewayBatch(cfg, inputs)
+	for _, in := range inputs {
+		in.Gateways = nil
+		err := b.scan(ctx, in, func(row GatewayRow) error {
+			if len(in.Gateways) < keep {
+				in.Gateways = append(in.Gateways, row)
+			}
+			return nil
+		})
+		if err != nil {
+			if len(inputs) > 1 {
+				err = fmt.Errorf("%s: %w", in.Source, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GatewayImporter creates gateways in a tenant.
+type GatewayImporter struct {
+	Gateways api.GatewayServiceClient
+	Token    string
+	TenantID string
+	DryRun   bool // only check that the gateways don't exist yet
+	Audit    *AuditLog
+	Pause    *PauseGate
+
+	// MaxFailures stops the import once enough rows have failed.
+	MaxFailures FailureLimit
+
+	// OnRow, if set, is called after each row like Importer.OnRow.
+	OnRow func(source string, row GatewayRow, err error)
+}
+
+// ImportFiles imports each of inputs in turn, creating the gateways as the
+// rows are read a second time. The failed rows of every file are saved to
+// the path returned by failuresPath for its source. The results count
+// gateways where they would count devices. Cancelling ctx or reaching
+// gi.MaxFailures stops the import after the row in flight, like
+// Importer.ImportFiles.
+func (gi *GatewayImporter) ImportFiles(ctx context.Context, inputs []*Input, cfg ListOptions, failuresPath func(source string) string) ([]FileResult, error) {
+	stop := ctx
+	ctx = AuthContext(context.WithoutCancel(ctx), gi.Token)
+
+	var results []FileResult
+	b := newGatewayBatch(cfg, inputs)
+	failures, rows := 0, 0
+	for _, in := range inputs {
+		rows += in.Count
+	}
+	for _, in := range inputs {
+		fr := FileResult{Input: in}
+		var failed []gatewayFailure
+		scanErr := b.scan(stop, in, func(row GatewayRow) error {
+			gi.Pause.wait(stop)
+			if stop.Err() != nil {
+				return context.Cause(stop)
+			}
+			err := gi.importRow(ctx, row)
+			if err != nil {
+				failed = append(failed, gatewayFailure{row: row, err: err})
+				fr.Result.Failures = append(fr.Result.Failures, RowFailure{
+					Row: Row{Pos: row.Pos, DevEUI: row.GatewayID, Name: row.Name}, Err: err})
+			} else {
+				fr.Result.Created++
+			}
+			if gi.OnRow != nil {
+				gi.OnRow(in.Source, row, err)
+			}
+			if countsAsFailure(err) {
+				failures++
+				if gi.MaxFailures.reached(failures, rows) {
+					return &Aborted{Failed: failures, Last: err}
+				}
+			}
+			return nil
+		})
+
+		if len(failed) > 0 && !gi.DryRun {
+			fr.FailuresFile = failuresPath(in.Source)
+			if err := saveGatewayFailures(fr.FailuresFile, failed); err != nil {
+				return nil, fmt.Errorf("writing failed rows: %w", err)
+			}
+		}
+		var abort *Aborted
+		if errors.As(scanErr, &abort) || stop.Err() != nil && errors.Is(scanErr, context.Cause(stop)) {
+			fr.Stopped = scanErr
+			return append(results, fr), nil
+		}
+		if scanErr != nil {
+			return nil, fmt.Errorf("reading %s: %w", in.Source, scanErr)
+		}
+		results = append(results, fr)
+	}
+	return results, nil
+}
+
+// importRow creates the gateway of row, or on a dry run checks that it
+// doesn't exist yet.
+func (gi *GatewayImporter) importRow(ctx context.Context, row GatewayRow) error {
+	if gi.DryRun {
+		_, err := gi.Gateways.Get(ctx, &api.GetGatewayRequest{GatewayId: row.GatewayID})
+		switch {
+		case err == nil:
+			err = status.Error(codes.AlreadyExists, "gateway already exists")
+		case status.Code(err) == codes.NotFound:
+			err = nil
+		}
+		gi.Audit.DryRun(ctx, api.GatewayService_Create_FullMethodName,
+			&api.CreateGatewayRequest{Gateway: &api.Gateway{GatewayId: row.GatewayID, TenantId: gi.TenantID}}, err)
+		return err
+	}
+
+	_, err := gi.Gateways.Create(ctx, &api.CreateGatewayRequest{
+		Gateway: &api.Gateway{
+			GatewayId:     row.GatewayID,
+			Name:          row.Name,
+			Description:   row.Description,
+			Location:      row.Location,
+			TenantId:      gi.TenantID,
+			StatsInterval: gatewayStatsInterval,
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create the gateway", "gateway_id", row.GatewayID, "rpc", api.GatewayService_Create_FullMethodName, "err", err)
+	}
+	return err
+}
+
+// writeGatewayFailures writes the failed rows as a gateway list that can be
+// fixed and re-imported, with what went wrong explained.
+func writeGatewayFailures(w io.Writer, failures []gatewayFailure) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"gateway_id", "name", "description", "latitude", "longitude", "altitude", "error", "remedy"})
+	for _, f := range failures {
+		lat, lon, alt := FormatLocation(f.row.Location)
+		e := explainError(f.err)
+		cw.Write([]string{f.row.GatewayID, f.row.Name, f.row.Description, lat, lon, alt, e.text, e.remedy})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// saveGatewayFailures writes failures to path, or to stderr when path is
+// empty.
+func saveGatewayFailures(path string, failures []gatewayFailure) error {
+	if path == "" {
+		return writeGatewayFailures(os.Stderr, failures)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeGatewayFailures(f, failures); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FormatLocation returns the coordinates of loc for a gateway list, or
+// empty cells without a location.
+func FormatLocation(loc *common.Location) (lat, lon, alt string) {
+	if loc == nil {
+		return "", "", ""
+	}
+	return strconv.FormatFloat(loc.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(loc.Longitude, 'f', -1, 64),
+		strconv.FormatFloat(loc.Altitude, 'f', -1, 64)
+}
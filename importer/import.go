@@ -0,0 +1,710 @@
+// Package importer reads lists of LoRaWAN devices and creates, updates,
+// moves or deletes the devices they list on a ChirpStack server. Run
+// imports lists in a single call; the command line drives an Importer
+// itself for the rest, such as pausing, retries and the records of a run.
+package importer
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+)
+
+// AuthContext attaches the API token to ctx for outgoing calls.
+func AuthContext(ctx context.Context, token string) context.Context {
+	return metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// Importer creates devices in the selected application, or in the
+// application named by each row.
+type Importer struct {
+	Devices       api.DeviceServiceClient
+	Apps          api.ApplicationServiceClient
+	Profiles      api.DeviceProfileServiceClient
+	Multicast     api.MulticastGroupServiceClient
+	Token         string
+	TenantID      string // looked up from ApplicationID when empty
+	ApplicationID string
+	ProfileID     string
+	Server        Version // of ChirpStack on the server, zero if unknown
+
+	// Name to ID lookups for per-row application, device profile and multicast
+	// group columns, filled on first use.
+	appIDs     map[string]string
+	profileIDs map[string]string
+	groupIDs   map[string]map[string]string // by application ID
+
+	// MAC versions of the device profiles by ID, which decide where the
+	// root keys go
+	macVersions map[string]common.MacVersion
+
+	// cache guards the lookups above, and targetTenants, which the rows in
+	// flight at once share. It is never held across a call to the server.
+	cache sync.Mutex
+
+	// MulticastGroup, by name or ID, is joined by the devices of rows
+	// without a multicast_group column; empty for none.
+	MulticastGroup string
+
+	// Downlink is enqueued for every created device; rows can have their
+	// own. Nothing is enqueued when neither has a payload.
+	Downlink Downlink
+
+	// GenerateKeys provisions random root keys for rows without them.
+	GenerateKeys bool
+
+	// OverwriteKeys replaces the keys of devices that exist already with
+	// those of the row. Without it such rows are skipped with a warning.
+	OverwriteKeys bool
+
+	// TargetApplication, by name or ID, is where --mode move moves the
+	// devices of rows without a target_application column. The tenants of
+	// target applications given by ID are filled on first use.
+	TargetApplication string
+	targetTenants     map[string]string
+
+	// Mode is what is done with each row. On a dry run the rows are only
+	// checked against the server.
+	Mode   Mode
+	DryRun bool
+
+	// Consent has to be given for a run that deletes devices or replaces
+	// keys, see destroys; without it the run doesn't start.
+	Consent *Consent
+
+	// Existing holds the devices of the application by DevEUI when syncing;
+	// rows for these are updated rather than created.
+	Existing map[string]*api.DeviceListItem
+
+	// Journal, if set, records the devices created so that the import can
+	// be undone.
+	Journal *Journal
+
+	// Audit, if set, records the writes a dry run checks instead of making;
+	// the connection records the others.
+	Audit *AuditLog
+
+	// Pause, if set, holds the import between rows while it is paused.
+	Pause *PauseGate
+
+	// Limit is how many devices are created at most, to stay within the
+	// device limit of the tenant; 0 for no limit.
+	Limit int
+
+	// MaxFailures stops the import once enough rows have failed.
+	MaxFailures FailureLimit
+
+	// Log, if set, is what the import logs to, e.g. with the run ID;
+	// otherwise the default logger.
+	Log *slog.Logger
+
+	// OnRow, if set, is called after each row has been processed with the
+	// error that made it fail, if any.
+	OnRow func(source string, row Row, err error)
+
+	// onFinished, if set, is called after OnRow with the outcome of the
+	// row, for Run.
+	onFinished func(r RowResult)
+
+	// Events, if set, is sent the events of the import as they happen; the
+	// caller emits RunStarted and RunFinished around the import, the latter
+	// with Report.
+	Events *EventStream
+
+	// report has the rows processed so far, see Report.
+	report Report
+
+	// ChunkSize is how many rows make a chunk, after which the undo
+	// journal, the audit log and the failed rows so far are flushed to disk;
+	// 0 for no chunks. OnChunk, if set, is called after each chunk, and the
+	// chunks of the last ImportFiles are kept in Chunks.
+	ChunkSize int
+	OnChunk   func(c ChunkTiming)
+	Chunks    []ChunkTiming
+
+	// Breaker, if set, calls OnTrip after a burst of identical failures.
+	// The import goes on once OnTrip returns, unless it returns an error,
+	// which stops the import like the failure limit does.
+	Breaker *Breaker
+	OnTrip  func(ctx context.Context, t Tripped) error
+
+	// Pool and Pace, if set, decide how many rows are imported at once and
+	// how fast they're started; both can change while the import runs.
+	// Without them one row is imported at a time, as fast as the server
+	// answers.
+	Pool *WorkerPool
+	Pace *Pacer
+}
+
+// Result is the outcome of an import run.
+type Result struct {
+	Created  int
+	Failures []RowFailure
+	Keys     []GeneratedKey // root keys generated for created devices
+
+	// Existing devices whose keys were provisioned or replaced, and those
+	// left alone with a warning
+	KeysUpdated int
+	Skipped     []RowFailure
+
+	// Outcome of a delete
+	Removed []Row
+	Absent  int   // devices that didn't exist
+	Kept    []Row // devices an undo left alone because they have been seen
+
+	// Outcome of a move
+	Moved []MovedDevice
+
+	// Outcome of a key rotation: the devices rotated, whose new keys are in
+	// keys, and those of them with a session the rotation didn't end
+	Rotated  []Row
+	Sessions []Row
+
+	// Outcome of a sync, besides the created and removed devices
+	Updated   int
+	Unchanged int
+
+	// Devices added to their multicast group, and those that failed to be.
+	// A device can be created and still fail to join its group.
+	Grouped       int
+	GroupFailures []RowFailure
+
+	// Downlinks enqueued for created devices, and those that failed to be
+	Enqueued        int
+	EnqueueFailures []RowFailure
+
+	// Devices created without the fields the server doesn't support, see
+	// importer.unsupported
+	Degraded []RowFailure
+
+	// Devices created, and how many of them read back as sent and which
+	// didn't, see Importer.Verify
+	Sent       []SentDevice
+	Verified   int
+	Mismatches []RowFailure
+}
+
+// FileResult is the outcome of importing one input file.
+type FileResult struct {
+	Input        *Input
+	Result       Result
+	FailuresFile string // where failed rows were written, if any
+	KeysFile     string // where generated AppKeys were written, if any
+	keysSaved    int    // of Result.Keys, written to KeysFile so far
+
+	// Stopped is errQuotaExceeded, errLimitReached, an *Aborted or the
+	// cause of the cancellation if the import stopped in this file; the
+	// rest of it and later files weren't imported.
+	Stopped error
+}
+
+// RowFailure is a row the server rejected.
+type RowFailure struct {
+	Row Row
+	Err error
+}
+
+// RowNote is returned by importRow for a row that was skipped with a
+// warning, so that it is shown as such rather than as a success or failure.
+type RowNote string
+
+func (n RowNote) Error() string { return string(n) }
+
+// ImportFiles imports each of inputs in turn, reading its rows with scan so
+// that devices are created as the rows are parsed. Up to imp.Pool workers
+// import rows at once, started no faster than imp.Pace allows. The failed
+// rows of every file are saved to the path returned by failuresPath, if
+// set, for its source, and the AppKeys generated for it to a keys file next
+// to it, see FileResult.KeysFile. The import stops early when the tenant
+// runs out of devices, as every later row would fail the same way, when
+// imp.MaxFailures is reached and when ctx is cancelled.
+// The rows in flight are finished first, so that what they did is recorded,
+// and after a cancellation the rest of their chunk too if that takes no
+// longer than chunkDrain.
+func (imp *Importer) ImportFiles(ctx context.Context, inputs []*Input, scan func(ctx context.Context, in *Input, emit func(row Row) error) error, failuresPath func(source string) string) ([]FileResult, error) {
+	if imp.destroys() && imp.Consent == nil {
+		return nil, ErrUnconfirmed
+	}
+	stop := ctx
+	ctx = AuthContext(context.WithoutCancel(ctx), imp.Token)
+	pool := imp.Pool
+	if pool == nil {
+		pool = NewWorkerPool(1)
+	}
+
+	var results []FileResult
+	created := 0 // by the earlier files
+	failed, rows := 0, 0
+	for _, in := range inputs {
+		rows += in.Count
+	}
+	imp.Chunks = nil
+
+	// mu guards what the rows in flight share: fr, created, failed, the
+	// chunk and the counts below.
+	var mu sync.Mutex
+	var flight sync.WaitGroup
+	chunk := newChunk(time.Now())
+	started, pending := 0, 0 // rows started and not yet finished
+	var halt error           // why the rows finished call for a stop
+	var stopped time.Time    // when the cancellation was noticed
+	for _, in := range inputs {
+		fr := FileResult{Input: in}
+		scanErr := scan(stop, in, func(row Row) error {
+			waited := time.Now()
+			held := imp.Pause.held()
+			if held {
+				imp.Events.Emit(RunPaused{Held: true})
+			}
+			imp.Pause.wait(stop)
+			if held {
+				imp.Events.Emit(RunPaused{Held: false})
+			}
+			paused := time.Since(waited)
+			imp.Pace.wait(stop)
+			pool.Acquire()
+
+			mu.Lock()
+			chunk.paused += paused
+			for {
+				err := halt
+				if err == nil && stop.Err() != nil {
+					if stopped.IsZero() {
+						stopped = time.Now()
+					}
+					// Finish the chunk unless it's paused, at its start or taking too long.
+					if started%max(imp.ChunkSize, 1) == 0 || imp.Pause.held() || time.Since(stopped) > chunkDrain {
+						err = context.Cause(stop)
+					}
+				}
+				if err == nil && imp.Limit > 0 && created+fr.Result.Created+pending >= imp.Limit {
+					if pending > 0 {
+						// Rows in flight might still fail and leave room.
+						mu.Unlock()
+						flight.Wait()
+						mu.Lock()
+						continue
+					}
+					err = errLimitReached
+				}
+				if err != nil {
+					mu.Unlock()
+					pool.Release()
+					return err
+				}
+				break
+			}
+			started++
+			pending++
+			flight.Add(1)
+			mu.Unlock()
+
+			go func() {
+				defer flight.Done()
+				defer pool.Release()
+				var res Result
+				err := imp.importRow(ctx, row, &res)
+
+				mu.Lock()
+				trip := imp.finishRow(row, err, &res, &fr, &chunk, &failed, rows, &halt, failuresPath)
+				pending--
+				mu.Unlock()
+				if trip && imp.OnTrip != nil {
+					if err := imp.OnTrip(stop, Tripped{Streak: imp.Breaker.threshold, Last: err}); err != nil {
+						mu.Lock()
+						if halt == nil {
+							halt = err
+						}
+						mu.Unlock()
+					}
+				}
+			}()
+			return nil
+		})
+		flight.Wait()
+		if scanErr == nil && halt != nil {
+			scanErr = halt
+		}
+		slices.SortFunc(fr.Result.Failures, func(a, b RowFailure) int {
+			return cmp.Or(cmp.Compare(a.Row.Pos.Line, b.Row.Pos.Line), cmp.Compare(a.Row.Pos.Index, b.Row.Pos.Index))
+		})
+		created += fr.Result.Created
+		if chunk.rows > 0 && (scanErr != nil || in == inputs[len(inputs)-1]) {
+			// The last chunk, cut short
+			imp.endChunk(chunk, &fr, failuresPath)
+			chunk = newChunk(time.Now())
+		}
+
+		// Keys of devices created before a read error still have to be
+		// saved, or they'd be lost.
+		if err := fr.flushKeys(); err != nil {
+			return nil, fmt.Errorf("writing generated keys: %w", err)
+		}
+		if len(fr.Result.Failures) > 0 && !imp.DryRun && failuresPath != nil {
+			fr.FailuresFile = failuresPath(in.Source)
+			if err := SaveFailures(fr.FailuresFile, fr.Result.Failures); err != nil {
+				return nil, fmt.Errorf("writing failed rows: %w", err)
+			}
+		}
+		var abort *Aborted
+		if errors.Is(scanErr, errQuotaExceeded) || errors.Is(scanErr, errLimitReached) || errors.As(scanErr, &abort) ||
+			stop.Err() != nil && errors.Is(scanErr, context.Cause(stop)) {
+			fr.Stopped = scanErr
+			return append(results, fr), nil
+		}
+		if scanErr != nil {
+			return nil, fmt.Errorf("reading %s: %w", in.Source, scanErr)
+		}
+		results = append(results, fr)
+	}
+	return results, nil
+}
+
+// finishRow adds the outcome res of a row that finished with err to fr,
+// ending the chunk when it's full, and sets halt when the row calls for the
+// import to stop. It reports whether the row tripped the breaker. The caller
+// holds the lock over the arguments.
+func (imp *Importer) finishRow(row Row, err error, res *Result, fr *FileResult, chunk *ChunkTiming, failed *int, rows int, halt *error, failuresPath func(source string) string) bool {
+	fr.Result.Add(*res)
+	imp.rowFinished(RowResult{Source: fr.Input.Source, Row: row, Status: rowStatus(res, err), Err: err})
+	if chunk.rows++; chunk.rows == imp.ChunkSize {
+		imp.endChunk(*chunk, fr, failuresPath)
+		*chunk = newChunk(time.Now())
+	}
+	switch {
+	case *halt != nil:
+	case isQuotaError(err):
+		*halt = errQuotaExceeded
+	case countsAsFailure(err):
+		*failed++
+		if imp.MaxFailures.reached(*failed, rows) {
+			*halt = &Aborted{Failed: *failed, Last: err}
+		}
+	}
+	return *halt == nil && imp.Breaker.record(err)
+}
+
+// Add adds the outcome o of more rows to r.
+func (r *Result) Add(o Result) {
+	r.Created += o.Created
+	r.Failures = append(r.Failures, o.Failures...)
+	r.Keys = append(r.Keys, o.Keys...)
+	r.KeysUpdated += o.KeysUpdated
+	r.Skipped = append(r.Skipped, o.Skipped...)
+	r.Removed = append(r.Removed, o.Removed...)
+	r.Absent += o.Absent
+	r.Kept = append(r.Kept, o.Kept...)
+	r.Moved = append(r.Moved, o.Moved...)
+	r.Rotated = append(r.Rotated, o.Rotated...)
+	r.Sessions = append(r.Sessions, o.Sessions...)
+	r.Updated += o.Updated
+	r.Unchanged += o.Unchanged
+	r.Grouped += o.Grouped
+	r.GroupFailures = append(r.GroupFailures, o.GroupFailures...)
+	r.Enqueued += o.Enqueued
+	r.EnqueueFailures = append(r.EnqueueFailures, o.EnqueueFailures...)
+	r.Degraded = append(r.Degraded, o.Degraded...)
+	r.Sent = append(r.Sent, o.Sent...)
+	r.Verified += o.Verified
+	r.Mismatches = append(r.Mismatches, o.Mismatches...)
+}
+
+// importRow creates the device for row, provisioning its keys when present or
+// generated, and records the outcome in res. The error is returned for
+// display only; it doesn't stop the import.
+func (imp *Importer) importRow(ctx context.Context, row Row, res *Result) error {
+	switch imp.Mode {
+	case ModeDelete:
+		return imp.deleteRow(ctx, row, res)
+	case ModeToggle:
+		return imp.toggleRow(ctx, row, res)
+	case ModeUpdate:
+		return imp.updateRow(ctx, row, res)
+	case ModeMove:
+		return imp.moveRow(ctx, row, res)
+	case ModeRotate:
+		return imp.rotateRow(ctx, row, res)
+	case ModeSync:
+		if d, ok := imp.Existing[row.DevEUI]; ok {
+			err := imp.syncRow(ctx, d, row, res)
+			if err == nil {
+				imp.joinGroup(ctx, row, res)
+			}
+			return err
+		}
+	}
+
+	row, dropped := imp.unsupported(row)
+	keys, generated, err := imp.keysFor(ctx, row)
+	created := false
+	switch {
+	case err != nil:
+	case imp.DryRun:
+		err = imp.check(ctx, row)
+	default:
+		created, err = imp.create(ctx, row, keys)
+	}
+
+	if joinsGroup(err) {
+		imp.joinGroup(ctx, row, res)
+	}
+	if status.Code(err) == codes.AlreadyExists && keys != nil && !imp.DryRun {
+		// Most likely the import is being run again.
+		return imp.rekey(ctx, row, keys, generated, res)
+	}
+	if created {
+		// The device exists even if its keys failed, so undo has to
+		// delete it and verify has to read it back.
+		imp.recordSent(ctx, row, keys != nil, res)
+	}
+	if err != nil {
+		// The failures file and the log pane explain the error; keep it
+		// as it came for debugging.
+		imp.logRow(row).Error("Failed to import the device", "err", err)
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+		return err
+	}
+	res.Created++
+	if dropped != nil {
+		res.Degraded = append(res.Degraded, RowFailure{Row: row, Err: dropped})
+	}
+	if !imp.DryRun {
+		imp.enqueue(ctx, row, res)
+	}
+	if generated != nil {
+		res.Keys = append(res.Keys, *generated)
+	}
+	return nil
+}
+
+// rowFinished adds r, a row that has been processed, to the report, and
+// passes it on to OnRow and the events.
+func (imp *Importer) rowFinished(r RowResult) {
+	imp.report.add(r)
+	if imp.OnRow != nil {
+		imp.OnRow(r.Source, r.Row, r.Err)
+	}
+	if imp.onFinished != nil {
+		imp.onFinished(r)
+	}
+	imp.Events.Emit(RowFinished{Source: r.Source, Row: r.Row, Status: r.Status, Err: r.Err})
+}
+
+// rowStatus returns what became of a row from its outcome res and the
+// error it finished with.
+func rowStatus(res *Result, err error) RowStatus {
+	var note RowNote
+	switch {
+	case errors.As(err, &note) || len(res.Skipped) > 0 || res.Absent > 0:
+		return StatusSkipped
+	case err != nil:
+		return StatusFailed
+	case res.Unchanged > 0:
+		return StatusUnchanged
+	case len(res.Removed) > 0:
+		return StatusRemoved
+	case res.Created > 0:
+		return StatusCreated
+	}
+	return StatusUpdated
+}
+
+// Report returns the rows processed so far by ImportFiles and
+// RemoveUnlisted, sorted by what became of them. It doesn't have the rows
+// that were rejected or skipped before the import; see Input.Rejected and
+// Input.Exists.
+func (imp *Importer) Report() Report {
+	return imp.report
+}
+
+// recordSent records the device created for row in the undo journal and
+// in res.Sent for verify; keys tells whether root keys were sent with it.
+func (imp *Importer) recordSent(ctx context.Context, row Row, keys bool, res *Result) {
+	// create has resolved, and cached, the application and device profile
+	// already.
+	appID, _ := imp.applicationFor(ctx, row)
+	if err := imp.Journal.record(row.DevEUI, appID); err != nil {
+		imp.logRow(row).Warn("Failed to record the device for undo", "err", err)
+	}
+	profileID, _ := imp.profileFor(ctx, row)
+	res.Sent = append(res.Sent, SentDevice{Row: row, appID: appID, profileID: profileID, keys: keys})
+}
+
+// create creates the device for row and provisions keys, its root keys if
+// not nil, and the ABP session of row if it has one. created tells whether
+// the device was created, which it may have been even when err is not nil.
+func (imp *Importer) create(ctx context.Context, row Row, keys *api.DeviceKeys) (created bool, err error) {
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return false, err
+	}
+	profileID, err := imp.profileFor(ctx, row)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = imp.Devices.Create(ctx, &api.CreateDeviceRequest{
+		Device: &api.Device{
+			DevEui:          row.DevEUI,
+			Name:            row.Name,
+			Description:     row.Description,
+			JoinEui:         row.JoinEUI,
+			ApplicationId:   appID,
+			DeviceProfileId: profileID,
+			Tags:            row.Tags,
+			Variables:       row.variables,
+			IsDisabled:      row.isDisabled,
+			SkipFcntCheck:   row.skipFCntCheck,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if keys != nil {
+		_, err = imp.Devices.CreateKeys(ctx, &api.CreateDeviceKeysRequest{DeviceKeys: keys})
+		if err != nil {
+			imp.logRow(row).Error("Failed to set the keys of the device", "rpc", api.DeviceService_CreateKeys_FullMethodName, "err", err)
+			return true, fmt.Errorf("device created but setting keys failed: %w", err)
+		}
+	}
+
+	if row.hasSession() {
+		_, err = imp.Devices.Activate(ctx, &api.ActivateDeviceRequest{
+			DeviceActivation: &api.DeviceActivation{
+				DevEui:      row.DevEUI,
+				DevAddr:     row.devAddr,
+				AppSKey:     row.appSKey,
+				NwkSEncKey:  row.nwkSKey,
+				SNwkSIntKey: row.nwkSKey,
+				FNwkSIntKey: row.nwkSKey,
+			},
+		})
+		if err != nil {
+			imp.logRow(row).Error("Failed to activate the device", "rpc", api.DeviceService_Activate_FullMethodName, "err", err)
+			return true, fmt.Errorf("device created but activating it failed: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// rekey provisions the keys of row for a device that exists already and
+// records the outcome in res.
+func (imp *Importer) rekey(ctx context.Context, row Row, keys *api.DeviceKeys, generated *GeneratedKey, res *Result) error {
+	err := imp.setKeys(ctx, row, keys)
+	var note RowNote
+	switch {
+	case errors.As(err, &note):
+		res.Skipped = append(res.Skipped, RowFailure{Row: row, Err: err})
+	case err != nil:
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+	default:
+		res.KeysUpdated++
+		if generated != nil {
+			res.Keys = append(res.Keys, *generated)
+		}
+	}
+	return err
+}
+
+// setKeys provisions keys for the existing device of row, provided it is in
+// the application the row is for. Keys it has already are only replaced
+// with OverwriteKeys, since a device that has joined with them is cut off.
+func (imp *Importer) setKeys(ctx context.Context, row Row, keys *api.DeviceKeys) error {
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	if err != nil {
+		return err
+	}
+	// create has resolved, and cached, the application already.
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return err
+	}
+	if id := resp.Device.GetApplicationId(); id != appID {
+		return status.Errorf(codes.AlreadyExists, "device already exists in application %s", id)
+	}
+
+	_, err = imp.Devices.CreateKeys(ctx, &api.CreateDeviceKeysRequest{DeviceKeys: keys})
+	if status.Code(err) != codes.AlreadyExists {
+		if err != nil {
+			imp.logRow(row).Error("Failed to set the keys of the device", "rpc", api.DeviceService_CreateKeys_FullMethodName, "err", err)
+		}
+		return err
+	}
+	if !imp.OverwriteKeys {
+		return RowNote("device and keys already exist, keys left unchanged (--overwrite-keys replaces them)")
+	}
+	if _, err = imp.Devices.UpdateKeys(ctx, &api.UpdateDeviceKeysRequest{DeviceKeys: keys}); err != nil {
+		imp.logRow(row).Error("Failed to replace the keys of the device", "rpc", api.DeviceService_UpdateKeys_FullMethodName, "err", err)
+	}
+	return err
+}
+
+// check does what create would short of writing anything: it resolves the
+// application and device profile of row and makes sure the device doesn't
+// exist yet. The would-be create goes to the audit log.
+func (imp *Importer) check(ctx context.Context, row Row) error {
+	appID, err := imp.applicationFor(ctx, row)
+	if err == nil {
+		_, err = imp.profileFor(ctx, row)
+	}
+	if err == nil {
+		_, err = imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+		switch {
+		case err == nil:
+			err = status.Error(codes.AlreadyExists, "device already exists")
+		case status.Code(err) == codes.NotFound:
+			err = nil
+		}
+	}
+	imp.Audit.DryRun(ctx, api.DeviceService_Create_FullMethodName,
+		&api.CreateDeviceRequest{Device: &api.Device{DevEui: row.DevEUI, ApplicationId: appID}}, err)
+	return err
+}
+
+// writeFailures writes the failed rows as CSV so they can be fixed and
+// re-imported, with what went wrong explained; the log file has the raw
+// errors.
+func writeFailures(w io.Writer, failures []RowFailure) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"dev_eui", "name", "description", "error", "remedy"})
+	for _, f := range failures {
+		e := explainError(f.Err)
+		cw.Write([]string{f.Row.DevEUI, f.Row.Name, f.Row.Description, e.text, e.remedy})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SaveFailures writes failures to path, or to stderr when path is empty.
+func SaveFailures(path string, failures []RowFailure) error {
+	if path == "" {
+		return writeFailures(os.Stderr, failures)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeFailures(f, failures); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,512 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/internal/chirpstacktest"
+)
+
+const (
+	testToken = "secret"
+	testKey   = "00112233445566778899aabbccddeeff"
+	otherKey  = "ffeeddccbbaa99887766554433221100"
+)
+
+// fakeServer starts a fake ChirpStack with a tenant, an application and a
+// LoRaWAN 1.0.3 device profile, and returns it with an importer into them.
+func fakeServer(t *testing.T) (*chirpstacktest.Server, *Importer) {
+	t.Helper()
+	srv := chirpstacktest.NewServer(t)
+	tenantID := srv.AddTenant(&api.Tenant{Name: "tenant"})
+	appID := srv.AddApplication(&api.Application{TenantId: tenantID, Name: "app"})
+	profileID := srv.AddProfile(&api.DeviceProfile{TenantId: tenantID, Name: "profile", Region: common.Region_EU868, MacVersion: common.MacVersion_LORAWAN_1_0_3})
+
+	conn := srv.Dial(t)
+	return srv, &Importer{
+		Devices:       api.NewDeviceServiceClient(conn),
+		Apps:          api.NewApplicationServiceClient(conn),
+		Profiles:      api.NewDeviceProfileServiceClient(conn),
+		Multicast:     api.NewMulticastGroupServiceClient(conn),
+		Token:         testToken,
+		TenantID:      tenantID,
+		ApplicationID: appID,
+		ProfileID:     profileID,
+		Log:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// importList imports the device list content with imp and returns the
+// result of its file.
+func importList(t *testing.T, imp *Importer, content string) FileResult {
+	t.Helper()
+	cfg := ListOptions{Mode: imp.Mode}
+	inputs := []*Input{readList(t, writeList(t, "devices.csv", content), cfg)}
+	results, err := imp.ImportFiles(context.Background(), inputs, NewBatch(cfg, inputs).Scan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("ImportFiles returned %d results, want 1", len(results))
+	}
+	return results[0]
+}
+
+// addDevice adds a device of the application and device profile of imp,
+// with keys if key isn't empty.
+func addDevice(srv *chirpstacktest.Server, imp *Importer, devEUI, key string) {
+	var keys *api.DeviceKeys
+	if key != "" {
+		keys = &api.DeviceKeys{DevEui: devEUI, NwkKey: key}
+	}
+	srv.AddDevice(&api.Device{DevEui: devEUI, Name: devEUI, ApplicationId: imp.ApplicationID, DeviceProfileId: imp.ProfileID}, keys)
+}
+
+func TestImportFiles(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000003", otherKey)
+	srv.Fail(api.DeviceService_Create_FullMethodName, nil, status.Error(codes.PermissionDenied, "not allowed"))
+	journal := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := NewJournal(journal, "chirpstack:8080", imp.ApplicationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp.Journal = j
+
+	fr := importList(t, imp, `dev_eui,name,app_key
+70b3d57ed0000001,sensor 1,`+testKey+`
+70b3d57ed0000002,sensor 2,
+70b3d57ed0000003,sensor 3,`+testKey+`
+70b3d57ed000004,sensor 4,
+`)
+	j.Close()
+
+	res := fr.Result
+	if res.Created != 1 {
+		t.Errorf("Created = %d, want 1", res.Created)
+	}
+	if len(res.Failures) != 1 || res.Failures[0].Row.DevEUI != "70b3d57ed0000002" || status.Code(res.Failures[0].Err) != codes.PermissionDenied {
+		t.Errorf("Failures = %+v, want 70b3d57ed0000002 denied", res.Failures)
+	}
+	var note RowNote
+	if len(res.Skipped) != 1 || res.Skipped[0].Row.DevEUI != "70b3d57ed0000003" || !errors.As(res.Skipped[0].Err, &note) {
+		t.Errorf("Skipped = %+v, want 70b3d57ed0000003 with a note", res.Skipped)
+	}
+	if len(fr.Input.Invalid) != 1 {
+		t.Errorf("Invalid = %q, want the row with the short DevEUI", fr.Input.Invalid)
+	}
+	if fr.FailuresFile != "" {
+		t.Errorf("FailuresFile = %q without a failures path", fr.FailuresFile)
+	}
+
+	if got := srv.Devices(); !slices.Equal(got, []string{"70b3d57ed0000001", "70b3d57ed0000003"}) {
+		t.Errorf("devices on the server = %q", got)
+	}
+	if k := srv.Keys("70b3d57ed0000001"); k.GetNwkKey() != testKey || k.GetAppKey() != "" {
+		t.Errorf("keys of the created device = %v, want the AppKey as the 1.0.x NwkKey", k)
+	}
+	if k := srv.Keys("70b3d57ed0000003"); k.GetNwkKey() != otherKey {
+		t.Errorf("keys of the existing device = %v, want them left alone", k)
+	}
+
+	for _, c := range srv.Calls("") {
+		if c.Auth != "Bearer "+testToken {
+			t.Errorf("%s sent with authorization %q", c.Method, c.Auth)
+		}
+	}
+
+	data, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "70b3d57ed0000001") {
+		t.Errorf("journal = %s, want the header and the created device", data)
+	}
+}
+
+func TestImportOverwriteKeys(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000001", otherKey)
+	addDevice(srv, imp, "70b3d57ed0000002", "")
+	imp.OverwriteKeys = true
+	imp.Consent = &Consent{}
+
+	res := importList(t, imp, "dev_eui,app_key\n70b3d57ed0000001,"+testKey+"\n70b3d57ed0000002,"+testKey+"\n").Result
+	if res.Created != 0 || res.KeysUpdated != 2 || len(res.Failures) != 0 || len(res.Skipped) != 0 {
+		t.Errorf("Created = %d, KeysUpdated = %d, Failures = %v, Skipped = %v; want both keys updated",
+			res.Created, res.KeysUpdated, res.Failures, res.Skipped)
+	}
+	for _, eui := range []string{"70b3d57ed0000001", "70b3d57ed0000002"} {
+		if k := srv.Keys(eui); k.GetNwkKey() != testKey {
+			t.Errorf("keys of %s = %v, want %s", eui, k, testKey)
+		}
+	}
+	if n := len(srv.Calls(api.DeviceService_UpdateKeys_FullMethodName)); n != 1 {
+		t.Errorf("UpdateKeys called %d times, want once for the device that had keys", n)
+	}
+}
+
+func TestImportOverwriteKeysUnconfirmed(t *testing.T) {
+	srv, imp := fakeServer(t)
+	imp.OverwriteKeys = true
+	cfg := ListOptions{}
+	inputs := []*Input{readList(t, writeList(t, "devices.csv", "dev_eui\n70b3d57ed0000001\n"), cfg)}
+	if _, err := imp.ImportFiles(context.Background(), inputs, NewBatch(cfg, inputs).Scan, nil); !errors.Is(err, ErrUnconfirmed) {
+		t.Fatalf("ImportFiles = %v, want ErrUnconfirmed", err)
+	}
+	if calls := srv.Calls(""); len(calls) != 0 {
+		t.Errorf("%d calls made without consent", len(calls))
+	}
+}
+
+func TestImportDeviceOfOtherApplication(t *testing.T) {
+	srv, imp := fakeServer(t)
+	srv.AddDevice(&api.Device{DevEui: "70b3d57ed0000001", ApplicationId: "elsewhere", DeviceProfileId: imp.ProfileID}, nil)
+
+	res := importList(t, imp, "dev_eui,app_key\n70b3d57ed0000001,"+testKey+"\n").Result
+	if len(res.Failures) != 1 || !strings.Contains(res.Failures[0].Err.Error(), "already exists in application elsewhere") {
+		t.Fatalf("Failures = %v, want the device of the other application", res.Failures)
+	}
+	if k := srv.Keys("70b3d57ed0000001"); k != nil {
+		t.Errorf("keys set on the device of another application: %v", k)
+	}
+}
+
+func TestImportKeysFailed(t *testing.T) {
+	srv, imp := fakeServer(t)
+	srv.Fail(api.DeviceService_CreateKeys_FullMethodName, status.Error(codes.Internal, "database down"))
+	journal := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := NewJournal(journal, "chirpstack:8080", imp.ApplicationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp.Journal = j
+
+	res := importList(t, imp, "dev_eui,app_key\n70b3d57ed0000001,"+testKey+"\n").Result
+	j.Close()
+	if len(res.Failures) != 1 || res.Created != 0 {
+		t.Errorf("Failures = %v, Created = %d; want the row failed", res.Failures, res.Created)
+	}
+	if len(res.Sent) != 1 || res.Sent[0].Row.DevEUI != "70b3d57ed0000001" {
+		t.Errorf("Sent = %+v, want the created device for verify", res.Sent)
+	}
+	data, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "70b3d57ed0000001") {
+		t.Errorf("journal = %s, want the created device for undo", data)
+	}
+}
+
+func TestImportSession(t *testing.T) {
+	srv, imp := fakeServer(t)
+
+	res := importList(t, imp, "dev_eui,dev_addr,nwk_s_key,app_s_key\n70b3d57ed0000001,0x01:02:03:04,"+testKey+","+otherKey+"\n70b3d57ed0000002,,,\n").Result
+	if res.Created != 2 || len(res.Failures) != 0 {
+		t.Fatalf("Created = %d, Failures = %v; want both created", res.Created, res.Failures)
+	}
+	a := srv.Activation("70b3d57ed0000001")
+	if a.GetDevAddr() != "01020304" || a.GetAppSKey() != otherKey || a.GetNwkSEncKey() != testKey || a.GetSNwkSIntKey() != testKey || a.GetFNwkSIntKey() != testKey {
+		t.Errorf("activation = %v, want the session of the row", a)
+	}
+	if a := srv.Activation("70b3d57ed0000002"); a != nil {
+		t.Errorf("device without a session activated: %v", a)
+	}
+}
+
+func TestImportMaxFailures(t *testing.T) {
+	srv, imp := fakeServer(t)
+	down := status.Error(codes.Internal, "database down")
+	srv.Fail(api.DeviceService_Create_FullMethodName, down, down)
+	imp.MaxFailures = FailureLimit{Count: 2}
+
+	fr := importList(t, imp, "dev_eui\n70b3d57ed0000001\n70b3d57ed0000002\n70b3d57ed0000003\n")
+	var abort *Aborted
+	if !errors.As(fr.Stopped, &abort) || abort.Failed != 2 {
+		t.Fatalf("Stopped = %v, want aborted after 2 failures", fr.Stopped)
+	}
+	if len(fr.Result.Failures) != 2 || fr.Result.Created != 0 {
+		t.Errorf("Failures = %v, Created = %d", fr.Result.Failures, fr.Result.Created)
+	}
+	if got := srv.Devices(); len(got) != 0 {
+		t.Errorf("devices created after the limit: %q", got)
+	}
+}
+
+func TestImportChunks(t *testing.T) {
+	_, imp := fakeServer(t)
+	imp.ChunkSize = 2
+	var chunks []ChunkTiming
+	imp.OnChunk = func(c ChunkTiming) { chunks = append(chunks, c) }
+
+	importList(t, imp, "dev_eui\n70b3d57ed0000001\n70b3d57ed0000002\n70b3d57ed0000003\n70b3d57ed0000004\n70b3d57ed0000005\n")
+	var done []int
+	for i, c := range chunks {
+		if c.Count != i+1 {
+			t.Errorf("chunk %d has Count %d", i+1, c.Count)
+		}
+		done = append(done, c.Done)
+	}
+	if !slices.Equal(done, []int{2, 4, 5}) {
+		t.Errorf("chunks end after %v rows, want [2 4 5]", done)
+	}
+	if len(imp.Chunks) != 3 {
+		t.Errorf("Chunks has %d chunks, want 3", len(imp.Chunks))
+	}
+}
+
+func TestImportChunkKeys(t *testing.T) {
+	_, imp := fakeServer(t)
+	imp.ChunkSize = 2
+	imp.GenerateKeys = true
+	cfg := ListOptions{GenerateKeys: true}
+	path := writeList(t, "devices.csv", "dev_eui\n70b3d57ed0000001\n70b3d57ed0000002\n70b3d57ed0000003\n70b3d57ed0000004\n70b3d57ed0000005\n")
+	keysFile := strings.TrimSuffix(path, ".csv") + ".keys.csv"
+	saved := func() int {
+		b, err := os.ReadFile(keysFile)
+		if err != nil {
+			return 0
+		}
+		return strings.Count(string(b), "\n") - 1
+	}
+	imp.OnChunk = func(c ChunkTiming) {
+		if n := saved(); n != c.Done {
+			t.Errorf("%d keys saved by the end of chunk %d, want %d", n, c.Count, c.Done)
+		}
+	}
+
+	inputs := []*Input{readList(t, path, cfg)}
+	results, err := imp.ImportFiles(context.Background(), inputs, NewBatch(cfg, inputs).Scan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].KeysFile != keysFile {
+		t.Errorf("KeysFile = %q, want %q", results[0].KeysFile, keysFile)
+	}
+	if n := saved(); n != 5 {
+		t.Errorf("%d keys saved, want each of the 5 once", n)
+	}
+}
+
+func TestImportChunkFailuresToStderr(t *testing.T) {
+	srv, imp := fakeServer(t)
+	imp.ChunkSize = 1
+	srv.Fail(api.DeviceService_Create_FullMethodName, status.Error(codes.PermissionDenied, "no"), status.Error(codes.PermissionDenied, "no"))
+
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f *os.File) { os.Stderr = f }(os.Stderr)
+	os.Stderr = stderr
+
+	cfg := ListOptions{}
+	inputs := []*Input{readList(t, writeList(t, "devices.csv", "dev_eui\n70b3d57ed0000001\n70b3d57ed0000002\n70b3d57ed0000003\n"), cfg)}
+	toStderr := func(string) string { return "" }
+	if _, err := imp.ImportFiles(context.Background(), inputs, NewBatch(cfg, inputs).Scan, toStderr); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "dev_eui,"); n != 1 {
+		t.Errorf("the failed rows were written to stderr %d times, want once:\n%s", n, b)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000002", "")
+	imp.DryRun = true
+
+	res := importList(t, imp, "dev_eui,app_key\n70b3d57ed0000001,"+testKey+"\n70b3d57ed0000002,\n").Result
+	if res.Created != 1 {
+		t.Errorf("Created = %d, want the new device counted", res.Created)
+	}
+	if len(res.Failures) != 1 || status.Code(res.Failures[0].Err) != codes.AlreadyExists {
+		t.Errorf("Failures = %v, want the existing device", res.Failures)
+	}
+	for _, method := range []string{api.DeviceService_Create_FullMethodName, api.DeviceService_CreateKeys_FullMethodName, api.DeviceService_Enqueue_FullMethodName} {
+		if n := len(srv.Calls(method)); n > 0 {
+			t.Errorf("dry run called %s %d times", method, n)
+		}
+	}
+	if got := srv.Devices(); !slices.Equal(got, []string{"70b3d57ed0000002"}) {
+		t.Errorf("devices on the server = %q", got)
+	}
+}
+
+func TestRemoveUnlisted(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000001", "")
+	addDevice(srv, imp, "70b3d57ed0000002", "")
+	unlisted := []*api.DeviceListItem{{DevEui: "70b3d57ed0000001"}, {DevEui: "70b3d57ed0000002"}, {DevEui: "70b3d57ed0000003"}}
+	srv.Fail(api.DeviceService_Delete_FullMethodName, nil, status.Error(codes.PermissionDenied, "not allowed"))
+
+	if _, err := imp.RemoveUnlisted(context.Background(), unlisted); !errors.Is(err, ErrUnconfirmed) {
+		t.Fatalf("RemoveUnlisted without consent = %v, want ErrUnconfirmed", err)
+	}
+
+	imp.Consent = &Consent{}
+	var rows []string
+	imp.OnRow = func(source string, row Row, err error) {
+		if source != UnlistedSource {
+			t.Errorf("source = %q", source)
+		}
+		rows = append(rows, row.DevEUI)
+	}
+	res, err := imp.RemoveUnlisted(context.Background(), unlisted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 1 || res.Removed[0].DevEUI != "70b3d57ed0000001" || len(res.Failures) != 1 || res.Absent != 1 {
+		t.Errorf("Removed = %v, Failures = %v, Absent = %d", res.Removed, res.Failures, res.Absent)
+	}
+	if len(rows) != 3 {
+		t.Errorf("OnRow called for %q, want every device", rows)
+	}
+	if got := srv.Devices(); !slices.Equal(got, []string{"70b3d57ed0000002"}) {
+		t.Errorf("devices on the server = %q", got)
+	}
+}
+
+func TestRemoveUnlistedDryRun(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000001", "")
+	imp.DryRun = true
+
+	if _, err := imp.RemoveUnlisted(context.Background(), []*api.DeviceListItem{{DevEui: "70b3d57ed0000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := srv.Calls(""); len(calls) != 0 {
+		t.Errorf("dry run made %d calls", len(calls))
+	}
+	if srv.Device("70b3d57ed0000001") == nil {
+		t.Error("dry run deleted the device")
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv, imp := fakeServer(t)
+	addDevice(srv, imp, "70b3d57ed0000003", otherKey)
+	addDevice(srv, imp, "70b3d57ed0000005", "")
+	path := writeList(t, "devices.csv", `dev_eui,app_key
+70b3d57ed0000001,`+testKey+`
+70b3d57ed0000002,
+70b3d57ed0000003,`+testKey+`
+70b3d57ed000004,
+70b3d57ed0000005,`+testKey+`
+`)
+
+	var progress []ProgressEvent
+	report, err := Run(context.Background(), Options{
+		Token:         testToken,
+		ApplicationID: imp.ApplicationID,
+		ProfileID:     imp.ProfileID,
+		Mode:          ModeImport,
+		Concurrency:   1,
+		Inputs:        []string{path},
+		Conn:          srv.Dial(t),
+	}, func(e ProgressEvent) { progress = append(progress, e) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Created) != 2 || len(report.Updated) != 1 || len(report.Skipped) != 1 || len(report.Failed) != 1 {
+		t.Fatalf("report = %+v, want 2 created, 1 re-keyed, 1 skipped and the invalid row failed", report)
+	}
+	if report.Updated[0].Row.DevEUI != "70b3d57ed0000005" {
+		t.Errorf("updated %s, want the device that had no keys", report.Updated[0].Row.DevEUI)
+	}
+	if report.Skipped[0].Row.DevEUI != "70b3d57ed0000003" {
+		t.Errorf("skipped %s, want the device that has keys", report.Skipped[0].Row.DevEUI)
+	}
+	if len(progress) != 4 || progress[3].Done != 4 || progress[3].Total != 4 {
+		t.Fatalf("progress = %+v, want 4 of 4 rows", progress)
+	}
+	want := []RowStatus{StatusCreated, StatusCreated, StatusSkipped, StatusUpdated}
+	for i, e := range progress {
+		if e.Status != want[i] {
+			t.Errorf("row %s is %s, want %s", e.Row.DevEUI, e.Status, want[i])
+		}
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	srv, imp := fakeServer(t)
+	path := writeList(t, "devices.csv", "dev_eui\n70b3d57ed0000001\n70b3d57ed0000002\n70b3d57ed0000003\n")
+	stream, _, events := collect(16)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stopped := errors.New("stopped")
+
+	report, err := Run(ctx, Options{
+		Token:         testToken,
+		ApplicationID: imp.ApplicationID,
+		ProfileID:     imp.ProfileID,
+		Mode:          ModeImport,
+		Concurrency:   1,
+		Inputs:        []string{path},
+		Conn:          srv.Dial(t),
+		Events:        stream,
+	}, func(ProgressEvent) { cancel(stopped) })
+	if !errors.Is(err, stopped) {
+		t.Fatalf("Run = %v, want it stopped after the first row", err)
+	}
+
+	got := events()
+	if r, ok := got[1].(RowFinished); !ok || r.Status != StatusCreated {
+		t.Errorf("second event = %+v, want the first row created", got[1])
+	}
+	f, ok := got[len(got)-1].(RunFinished)
+	if !ok {
+		t.Fatalf("last event = %T, want RunFinished", got[len(got)-1])
+	}
+	if !errors.Is(f.Err, stopped) || len(f.Results) != 1 {
+		t.Errorf("RunFinished has Err %v and %d results, want why the run stopped with what it did", f.Err, len(f.Results))
+	}
+	if len(f.Report.Created) != 1 || len(report.Created) != 1 {
+		t.Errorf("RunFinished has report %+v, Run returned %+v; want the created row in both", f.Report, report)
+	}
+}
+
+func TestRunURL(t *testing.T) {
+	srv, imp := fakeServer(t)
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "dev_eui\n70b3d57ed0000001\n")
+	}))
+	defer list.Close()
+
+	report, err := Run(context.Background(), Options{
+		Token:         testToken,
+		ApplicationID: imp.ApplicationID,
+		ProfileID:     imp.ProfileID,
+		Mode:          ModeImport,
+		Concurrency:   1,
+		Inputs:        []string{list.URL + "/devices.csv"},
+		Conn:          srv.Dial(t),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 1 {
+		t.Errorf("report = %+v, want the downloaded device created", report)
+	}
+}
@@ -0,0 +1,173 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// jsonDevice is the shape of one entry in a JSON device list.
+type jsonDevice struct {
+	DevEUI      string            `json:"dev_eui"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	JoinEUI     string            `json:"join_eui"`
+	AppKey      string            `json:"app_key"`
+	NwkKey      string            `json:"nwk_key"`
+	DevAddr     string            `json:"dev_addr"`
+	NwkSKey     string            `json:"nwk_s_key"`
+	AppSKey     string            `json:"app_s_key"`
+	Tags        map[string]string `json:"tags"`
+	Variables   map[string]string `json:"variables"`
+
+	DeviceProfile     string `json:"device_profile"`
+	Application       string `json:"application"`
+	MulticastGroup    string `json:"multicast_group"`
+	TargetApplication string `json:"target_application"`
+	VendorID          string `json:"vendor_id"`
+	VendorProfileID   string `json:"vendor_profile_id"`
+	DownlinkPayload   string `json:"downlink_payload"`
+	DownlinkFPort     uint32 `json:"downlink_fport"`
+	IsDisabled        *bool  `json:"is_disabled"`
+	SkipFCntCheck     bool   `json:"skip_fcnt_check"`
+}
+
+// readJSON reads a JSON array of device objects, a single object, or one
+// object per line as the TTS CLI emits them. Entries are decoded one at a
+// time so that large files don't have to be held in memory as a whole, and an
+// entry that doesn't match the expected shape is reported by its index
+// without aborting the rest of the file. End devices exported from The
+// Things Stack are recognized by their ids object, see ttsRow.
+func readJSON(r io.Reader, s *scanner) error {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return fmt.Errorf("reading JSON: %w", err)
+	}
+	dec := json.NewDecoder(br)
+
+	array := first == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("reading JSON: %w", err)
+		}
+	} else if first != '{' {
+		return fmt.Errorf("reading JSON: expected an array of devices or one object per device")
+	}
+
+	ignored := make(map[string]bool) // TTS fields without a ChirpStack equivalent
+	i, tts := 0, 0
+	for ; !array || dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF && !array {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading JSON: [%d]: %w", i, err)
+		}
+
+		row, isTTS, err := jsonRow(raw, i, ignored)
+		if isTTS {
+			tts++
+		}
+		if err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				s.reject(fmt.Sprintf("[%d].%s: unexpected %s", i, typeErr.Field, typeErr.Value))
+			} else {
+				s.reject(fmt.Sprintf("[%d]: %v", i, err))
+			}
+			continue
+		}
+		if err := s.add(row); err != nil {
+			return err
+		}
+	}
+
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("reading JSON: %w", err)
+		}
+	}
+	if len(ignored) > 0 {
+		s.in.Warnings = append(s.in.Warnings, "ignored The Things Stack fields without a ChirpStack equivalent: "+
+			strings.Join(slices.Sorted(maps.Keys(ignored)), ", "))
+	}
+
+	format := "JSON array"
+	switch {
+	case !array && i > 1:
+		format = "JSON lines"
+	case !array:
+		format = "JSON object"
+	}
+	if tts > 0 {
+		format = "The Things Stack end devices, " + format
+	}
+	s.setFormat(fmt.Sprintf("%s, %d entries", format, i))
+	return nil
+}
+
+// peekNonSpace returns the first byte of r that isn't white space, leaving
+// it to be read.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// jsonRow decodes the entry at index i of a JSON device list, in our own
+// shape or as a TTS end device; isTTS tells which. The fields of a TTS end
+// device that are dropped are added to ignored.
+func jsonRow(raw json.RawMessage, i int, ignored map[string]bool) (row Row, isTTS bool, err error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return Row{}, false, err
+	}
+	if _, ok := fields["ids"]; ok {
+		row, err := ttsRow(raw, fields, ignored)
+		row.Pos = RowPos{Index: i}
+		return row, true, err
+	}
+
+	var d jsonDevice
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return Row{}, false, err
+	}
+	return Row{
+		Pos:         RowPos{Index: i},
+		DevEUI:      d.DevEUI,
+		Name:        d.Name,
+		Description: d.Description,
+		JoinEUI:     d.JoinEUI,
+		AppKey:      d.AppKey,
+		nwkKey:      d.NwkKey,
+		Tags:        d.Tags,
+		variables:   d.Variables,
+		devAddr:     d.DevAddr,
+		nwkSKey:     d.NwkSKey,
+		appSKey:     d.AppSKey,
+
+		Profile:           d.DeviceProfile,
+		application:       d.Application,
+		multicastGroup:    d.MulticastGroup,
+		targetApplication: d.TargetApplication,
+		VendorID:          d.VendorID,
+		VendorProfileID:   d.VendorProfileID,
+		downlinkPayload:   d.DownlinkPayload,
+		downlinkFPort:     d.DownlinkFPort,
+		isDisabled:        d.IsDisabled != nil && *d.IsDisabled,
+		disabledSet:       d.IsDisabled != nil,
+		skipFCntCheck:     d.SkipFCntCheck,
+	}, false, nil
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// GeneratedKey is a set of root keys the tool generated and provisioned for
+// a device. The NwkKey is only generated for LoRaWAN 1.1 devices.
+type GeneratedKey struct {
+	devEUI string
+	appKey string
+	nwkKey string
+}
+
+// IsLoRaWAN11 reports whether devices of MAC version v have separate AppKey
+// and NwkKey root keys.
+func IsLoRaWAN11(v common.MacVersion) bool {
+	return v >= common.MacVersion_LORAWAN_1_1_0
+}
+
+// rootKeys places the keys of row in the DeviceKeys fields that devices of
+// MAC version v use, or returns nil if the row has none. LoRaWAN 1.0.x
+// devices have a single root key, the AppKey, which ChirpStack keeps in the
+// NwkKey field; LoRaWAN 1.1 devices need both keys, and a device given the
+// wrong ones never joins.
+func rootKeys(row Row, v common.MacVersion) (*api.DeviceKeys, error) {
+	if row.AppKey == "" && row.nwkKey == "" {
+		return nil, nil
+	}
+
+	if IsLoRaWAN11(v) {
+		switch {
+		case row.nwkKey == "":
+			return nil, fmt.Errorf("%s devices need an nwk_key as well as an app_key", MACVersionName(v))
+		case row.AppKey == "":
+			return nil, fmt.Errorf("%s devices need an app_key as well as an nwk_key", MACVersionName(v))
+		}
+		return &api.DeviceKeys{DevEui: row.DevEUI, NwkKey: row.nwkKey, AppKey: row.AppKey}, nil
+	}
+
+	key := row.AppKey
+	switch {
+	case key == "":
+		key = row.nwkKey
+	case row.nwkKey != "" && !strings.EqualFold(row.nwkKey, key):
+		return nil, fmt.Errorf("%s devices have a single root key, but app_key and nwk_key differ", MACVersionName(v))
+	}
+	return &api.DeviceKeys{DevEui: row.DevEUI, NwkKey: key}, nil
+}
+
+// keysFor returns the root keys of the device of row for the MAC version of
+// its device profile, or nil if it has none. When key generation is enabled
+// the missing keys are generated first and returned in generated, so that
+// they can be saved.
+func (imp *Importer) keysFor(ctx context.Context, row Row) (keys *api.DeviceKeys, generated *GeneratedKey, err error) {
+	if row.AppKey == "" && row.nwkKey == "" && (!imp.GenerateKeys || imp.DryRun) {
+		return nil, nil, nil
+	}
+
+	profileID, err := imp.profileFor(ctx, row)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := imp.macVersion(ctx, profileID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if imp.GenerateKeys && !imp.DryRun {
+		g := GeneratedKey{devEUI: row.DevEUI}
+		if row.AppKey == "" && (row.nwkKey == "" || IsLoRaWAN11(v)) {
+			if g.appKey, err = lorakey.NewKey(); err != nil {
+				return nil, nil, fmt.Errorf("generating AppKey: %w", err)
+			}
+			row.AppKey = g.appKey
+		}
+		if row.nwkKey == "" && IsLoRaWAN11(v) {
+			if g.nwkKey, err = lorakey.NewKey(); err != nil {
+				return nil, nil, fmt.Errorf("generating NwkKey: %w", err)
+			}
+			row.nwkKey = g.nwkKey
+		}
+		if g.appKey != "" || g.nwkKey != "" {
+			generated = &g
+		}
+	}
+
+	keys, err = rootKeys(row, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, generated, nil
+}
+
+// keysPath returns where the keys generated for an import from source are
+// written: next to the source file, or in the current directory for stdin
+// and downloads.
+func keysPath(source string) string {
+	switch {
+	case source == "" || source == "-":
+		return "stdin.keys.csv"
+	case IsURL(source):
+		return "download.keys.csv"
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".keys.csv"
+}
+
+// flushKeys appends the keys generated for fr since the last flush to its
+// keys file, see keysPath.
+func (fr *FileResult) flushKeys() error {
+	keys := fr.Result.Keys[fr.keysSaved:]
+	if len(keys) == 0 {
+		return nil
+	}
+	fr.KeysFile = keysPath(fr.Input.Source)
+	if err := saveKeys(fr.KeysFile, keys); err != nil {
+		return err
+	}
+	fr.keysSaved = len(fr.Result.Keys)
+	return nil
+}
+
+// saveKeys appends keys to the CSV file at path, creating it readable by the
+// owner only. An existing file is appended to rather than replaced, so keys
+// from an earlier run aren't lost before they've been loaded onto devices.
+func saveKeys(path string, keys []GeneratedKey) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	// The mode above only applies to new files.
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+
+	cw := csv.NewWriter(f)
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		cw.Write([]string{"dev_eui", "app_key", "nwk_key"})
+	}
+	for _, k := range keys {
+		cw.Write([]string{k.devEUI, k.appKey, k.nwkKey})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+)
+
+// listLookups is how many per-item calls the list loaders make at once when
+// fetching counts for the descriptions.
+const listLookups = 8
+
+// ForEachParallel calls fn for every index below n, listLookups at a time,
+// and waits for all calls to return.
+func ForEachParallel(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, listLookups)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			fn(i)
+			<-sem
+		}()
+	}
+	wg.Wait()
+}
+
+// MACVersionName formats a MAC version as in the LoRaWAN specifications,
+// e.g. "LoRaWAN 1.0.3".
+func MACVersionName(v common.MacVersion) string {
+	name := strings.TrimPrefix(v.String(), "LORAWAN_")
+	return "LoRaWAN " + strings.ReplaceAll(name, "_", ".")
+}
+
+// ListDevices returns every device of an application, fetching them a page
+// at a time. progress, if not nil, is called after each page with the number
+// of devices fetched so far and the total.
+func ListDevices(ctx context.Context, client api.DeviceServiceClient, applicationID string, progress func(done, total int)) ([]*api.DeviceListItem, error) {
+	var devices []*api.DeviceListItem
+	for {
+		resp, err := client.List(ctx, &api.ListDevicesRequest{
+			ApplicationId: applicationID,
+			Limit:         ListPageSize,
+			Offset:        uint32(len(devices)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, resp.Result...)
+		if progress != nil {
+			progress(len(devices), int(resp.TotalCount))
+		}
+		// Devices added while paging can push the total up; an empty page
+		// ends the listing either way.
+		if len(resp.Result) == 0 || len(devices) >= int(resp.TotalCount) {
+			return devices, nil
+		}
+	}
+}
+
+// ListDeviceProfiles lists every device profile of the tenant tenantID, a
+// page at a time.
+func ListDeviceProfiles(ctx context.Context, client api.DeviceProfileServiceClient, tenantID string) ([]*api.DeviceProfileListItem, error) {
+	var profiles []*api.DeviceProfileListItem
+	for offset := uint32(0); ; offset += ListPageSize {
+		resp, err := client.List(ctx, &api.ListDeviceProfilesRequest{
+			TenantId: tenantID,
+			Limit:    ListPageSize,
+			Offset:   offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, resp.Result...)
+		if len(resp.Result) < ListPageSize {
+			return profiles, nil
+		}
+	}
+}
+
+// ListGateways returns every gateway of a tenant, fetching them a page at a
+// time like ListDevices. The gateways are listed by ID rather than by name,
+// so that one renamed while paging can't move to a page already fetched;
+// one added while paging can still push the others a page further, so
+// gateways already fetched are skipped.
+func ListGateways(ctx context.Context, client api.GatewayServiceClient, tenantID string, progress func(done, total int)) ([]*api.GatewayListItem, error) {
+	var gateways []*api.GatewayListItem
+	seen := map[string]bool{}
+	offset := 0
+	for {
+		resp, err := client.List(ctx, &api.ListGatewaysRequest{
+			TenantId: tenantID,
+			Limit:    ListPageSize,
+			Offset:   uint32(offset),
+			OrderBy:  api.ListGatewaysRequest_GATEWAY_ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		offset += len(resp.Result)
+		for _, gw := range resp.Result {
+			if !seen[gw.GatewayId] {
+				seen[gw.GatewayId] = true
+				gateways = append(gateways, gw)
+			}
+		}
+		if progress != nil {
+			progress(len(gateways), int(resp.TotalCount))
+		}
+		if len(resp.Result) == 0 || offset >= int(resp.TotalCount) {
+			return gateways, nil
+		}
+	}
+}
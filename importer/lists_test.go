@@ -0,0 +1,28 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestListDevices(t *testing.T) {
+	srv, imp := fakeServer(t)
+	for i := range ListPageSize + 5 {
+		addDevice(srv, imp, fmt.Sprintf("70b3d57ed%07x", i), "")
+	}
+
+	pages := 0
+	devices, err := ListDevices(AuthContext(context.Background(), testToken), imp.Devices, imp.ApplicationID, func(done, total int) {
+		pages++
+		if total != ListPageSize+5 {
+			t.Errorf("progress total = %d, want %d", total, ListPageSize+5)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != ListPageSize+5 || pages != 2 {
+		t.Errorf("listed %d devices in %d pages, want %d in 2", len(devices), pages, ListPageSize+5)
+	}
+}
@@ -0,0 +1,25 @@
+package importer
+
+import "log/slog"
+
+// RowAttrs are the fields of the records about row: its DevEUI and where it
+// is in its list.
+func RowAttrs(row Row) []any {
+	if row.Pos.Line == 0 {
+		return []any{"dev_eui", row.DevEUI, "index", row.Pos.Index}
+	}
+	return []any{"dev_eui", row.DevEUI, "row", row.Pos.Line}
+}
+
+// logger returns the logger of the import, or the default one.
+func (imp *Importer) logger() *slog.Logger {
+	if imp.Log != nil {
+		return imp.Log
+	}
+	return slog.Default()
+}
+
+// logRow returns the logger of the import for the records about row.
+func (imp *Importer) logRow(row Row) *slog.Logger {
+	return imp.logger().With(RowAttrs(row)...)
+}
@@ -0,0 +1,61 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ColumnMapping assigns the columns of a file with unrecognized headers to
+// device fields. It is saved as a preset under a name and applied
+// automatically to later files with the same header signature, or to every
+// file with --mapping.
+type ColumnMapping struct {
+	Name      string            `json:"name"`
+	Signature string            `json:"signature"`
+	Columns   map[string]string `json:"columns"` // field name -> header
+
+	Path string `json:"-"` // file the preset was loaded from, empty for a new one
+}
+
+// HeaderSignature identifies a header row independent of case and
+// punctuation.
+func HeaderSignature(header []string) string {
+	norm := make([]string, len(header))
+	for i, h := range header {
+		norm[i] = NormalizeHeader(h)
+	}
+	return strings.Join(norm, ",")
+}
+
+// headerMap builds the mapping of header's columns described by cm.
+func (cm ColumnMapping) headerMap(header []string) (HeaderMap, bool) {
+	m := make(HeaderMap, len(header))
+	ok := false
+	for field, h := range cm.Columns {
+		def := lookupColumn(field)
+		if def == nil {
+			continue
+		}
+		for i, col := range header {
+			if strings.TrimSpace(col) == h {
+				m[i] = headerColumn{def.Name, def.set}
+				ok = ok || def.Name == "dev_eui"
+			}
+		}
+	}
+	return m, ok
+}
+
+// HeaderError is returned when a header row has no DevEUI column and no
+// saved mapping matches it, so that the TUI can offer to map the columns by
+// hand.
+type HeaderError struct {
+	Source string
+	Header []string
+	Sample []string // first data row, for previews
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("no dev_eui column in header (%s); rename the columns or map them in the interactive UI",
+		strings.Join(e.Header, ", "))
+}
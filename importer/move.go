@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// MovedDevice is a device moved to another application.
+type MovedDevice struct {
+	Row      Row
+	From, To string // application IDs
+}
+
+// targetFor returns the application row moves its device to: its own
+// target_application column, resolved by name unless it is an ID, or
+// --to-application. An application given by ID must be in the tenant of
+// the selected application, so that a move can't take a device out of it.
+func (imp *Importer) targetFor(ctx context.Context, row Row) (string, error) {
+	target := row.targetApplication
+	if target == "" {
+		target = imp.TargetApplication
+	}
+	if target == "" {
+		return "", errors.New("no target application")
+	}
+	id, err := imp.applicationFor(ctx, Row{application: target})
+	if err != nil || !LooksLikeUUID(target) {
+		return id, err
+	}
+
+	imp.cache.Lock()
+	tenantID, ok := imp.targetTenants[id]
+	imp.cache.Unlock()
+	if !ok {
+		resp, err := imp.Apps.Get(ctx, &api.GetApplicationRequest{Id: id})
+		if err != nil {
+			return "", fmt.Errorf("looking up application %s: %w", id, err)
+		}
+		tenantID = resp.Application.TenantId
+		imp.cache.Lock()
+		if imp.targetTenants == nil {
+			imp.targetTenants = make(map[string]string)
+		}
+		imp.targetTenants[id] = tenantID
+		imp.cache.Unlock()
+	}
+	own, err := imp.Tenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tenantID != own {
+		return "", fmt.Errorf("application %s is in another tenant", id)
+	}
+	return id, nil
+}
+
+// moveRow moves the device of row to its target application and records
+// the outcome in res. The device is read first and written back whole with
+// the new application, keeping its frame counters and history; one already
+// in the target is skipped. As when deleting, a device of another
+// application than the row's is a failure.
+func (imp *Importer) moveRow(ctx context.Context, row Row, res *Result) error {
+	from, to, err := imp.move(ctx, row)
+	var note RowNote
+	switch {
+	case errors.As(err, &note):
+		res.Skipped = append(res.Skipped, RowFailure{Row: row, Err: err})
+	case err != nil:
+		imp.logRow(row).Error("Failed to move the device", "err", err)
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+	default:
+		if !imp.DryRun {
+			imp.logRow(row).Info("Moved the device", "from", from, "to", to)
+		}
+		res.Moved = append(res.Moved, MovedDevice{Row: row, From: from, To: to})
+	}
+	return err
+}
+
+// move sets the application of the device of row to its target and returns
+// the old and the new application. On a dry run the device is only looked
+// up.
+func (imp *Importer) move(ctx context.Context, row Row) (from, to string, err error) {
+	from, err = imp.applicationFor(ctx, row)
+	if err != nil {
+		return "", "", err
+	}
+	to, err = imp.targetFor(ctx, row)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return "", "", status.Errorf(codes.NotFound, "device %s not found", row.DevEUI)
+	case err != nil:
+		return "", "", err
+	case resp.Device.GetApplicationId() == to:
+		return "", "", RowNote("already in application " + to)
+	case resp.Device.GetApplicationId() != from:
+		return "", "", fmt.Errorf("device belongs to application %s, not %s", resp.Device.GetApplicationId(), from)
+	}
+
+	d := resp.Device
+	d.ApplicationId = to
+	req := &api.UpdateDeviceRequest{Device: d}
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_Update_FullMethodName, req, nil)
+		return from, to, nil
+	}
+	if _, err := imp.Devices.Update(ctx, req); err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
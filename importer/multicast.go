@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// joinGroup adds the device of row to its multicast group, the row's own
+// multicast_group column or the selected group, and records the outcome in
+// res. Rows without a group are left alone. On a dry run the group is only
+// resolved.
+func (imp *Importer) joinGroup(ctx context.Context, row Row, res *Result) {
+	group := row.multicastGroup
+	if group == "" {
+		group = imp.MulticastGroup
+	}
+	if group == "" {
+		return
+	}
+
+	groupID, err := imp.multicastGroupFor(ctx, row, group)
+	req := &api.AddDeviceToMulticastGroupRequest{MulticastGroupId: groupID, DevEui: row.DevEUI}
+	switch {
+	case imp.DryRun:
+		imp.Audit.DryRun(ctx, api.MulticastGroupService_AddDevice_FullMethodName, req, err)
+	case err == nil:
+		_, err = imp.Multicast.AddDevice(ctx, req)
+	}
+	if err != nil {
+		imp.logRow(row).Error("Failed to add the device to the multicast group", "group", group, "rpc", api.MulticastGroupService_AddDevice_FullMethodName, "err", err)
+		res.GroupFailures = append(res.GroupFailures, RowFailure{Row: row, Err: err})
+		return
+	}
+	res.Grouped++
+}
+
+// joinsGroup reports whether a row that failed with err names a device that
+// should still join its multicast group: one that already existed.
+func joinsGroup(err error) bool {
+	return err == nil || status.Code(err) == codes.AlreadyExists
+}
@@ -0,0 +1,58 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+const NamesAllow = "allow" // don't check
+
+const NamesSuffix = "suffix" // rename the rows to the suggested names
+
+// checkName flags row, at where, if its name is used by an earlier row of
+// the batch or by another device of the application, and suggests a unique
+// one, e.g. "meter-12 (2)". ChirpStack allows duplicate names, but devices
+// that share one can't be told apart in its UI. With --duplicate-names
+// suffix the row is renamed instead.
+func (b *Batch) checkName(in *Input, row *Row, where string) {
+	if row.Name == "" || !b.cfg.Mode.Creates() || b.cfg.DuplicateNames == NamesAllow {
+		return
+	}
+	where = strings.TrimSuffix(where, "dev_eui") + "name"
+
+	var clash string
+	if first, ok := b.names[row.Name]; ok {
+		clash = "also used by " + first
+	} else if eui, ok := b.cfg.ServerNames[row.Name]; ok && eui != row.DevEUI {
+		clash = "already used by device " + eui + " of the application"
+	}
+	if clash == "" {
+		b.names[row.Name] = where
+		return
+	}
+
+	unique := b.uniqueName(row.Name)
+	b.suggested[unique] = true
+	in.NameClashes++
+	if b.cfg.DuplicateNames == NamesSuffix {
+		in.Warnings = append(in.Warnings, fmt.Sprintf("%s: %q is %s, renamed to %q", row.Pos.Field("name"), row.Name, clash, unique))
+		row.Name = unique
+		b.names[unique] = where
+	} else {
+		in.Warnings = append(in.Warnings, fmt.Sprintf("%s: %q is %s; %q would be unique", row.Pos.Field("name"), row.Name, clash, unique))
+		row.UniqueName = unique
+	}
+}
+
+// uniqueName returns name with the first number suffix that isn't used by
+// the batch or on the server, or suggested for another row.
+func (b *Batch) uniqueName(name string) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		_, inBatch := b.names[candidate]
+		_, onServer := b.cfg.ServerNames[candidate]
+		if !inBatch && !onServer && !b.suggested[candidate] {
+			return candidate
+		}
+	}
+}
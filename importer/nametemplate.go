@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// namePlaceholder matches the placeholders of a name template: {eui},
+// {eui_lastN} and {row}, the latter with an optional printf-style width such
+// as {row:04d}.
+var namePlaceholder = regexp.MustCompile(`\{([a-z_0-9]+)(?::([^}]*))?\}`)
+
+// NameTemplate synthesizes device names for rows that don't have one, e.g.
+// "meter-{eui_last4}" or "sensor-{row:04d}".
+type NameTemplate string
+
+// ParseNameTemplate checks that every placeholder in s is known.
+func ParseNameTemplate(s string) (NameTemplate, error) {
+	for _, m := range namePlaceholder.FindAllStringSubmatch(s, -1) {
+		name, format := m[1], m[2]
+		switch {
+		case name == "eui" && format == "":
+		case strings.HasPrefix(name, "eui_last") && format == "":
+			if n, err := strconv.Atoi(strings.TrimPrefix(name, "eui_last")); err != nil || n < 1 || n > 16 {
+				return "", fmt.Errorf("name template: %s must end in a number from 1 to 16", m[0])
+			}
+		case name == "row":
+			if format != "" && !strings.HasSuffix(format, "d") {
+				return "", fmt.Errorf("name template: %s must use an integer format such as {row:04d}", m[0])
+			}
+		default:
+			return "", fmt.Errorf("name template: unknown placeholder %s (use {eui}, {eui_lastN} or {row})", m[0])
+		}
+	}
+	return NameTemplate(s), nil
+}
+
+// expand returns the name for a device with the given normalized EUI at the
+// given 1-based row of its file.
+func (t NameTemplate) expand(eui string, row int) string {
+	return namePlaceholder.ReplaceAllStringFunc(string(t), func(p string) string {
+		m := namePlaceholder.FindStringSubmatch(p)
+		name, format := m[1], m[2]
+		switch {
+		case name == "eui":
+			return eui
+		case strings.HasPrefix(name, "eui_last"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(name, "eui_last"))
+			if n > len(eui) {
+				return eui
+			}
+			return eui[len(eui)-n:]
+		case name == "row":
+			if format == "" {
+				format = "d"
+			}
+			return fmt.Sprintf("%"+format, row)
+		}
+		return p
+	})
+}
+
+// euiName returns the name of a device with the normalized EUI eui whose
+// row has no name and no name template applies: the EUI, upper-cased and
+// with a prefix if so configured.
+func (cfg ListOptions) euiName(eui string) string {
+	if cfg.EUINameUpper {
+		eui = strings.ToUpper(eui)
+	}
+	return cfg.EUINamePrefix + eui
+}
@@ -0,0 +1,50 @@
+package importer
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseGate holds an import between rows while it is paused, e.g. to take
+// load off a struggling server. The row in flight is finished first.
+type PauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed on resume; nil while running
+}
+
+// Pause makes the import wait before its next row.
+func (g *PauseGate) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets the import continue.
+func (g *PauseGate) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// wait blocks while the import is paused, or until ctx is done. A nil
+// *PauseGate never pauses.
+func (g *PauseGate) wait(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
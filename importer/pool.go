@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxWorkers is the most rows an import works on at once.
+const MaxWorkers = 32
+
+// WorkerPool limits how many rows of an import are in flight at once. The
+// limit can change while the import runs: raising it lets more rows start
+// right away, lowering it lets the rows in flight finish and starts no more
+// until fewer are left than the new limit. A nil *WorkerPool runs one row
+// at a time.
+type WorkerPool struct {
+	mu     sync.Mutex
+	free   *sync.Cond // signalled when a row finishes or the limit changes
+	size   int
+	active int
+}
+
+func NewWorkerPool(size int) *WorkerPool {
+	p := &WorkerPool{size: min(max(size, 1), MaxWorkers)}
+	p.free = sync.NewCond(&p.mu)
+	return p
+}
+
+// Acquire waits for a worker to take a row.
+func (p *WorkerPool) Acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.active >= p.size {
+		p.free.Wait()
+	}
+	p.active++
+}
+
+// Release returns the worker of a row that has finished.
+func (p *WorkerPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	p.free.Broadcast()
+}
+
+// Resize sets the number of workers, between 1 and MaxWorkers, and returns
+// it.
+func (p *WorkerPool) Resize(size int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = min(max(size, 1), MaxWorkers)
+	p.free.Broadcast()
+	return p.size
+}
+
+// Workers returns the number of workers.
+func (p *WorkerPool) Workers() int {
+	if p == nil {
+		return 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Pacer spaces the rows of an import out to a rate, in rows per second, that
+// can change while the import runs. A nil *Pacer or a rate of 0 doesn't hold
+// rows back.
+type Pacer struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time // when the next row may start
+}
+
+func NewPacer(rate float64) *Pacer {
+	return &Pacer{rate: max(rate, 0)}
+}
+
+// wait blocks until the next row may start, or until ctx is done.
+func (p *Pacer) wait(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.rate <= 0 {
+		p.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	start := p.next
+	if start.Before(now) {
+		start = now
+	}
+	p.next = start.Add(time.Duration(float64(time.Second) / p.rate))
+	p.mu.Unlock()
+
+	t := time.NewTimer(time.Until(start))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// SetRate changes the rate, 0 for no limit, and returns it.
+func (p *Pacer) SetRate(rate float64) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rate = max(rate, 0)
+	p.next = time.Time{}
+	return p.rate
+}
+
+// Limit returns the rate, 0 for no limit.
+func (p *Pacer) Limit() float64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rate
+}
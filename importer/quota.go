@@ -0,0 +1,28 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// isQuotaError reports whether err is the server refusing a device because
+// the tenant has reached its device limit. Every later row would fail the
+// same way.
+func isQuotaError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		return true
+	}
+	return strings.Contains(strings.ToLower(status.Convert(err).Message()), "max number of devices")
+}
+
+// Why an import stopped before the end of its lists
+var (
+	errQuotaExceeded = errors.New("the tenant has reached its device limit")
+	errLimitReached  = errors.New("the import was truncated to fit the tenant's device limit")
+)
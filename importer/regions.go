@@ -0,0 +1,48 @@
+package importer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// regionWarning returns a warning if the valid rows of in use device
+// profiles of more than one region, as a list meant for one network mixing
+// in a profile for another is a common mistake. Rows without a profile
+// column use the selected profile. Profiles that aren't in
+// cfg.ProfileRegions are left to fail on import.
+func regionWarning(in *Input, cfg ListOptions) string {
+	if cfg.ProfileRegions == nil || !cfg.Mode.NeedsProfile() {
+		return ""
+	}
+	rows := make(map[string]int)              // region -> rows
+	names := make(map[string]map[string]bool) // region -> profile columns
+	for profile, n := range in.profiles {
+		region := cfg.ProfileRegion
+		if profile != "" {
+			region = cfg.ProfileRegions[profile]
+		}
+		if region == "" {
+			continue
+		}
+		rows[region] += n
+		if names[region] == nil {
+			names[region] = make(map[string]bool)
+		}
+		if profile == "" {
+			profile = "the selected profile"
+		}
+		names[region][profile] = true
+	}
+	if len(rows) < 2 {
+		return ""
+	}
+
+	var parts []string
+	for _, region := range slices.Sorted(maps.Keys(rows)) {
+		parts = append(parts, fmt.Sprintf("%s for %d rows (%s)", region, rows[region],
+			strings.Join(slices.Sorted(maps.Keys(names[region])), ", ")))
+	}
+	return "device profiles of different regions: " + strings.Join(parts, "; ")
+}
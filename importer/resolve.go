@@ -0,0 +1,221 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// ListPageSize is the page size used when listing objects from the server.
+const ListPageSize = 100
+
+// LooksLikeUUID reports whether s has the shape of a ChirpStack object ID.
+func LooksLikeUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !lorakey.IsHex(string(c)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// applicationFor returns the application a row is created in: its own
+// application column, resolved by name unless it is an ID, or the selected
+// application.
+func (imp *Importer) applicationFor(ctx context.Context, row Row) (string, error) {
+	if row.application == "" {
+		return imp.ApplicationID, nil
+	}
+	if LooksLikeUUID(row.application) {
+		return row.application, nil
+	}
+
+	imp.cache.Lock()
+	ids := imp.appIDs
+	imp.cache.Unlock()
+	if ids == nil {
+		tenantID, err := imp.Tenant(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		ids = make(map[string]string)
+		for offset := uint32(0); ; offset += ListPageSize {
+			resp, err := imp.Apps.List(ctx, &api.ListApplicationsRequest{
+				TenantId: tenantID,
+				Limit:    ListPageSize,
+				Offset:   offset,
+			})
+			if err != nil {
+				return "", fmt.Errorf("listing applications: %w", err)
+			}
+			for _, app := range resp.Result {
+				ids[app.Name] = app.Id
+			}
+			if len(resp.Result) < ListPageSize {
+				break
+			}
+		}
+		imp.cache.Lock()
+		imp.appIDs = ids
+		imp.cache.Unlock()
+	}
+
+	id, ok := ids[row.application]
+	if !ok {
+		return "", fmt.Errorf("unknown application %q", row.application)
+	}
+	return id, nil
+}
+
+// profileFor returns the device profile of a row: its own device_profile
+// column, resolved by name unless it is an ID, or the selected profile.
+func (imp *Importer) profileFor(ctx context.Context, row Row) (string, error) {
+	if row.Profile == "" {
+		return imp.ProfileID, nil
+	}
+	if LooksLikeUUID(row.Profile) {
+		return row.Profile, nil
+	}
+
+	imp.cache.Lock()
+	ids := imp.profileIDs
+	imp.cache.Unlock()
+	if ids == nil {
+		tenantID, err := imp.Tenant(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		ids = make(map[string]string)
+		for offset := uint32(0); ; offset += ListPageSize {
+			resp, err := imp.Profiles.List(ctx, &api.ListDeviceProfilesRequest{
+				TenantId: tenantID,
+				Limit:    ListPageSize,
+				Offset:   offset,
+			})
+			if err != nil {
+				return "", fmt.Errorf("listing device profiles: %w", err)
+			}
+			for _, profile := range resp.Result {
+				ids[profile.Name] = profile.Id
+			}
+			if len(resp.Result) < ListPageSize {
+				break
+			}
+		}
+		imp.cache.Lock()
+		imp.profileIDs = ids
+		imp.cache.Unlock()
+	}
+
+	id, ok := ids[row.Profile]
+	if !ok {
+		return "", fmt.Errorf("unknown device profile %q", row.Profile)
+	}
+	return id, nil
+}
+
+// multicastGroupFor returns the ID of the multicast group named group in the
+// application of row, resolved by name unless it is an ID.
+func (imp *Importer) multicastGroupFor(ctx context.Context, row Row, group string) (string, error) {
+	if LooksLikeUUID(group) {
+		return group, nil
+	}
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return "", err
+	}
+
+	imp.cache.Lock()
+	groups, ok := imp.groupIDs[appID]
+	imp.cache.Unlock()
+	if !ok {
+		groups = make(map[string]string)
+		for offset := uint32(0); ; offset += ListPageSize {
+			resp, err := imp.Multicast.List(ctx, &api.ListMulticastGroupsRequest{
+				ApplicationId: appID,
+				Limit:         ListPageSize,
+				Offset:        offset,
+			})
+			if err != nil {
+				return "", fmt.Errorf("listing multicast groups: %w", err)
+			}
+			for _, g := range resp.Result {
+				groups[g.Name] = g.Id
+			}
+			if len(resp.Result) < ListPageSize {
+				break
+			}
+		}
+		imp.cache.Lock()
+		if imp.groupIDs == nil {
+			imp.groupIDs = make(map[string]map[string]string)
+		}
+		imp.groupIDs[appID] = groups
+		imp.cache.Unlock()
+	}
+
+	id, ok := groups[group]
+	if !ok {
+		return "", fmt.Errorf("unknown multicast group %q", group)
+	}
+	return id, nil
+}
+
+// macVersion returns the LoRaWAN MAC version of the devices of a device
+// profile, which decides where their root keys go.
+func (imp *Importer) macVersion(ctx context.Context, profileID string) (common.MacVersion, error) {
+	imp.cache.Lock()
+	v, ok := imp.macVersions[profileID]
+	imp.cache.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	resp, err := imp.Profiles.Get(ctx, &api.GetDeviceProfileRequest{Id: profileID})
+	if err != nil {
+		return 0, fmt.Errorf("looking up device profile %s: %w", profileID, err)
+	}
+	imp.cache.Lock()
+	defer imp.cache.Unlock()
+	if imp.macVersions == nil {
+		imp.macVersions = make(map[string]common.MacVersion)
+	}
+	imp.macVersions[profileID] = resp.DeviceProfile.MacVersion
+	return resp.DeviceProfile.MacVersion, nil
+}
+
+// Tenant returns the tenant names are resolved in, looking it up from the
+// selected application when it wasn't given.
+func (imp *Importer) Tenant(ctx context.Context) (string, error) {
+	imp.cache.Lock()
+	tenantID := imp.TenantID
+	imp.cache.Unlock()
+	if tenantID != "" {
+		return tenantID, nil
+	}
+
+	resp, err := imp.Apps.Get(ctx, &api.GetApplicationRequest{Id: imp.ApplicationID})
+	if err != nil {
+		return "", fmt.Errorf("looking up application %s: %w", imp.ApplicationID, err)
+	}
+	imp.cache.Lock()
+	defer imp.cache.Unlock()
+	imp.TenantID = resp.Application.TenantId
+	return imp.TenantID, nil
+}
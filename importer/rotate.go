@@ -0,0 +1,103 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// rotateRow replaces the root keys of the device of row with newly generated
+// ones and records the outcome in res: the new keys, to be saved like
+// generated ones, and whether the device has a session that the rotation
+// leaves running. A device without keys is skipped with a warning. As when
+// deleting, a device of another application is a failure.
+func (imp *Importer) rotateRow(ctx context.Context, row Row, res *Result) error {
+	keys, session, err := imp.rotate(ctx, row)
+	var note RowNote
+	switch {
+	case errors.As(err, &note):
+		res.Skipped = append(res.Skipped, RowFailure{Row: row, Err: err})
+	case err != nil:
+		imp.logRow(row).Error("Failed to rotate the keys of the device", "err", err)
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+	default:
+		res.Rotated = append(res.Rotated, row)
+		if keys != nil {
+			res.Keys = append(res.Keys, *keys)
+		}
+		if session {
+			res.Sessions = append(res.Sessions, row)
+		}
+	}
+	return err
+}
+
+// rotate generates new root keys for the device of row, for the MAC version
+// of its device profile, and replaces its keys with them. It reports whether
+// the device has an active session. On a dry run the device is only looked
+// up and no keys are generated.
+func (imp *Importer) rotate(ctx context.Context, row Row) (*GeneratedKey, bool, error) {
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return nil, false, status.Errorf(codes.NotFound, "device %s not found", row.DevEUI)
+	case err != nil:
+		return nil, false, err
+	case resp.Device.GetApplicationId() != appID:
+		return nil, false, fmt.Errorf("device belongs to application %s, not %s", resp.Device.GetApplicationId(), appID)
+	}
+
+	current, err := imp.Devices.GetKeys(ctx, &api.GetDeviceKeysRequest{DevEui: row.DevEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return nil, false, RowNote("device has no root keys to rotate, e.g. an ABP device")
+	case err != nil:
+		return nil, false, err
+	}
+	v, err := imp.macVersion(ctx, resp.Device.DeviceProfileId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	act, err := imp.Devices.GetActivation(ctx, &api.GetDeviceActivationRequest{DevEui: row.DevEUI})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, false, err
+	}
+	session := act.GetDeviceActivation().GetDevAddr() != ""
+
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_UpdateKeys_FullMethodName,
+			&api.UpdateDeviceKeysRequest{DeviceKeys: &api.DeviceKeys{DevEui: row.DevEUI}}, nil)
+		return nil, session, nil
+	}
+
+	// The keys go where rootKeys puts them; the GenAppKey, used to set up
+	// multicast sessions, stays.
+	g := GeneratedKey{devEUI: row.DevEUI}
+	if g.appKey, err = lorakey.NewKey(); err != nil {
+		return nil, false, fmt.Errorf("generating AppKey: %w", err)
+	}
+	keys := &api.DeviceKeys{DevEui: row.DevEUI, NwkKey: g.appKey, GenAppKey: current.DeviceKeys.GetGenAppKey()}
+	if IsLoRaWAN11(v) {
+		if g.nwkKey, err = lorakey.NewKey(); err != nil {
+			return nil, false, fmt.Errorf("generating NwkKey: %w", err)
+		}
+		keys.AppKey, keys.NwkKey = g.appKey, g.nwkKey
+	}
+	if _, err := imp.Devices.UpdateKeys(ctx, &api.UpdateDeviceKeysRequest{DeviceKeys: keys}); err != nil {
+		return nil, false, err
+	}
+	return &g, session, nil
+}
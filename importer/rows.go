@@ -0,0 +1,572 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// Row is a single device to import, independent of the input format.
+type Row struct {
+	Pos RowPos
+
+	DevEUI      string
+	Name        string
+	Description string
+	JoinEUI     string
+	AppKey      string
+	nwkKey      string // LoRaWAN 1.1 devices only
+	Tags        map[string]string
+	variables   map[string]string
+
+	// ABP session to activate the device with once it is created; the
+	// NwkSKey stands for all three network session keys of LoRaWAN 1.1
+	devAddr, nwkSKey, appSKey string
+
+	// Overrides of the selected application and device profile, by name or ID
+	application string
+	Profile     string
+
+	// Application to move the device to with --mode move, by name or ID
+	targetApplication string
+
+	// Multicast group of the application to add the device to, by name or ID
+	multicastGroup string
+
+	// LoRa Alliance vendor ID and the vendor's profile ID of the device,
+	// 4 hex characters each, for its TR005 QR code
+	VendorID        string
+	VendorProfileID string
+
+	// Downlink enqueued once the device is created, in hex; FPort 0 means
+	// the default
+	downlinkPayload string
+	downlinkFPort   uint32
+
+	isDisabled    bool
+	disabledSet   bool // is_disabled has a value, which --mode toggle needs
+	skipFCntCheck bool
+
+	NameGenerated bool   // name came from the name template or the DevEUI
+	UniqueName    string // suggested instead of a name used more than once
+}
+
+// RowPos identifies where a row came from in the input file.
+type RowPos struct {
+	Line  int // 1-based line of a delimited file, 0 for JSON
+	Index int // array index of a JSON entry
+}
+
+// Field returns a human-readable location for the named field of the row,
+// e.g. "line 12, dev_eui" or "[42].dev_eui".
+func (p RowPos) Field(name string) string {
+	if p.Line == 0 {
+		return fmt.Sprintf("[%d].%s", p.Index, name)
+	}
+	return fmt.Sprintf("line %d, %s", p.Line, name)
+}
+
+// ListOptions are how device lists are read and their rows checked.
+type ListOptions struct {
+	Mode              Mode   // what is done with the listed devices
+	Disable           *bool  // with --mode toggle, the state of rows without an is_disabled value: true for --disable, false for --enable
+	UpdateInvasive    bool   // let --mode update change device profiles, variables and states
+	TargetApplication string // with --mode move, the application of rows without a target_application, by name or ID
+
+	Gateways        bool             // lists of gateways to import into a tenant instead of devices
+	DefaultLocation *common.Location // of gateways without coordinates of their own, from --default-location
+	ValidateOnly    bool             // only validate the lists, without connecting to a server
+
+	HTTPHeaders []string      // extra headers for downloads, "Name: value"
+	HTTPTimeout time.Duration // download timeout, DefaultHTTPTimeout if 0
+
+	Delimiter rune              // 0 means sniff from the file
+	Encoding  encoding.Encoding // nil means UTF-8
+	Sheet     string            // XLSX sheet to read, empty for the first
+	Mappings  []ColumnMapping   // saved mapping presets, applied to headers of their signature
+	Mapping   *ColumnMapping    // preset applied to every header, from --mapping
+
+	NameTemplate  NameTemplate // names for rows without one; an import names them after their DevEUI without one
+	EUINamePrefix string       // prefixed to the DevEUI to name a device after it
+	EUINameUpper  bool         // upper-case the DevEUI to name a device after it
+
+	Tags        map[string]string   // added to every device to create or sync; a row's own values win
+	Description DescriptionTemplate // for rows without a description
+
+	Lenient       bool     // ignore header columns that map to no field instead of rejecting the file
+	IgnoreColumns []string // header columns that map to no field but aren't an error, normalized
+	AllowExt      []string // file types offered for import besides inputExtensions, e.g. ".dat"
+
+	DuplicateNames string            // what is done about names used more than once: warn, allow or suffix
+	ServerNames    map[string]string // names of the devices of the application -> DevEUI, nil until listed
+	Renames        map[string]string // DevEUI -> unique name accepted for the row
+
+	SkipExisting  bool                           // list the application first and skip the rows of devices in it
+	ServerDevices map[string]*api.DeviceListItem // devices of the application by DevEUI, nil until listed
+
+	GenerateKeys bool // provision random AppKeys for rows without one
+	LoRaWAN11    bool // the selected device profile is for LoRaWAN 1.1, whose devices need an nwk_key
+
+	ProfileRegions map[string]string // device profile names and IDs -> region, nil if unknown
+	ProfileRegion  string            // region of the selected device profile
+}
+
+// inputExtensions lists the file types the parsers understand.
+var inputExtensions = []string{".csv", ".tsv", ".txt", ".json", ".jsonl", ".ndjson", ".xlsx"}
+
+// Extensions returns the file types offered for import: those of
+// inputExtensions and those allowed with --allow-ext.
+func (cfg ListOptions) Extensions() []string {
+	return append(slices.Clone(inputExtensions), cfg.AllowExt...)
+}
+
+// Formats of device lists, each read by its own parser
+const (
+	formatDelimited = "delimited text"
+	formatJSON      = "a JSON device list"
+	formatXLSX      = "an XLSX workbook"
+)
+
+// extensionFormat returns the format the extension of name stands for, or
+// an empty string for an extension none does.
+func extensionFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".jsonl", ".ndjson":
+		return formatJSON
+	case ".xlsx":
+		return formatXLSX
+	case ".csv", ".tsv", ".txt":
+		return formatDelimited
+	}
+	return ""
+}
+
+// sniffFormat guesses the format of the content br starts with: a ZIP
+// archive is a workbook, an opening brace or bracket JSON and anything
+// else delimited text.
+func sniffFormat(br *bufio.Reader) string {
+	head, _ := br.Peek(512)
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return formatXLSX
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+	if len(head) > 0 && (head[0] == '{' || head[0] == '[') {
+		return formatJSON
+	}
+	return formatDelimited
+}
+
+// Input is a device list and what was found in it. Rows are streamed
+// from the source rather than held in memory, so only the first few are kept
+// for display; see ReadInputs.
+type Input struct {
+	Source string // path or URL of the list, "-" for stdin
+	Name   string // name whose extension selects the parser
+	Data   []byte // content of stdin and downloads, which can't be read twice
+
+	Rows        []Row          // the first valid rows, for display
+	Gateways    []GatewayRow   // the same for a gateway list
+	Count       int            // number of valid rows
+	Named       int            // valid rows named by the name template or after their DevEUI
+	Keyless     int            // valid rows without root keys
+	Downlinks   int            // valid rows with their own downlink payload
+	NameClashes int            // valid rows whose name is used more than once
+	profiles    map[string]int // valid rows by their device profile column, "" for none
+	Format      string         // how the file was interpreted, for display
+	Warnings    []string       // problems that don't prevent an import
+	Invalid     []string       // rows that were rejected, with the reason
+	Rejected    []RowFailure   // the rejected rows that could be read, for correcting them
+	Exists      []Row          // valid rows of devices that exist already, skipped with --skip-existing
+}
+
+// newInput returns the device list at path, which may also be an HTTP(S) URL
+// or "-" for standard input. Nothing is read until it is scanned.
+func newInput(path string) *Input {
+	return &Input{Source: path, Name: path}
+}
+
+// NewInputs calls newInput for each of paths.
+func NewInputs(paths []string) []*Input {
+	inputs := make([]*Input, len(paths))
+	for i, path := range paths {
+		inputs[i] = newInput(path)
+	}
+	return inputs
+}
+
+// Open returns a reader for the content of in. Standard input and downloads
+// are read into memory on first use, so that a second pass over them sees
+// the same content; cancelling ctx aborts a download.
+func (in *Input) Open(ctx context.Context, cfg ListOptions) (io.ReadCloser, error) {
+	if in.Data == nil {
+		switch {
+		case in.Source == "-":
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, err
+			}
+			in.Data = data
+		case IsURL(in.Source):
+			if err := fetchInput(ctx, in, cfg); err != nil {
+				return nil, err
+			}
+		default:
+			return os.Open(in.Source)
+		}
+	}
+	return io.NopCloser(bytes.NewReader(in.Data)), nil
+}
+
+// scanner validates rows as a parser produces them and passes the valid ones
+// on, so that no parser has to hold a whole file.
+type scanner struct {
+	batch   *Batch
+	in      *Input
+	emit    func(row Row) error
+	n       int    // rows added so far, numbering rows for the name template
+	mapping string // saved column mapping used for the header, if any
+}
+
+// add normalizes and validates row. Valid rows are counted and passed to
+// emit; invalid ones are described in the invalid list.
+func (s *scanner) add(row Row) error {
+	s.n++
+	trimRow(&row)
+	row.DevEUI = lorakey.NormalizeEUI(row.DevEUI)
+	row.JoinEUI = lorakey.NormalizeEUI(row.JoinEUI)
+	row.AppKey = lorakey.NormalizeKey(row.AppKey)
+	row.nwkKey = lorakey.NormalizeKey(row.nwkKey)
+	row.devAddr = lorakey.NormalizeEUI(row.devAddr)
+	row.nwkSKey = lorakey.NormalizeKey(row.nwkSKey)
+	row.appSKey = lorakey.NormalizeKey(row.appSKey)
+
+	if tmpl := s.batch.cfg.NameTemplate; row.Name == "" && tmpl != "" {
+		row.Name = tmpl.expand(row.DevEUI, s.n)
+		row.NameGenerated = true
+	}
+	// Not in a sync, where it would rename the devices already there.
+	if cfg := s.batch.cfg; row.Name == "" && row.DevEUI != "" && cfg.Mode == ModeImport {
+		row.Name = cfg.euiName(row.DevEUI)
+		row.NameGenerated = true
+	}
+	if name, ok := s.batch.cfg.Renames[row.DevEUI]; ok {
+		row.Name = name
+	}
+	s.applyDefaults(&row)
+	if err := checkUpdate(row, s.batch.cfg); err != nil {
+		return err
+	}
+
+	msg := ValidateRow(row, s.batch.cfg)
+	if msg == "" {
+		msg = s.batch.check(s.in, &row)
+	}
+	if msg != "" {
+		s.reject(msg)
+		s.in.Rejected = append(s.in.Rejected, RowFailure{Row: row, Err: InvalidRow(msg)})
+		return nil
+	}
+	if _, ok := s.batch.cfg.ServerDevices[row.DevEUI]; ok && s.batch.skipsExisting() {
+		s.in.Exists = append(s.in.Exists, row)
+		return nil
+	}
+
+	s.in.Count++
+	if row.NameGenerated {
+		s.in.Named++
+	}
+	if row.AppKey == "" && row.nwkKey == "" {
+		s.in.Keyless++
+	}
+	if row.downlinkPayload != "" {
+		s.in.Downlinks++
+	}
+	if s.in.profiles == nil {
+		s.in.profiles = make(map[string]int)
+	}
+	s.in.profiles[row.Profile]++
+	return s.emit(row)
+}
+
+// trimRow trims the fields of row, so that a value of nothing but spaces is
+// absent, as spreadsheets pad cells with them. Tags and variables left
+// empty are dropped.
+func trimRow(row *Row) {
+	for _, f := range []*string{
+		&row.DevEUI, &row.Name, &row.Description, &row.JoinEUI, &row.AppKey, &row.nwkKey,
+		&row.application, &row.Profile, &row.targetApplication, &row.multicastGroup, &row.downlinkPayload,
+		&row.VendorID, &row.VendorProfileID, &row.devAddr, &row.nwkSKey, &row.appSKey,
+	} {
+		*f = strings.TrimSpace(*f)
+	}
+	for _, m := range []map[string]string{row.Tags, row.variables} {
+		for k, v := range m {
+			if v = strings.TrimSpace(v); v == "" {
+				delete(m, k)
+			} else {
+				m[k] = v
+			}
+		}
+	}
+}
+
+// reject records a row that can't be imported.
+func (s *scanner) reject(msg string) {
+	s.in.Invalid = append(s.in.Invalid, msg)
+}
+
+// InvalidRow is why a row was rejected before anything was sent to the
+// server.
+type InvalidRow string
+
+func (e InvalidRow) Error() string { return string(e) }
+
+// setFormat describes how the file was interpreted, noting the column
+// mapping preset if one was used.
+func (s *scanner) setFormat(format string) {
+	if s.mapping != "" {
+		format += fmt.Sprintf(", mapping preset %q", s.mapping)
+	}
+	s.in.Format = format
+}
+
+// Batch reads the inputs of one import. Rows whose DevEUI already appeared
+// earlier in the batch are rejected, so duplicates across files are caught
+// before anything is written rather than failing as AlreadyExists halfway
+// through a later file. Names used more than once are reported as warnings,
+// see checkName.
+type Batch struct {
+	cfg   ListOptions
+	multi bool
+	seen  map[string]string // DevEUI -> where it was first seen
+	names map[string]string // name -> where it was first used
+
+	suggested map[string]bool // unique names suggested so far, see checkName
+	started   time.Time       // the {date} of the default description
+}
+
+func NewBatch(cfg ListOptions, inputs []*Input) *Batch {
+	return &Batch{
+		cfg:   cfg,
+		multi: len(inputs) > 1,
+		seen:  make(map[string]string),
+		names: make(map[string]string),
+
+		suggested: make(map[string]bool),
+		started:   time.Now(),
+	}
+}
+
+// Scan reads in from the start, choosing the parser from the extension of
+// its name, or from its content for other extensions, and passes each valid
+// row to emit. The counts, warnings and invalid rows of in are replaced. A
+// file whose content doesn't match its extension isn't read.
+func (b *Batch) Scan(ctx context.Context, in *Input, emit func(row Row) error) error {
+	r, err := in.Open(ctx, b.cfg)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	in.Rows, in.Count, in.Named, in.Keyless, in.Downlinks, in.NameClashes = nil, 0, 0, 0, 0, 0
+	in.Warnings, in.Invalid, in.Rejected, in.Exists, in.profiles = nil, nil, nil, nil, nil
+
+	br := bufio.NewReader(r)
+	format, content := extensionFormat(in.Name), sniffFormat(br)
+	switch {
+	case format == "":
+		format = content
+	case format != content:
+		return fmt.Errorf("%s looks like %s, not %s as its extension says; rename it to match its content",
+			filepath.Base(in.Name), content, format)
+	}
+
+	s := &scanner{batch: b, in: in, emit: emit}
+	switch format {
+	case formatJSON:
+		err = readJSON(br, s)
+	case formatXLSX:
+		err = readXLSX(br, s)
+	default:
+		err = readDelimited(br, s)
+	}
+
+	var hErr *HeaderError
+	if errors.As(err, &hErr) {
+		hErr.Source = in.Source
+	}
+	if w := regionWarning(in, b.cfg); err == nil && w != "" {
+		in.Warnings = append(in.Warnings, w)
+	}
+	return err
+}
+
+// check returns why row duplicates an earlier row of the batch, or an empty
+// string. It also checks the name of the row, see checkName.
+func (b *Batch) check(in *Input, row *Row) string {
+	where := row.Pos.Field("dev_eui")
+
+	eui := strings.ToLower(row.DevEUI)
+	if first, ok := b.seen[eui]; ok {
+		return fmt.Sprintf("%s: %s duplicates %s", where, row.DevEUI, first)
+	}
+	if b.multi {
+		where = filepath.Base(in.Source) + " " + where
+	}
+	b.seen[eui] = where
+
+	b.checkName(in, row, where)
+	return ""
+}
+
+// ReadInputs reads each of inputs once to validate it, keeping its first
+// keep rows for display. onRow, if set, is called for each valid row.
+func ReadInputs(ctx context.Context, inputs []*Input, cfg ListOptions, keep int, onRow func(in *Input)) error {
+	b := NewBatch(cfg, inputs)
+	for _, in := range inputs {
+		err := b.Scan(ctx, in, func(row Row) error {
+			if len(in.Rows) < keep {
+				in.Rows = append(in.Rows, row)
+			}
+			if onRow != nil {
+				onRow(in)
+			}
+			return nil
+		})
+		if err != nil {
+			if len(inputs) > 1 {
+				err = fmt.Errorf("%s: %w", in.Source, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandInput resolves a --csv argument naming a file, a directory or a glob
+// pattern to the files to import. Directories and patterns only match files
+// with one of exts.
+func ExpandInput(arg string, exts []string) ([]string, error) {
+	if arg == "-" || IsURL(arg) {
+		return []string{arg}, nil
+	}
+
+	var matches []string
+	if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				matches = append(matches, filepath.Join(arg, e.Name()))
+			}
+		}
+	} else if strings.ContainsAny(arg, "*?[") {
+		if matches, err = filepath.Glob(arg); err != nil {
+			return nil, err
+		}
+	} else {
+		return []string{arg}, nil
+	}
+
+	var paths []string
+	for _, m := range matches {
+		if slices.Contains(exts, strings.ToLower(filepath.Ext(m))) {
+			paths = append(paths, m)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no device lists found in %s", arg)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ValidateRow returns a description of the first problem with row, or an
+// empty string if it can be processed as cfg asks. Only imports need names.
+func ValidateRow(row Row, cfg ListOptions) string {
+	switch {
+	case row.DevEUI == "":
+		return row.Pos.Field("dev_eui") + ": must not be empty"
+	case lorakey.HexProblem(row.DevEUI, 16) != "":
+		return row.Pos.Field("dev_eui") + ": " + lorakey.HexProblem(row.DevEUI, 16)
+	case row.Name == "" && cfg.Mode.Creates():
+		return row.Pos.Field("name") + ": must not be empty"
+	case row.JoinEUI != "" && lorakey.HexProblem(row.JoinEUI, 16) != "":
+		return row.Pos.Field("join_eui") + ": " + lorakey.HexProblem(row.JoinEUI, 16)
+	case row.AppKey != "" && lorakey.HexProblem(row.AppKey, 32) != "":
+		return row.Pos.Field("app_key") + ": " + lorakey.HexProblem(row.AppKey, 32)
+	case row.nwkKey != "" && lorakey.HexProblem(row.nwkKey, 32) != "":
+		return row.Pos.Field("nwk_key") + ": " + lorakey.HexProblem(row.nwkKey, 32)
+	case row.devAddr != "" && lorakey.HexProblem(row.devAddr, 8) != "":
+		return row.Pos.Field("dev_addr") + ": " + lorakey.HexProblem(row.devAddr, 8)
+	case row.nwkSKey != "" && lorakey.HexProblem(row.nwkSKey, 32) != "":
+		return row.Pos.Field("nwk_s_key") + ": " + lorakey.HexProblem(row.nwkSKey, 32)
+	case row.appSKey != "" && lorakey.HexProblem(row.appSKey, 32) != "":
+		return row.Pos.Field("app_s_key") + ": " + lorakey.HexProblem(row.appSKey, 32)
+	case row.hasSession() && (row.devAddr == "" || row.nwkSKey == "" || row.appSKey == ""):
+		return row.Pos.Field(missingSessionField(row)) + ": must be given with the other ABP session columns, dev_addr, nwk_s_key and app_s_key"
+	case row.VendorID != "" && lorakey.HexProblem(row.VendorID, 4) != "":
+		return row.Pos.Field("vendor_id") + ": " + lorakey.HexProblem(row.VendorID, 4)
+	case row.VendorProfileID != "" && lorakey.HexProblem(row.VendorProfileID, 4) != "":
+		return row.Pos.Field("vendor_profile_id") + ": " + lorakey.HexProblem(row.VendorProfileID, 4)
+	case cfg.Mode == ModeMove && row.targetApplication == "" && cfg.TargetApplication == "":
+		return row.Pos.Field("target_application") + ": must name an application, unless --to-application is given"
+	case cfg.Mode == ModeUpdate && row.Name == clearValue:
+		return row.Pos.Field("name") + ": can't be cleared, devices need a name"
+	case cfg.Mode == ModeToggle && !row.disabledSet:
+		return row.Pos.Field("is_disabled") + ": must be true or false, unless --enable or --disable is given"
+	case cfg.LoRaWAN11 && row.Profile == "" && row.AppKey != "" && row.nwkKey == "" && !cfg.GenerateKeys:
+		// Rows with their own profile are checked once it is known, see
+		// rootKeys.
+		return row.Pos.Field("nwk_key") + ": the device profile is for LoRaWAN 1.1, whose devices need an nwk_key as well as the app_key"
+	}
+	if row.downlinkPayload != "" {
+		if _, err := decodePayload(row.downlinkPayload); err != nil {
+			return row.Pos.Field("downlink_payload") + ": " + err.Error()
+		}
+	}
+	return ""
+}
+
+// hasSession reports whether row has any of the ABP session columns.
+func (r Row) hasSession() bool {
+	return r.devAddr != "" || r.nwkSKey != "" || r.appSKey != ""
+}
+
+// missingSessionField returns the first ABP session column row lacks.
+func missingSessionField(row Row) string {
+	switch {
+	case row.devAddr == "":
+		return "dev_addr"
+	case row.nwkSKey == "":
+		return "nwk_s_key"
+	}
+	return "app_s_key"
+}
+
+// ExistsNote is the outcome of a row skipped by --skip-existing.
+const ExistsNote = RowNote("skip (exists)")
+
+// skipsExisting reports whether rows of devices that exist already are left
+// out of the batch rather than sent to fail as AlreadyExists.
+func (b *Batch) skipsExisting() bool {
+	return b.cfg.SkipExisting && b.cfg.Mode == ModeImport && b.cfg.ServerDevices != nil
+}
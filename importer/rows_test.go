@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeList writes a device list named name to a temporary directory and
+// returns its path.
+func writeList(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readList reads the device list at path with cfg, keeping every row.
+func readList(t *testing.T, path string, cfg ListOptions) *Input {
+	t.Helper()
+	inputs := NewInputs([]string{path})
+	if err := ReadInputs(context.Background(), inputs, cfg, 1000, nil); err != nil {
+		t.Fatal(err)
+	}
+	return inputs[0]
+}
+
+func TestReadInputs(t *testing.T) {
+	path := writeList(t, "devices.csv", `dev_eui,name,join_eui,app_key
+70-B3-D5-7E-D0-00-00-01,sensor 1,0000000000000000,00112233445566778899AABBCCDDEEFF
+70b3d57ed0000002,sensor 2,,ABEiM0RVZneImaq7zN3u/w==
+70b3d57ed000003,sensor 3,,
+70b3d57ed0000001,sensor 4,,
+70b3d57ed0000005,sensor 5,,0011
+`)
+	in := readList(t, path, ListOptions{})
+
+	if in.Count != 2 {
+		t.Errorf("Count = %d, want 2", in.Count)
+	}
+	want := []Row{
+		{DevEUI: "70b3d57ed0000001", Name: "sensor 1", JoinEUI: "0000000000000000", AppKey: "00112233445566778899aabbccddeeff"},
+		{DevEUI: "70b3d57ed0000002", Name: "sensor 2", AppKey: "00112233445566778899aabbccddeeff"},
+	}
+	if len(in.Rows) != len(want) {
+		t.Fatalf("read %d rows, want %d: %+v", len(in.Rows), len(want), in.Rows)
+	}
+	for i, w := range want {
+		got := in.Rows[i]
+		if got.DevEUI != w.DevEUI || got.Name != w.Name || got.JoinEUI != w.JoinEUI || got.AppKey != w.AppKey {
+			t.Errorf("row %d = %+v, want %+v", i+1, got, w)
+		}
+	}
+
+	wantInvalid := []string{
+		"line 4, dev_eui: is 15 hex characters, must be 16",
+		"line 5, dev_eui: 70b3d57ed0000001 duplicates line 2",
+		"line 6, app_key: is 4 hex characters, must be 32",
+	}
+	if len(in.Invalid) != len(wantInvalid) {
+		t.Fatalf("Invalid = %q, want %d rows", in.Invalid, len(wantInvalid))
+	}
+	for i, w := range wantInvalid {
+		if !strings.HasPrefix(in.Invalid[i], w) {
+			t.Errorf("Invalid[%d] = %q, want it to start with %q", i, in.Invalid[i], w)
+		}
+	}
+}
+
+func TestReadInputsSniffsDelimiter(t *testing.T) {
+	path := writeList(t, "devices.csv", "DevEUI;Name\n70b3d57ed0000001;sensor 1\n70b3d57ed0000002;sensor 2\n")
+	in := readList(t, path, ListOptions{})
+	if in.Count != 2 || len(in.Invalid) != 0 {
+		t.Fatalf("Count = %d, Invalid = %q; want 2 valid rows", in.Count, in.Invalid)
+	}
+	if in.Rows[1].Name != "sensor 2" {
+		t.Errorf("second row = %+v", in.Rows[1])
+	}
+}
+
+func TestReadInputsUnknownHeader(t *testing.T) {
+	path := writeList(t, "devices.csv", "serial,label\n1,a\n")
+	inputs := NewInputs([]string{path})
+	err := ReadInputs(context.Background(), inputs, ListOptions{}, 0, nil)
+	if err == nil {
+		t.Fatal("ReadInputs accepted a list without a dev_eui column")
+	}
+}
+
+func TestValidateRow(t *testing.T) {
+	row := func(f func(r *Row)) Row {
+		r := Row{Pos: RowPos{Line: 2}, DevEUI: "70b3d57ed0000001", Name: "sensor"}
+		f(&r)
+		return r
+	}
+	for _, tc := range []struct {
+		row  Row
+		cfg  ListOptions
+		want string
+	}{
+		{row(func(r *Row) {}), ListOptions{}, ""},
+		{row(func(r *Row) { r.DevEUI = "" }), ListOptions{}, "line 2, dev_eui: must not be empty"},
+		{row(func(r *Row) { r.Name = "" }), ListOptions{}, "line 2, name: must not be empty"},
+		{row(func(r *Row) { r.Name = "" }), ListOptions{Mode: ModeDelete}, ""},
+		{row(func(r *Row) { r.AppKey = "0011" }), ListOptions{}, "line 2, app_key: is 4 hex characters, must be 32"},
+		{row(func(r *Row) { r.VendorID = "xyz1" }), ListOptions{}, `line 2, vendor_id: has 'x', which isn't a hex character`},
+		{row(func(r *Row) { r.devAddr, r.nwkSKey, r.appSKey = "01020304", testKey, testKey }), ListOptions{}, ""},
+		{row(func(r *Row) { r.devAddr, r.nwkSKey, r.appSKey = "0102030", testKey, testKey }), ListOptions{}, "line 2, dev_addr: is 7 hex characters, must be 8"},
+		{row(func(r *Row) { r.devAddr, r.nwkSKey, r.appSKey = "01020304", testKey[1:], testKey }), ListOptions{}, "line 2, nwk_s_key: is 31 hex characters, must be 32"},
+		{row(func(r *Row) { r.devAddr, r.nwkSKey, r.appSKey = "01020304", testKey, "g"+testKey[1:] }), ListOptions{}, `line 2, app_s_key: has 'g', which isn't a hex character`},
+		{row(func(r *Row) { r.devAddr, r.nwkSKey = "01020304", testKey }), ListOptions{}, "line 2, app_s_key: must be given with the other ABP session columns, dev_addr, nwk_s_key and app_s_key"},
+		{row(func(r *Row) {}), ListOptions{Mode: ModeMove}, "line 2, target_application: must name an application, unless --to-application is given"},
+		{row(func(r *Row) {}), ListOptions{Mode: ModeMove, TargetApplication: "other"}, ""},
+		{row(func(r *Row) {}), ListOptions{Mode: ModeToggle}, "line 2, is_disabled: must be true or false, unless --enable or --disable is given"},
+	} {
+		if got := ValidateRow(tc.row, tc.cfg); got != tc.want {
+			t.Errorf("ValidateRow(%+v, mode %s) = %q, want %q", tc.row, tc.cfg.Mode, got, tc.want)
+		}
+	}
+}
+
+func TestExpandInput(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.csv", "a.csv", "notes.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exts := ListOptions{}.Extensions()
+	got, err := ExpandInput(dir, exts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ExpandInput(dir) = %q, want %q", got, want)
+	}
+	if got, _ := ExpandInput("-", exts); len(got) != 1 || got[0] != "-" {
+		t.Errorf(`ExpandInput("-") = %q`, got)
+	}
+	if _, err := ExpandInput(filepath.Join(dir, "*.json"), exts); err == nil {
+		t.Error("ExpandInput accepted a glob matching nothing")
+	}
+}
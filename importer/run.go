@@ -0,0 +1,174 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// Options are what Run needs to import device lists. Everything else, such
+// as how the lists are read, is in List.
+type Options struct {
+	Server        string // host:port of the ChirpStack gRPC API
+	Token         string // API key
+	ApplicationID string
+	ProfileID     string
+	Mode          Mode // ModeImport or ModeUpdate
+	Concurrency   int  // rows imported at once, at least 1
+
+	// Inputs are the device lists: files, directories, globs, URLs or "-"
+	// for standard input, as for ExpandInput.
+	Inputs []string
+	List   ListOptions
+
+	// Conn, if set, is used instead of connecting to Server.
+	Conn grpc.ClientConnInterface
+
+	// Events, if set, is sent the events of the run, from RunStarted to
+	// RunFinished. Run finishes the stream, even when it fails to start.
+	Events *EventStream
+}
+
+// ProgressEvent is a row Run has finished, with what became of it and the
+// error that made it fail or be skipped, if any. Done counts the rows
+// finished so far, this one included, out of Total.
+type ProgressEvent struct {
+	Source      string
+	Row         Row
+	Status      RowStatus
+	Err         error
+	Done, Total int
+}
+
+// ProgressFunc is called by Run after each row, one row at a time.
+type ProgressFunc func(ProgressEvent)
+
+// RowResult is a row of a Run and what became of it.
+type RowResult struct {
+	Source string
+	Row    Row
+	Status RowStatus
+	Err    error // why the row failed or was skipped with a warning; nil otherwise
+}
+
+// Report sorts the rows of a Run by outcome. Updated rows include those of
+// devices that existed already and only had their keys set. Skipped rows
+// were left alone with a warning, or are of devices that already were as
+// the rows ask; failed rows include those that didn't validate. Removed
+// rows are of devices a sync deleted because no list has them.
+type Report struct {
+	Created []RowResult
+	Updated []RowResult
+	Skipped []RowResult
+	Failed  []RowResult
+	Removed []RowResult
+}
+
+// add sorts r into the report by its status.
+func (rep *Report) add(r RowResult) {
+	switch r.Status {
+	case StatusCreated:
+		rep.Created = append(rep.Created, r)
+	case StatusUpdated:
+		rep.Updated = append(rep.Updated, r)
+	case StatusSkipped, StatusUnchanged:
+		rep.Skipped = append(rep.Skipped, r)
+	case StatusFailed:
+		rep.Failed = append(rep.Failed, r)
+	case StatusRemoved:
+		rep.Removed = append(rep.Removed, r)
+	}
+}
+
+// Run imports the device lists of opts, calling progress, if set, after
+// each row. It is an import as the command line runs it without its
+// records: no undo journal, audit log or files of failed rows are written,
+// only the keys generated with List.GenerateKeys, next to their lists.
+// The error is for a run that couldn't start or stopped early; rows that
+// failed are in the report. The terminal event has both.
+//
+// The command line and the interactive UI don't go through Run, as they
+// keep those records, lock the application and verify, sync or retry
+// rows; they drive an Importer themselves and take its Report as Run does.
+func Run(ctx context.Context, opts Options, progress ProgressFunc) (report Report, err error) {
+	var results []FileResult
+	defer func() {
+		opts.Events.Finish(RunFinished{Results: results, Report: report, Err: err})
+	}()
+	if opts.Mode != ModeImport && opts.Mode != ModeUpdate {
+		return report, fmt.Errorf("%s isn't supported, only import and update", opts.Mode)
+	}
+	opts.List.Mode = opts.Mode
+
+	var paths []string
+	for _, arg := range opts.Inputs {
+		p, err := ExpandInput(arg, opts.List.Extensions())
+		if err != nil {
+			return report, err
+		}
+		paths = append(paths, p...)
+	}
+	if len(paths) == 0 {
+		return report, errors.New("no device lists to import")
+	}
+	inputs := NewInputs(paths)
+	if err := ReadInputs(ctx, inputs, opts.List, 0, nil); err != nil {
+		return report, err
+	}
+	total := 0
+	for _, in := range inputs {
+		total += in.Count
+	}
+
+	conn := opts.Conn
+	if conn == nil {
+		cc, err := grpc.NewClient(opts.Server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return report, fmt.Errorf("failed to connect to ChirpStack at %s: %w", opts.Server, err)
+		}
+		defer cc.Close()
+		conn = cc
+	}
+
+	done := 0
+	imp := &Importer{
+		Devices:       api.NewDeviceServiceClient(conn),
+		Apps:          api.NewApplicationServiceClient(conn),
+		Profiles:      api.NewDeviceProfileServiceClient(conn),
+		Multicast:     api.NewMulticastGroupServiceClient(conn),
+		Token:         opts.Token,
+		ApplicationID: opts.ApplicationID,
+		ProfileID:     opts.ProfileID,
+		Mode:          opts.Mode,
+		GenerateKeys:  opts.List.GenerateKeys,
+		Pool:          NewWorkerPool(opts.Concurrency),
+		// Called one row at a time, under the lock of ImportFiles
+		onFinished: func(r RowResult) {
+			done++
+			if progress != nil {
+				progress(ProgressEvent{Source: r.Source, Row: r.Row, Status: r.Status, Err: r.Err, Done: done, Total: total})
+			}
+		},
+	}
+	opts.Events.Emit(RunStarted{Total: total})
+	imp.Events = opts.Events
+	results, err = imp.ImportFiles(ctx, inputs, NewBatch(opts.List, inputs).Scan, nil)
+	report = imp.Report()
+	for _, fr := range results {
+		for _, f := range fr.Input.Rejected {
+			report.add(RowResult{Source: fr.Input.Source, Row: f.Row, Status: StatusFailed, Err: f.Err})
+		}
+		for _, row := range fr.Input.Exists {
+			report.add(RowResult{Source: fr.Input.Source, Row: row, Status: StatusSkipped, Err: ExistsNote})
+		}
+		if fr.Stopped != nil {
+			err = fr.Stopped
+		}
+	}
+	return report, err
+}
@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// DiffDevice returns the fields of d that row would change. An empty
+// description or tag value in the row leaves the server's value alone, so
+// that a list without those columns doesn't wipe them.
+func DiffDevice(d *api.DeviceListItem, row Row) []string {
+	var changes []string
+	if row.Name != d.Name {
+		changes = append(changes, fmt.Sprintf("name: %q → %q", d.Name, row.Name))
+	}
+	if row.Description != "" && row.Description != d.Description {
+		changes = append(changes, fmt.Sprintf("description: %q → %q", d.Description, row.Description))
+	}
+	for _, k := range slices.Sorted(maps.Keys(row.Tags)) {
+		if v := row.Tags[k]; v != d.Tags[k] {
+			changes = append(changes, fmt.Sprintf("%s%s: %q → %q", TagPrefix, k, d.Tags[k], v))
+		}
+	}
+	return changes
+}
+
+// syncRow updates the existing device d to match row, if they differ.
+func (imp *Importer) syncRow(ctx context.Context, d *api.DeviceListItem, row Row, res *Result) error {
+	if len(DiffDevice(d, row)) == 0 {
+		res.Unchanged++
+		return nil
+	}
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_Update_FullMethodName,
+			&api.UpdateDeviceRequest{Device: &api.Device{DevEui: row.DevEUI, ApplicationId: imp.ApplicationID}}, nil)
+	} else if err := imp.update(ctx, row); err != nil {
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+		return err
+	}
+	res.Updated++
+	return nil
+}
+
+// update sets the name, description and tags of the device of row. Like
+// DiffDevice, it keeps the description and tags the row leaves empty.
+func (imp *Importer) update(ctx context.Context, row Row) error {
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	if err != nil {
+		return err
+	}
+
+	d := resp.Device
+	d.Name = row.Name
+	if row.Description != "" {
+		d.Description = row.Description
+	}
+	if len(row.Tags) > 0 && d.Tags == nil {
+		d.Tags = make(map[string]string)
+	}
+	maps.Copy(d.Tags, row.Tags)
+
+	if _, err := imp.Devices.Update(ctx, &api.UpdateDeviceRequest{Device: d}); err != nil {
+		imp.logRow(row).Error("Failed to update the device", "rpc", api.DeviceService_Update_FullMethodName, "err", err)
+		return err
+	}
+	return nil
+}
+
+// RemoveUnlisted deletes the devices a sync plans to remove, which takes
+// imp.Consent unless it's a dry run. Each device is reported like a row of
+// ImportFiles, with UnlistedSource as its source. Cancelling ctx stops it
+// before the next device, with what was done so far and the cause.
+func (imp *Importer) RemoveUnlisted(ctx context.Context, devices []*api.DeviceListItem) (Result, error) {
+	if len(devices) > 0 && !imp.DryRun && imp.Consent == nil {
+		return Result{}, ErrUnconfirmed
+	}
+	ctx = AuthContext(ctx, imp.Token)
+
+	var res Result
+	for _, d := range devices {
+		if ctx.Err() != nil {
+			return res, context.Cause(ctx)
+		}
+		row := Row{DevEUI: d.DevEui, Name: d.Name}
+		var err error
+		req := &api.DeleteDeviceRequest{DevEui: d.DevEui}
+		if imp.DryRun {
+			imp.Audit.DryRun(ctx, api.DeviceService_Delete_FullMethodName, req, nil)
+		} else {
+			_, err = imp.Devices.Delete(ctx, req)
+		}
+		st := StatusRemoved
+		switch {
+		case status.Code(err) == codes.NotFound:
+			res.Absent++
+			st, err = StatusSkipped, nil
+		case err != nil:
+			imp.logger().Error("Failed to delete the device", "dev_eui", d.DevEui, "rpc", api.DeviceService_Delete_FullMethodName, "err", err)
+			res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+			st = StatusFailed
+		default:
+			res.Removed = append(res.Removed, row)
+		}
+		imp.rowFinished(RowResult{Source: UnlistedSource, Row: row, Status: st, Err: err})
+	}
+	return res, nil
+}
+
+// UnlistedSource stands in for the source file of devices removed because
+// no list has them.
+const UnlistedSource = "devices not in the list"
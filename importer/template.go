@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// templateTagColumn and templateVarColumn show the tag and variable prefixes
+// in the generated template.
+const (
+	templateTagColumn = TagPrefix + "example"
+	templateVarColumn = VarPrefix + "example"
+)
+
+// writeTemplate writes a CSV with a header naming every supported column,
+// a comment line describing the optional ones and two example rows. It is
+// generated from ColumnDefs, so whatever it contains the parser accepts.
+func writeTemplate(w io.Writer) error {
+	var header, optional []string
+	var examples [2][]string
+	for _, def := range ColumnDefs {
+		header = append(header, def.Name)
+		if !def.Required {
+			optional = append(optional, def.Name)
+		}
+		for i := range examples {
+			examples[i] = append(examples[i], def.examples[i])
+		}
+	}
+
+	header = append(header, templateTagColumn, templateVarColumn)
+	optional = append(optional, TagPrefix+"<key>", VarPrefix+"<key>")
+	examples[0] = append(examples[0], "north", "42")
+	examples[1] = append(examples[1], "south", "")
+
+	fmt.Fprintf(w, "# Optional columns (may be left empty or removed): %s. "+
+		"device_profile and application take a name or ID and default to the selection.\n",
+		strings.Join(optional, ", "))
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, row := range examples {
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SaveTemplate writes the template CSV to path, refusing to overwrite an
+// existing file.
+func SaveTemplate(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := writeTemplate(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
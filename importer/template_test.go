@@ -0,0 +1,25 @@
+package importer
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// TestTemplate checks that the template passes the validation it's made
+// to pass: both example rows valid, none rejected.
+func TestTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.csv")
+	if err := SaveTemplate(path); err != nil {
+		t.Fatal(err)
+	}
+	in := readList(t, path, ListOptions{Mode: ModeImport})
+	if in.Count != 2 || len(in.Invalid) != 0 {
+		t.Errorf("template has %d valid rows and %d invalid ones %q, want 2 valid", in.Count, len(in.Invalid), in.Invalid)
+	}
+
+	if err := SaveTemplate(path); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("SaveTemplate over an existing file = %v, want fs.ErrExist", err)
+	}
+}
@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// StateName describes disabled for messages, e.g. "already disabled".
+func StateName(disabled bool) string {
+	if disabled {
+		return "disabled"
+	}
+	return "enabled"
+}
+
+// toggleRow enables or disables the device of row as it asks, see
+// applyDefaults, and records the outcome in res. The device is read first
+// and written back whole, so that nothing but its state changes; one already
+// in that state is skipped. As when deleting, a device of another
+// application is a failure.
+func (imp *Importer) toggleRow(ctx context.Context, row Row, res *Result) error {
+	disabled := row.isDisabled
+	err := imp.toggle(ctx, row, disabled)
+	var note RowNote
+	switch {
+	case errors.As(err, &note):
+		res.Skipped = append(res.Skipped, RowFailure{Row: row, Err: err})
+	case err != nil:
+		imp.logRow(row).Error("Failed to set the device "+StateName(disabled), "err", err)
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+	default:
+		res.Updated++
+	}
+	return err
+}
+
+// toggle sets the device of row disabled or enabled. On a dry run the device
+// is only looked up.
+func (imp *Importer) toggle(ctx context.Context, row Row, disabled bool) error {
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return err
+	}
+
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return status.Errorf(codes.NotFound, "device %s not found", row.DevEUI)
+	case err != nil:
+		return err
+	case resp.Device.GetApplicationId() != appID:
+		return fmt.Errorf("device belongs to application %s, not %s", resp.Device.GetApplicationId(), appID)
+	case resp.Device.IsDisabled == disabled:
+		return RowNote("already " + StateName(disabled))
+	}
+
+	d := resp.Device
+	d.IsDisabled = disabled
+	req := &api.UpdateDeviceRequest{Device: d}
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_Update_FullMethodName, req, nil)
+		return nil
+	}
+	_, err = imp.Devices.Update(ctx, req)
+	return err
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// ttsDevice is the part of an end device exported from The Things Stack
+// (TTN or TTI) that ChirpStack has a place for.
+type ttsDevice struct {
+	IDs struct {
+		DeviceID string `json:"device_id"`
+		DevEUI   string `json:"dev_eui"`
+		JoinEUI  string `json:"join_eui"`
+		AppEUI   string `json:"app_eui"` // join_eui of older exports
+	} `json:"ids"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Attributes  map[string]string `json:"attributes"`
+	RootKeys    struct {
+		AppKey ttsKey `json:"app_key"`
+		NwkKey ttsKey `json:"nwk_key"`
+	} `json:"root_keys"`
+}
+
+// ttsKey is a root key of a TTS end device. Keys wrapped with a key
+// encryption key can't be imported.
+type ttsKey struct {
+	Key          string `json:"key"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+// ttsFields are the fields of a TTS end device that ttsRow maps.
+var ttsFields = []string{"ids", "name", "description", "attributes", "root_keys"}
+
+// ttsRow converts a TTS end device, whose top-level fields are given in
+// fields, into a row. Its attributes become tags, and its device ID the
+// name if it has none. The other fields, such as the frequency plan and
+// MAC settings, are added to ignored.
+func ttsRow(raw json.RawMessage, fields map[string]json.RawMessage, ignored map[string]bool) (Row, error) {
+	var d ttsDevice
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return Row{}, err
+	}
+	for f := range fields {
+		if !slices.Contains(ttsFields, f) {
+			ignored[f] = true
+		}
+	}
+	if d.RootKeys.AppKey.Key == "" && d.RootKeys.AppKey.EncryptedKey != "" {
+		ignored["root_keys.app_key.encrypted_key"] = true
+	}
+	if d.RootKeys.NwkKey.Key == "" && d.RootKeys.NwkKey.EncryptedKey != "" {
+		ignored["root_keys.nwk_key.encrypted_key"] = true
+	}
+
+	row := Row{
+		DevEUI:      d.IDs.DevEUI,
+		Name:        d.Name,
+		Description: d.Description,
+		JoinEUI:     d.IDs.JoinEUI,
+		AppKey:      d.RootKeys.AppKey.Key,
+		nwkKey:      d.RootKeys.NwkKey.Key,
+		Tags:        d.Attributes,
+	}
+	if row.Name == "" {
+		row.Name = d.IDs.DeviceID
+	}
+	if row.JoinEUI == "" {
+		row.JoinEUI = d.IDs.AppEUI
+	}
+	return row, nil
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The undo journal lists the devices created by an import, so that the
+// import can be undone. It is JSON lines: a JournalHeader naming the target,
+// then a JournalEntry per device, appended as each is created so that an
+// interrupted import can be undone too.
+
+// JournalHeader is the first line of the undo journal. An undo only runs
+// against the server it names.
+type JournalHeader struct {
+	Server        string    `json:"server"`
+	ApplicationID string    `json:"application_id"`
+	StartedAt     time.Time `json:"started_at"`
+}
+
+// JournalEntry is a device created by the import.
+type JournalEntry struct {
+	DevEUI        string `json:"dev_eui"`
+	ApplicationID string `json:"application_id"` // differs from the header's for rows with an application column
+}
+
+// Journal records the devices created by an import. A nil journal records
+// nothing.
+type Journal struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewJournal starts a journal at path for an import into the given server
+// and application.
+func NewJournal(path, server, applicationID string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{f: f, enc: json.NewEncoder(f)}
+	if err := j.enc.Encode(JournalHeader{Server: server, ApplicationID: applicationID, StartedAt: time.Now().UTC()}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// AppendJournal appends to the journal at path, starting it if there is
+// none.
+func AppendJournal(path, server, applicationID string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewJournal(path, server, applicationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// record adds a created device to the journal.
+func (j *Journal) record(devEUI, applicationID string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(JournalEntry{DevEUI: devEUI, ApplicationID: applicationID})
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
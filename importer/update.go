@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// clearValue in a cell clears the field in update mode; an empty cell
+// leaves it as it is.
+const clearValue = "-"
+
+// invasiveFields returns the fields beyond name, description and tags that
+// row would change in update mode, which --update-invasive allows, and
+// those update mode never changes. The application column only says where
+// the device is, as when deleting.
+func invasiveFields(row Row) (allowed, refused []string) {
+	if row.Profile != "" {
+		allowed = append(allowed, "device_profile")
+	}
+	if len(row.variables) > 0 {
+		allowed = append(allowed, VarPrefix+"…")
+	}
+	if row.disabledSet {
+		allowed = append(allowed, "is_disabled")
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"join_eui", row.JoinEUI != ""},
+		{"app_key", row.AppKey != ""},
+		{"nwk_key", row.nwkKey != ""},
+		{"multicast_group", row.multicastGroup != ""},
+		{"downlink_payload", row.downlinkPayload != ""},
+		{"skip_fcnt_check", row.skipFCntCheck},
+	} {
+		if f.set {
+			refused = append(refused, f.name)
+		}
+	}
+	return allowed, refused
+}
+
+// checkUpdate returns why update mode refuses to read a list with row,
+// which changes more than it should. The whole list is refused rather than
+// the row, so that a list meant for another mode isn't half applied.
+func checkUpdate(row Row, cfg ListOptions) error {
+	if cfg.Mode != ModeUpdate {
+		return nil
+	}
+	allowed, refused := invasiveFields(row)
+	switch {
+	case len(refused) > 0:
+		return fmt.Errorf("%s: update mode doesn't change %s; import, toggle or the key options do",
+			row.Pos.Field(refused[0]), strings.Join(refused, ", "))
+	case len(allowed) > 0 && !cfg.UpdateInvasive:
+		return fmt.Errorf("%s: %s would change more than names, descriptions and tags; allow it with --update-invasive",
+			row.Pos.Field(allowed[0]), strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// applyUpdate changes d as row asks, to profileID if the row has a
+// device_profile, and returns how, e.g. `name: "a" → "b"`. Empty cells
+// leave a field alone and clearValue clears it.
+func applyUpdate(d *api.Device, row Row, profileID string) []string {
+	var changes []string
+	if row.Name != "" && row.Name != d.Name {
+		changes = append(changes, fmt.Sprintf("name: %q → %q", d.Name, row.Name))
+		d.Name = row.Name
+	}
+	desc := row.Description
+	if desc == clearValue {
+		desc = ""
+	}
+	if row.Description != "" && desc != d.Description {
+		changes = append(changes, fmt.Sprintf("description: %q → %q", d.Description, desc))
+		d.Description = desc
+	}
+	changes = append(changes, updateMap(&d.Tags, row.Tags, TagPrefix)...)
+	changes = append(changes, updateMap(&d.Variables, row.variables, VarPrefix)...)
+	if row.Profile != "" && profileID != d.DeviceProfileId {
+		changes = append(changes, fmt.Sprintf("device_profile: %s → %s", d.DeviceProfileId, profileID))
+		d.DeviceProfileId = profileID
+	}
+	if row.disabledSet && row.isDisabled != d.IsDisabled {
+		changes = append(changes, fmt.Sprintf("is_disabled: %t → %t", d.IsDisabled, row.isDisabled))
+		d.IsDisabled = row.isDisabled
+	}
+	return changes
+}
+
+// updateMap sets the keys of values in m, deleting those set to clearValue,
+// and returns the changes, their keys led by prefix. Values that look like
+// secrets are masked in the changes.
+func updateMap(m *map[string]string, values map[string]string, prefix string) []string {
+	var changes []string
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		old, ok := (*m)[k]
+		switch v := values[k]; {
+		case v == clearValue && ok:
+			changes = append(changes, fmt.Sprintf("%s%s: %q cleared", prefix, k, redact.Field(k, old)))
+			delete(*m, k)
+		case v != clearValue && (v != old || !ok):
+			changes = append(changes, fmt.Sprintf("%s%s: %q → %q", prefix, k, redact.Field(k, old), redact.Field(k, v)))
+			if *m == nil {
+				*m = make(map[string]string)
+			}
+			(*m)[k] = v
+		}
+	}
+	return changes
+}
+
+// updateRow changes the fields of the device of row that the row has values
+// for and records the outcome in res. The device is read first and written
+// back whole; one whose fields already match is counted as unchanged. As
+// when deleting, a device of another application is a failure.
+func (imp *Importer) updateRow(ctx context.Context, row Row, res *Result) error {
+	err := imp.updateFields(ctx, row)
+	switch {
+	case errors.Is(err, errUnchanged):
+		res.Unchanged++
+		return nil
+	case err != nil:
+		imp.logRow(row).Error("Failed to update the device", "err", err)
+		res.Failures = append(res.Failures, RowFailure{Row: row, Err: err})
+		return err
+	}
+	res.Updated++
+	return nil
+}
+
+// errUnchanged is returned by updateFields for a device that already is as
+// the row asks.
+var errUnchanged = errors.New("unchanged")
+
+// updateFields updates the device of row as applyUpdate changes it. On a dry
+// run the device is only looked up.
+func (imp *Importer) updateFields(ctx context.Context, row Row) error {
+	appID, err := imp.applicationFor(ctx, row)
+	if err != nil {
+		return err
+	}
+	var profileID string
+	if row.Profile != "" {
+		if profileID, err = imp.profileFor(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: row.DevEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return status.Errorf(codes.NotFound, "device %s not found", row.DevEUI)
+	case err != nil:
+		return err
+	case resp.Device.GetApplicationId() != appID:
+		return fmt.Errorf("device belongs to application %s, not %s", resp.Device.GetApplicationId(), appID)
+	}
+
+	d := resp.Device
+	changes := applyUpdate(d, row, profileID)
+	if len(changes) == 0 {
+		return errUnchanged
+	}
+	req := &api.UpdateDeviceRequest{Device: d}
+	if imp.DryRun {
+		imp.Audit.DryRun(ctx, api.DeviceService_Update_FullMethodName, req, nil)
+		return nil
+	}
+	if _, err := imp.Devices.Update(ctx, req); err != nil {
+		return err
+	}
+	imp.logRow(row).Info("Updated the device", "changes", strings.Join(changes, ", "))
+	return nil
+}
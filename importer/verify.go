@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// SentDevice is a created device as it was sent to the server, for reading
+// it back in verify.
+type SentDevice struct {
+	Row              Row
+	appID, profileID string
+	keys             bool // root keys were provisioned
+}
+
+// Mismatch is how a created device read back differs from what was sent.
+type Mismatch string
+
+func (e Mismatch) Error() string { return string(e) }
+
+// Verify reads back the devices created for results, listLookups at a
+// time, and records in each result how many match what was sent and which
+// don't. progress is called after each device. Cancelling ctx stops it,
+// leaving the rest unverified.
+func (imp *Importer) Verify(ctx context.Context, results []FileResult, progress func(done, total int)) {
+	stop := ctx
+	ctx = AuthContext(context.WithoutCancel(ctx), imp.Token)
+
+	total := 0
+	for _, fr := range results {
+		total += len(fr.Result.Sent)
+	}
+	if progress != nil && total > 0 {
+		progress(0, total)
+	}
+	var mu sync.Mutex
+	done := 0
+	for i := range results {
+		res := &results[i].Result
+		ForEachParallel(len(res.Sent), func(j int) {
+			imp.Pause.wait(stop)
+			if stop.Err() != nil {
+				return
+			}
+			d := res.Sent[j]
+			err := imp.readBack(ctx, d)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				imp.logRow(d.Row).Warn("Verifying the device", "err", err)
+				res.Mismatches = append(res.Mismatches, RowFailure{Row: d.Row, Err: err})
+			} else {
+				res.Verified++
+			}
+			done++
+			if progress != nil {
+				progress(done, total)
+			}
+		})
+	}
+}
+
+// readBack fetches the device d and returns a mismatch listing every way
+// it differs from what was sent, or the error reading it.
+func (imp *Importer) readBack(ctx context.Context, d SentDevice) error {
+	resp, err := imp.Devices.Get(ctx, &api.GetDeviceRequest{DevEui: d.Row.DevEUI})
+	if status.Code(err) == codes.NotFound {
+		return Mismatch("not found when read back")
+	} else if err != nil {
+		return err
+	}
+
+	var problems []string
+	got := resp.Device
+	if got.Name != d.Row.Name {
+		problems = append(problems, fmt.Sprintf("name is %q, not %q", got.Name, d.Row.Name))
+	}
+	if !strings.EqualFold(got.ApplicationId, d.appID) {
+		problems = append(problems, "in application "+got.ApplicationId+", not "+d.appID)
+	}
+	if !strings.EqualFold(got.DeviceProfileId, d.profileID) {
+		problems = append(problems, "device profile is "+got.DeviceProfileId+", not "+d.profileID)
+	}
+	if d.keys {
+		_, err := imp.Devices.GetKeys(ctx, &api.GetDeviceKeysRequest{DevEui: d.Row.DevEUI})
+		switch {
+		case status.Code(err) == codes.NotFound:
+			problems = append(problems, "has no keys")
+		case err != nil:
+			return err
+		}
+	}
+	if len(problems) > 0 {
+		return Mismatch(strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package importer
+
+import "fmt"
+
+// Version is a ChirpStack release, e.g. 4.6.0. The zero version is an
+// unknown one.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// joinEUIVersion is the first release that stores the JoinEUI of a device;
+// older ones drop it without an error.
+var joinEUIVersion = Version{4, 6, 0}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Known reports whether v was determined.
+func (v Version) Known() bool {
+	return v != Version{}
+}
+
+// Less reports whether v is an older release than o.
+func (v Version) Less(o Version) bool {
+	switch {
+	case v.Major != o.Major:
+		return v.Major < o.Major
+	case v.Minor != o.Minor:
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// unsupported returns row without the fields the server is too old to
+// store, and a RowNote naming them, or nil if it stores every field of the
+// row. A server of unknown version is sent every field.
+func (imp *Importer) unsupported(row Row) (Row, error) {
+	if row.JoinEUI == "" || !imp.Server.Known() || !imp.Server.Less(joinEUIVersion) {
+		return row, nil
+	}
+	row.JoinEUI = ""
+	return row, RowNote(fmt.Sprintf("join_eui left out: ChirpStack %s doesn't store it, %s or later does", imp.Server, joinEUIVersion))
+}
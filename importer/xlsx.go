@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// readXLSX reads a device list from an Excel workbook. The first sheet is used
+// unless one is configured. Cell values are read raw rather than formatted,
+// so long numeric EUIs aren't rendered in scientific notation. The workbook
+// itself has to be unpacked in memory, but its rows are read one at a time.
+func readXLSX(r io.Reader, s *scanner) error {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return fmt.Errorf("reading workbook: %w", err)
+	}
+	defer f.Close()
+
+	sheet := s.batch.cfg.Sheet
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	} else if idx, _ := f.GetSheetIndex(sheet); idx < 0 {
+		return fmt.Errorf("workbook has no sheet named %q (sheets: %s)", sheet, strings.Join(f.GetSheetList(), ", "))
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return fmt.Errorf("reading sheet %q: %w", sheet, err)
+	}
+	defer rows.Close()
+
+	line, n := 0, 0
+	err = rowsFromRecords(func() ([]string, int, error) {
+		for rows.Next() {
+			line++
+			row, err := rows.Columns(excelize.Options{RawCellValue: true})
+			if err != nil {
+				return nil, 0, err
+			}
+			if strings.TrimSpace(strings.Join(row, "")) == "" {
+				continue
+			}
+			n++
+			return row, line, nil
+		}
+		if err := rows.Error(); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, io.EOF
+	}, s)
+	if err != nil {
+		return err
+	}
+
+	s.setFormat(fmt.Sprintf("XLSX sheet %q, %d rows", sheet, n))
+	return nil
+}
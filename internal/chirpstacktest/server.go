@@ -0,0 +1,351 @@
+// Package chirpstacktest runs a ChirpStack gRPC API in memory for tests. A
+// Server keeps tenants, applications, device profiles, multicast groups and
+// devices, answers the calls the importer makes from them as ChirpStack
+// would, records every call, and can be told to fail calls.
+package chirpstacktest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// Version is what GetVersion answers unless Server.Version is set.
+const Version = "4.14.1"
+
+// Call is a call the server received.
+type Call struct {
+	Method string // full method name, e.g. api.DeviceService_Create_FullMethodName
+	Auth   string // the authorization metadata, e.g. "Bearer token"
+	Req    proto.Message
+}
+
+// Server is an in-memory ChirpStack. Its zero value isn't usable; start one
+// with NewServer and connect to it with Dial.
+type Server struct {
+	// Version is what GetVersion answers, Version if empty. Set it before
+	// the first call.
+	Version string
+
+	mu       sync.Mutex
+	tenants  []*api.Tenant
+	apps     []*api.Application
+	profiles []*api.DeviceProfile
+	groups   []*api.MulticastGroup
+	devices  map[string]*api.Device // by DevEUI
+	keys     map[string]*api.DeviceKeys
+	sessions map[string]*api.DeviceActivation // of ABP-activated devices
+	seen     map[string]time.Time
+	queue    map[string][]*api.DeviceQueueItem
+	members  map[string][]string // DevEUIs by multicast group ID
+	ids      int
+
+	calls       []Call
+	faults      map[string][]error // by method, returned by its next calls in turn
+	faultsAfter map[string][]error // as faults, but after the call was carried out
+
+	lis *bufconn.Listener
+	srv *grpc.Server
+}
+
+// NewServer starts a server, which is stopped when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		devices:     make(map[string]*api.Device),
+		keys:        make(map[string]*api.DeviceKeys),
+		sessions:    make(map[string]*api.DeviceActivation),
+		seen:        make(map[string]time.Time),
+		queue:       make(map[string][]*api.DeviceQueueItem),
+		members:     make(map[string][]string),
+		faults:      make(map[string][]error),
+		faultsAfter: make(map[string][]error),
+	}
+	s.Start()
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// Start serves on a new listener, after Stop; the connections of Dial find
+// it when they reconnect.
+func (s *Server) Start() {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(s.intercept))
+	api.RegisterTenantServiceServer(srv, tenants{s: s})
+	api.RegisterApplicationServiceServer(srv, applications{s: s})
+	api.RegisterDeviceProfileServiceServer(srv, profiles{s: s})
+	api.RegisterDeviceServiceServer(srv, devices{s: s})
+	api.RegisterMulticastGroupServiceServer(srv, multicastGroups{s: s})
+	api.RegisterInternalServiceServer(srv, internal{s: s})
+
+	lis := bufconn.Listen(1 << 20)
+	s.mu.Lock()
+	s.lis, s.srv = lis, srv
+	s.mu.Unlock()
+	go srv.Serve(lis)
+}
+
+// Stop drops the connections to the server and stops it taking new ones,
+// as a server that went away; the data is kept for Start.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	srv.Stop()
+}
+
+// Dial connects to the server with opts. The connection is closed when the
+// test ends.
+func (s *Server) Dial(t testing.TB, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			s.mu.Lock()
+			lis := s.lis
+			s.mu.Unlock()
+			return lis.DialContext(ctx)
+		}),
+	}, opts...)
+	cc, err := grpc.NewClient("passthrough:///chirpstack", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+// Fail makes the next calls of method fail with errs, one call each. A nil
+// error lets its call through.
+func (s *Server) Fail(method string, errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = append(s.faults[method], errs...)
+}
+
+// FailAfter is Fail, except that the calls are carried out before they
+// fail, as calls whose answer was lost with the connection.
+func (s *Server) FailAfter(method string, errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultsAfter[method] = append(s.faultsAfter[method], errs...)
+}
+
+// Calls returns the calls of method received so far, or every call if
+// method is empty.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// intercept records each call and fails it if Fail or FailAfter asked for
+// it.
+func (s *Server) intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var auth string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			auth = v[0]
+		}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: info.FullMethod, Auth: auth, Req: proto.Clone(req.(proto.Message))})
+	var err, after error
+	if errs := s.faults[info.FullMethod]; len(errs) > 0 {
+		err, s.faults[info.FullMethod] = errs[0], errs[1:]
+	}
+	if errs := s.faultsAfter[info.FullMethod]; err == nil && len(errs) > 0 {
+		after, s.faultsAfter[info.FullMethod] = errs[0], errs[1:]
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	if after != nil {
+		return nil, after
+	}
+	return resp, err
+}
+
+// newID returns an ID for a new object, unique on the server.
+func (s *Server) newID() string {
+	s.ids++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", s.ids)
+}
+
+// AddTenant adds t, giving it an ID if it has none, and returns its ID.
+func (s *Server) AddTenant(t *api.Tenant) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t = proto.Clone(t).(*api.Tenant)
+	if t.Id == "" {
+		t.Id = s.newID()
+	}
+	s.tenants = append(s.tenants, t)
+	return t.Id
+}
+
+// AddApplication adds a, giving it an ID if it has none, and returns its ID.
+func (s *Server) AddApplication(a *api.Application) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a = proto.Clone(a).(*api.Application)
+	if a.Id == "" {
+		a.Id = s.newID()
+	}
+	s.apps = append(s.apps, a)
+	return a.Id
+}
+
+// AddProfile adds p, giving it an ID if it has none, and returns its ID.
+func (s *Server) AddProfile(p *api.DeviceProfile) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p = proto.Clone(p).(*api.DeviceProfile)
+	if p.Id == "" {
+		p.Id = s.newID()
+	}
+	s.profiles = append(s.profiles, p)
+	return p.Id
+}
+
+// AddMulticastGroup adds g, giving it an ID if it has none, and returns its
+// ID.
+func (s *Server) AddMulticastGroup(g *api.MulticastGroup) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g = proto.Clone(g).(*api.MulticastGroup)
+	if g.Id == "" {
+		g.Id = s.newID()
+	}
+	s.groups = append(s.groups, g)
+	return g.Id
+}
+
+// AddDevice adds d with keys, which may be nil, as if it had been created.
+func (s *Server) AddDevice(d *api.Device, keys *api.DeviceKeys) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.DevEui] = proto.Clone(d).(*api.Device)
+	if keys != nil {
+		s.keys[d.DevEui] = proto.Clone(keys).(*api.DeviceKeys)
+	}
+}
+
+// Seen marks the device devEUI as last seen at.
+func (s *Server) Seen(devEUI string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[devEUI] = at
+}
+
+// Device returns the device devEUI, or nil if there is none.
+func (s *Server) Device(devEUI string) *api.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[devEUI]
+	if !ok {
+		return nil
+	}
+	return proto.Clone(d).(*api.Device)
+}
+
+// Devices returns the DevEUIs of the devices, sorted.
+func (s *Server) Devices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var euis []string
+	for eui := range s.devices {
+		euis = append(euis, eui)
+	}
+	slices.Sort(euis)
+	return euis
+}
+
+// Keys returns the root keys of the device devEUI, or nil if it has none.
+func (s *Server) Keys(devEUI string) *api.DeviceKeys {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[devEUI]
+	if !ok {
+		return nil
+	}
+	return proto.Clone(k).(*api.DeviceKeys)
+}
+
+// Activation returns the session the device devEUI was activated with, or
+// nil if it wasn't.
+func (s *Server) Activation(devEUI string) *api.DeviceActivation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.sessions[devEUI]
+	if !ok {
+		return nil
+	}
+	return proto.Clone(a).(*api.DeviceActivation)
+}
+
+// Queue returns the downlinks enqueued for the device devEUI.
+func (s *Server) Queue(devEUI string) []*api.DeviceQueueItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.queue[devEUI])
+}
+
+// Members returns the DevEUIs of the devices in the multicast group id.
+func (s *Server) Members(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.members[id])
+}
+
+// matches reports whether name matches the search of a List call, which
+// like ChirpStack's is a case-insensitive substring.
+func matches(name, search string) bool {
+	return strings.Contains(strings.ToLower(name), strings.ToLower(search))
+}
+
+// page returns the page of items a List call with limit and offset asks for.
+func page[T any](items []T, limit, offset uint32) []T {
+	start := min(int(offset), len(items))
+	end := min(start+int(limit), len(items))
+	return items[start:end]
+}
+
+// find returns the object of items with the given ID.
+func find[T interface{ GetId() string }](items []T, id string) (T, bool) {
+	for _, it := range items {
+		if it.GetId() == id {
+			return it, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func notFound(what string) error {
+	return status.Errorf(codes.NotFound, "Object does not exist (%s)", what)
+}
+
+var errExists = status.Error(codes.AlreadyExists, "Object already exists")
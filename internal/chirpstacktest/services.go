@@ -0,0 +1,336 @@
+package chirpstacktest
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// The services each implement their part of the API over the data of s;
+// the calls they leave out fail as Unimplemented.
+type (
+	tenants struct {
+		api.UnimplementedTenantServiceServer
+		s *Server
+	}
+	applications struct {
+		api.UnimplementedApplicationServiceServer
+		s *Server
+	}
+	profiles struct {
+		api.UnimplementedDeviceProfileServiceServer
+		s *Server
+	}
+	devices struct {
+		api.UnimplementedDeviceServiceServer
+		s *Server
+	}
+	multicastGroups struct {
+		api.UnimplementedMulticastGroupServiceServer
+		s *Server
+	}
+	internal struct {
+		api.UnimplementedInternalServiceServer
+		s *Server
+	}
+)
+
+func (x tenants) Get(_ context.Context, req *api.GetTenantRequest) (*api.GetTenantResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	t, ok := find(x.s.tenants, req.Id)
+	if !ok {
+		return nil, notFound("tenant")
+	}
+	return &api.GetTenantResponse{Tenant: proto.Clone(t).(*api.Tenant)}, nil
+}
+
+func (x tenants) List(_ context.Context, req *api.ListTenantsRequest) (*api.ListTenantsResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var items []*api.TenantListItem
+	for _, t := range x.s.tenants {
+		if matches(t.Name, req.Search) {
+			items = append(items, &api.TenantListItem{
+				Id:              t.Id,
+				Name:            t.Name,
+				CanHaveGateways: t.CanHaveGateways,
+				MaxGatewayCount: t.MaxGatewayCount,
+				MaxDeviceCount:  t.MaxDeviceCount,
+			})
+		}
+	}
+	return &api.ListTenantsResponse{TotalCount: uint32(len(items)), Result: page(items, req.Limit, req.Offset)}, nil
+}
+
+func (x applications) Get(_ context.Context, req *api.GetApplicationRequest) (*api.GetApplicationResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	a, ok := find(x.s.apps, req.Id)
+	if !ok {
+		return nil, notFound("application")
+	}
+	return &api.GetApplicationResponse{Application: proto.Clone(a).(*api.Application)}, nil
+}
+
+func (x applications) List(_ context.Context, req *api.ListApplicationsRequest) (*api.ListApplicationsResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var items []*api.ApplicationListItem
+	for _, a := range x.s.apps {
+		if a.TenantId == req.TenantId && matches(a.Name, req.Search) {
+			items = append(items, &api.ApplicationListItem{Id: a.Id, Name: a.Name, Description: a.Description})
+		}
+	}
+	return &api.ListApplicationsResponse{TotalCount: uint32(len(items)), Result: page(items, req.Limit, req.Offset)}, nil
+}
+
+func (x profiles) Get(_ context.Context, req *api.GetDeviceProfileRequest) (*api.GetDeviceProfileResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	p, ok := find(x.s.profiles, req.Id)
+	if !ok {
+		return nil, notFound("device profile")
+	}
+	return &api.GetDeviceProfileResponse{DeviceProfile: proto.Clone(p).(*api.DeviceProfile)}, nil
+}
+
+func (x profiles) List(_ context.Context, req *api.ListDeviceProfilesRequest) (*api.ListDeviceProfilesResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var items []*api.DeviceProfileListItem
+	for _, p := range x.s.profiles {
+		if p.TenantId == req.TenantId && matches(p.Name, req.Search) {
+			items = append(items, &api.DeviceProfileListItem{
+				Id:                p.Id,
+				Name:              p.Name,
+				Region:            p.Region,
+				MacVersion:        p.MacVersion,
+				RegParamsRevision: p.RegParamsRevision,
+				SupportsOtaa:      p.SupportsOtaa,
+				SupportsClassB:    p.SupportsClassB,
+				SupportsClassC:    p.SupportsClassC,
+			})
+		}
+	}
+	return &api.ListDeviceProfilesResponse{TotalCount: uint32(len(items)), Result: page(items, req.Limit, req.Offset)}, nil
+}
+
+func (x devices) Create(_ context.Context, req *api.CreateDeviceRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	d := req.Device
+	if _, ok := x.s.devices[d.GetDevEui()]; ok {
+		return nil, errExists
+	}
+	if _, ok := find(x.s.apps, d.GetApplicationId()); !ok {
+		return nil, notFound("application")
+	}
+	if _, ok := find(x.s.profiles, d.GetDeviceProfileId()); !ok {
+		return nil, notFound("device profile")
+	}
+	x.s.devices[d.DevEui] = proto.Clone(d).(*api.Device)
+	return &emptypb.Empty{}, nil
+}
+
+func (x devices) Get(_ context.Context, req *api.GetDeviceRequest) (*api.GetDeviceResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	d, ok := x.s.devices[req.DevEui]
+	if !ok {
+		return nil, notFound("device")
+	}
+	resp := &api.GetDeviceResponse{Device: proto.Clone(d).(*api.Device)}
+	if at, ok := x.s.seen[req.DevEui]; ok {
+		resp.LastSeenAt = timestamppb.New(at)
+	}
+	return resp, nil
+}
+
+func (x devices) Update(_ context.Context, req *api.UpdateDeviceRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	d := req.Device
+	if _, ok := x.s.devices[d.GetDevEui()]; !ok {
+		return nil, notFound("device")
+	}
+	x.s.devices[d.DevEui] = proto.Clone(d).(*api.Device)
+	return &emptypb.Empty{}, nil
+}
+
+func (x devices) Delete(_ context.Context, req *api.DeleteDeviceRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	if _, ok := x.s.devices[req.DevEui]; !ok {
+		return nil, notFound("device")
+	}
+	delete(x.s.devices, req.DevEui)
+	delete(x.s.keys, req.DevEui)
+	delete(x.s.sessions, req.DevEui)
+	delete(x.s.seen, req.DevEui)
+	delete(x.s.queue, req.DevEui)
+	return &emptypb.Empty{}, nil
+}
+
+func (x devices) List(_ context.Context, req *api.ListDevicesRequest) (*api.ListDevicesResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var items []*api.DeviceListItem
+	for _, d := range x.s.devices {
+		if d.ApplicationId != req.ApplicationId || !matches(d.Name, req.Search) {
+			continue
+		}
+		item := &api.DeviceListItem{
+			DevEui:          d.DevEui,
+			Name:            d.Name,
+			Description:     d.Description,
+			DeviceProfileId: d.DeviceProfileId,
+			Tags:            d.Tags,
+		}
+		if p, ok := find(x.s.profiles, d.DeviceProfileId); ok {
+			item.DeviceProfileName = p.Name
+		}
+		if at, ok := x.s.seen[d.DevEui]; ok {
+			item.LastSeenAt = timestamppb.New(at)
+		}
+		items = append(items, item)
+	}
+	// By name, as ChirpStack lists them
+	slices.SortFunc(items, func(a, b *api.DeviceListItem) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.DevEui, b.DevEui))
+	})
+	return &api.ListDevicesResponse{TotalCount: uint32(len(items)), Result: page(items, req.Limit, req.Offset)}, nil
+}
+
+func (x devices) CreateKeys(_ context.Context, req *api.CreateDeviceKeysRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	k := req.DeviceKeys
+	if _, ok := x.s.devices[k.GetDevEui()]; !ok {
+		return nil, notFound("device")
+	}
+	if _, ok := x.s.keys[k.DevEui]; ok {
+		return nil, errExists
+	}
+	x.s.keys[k.DevEui] = proto.Clone(k).(*api.DeviceKeys)
+	return &emptypb.Empty{}, nil
+}
+
+func (x devices) GetKeys(_ context.Context, req *api.GetDeviceKeysRequest) (*api.GetDeviceKeysResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	k, ok := x.s.keys[req.DevEui]
+	if !ok {
+		return nil, notFound("device keys")
+	}
+	return &api.GetDeviceKeysResponse{DeviceKeys: proto.Clone(k).(*api.DeviceKeys)}, nil
+}
+
+func (x devices) UpdateKeys(_ context.Context, req *api.UpdateDeviceKeysRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	k := req.DeviceKeys
+	if _, ok := x.s.keys[k.GetDevEui()]; !ok {
+		return nil, notFound("device keys")
+	}
+	x.s.keys[k.DevEui] = proto.Clone(k).(*api.DeviceKeys)
+	return &emptypb.Empty{}, nil
+}
+
+func (x devices) Activate(_ context.Context, req *api.ActivateDeviceRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	a := req.DeviceActivation
+	if _, ok := x.s.devices[a.GetDevEui()]; !ok {
+		return nil, notFound("device")
+	}
+	x.s.sessions[a.DevEui] = proto.Clone(a).(*api.DeviceActivation)
+	return &emptypb.Empty{}, nil
+}
+
+// GetActivation answers with the session of Activate, or that the device
+// has none.
+func (x devices) GetActivation(_ context.Context, req *api.GetDeviceActivationRequest) (*api.GetDeviceActivationResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	if _, ok := x.s.devices[req.DevEui]; !ok {
+		return nil, notFound("device")
+	}
+	if a, ok := x.s.sessions[req.DevEui]; ok {
+		return &api.GetDeviceActivationResponse{DeviceActivation: proto.Clone(a).(*api.DeviceActivation)}, nil
+	}
+	return &api.GetDeviceActivationResponse{}, nil
+}
+
+func (x devices) Enqueue(_ context.Context, req *api.EnqueueDeviceQueueItemRequest) (*api.EnqueueDeviceQueueItemResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	item := proto.Clone(req.QueueItem).(*api.DeviceQueueItem)
+	if _, ok := x.s.devices[item.GetDevEui()]; !ok {
+		return nil, notFound("device")
+	}
+	item.Id = x.s.newID()
+	x.s.queue[item.DevEui] = append(x.s.queue[item.DevEui], item)
+	return &api.EnqueueDeviceQueueItemResponse{Id: item.Id}, nil
+}
+
+func (x multicastGroups) List(_ context.Context, req *api.ListMulticastGroupsRequest) (*api.ListMulticastGroupsResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var items []*api.MulticastGroupListItem
+	for _, g := range x.s.groups {
+		if g.ApplicationId == req.ApplicationId && matches(g.Name, req.Search) {
+			items = append(items, &api.MulticastGroupListItem{Id: g.Id, Name: g.Name, Region: g.Region, GroupType: g.GroupType})
+		}
+	}
+	return &api.ListMulticastGroupsResponse{TotalCount: uint32(len(items)), Result: page(items, req.Limit, req.Offset)}, nil
+}
+
+func (x multicastGroups) AddDevice(_ context.Context, req *api.AddDeviceToMulticastGroupRequest) (*emptypb.Empty, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	if _, ok := find(x.s.groups, req.MulticastGroupId); !ok {
+		return nil, notFound("multicast group")
+	}
+	if _, ok := x.s.devices[req.DevEui]; !ok {
+		return nil, notFound("device")
+	}
+	if !slices.Contains(x.s.members[req.MulticastGroupId], req.DevEui) {
+		x.s.members[req.MulticastGroupId] = append(x.s.members[req.MulticastGroupId], req.DevEui)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// GetDevicesSummary counts the devices of the tenant, those seen as active.
+func (x internal) GetDevicesSummary(_ context.Context, req *api.GetDevicesSummaryRequest) (*api.GetDevicesSummaryResponse, error) {
+	x.s.mu.Lock()
+	defer x.s.mu.Unlock()
+	var resp api.GetDevicesSummaryResponse
+	for _, d := range x.s.devices {
+		if a, ok := find(x.s.apps, d.ApplicationId); !ok || a.TenantId != req.TenantId {
+			continue
+		}
+		if _, ok := x.s.seen[d.DevEui]; ok {
+			resp.ActiveCount++
+		} else {
+			resp.NeverSeenCount++
+		}
+	}
+	return &resp, nil
+}
+
+// GetGatewaysSummary answers that the tenant has no gateways; the server
+// keeps none.
+func (x internal) GetGatewaysSummary(context.Context, *api.GetGatewaysSummaryRequest) (*api.GetGatewaysSummaryResponse, error) {
+	return &api.GetGatewaysSummaryResponse{}, nil
+}
+
+func (x internal) GetVersion(context.Context, *emptypb.Empty) (*api.GetVersionResponse, error) {
+	return &api.GetVersionResponse{Version: cmp.Or(x.s.Version, Version)}, nil
+}
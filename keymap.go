@@ -0,0 +1,469 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// binding is a key binding of the UI together with the screens it applies
+// to. The key handlers match against these bindings and the footer and the
+// help overlay are generated from them, so the help can't drift from what
+// the keys actually do.
+type binding struct {
+	key.Binding
+	group  int                                  // column in the help overlay
+	active func(m model) bool                   // whether the key does anything right now
+	help   func(m model) (helpKey, desc string) // overrides the help text
+	short  bool                                 // also shown in the footer
+}
+
+// Columns of the help overlay
+const (
+	groupMove = iota
+	groupAction
+	groupGeneral
+)
+
+func newBinding(group int, short bool, active func(model) bool, keys []string, helpKey, desc string) *binding {
+	return &binding{
+		Binding: key.NewBinding(key.WithKeys(keys...), key.WithHelp(helpKey, desc)),
+		group:   group,
+		active:  active,
+		short:   short,
+	}
+}
+
+// withHelp sets a function describing the binding in the help, for
+// bindings whose help depends on the model.
+func (b *binding) withHelp(f func(model) (string, string)) *binding {
+	b.help = f
+	return b
+}
+
+// matches reports whether msg is one of b's keys and b is active.
+func (b *binding) matches(m model, msg tea.KeyMsg) bool {
+	return b.active(m) && key.Matches(msg, b.Binding)
+}
+
+// in returns a predicate that is true in any of the given states.
+func in(states ...state) func(model) bool {
+	return func(m model) bool {
+		for _, s := range states {
+			if m.state == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// typing reports whether keys are going into a text input, where letters
+// and "?" are text rather than commands.
+func (m model) typing() bool {
+	switch {
+	case m.state == stateConnecting, m.state == stateCreateTenant, m.state == stateCreateApplication, m.state == stateCreateMulticast:
+		return true
+	case m.naming():
+		return true
+	case m.state == stateFileSelect && (m.enteringPath || m.enteringURL || m.enteringFilter):
+		return true
+	case m.state == stateExport && m.export.editing():
+		return true
+	case m.state == stateConfirm && m.typed != nil:
+		return true
+	case m.state == stateUndo && m.undo.confirming():
+		return true
+	case m.editingQRPath():
+		return true
+	case m.editingRow():
+		return true
+	}
+	return m.filtering()
+}
+
+// listState reports whether a selection list is shown and in one of the
+// given filter states, or not being filtered if none are given.
+func (m model) listState(filterStates ...list.FilterState) bool {
+	l := m.currentList()
+	if l == nil {
+		return false
+	}
+	if len(filterStates) == 0 {
+		return l.FilterState() != list.Filtering
+	}
+	for _, fs := range filterStates {
+		if l.FilterState() == fs {
+			return true
+		}
+	}
+	return false
+}
+
+// browsing reports whether the file picker itself has the keys.
+func (m model) browsing() bool {
+	return m.state == stateFileSelect && !m.enteringPath && !m.enteringURL && !m.enteringFilter
+}
+
+// naming reports whether the column mapping is being named.
+func (m model) naming() bool {
+	return m.state == stateColumnMapping && m.mapping != nil && m.mapping.naming
+}
+
+// mappingColumns reports whether columns are being assigned on the mapping
+// screen.
+func (m model) mappingColumns() bool {
+	return m.state == stateColumnMapping && m.mapping != nil && !m.mapping.naming
+}
+
+// exportable reports whether the highlighted application can be exported.
+func (m model) exportable() bool {
+	it, ok := m.appList.SelectedItem().(item)
+	return m.state == stateApplicationSelect && m.listState() && ok && !it.create
+}
+
+// gatewaysExportable reports whether the gateways of the highlighted tenant
+// can be exported.
+func (m model) gatewaysExportable() bool {
+	it, ok := m.tenantList.SelectedItem().(item)
+	return m.state == stateTenantSelect && m.listState() && ok && !it.create
+}
+
+func (m model) exportDoneHelp() (string, string) {
+	if m.export.gateways {
+		return "enter", "back to tenants"
+	}
+	return "enter", "back to applications"
+}
+
+// exportPhase reports whether the export screen is in the given phase:
+// entering the path or finished.
+func (m model) exportPhase(editing bool) bool {
+	if m.state != stateExport {
+		return false
+	}
+	if editing {
+		return m.export.editing()
+	}
+	return m.export.path != ""
+}
+
+// categories reports whether a sync plan or comparison is shown, with the
+// devices counted by category.
+func (m model) categories() bool {
+	return m.state == stateSyncPlan || m.state == stateCompare
+}
+
+// choosing reports whether the confirmation is chosen with buttons.
+func (m model) choosing() bool {
+	return m.state == stateConfirm && m.typed == nil && !m.editingTags
+}
+
+func (m model) recentHelp() (string, string) {
+	return fmt.Sprintf("1-%d", len(m.history.RecentFiles)), "recent file"
+}
+
+func (m model) modeHelp() (string, string) {
+	return "m", "switch to " + m.cfg.Mode.Next().String()
+}
+
+func (m model) reviewHelp() (string, string) {
+	switch m.cfg.Mode {
+	case importer.ModeCompare:
+		return "y", fmt.Sprintf("compare %d devices with %s", m.previewTotal(), m.appName)
+	case importer.ModeStatus:
+		return "y", fmt.Sprintf("check the status of %d devices", m.previewTotal())
+	case importer.ModeQR:
+		return "y", fmt.Sprintf("write the QR codes of %d devices", m.previewTotal())
+	}
+	return "y", fmt.Sprintf("review %d %s to %s", m.previewTotal(), m.noun(), m.cfg.Mode.Verb())
+}
+
+// Key bindings, in the order they are listed in the help
+var (
+	// Token input
+	keyConnect         = newBinding(groupAction, true, in(stateConnecting), []string{"enter"}, "enter", "connect")
+	keyRevealToken     = newBinding(groupAction, true, model.revealable, []string{"ctrl+r"}, "ctrl+r", "show token").withHelp(model.revealHelp)
+	keyValidateOffline = newBinding(groupAction, true, in(stateConnecting), []string{"ctrl+o"}, "ctrl+o", "validate lists offline")
+
+	// Selection lists
+	keyListMove       = newBinding(groupMove, true, func(m model) bool { return m.listState() }, []string{"up", "down", "k", "j"}, "↑/↓", "navigate")
+	keyListPage       = newBinding(groupMove, false, func(m model) bool { return m.listState() }, []string{"left", "right", "h", "l"}, "←/→", "page")
+	keyFilter         = newBinding(groupAction, true, func(m model) bool { return m.listState(list.Unfiltered) }, []string{"/"}, "/", "filter")
+	keySelect         = newBinding(groupAction, true, func(m model) bool { return m.listState() }, []string{"enter"}, "enter", "select")
+	keyExport         = newBinding(groupAction, true, model.exportable, []string{"e"}, "e", "export devices")
+	keyBrowse         = newBinding(groupAction, true, model.exportable, []string{"b"}, "b", "browse devices")
+	keyKeyless        = newBinding(groupAction, false, model.exportable, []string{"K"}, "K", "report devices missing keys")
+	keyExportGateways = newBinding(groupAction, true, model.gatewaysExportable, []string{"e"}, "e", "export gateways")
+	keyGateways       = newBinding(groupAction, true, func(m model) bool { return m.state == stateTenantSelect && m.listState() }, []string{"tab"}, "tab", "switch to gateways").withHelp(model.gatewaysHelp)
+	keyRegion         = newBinding(groupAction, true, model.regionFilterable, []string{"tab"}, "tab", "filter by region").withHelp(model.regionHelp)
+	keyTemplateBack   = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateTemplateSelect && m.listState(list.Unfiltered) }, []string{"esc"}, "esc", "back to device profiles")
+	keyBrowseBack     = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateBrowse && m.listState(list.Unfiltered) }, []string{"esc"}, "esc", "back to applications")
+	keyClearFilter    = newBinding(groupAction, true, func(m model) bool { return m.listState(list.FilterApplied) }, []string{"esc"}, "esc", "clear filter")
+	keyApplyFilter    = newBinding(groupAction, true, func(m model) bool { return m.listState(list.Filtering) }, []string{"enter"}, "enter", "apply filter")
+	keyStopFilter     = newBinding(groupAction, true, func(m model) bool { return m.listState(list.Filtering) }, []string{"esc"}, "esc", "cancel filter")
+
+	// Device details
+	keyDetailBack = newBinding(groupGeneral, true, in(stateDeviceDetail), []string{"esc"}, "esc", "back to devices")
+
+	// Create-application form
+	keyNextField      = newBinding(groupMove, true, in(stateCreateTenant, stateCreateApplication, stateCreateMulticast), []string{"tab", "shift+tab", "up", "down"}, "tab", "next field")
+	keyToggleGateways = newBinding(groupAction, true, model.togglingGateways, []string{" "}, "space", "toggle gateways")
+	keyCreateApp      = newBinding(groupAction, true, in(stateCreateTenant, stateCreateApplication), []string{"enter"}, "enter", "create")
+	keyToggleClass    = newBinding(groupAction, true, model.togglingClass, []string{" "}, "space", "toggle class B/C")
+	keyUseGroup       = newBinding(groupAction, true, in(stateCreateMulticast), []string{"enter"}, "enter", "use group")
+	keyFormBack       = newBinding(groupGeneral, true, in(stateCreateTenant, stateCreateApplication, stateCreateMulticast), []string{"esc"}, "esc", "back")
+
+	// Export
+	keyExportStart = newBinding(groupAction, true, func(m model) bool { return m.exportPhase(true) }, []string{"enter"}, "enter", "export")
+	keyExportBack  = newBinding(groupGeneral, true, func(m model) bool { return m.exportPhase(true) }, []string{"esc"}, "esc", "back")
+	keyExportDone  = newBinding(groupGeneral, true, func(m model) bool { return m.exportPhase(false) }, []string{"enter", "esc"}, "enter", "back to applications").withHelp(model.exportDoneHelp)
+
+	// File picker
+	keyPickerMove = newBinding(groupMove, false, model.browsing, []string{"up", "down", "k", "j", "pgup", "pgdown", "home", "end"}, "↑/↓", "navigate")
+	keyPickerDir  = newBinding(groupMove, false, model.browsing, []string{"left", "right", "h", "l", "backspace"}, "←/→", "parent/open folder")
+	keyMark       = newBinding(groupAction, true, model.browsing, []string{" "}, "space", "mark file")
+	keyImport     = newBinding(groupAction, true, model.browsing, []string{"enter"}, "enter", "import")
+	keyTypePath   = newBinding(groupAction, true, model.browsing, []string{"ctrl+p"}, "ctrl+p", "type a path")
+	keyFetchURL   = newBinding(groupAction, false, model.browsing, []string{"u"}, "u", "fetch from URL")
+	keyStdin      = newBinding(groupAction, true, func(m model) bool { return m.browsing() && m.stdin != nil }, []string{"s"}, "s", "read from stdin")
+	keyRecent     = newBinding(groupAction, false, func(m model) bool { return m.browsing() && len(m.history.RecentFiles) > 0 }, []string{"1", "2", "3", "4", "5"}, "1-5", "recent file").withHelp(model.recentHelp)
+	keyMode       = newBinding(groupAction, true, func(m model) bool { return m.browsing() && !m.cfg.Gateways }, []string{"m"}, "m", "switch mode").withHelp(model.modeHelp)
+	keyTemplate   = newBinding(groupAction, false, func(m model) bool { return m.browsing() && !m.cfg.Gateways }, []string{"t"}, "t", "write template")
+	keyLastResult = newBinding(groupAction, false, func(m model) bool { return m.browsing() && m.results != nil }, []string{"v"}, "v", "last summary")
+	keyHidden     = newBinding(groupAction, false, model.browsing, []string{"."}, ".", "show hidden files").withHelp(model.hiddenHelp)
+	keySortFiles  = newBinding(groupAction, false, model.browsing, []string{"o"}, "o", "newest first").withHelp(model.sortHelp)
+	keyAllFiles   = newBinding(groupAction, false, model.browsing, []string{"*"}, "*", "show all files").withHelp(model.allFilesHelp)
+	keySelectTags = newBinding(groupAction, true, func(m model) bool {
+		return m.browsing() && m.cfg.Mode.Selectable() && !m.cfg.Gateways && !m.cfg.ValidateOnly
+	}, []string{"a"}, "a", "select devices by tag")
+	keyOfflineBack = newBinding(groupGeneral, true, func(m model) bool { return m.browsing() && m.cfg.ValidateOnly }, []string{"esc"}, "esc", "connect to a server")
+
+	// Path and URL inputs
+	keyComplete  = newBinding(groupAction, true, func(m model) bool { return m.state == stateFileSelect && m.enteringPath }, []string{"tab"}, "tab", "complete")
+	keyOpenPath  = newBinding(groupAction, true, func(m model) bool { return m.state == stateFileSelect && m.enteringPath }, []string{"enter"}, "enter", "import")
+	keyDownload  = newBinding(groupAction, true, func(m model) bool { return m.state == stateFileSelect && m.enteringURL }, []string{"enter"}, "enter", "download and import")
+	keyInputBack = newBinding(groupGeneral, true, func(m model) bool {
+		return m.state == stateFileSelect && (m.enteringPath || m.enteringURL || m.enteringFilter)
+	}, []string{"esc"}, "esc", "back to file picker")
+	keyPathToggle = newBinding(groupGeneral, false, func(m model) bool { return m.state == stateFileSelect && m.enteringPath }, []string{"ctrl+p"}, "ctrl+p", "back to file picker")
+
+	// Tag filter input
+	keySelectDevices = newBinding(groupAction, true, func(m model) bool { return m.state == stateFileSelect && m.enteringFilter }, []string{"enter"}, "enter", "select matching devices")
+	keyFilterPrefix  = newBinding(groupAction, true, func(m model) bool { return m.state == stateFileSelect && m.enteringFilter }, []string{"tab"}, "tab", "match value prefixes").withHelp(model.filterPrefixHelp)
+
+	// Column mapping
+	keyMapField   = newBinding(groupMove, true, model.mappingColumns, []string{"up", "down", "k", "j"}, "↑/↓", "field")
+	keyMapColumn  = newBinding(groupMove, true, model.mappingColumns, []string{"left", "right", "h", "l"}, "←/→", "choose column")
+	keyMapPreset  = newBinding(groupAction, true, func(m model) bool { return m.mappingColumns() && len(m.cfg.Mappings) > 0 }, []string{"p"}, "p", "apply a saved preset").withHelp(model.presetHelp)
+	keySaveMap    = newBinding(groupAction, true, model.mappingColumns, []string{"enter"}, "enter", "save mapping")
+	keyMapBack    = newBinding(groupGeneral, true, model.mappingColumns, []string{"esc"}, "esc", "back")
+	keyNameImport = newBinding(groupAction, true, model.naming, []string{"enter"}, "enter", "save and import")
+	keyNameBack   = newBinding(groupGeneral, true, model.naming, []string{"esc"}, "esc", "back to mapping")
+
+	// Preview
+	keyScroll    = newBinding(groupMove, true, in(statePreview), []string{"up", "down", "k", "j", "pgup", "pgdown"}, "↑/↓", "scroll")
+	keyReview    = newBinding(groupAction, true, func(m model) bool { return m.state == statePreview && m.previewTotal() > 0 && !m.cfg.ValidateOnly }, []string{"y"}, "y", "review import").withHelp(model.reviewHelp)
+	keyDiscard   = newBinding(groupGeneral, true, in(statePreview), []string{"n", "esc"}, "n/esc", "back")
+	keyRename    = newBinding(groupAction, true, model.renamable, []string{"s"}, "s", "rename").withHelp(model.renameHelp)
+	keyRenameAll = newBinding(groupAction, true, func(m model) bool {
+		return m.state == statePreview && m.nameClashes() > 0 && m.cfg.DuplicateNames == namesWarn
+	}, []string{"S"}, "S", "rename all duplicate names")
+	keyCheckNames   = newBinding(groupAction, false, model.checkingNames, []string{"c"}, "c", "check names against the application")
+	keySwitchState  = newBinding(groupAction, true, model.toggling, []string{"d"}, "d", "switch state").withHelp(model.switchStateHelp)
+	keySkipExisting = newBinding(groupAction, false, model.skippable, []string{"x"}, "x", "skip devices that exist already")
+
+	// Sync plan and comparison
+	keyPlanMove   = newBinding(groupMove, true, func(m model) bool { return m.categories() && !m.planOpen }, []string{"up", "down", "k", "j"}, "↑/↓", "category")
+	keyPlanScroll = newBinding(groupMove, true, func(m model) bool { return m.categories() && m.planOpen }, []string{"up", "down", "pgup", "pgdown"}, "↑/↓", "scroll")
+	keyPlanOpen   = newBinding(groupAction, true, func(m model) bool { return m.categories() && !m.planOpen }, []string{"enter"}, "enter", "show devices")
+	keyPlanAccept = newBinding(groupAction, true, in(stateSyncPlan), []string{"y"}, "y", "review sync")
+	keyReportCSV  = newBinding(groupAction, true, in(stateCompare, stateStatus), []string{"e"}, "e", "save report as CSV")
+	keyReportJSON = newBinding(groupAction, false, in(stateCompare, stateStatus), []string{"E"}, "E", "save report as JSON")
+	keyPlanClose  = newBinding(groupGeneral, true, func(m model) bool { return m.categories() && m.planOpen }, []string{"esc"}, "esc", "back to categories")
+	keyPlanBack   = newBinding(groupGeneral, true, func(m model) bool { return m.categories() && !m.planOpen }, []string{"n", "esc"}, "n/esc", "back")
+
+	// Device status
+	keyStatusScroll = newBinding(groupMove, true, in(stateStatus), []string{"up", "down", "k", "j", "pgup", "pgdown"}, "↑/↓", "scroll")
+	keyStatusBack   = newBinding(groupGeneral, true, in(stateStatus), []string{"n", "esc"}, "n/esc", "back")
+
+	// Confirmation
+	keyChoose       = newBinding(groupMove, true, model.choosing, []string{"left", "right", "h", "l", "tab", "shift+tab"}, "←/→", "choose")
+	keyConfirm      = newBinding(groupAction, true, model.choosing, []string{"enter"}, "enter", "confirm choice")
+	keyStart        = newBinding(groupAction, true, model.choosing, []string{"y"}, "y", "start import")
+	keyConfirmBack  = newBinding(groupGeneral, true, model.choosing, []string{"n", "esc"}, "n/esc", "back")
+	keyFailureLimit = newBinding(groupAction, true, model.choosing, []string{"f"}, "f", "when to stop")
+	keyEditTags     = newBinding(groupAction, true, model.taggable, []string{"t"}, "t", "tags for every device")
+	keyTagsSave     = newBinding(groupAction, true, func(m model) bool { return m.editingTags }, []string{"enter"}, "enter", "save tags")
+	keyTagsCancel   = newBinding(groupGeneral, true, func(m model) bool { return m.editingTags }, []string{"esc"}, "esc", "cancel")
+	keyTypedStart   = newBinding(groupAction, true, func(m model) bool { return m.state == stateConfirm && m.typed != nil }, []string{"enter"}, "enter", "confirm")
+	keyBreakLock    = newBinding(groupAction, true, model.breakable, []string{"ctrl+b"}, "ctrl+b", "break stale lock and start")
+	keyTypedBack    = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateConfirm && m.typed != nil }, []string{"esc"}, "esc", "back")
+
+	// Processing
+	keyPause         = newBinding(groupAction, true, model.pausable, []string{" "}, "space", "pause").withHelp(model.pauseHelp)
+	keyCancelTripped = newBinding(groupAction, true, func(m model) bool { return m.pausable() && m.tripped != nil }, []string{"x"}, "x", "cancel the rest")
+	keyWorkers       = newBinding(groupAction, true, model.tunable, []string{"+", "=", "-"}, "+/-", "workers")
+	keyRate          = newBinding(groupAction, true, model.tunable, []string{"[", "]"}, "[/]", "rate limit")
+
+	// Results
+	keyScrollLog = newBinding(groupMove, true, in(stateComplete), []string{"pgup", "pgdown"}, "pgup/pgdn", "scroll log")
+	keyAnother   = newBinding(groupAction, true, func(m model) bool {
+		return in(stateComplete, stateError)(m) && (m.selectedProfile != "" || m.cfg.Gateways)
+	}, []string{"a"}, "a", "import another file")
+	keyStartOver   = newBinding(groupAction, true, func(m model) bool { return in(stateComplete, stateError)(m) && m.client != nil }, []string{"r"}, "r", "start over from tenant selection")
+	keyUndo        = newBinding(groupAction, true, model.undoable, []string{"u"}, "u", "undo this import")
+	keyRetryFailed = newBinding(groupAction, true, model.retryable, []string{"R"}, "R", "retry failed rows").withHelp(model.retryHelp)
+	keyResults     = newBinding(groupAction, true, func(m model) bool { return m.state == stateComplete && len(m.report) > 0 }, []string{"t"}, "t", "table of every row")
+	keyCopySummary = newBinding(groupAction, true, in(stateComplete), []string{"c"}, "c", "copy summary")
+	keyReport      = newBinding(groupAction, false, in(stateComplete), []string{"M"}, "M", "write Markdown report")
+	keyQRCodes     = newBinding(groupAction, false, func(m model) bool { return m.state == stateComplete && len(createdRows(m.results)) > 0 }, []string{"Q"}, "Q", "write QR codes of the created devices")
+
+	// Results table
+	keyResultsMove      = newBinding(groupMove, true, model.browsingResults, []string{"up", "down", "k", "j", "pgup", "pgdown", "home", "end"}, "↑/↓", "scroll")
+	keyResultsFilter    = newBinding(groupAction, true, model.browsingResults, []string{"f"}, "f", "show failures only").withHelp(model.failuresOnlyHelp)
+	keyResultsOrder     = newBinding(groupAction, true, model.browsingResults, []string{"o"}, "o", "sort").withHelp(model.orderHelp)
+	keyResultsSave      = newBinding(groupAction, true, model.browsingResults, []string{"s"}, "s", "save as CSV")
+	keyResultsEdit      = newBinding(groupAction, true, model.editable, []string{"e"}, "e", "correct and resubmit row")
+	keyResultsCorrected = newBinding(groupAction, false, func(m model) bool { return m.browsingResults() && m.resultsTable.run == nil && len(m.corrections) > 0 }, []string{"c"}, "c", "write a corrected copy of the list")
+	keyResultsBack      = newBinding(groupGeneral, true, model.browsingResults, []string{"esc"}, "esc", "back to summary").withHelp(model.resultsBackHelp)
+
+	// Row editor
+	keyEditField  = newBinding(groupMove, true, model.editingRow, []string{"tab", "shift+tab", "up", "down"}, "tab", "next field")
+	keyEditSubmit = newBinding(groupAction, true, model.editingRow, []string{"enter"}, "enter", "resubmit")
+	keyEditCancel = newBinding(groupGeneral, true, model.editingRow, []string{"esc"}, "esc", "cancel")
+
+	// QR codes
+	keyQRWrite = newBinding(groupAction, true, model.editingQRPath, []string{"enter"}, "enter", "write")
+	keyQRDone  = newBinding(groupAction, true, func(m model) bool { return m.state == stateQRCodes && m.qrCodes.out != nil }, []string{"enter"}, "enter", "back")
+	keyQRBack  = newBinding(groupGeneral, true, in(stateQRCodes), []string{"esc"}, "esc", "back")
+
+	// Undo
+	keyUndoStart = newBinding(groupAction, true, func(m model) bool { return m.state == stateUndo && m.undo.confirming() }, []string{"enter"}, "enter", "confirm")
+	keyUndoForce = newBinding(groupAction, true, func(m model) bool { return m.state == stateUndo && m.undo.confirming() }, []string{"ctrl+f"}, "ctrl+f", "toggle deleting seen devices")
+	keyUndoBack  = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateUndo && !m.undo.running }, []string{"esc"}, "esc", "back to summary").withHelp(model.undoBackHelp)
+
+	// Previous imports
+	keyRuns = newBinding(groupAction, true, func(m model) bool {
+		return m.state == stateConnecting || (m.state == stateTenantSelect && m.listState(list.Unfiltered))
+	}, []string{"ctrl+t"}, "ctrl+t", "previous imports")
+	keyRunUndo  = newBinding(groupAction, true, model.runUndoable, []string{"u"}, "u", "undo this import")
+	keyRunsBack = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateRuns && m.listState(list.Unfiltered) }, []string{"esc"}, "esc", "back")
+
+	// Loading
+	keyCancelPrefetch = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateLoading && m.prefetch != nil }, []string{"esc"}, "esc", "cancel")
+
+	// Failed fetch
+	keyRetry       = newBinding(groupAction, true, in(stateLoadFailed), []string{"r"}, "r", "retry")
+	keyLoadBack    = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateLoadFailed && m.loadFrom != stateConnecting }, []string{"esc"}, "esc", "back")
+	keyChangeToken = newBinding(groupGeneral, true, func(m model) bool { return m.state == stateLoadFailed && m.loadFrom == stateConnecting }, []string{"esc"}, "esc", "change token")
+
+	// Everywhere
+	keyHelp      = newBinding(groupGeneral, true, func(m model) bool { return !m.typing() && m.state != stateLoading }, []string{"?"}, "?", "help")
+	keyQuit      = newBinding(groupGeneral, true, func(m model) bool { return !m.typing() && m.state != stateLoading }, []string{"q", "ctrl+c"}, "q", "quit")
+	keyForceQuit = newBinding(groupGeneral, true, func(m model) bool { return m.typing() || m.state == stateLoading }, []string{"ctrl+c"}, "ctrl+c", "quit")
+)
+
+var keyBindings = []*binding{
+	keyConnect, keyRevealToken, keyValidateOffline,
+	keyListMove, keyListPage, keyFilter, keySelect, keyExport, keyBrowse, keyKeyless, keyExportGateways, keyGateways, keyRegion, keyTemplateBack, keyBrowseBack, keyClearFilter, keyApplyFilter, keyStopFilter,
+	keyDetailBack,
+	keyNextField, keyToggleGateways, keyToggleClass, keyCreateApp, keyUseGroup, keyFormBack,
+	keyExportStart, keyExportBack, keyExportDone,
+	keyPickerMove, keyPickerDir, keyMark, keyImport, keyTypePath, keyFetchURL, keyStdin, keyRecent, keyMode, keyTemplate, keyLastResult, keyHidden, keyAllFiles, keySortFiles, keySelectTags, keyOfflineBack,
+	keyComplete, keyOpenPath, keyDownload, keyInputBack, keySelectDevices, keyFilterPrefix, keyPathToggle,
+	keyMapField, keyMapColumn, keyMapPreset, keySaveMap, keyMapBack, keyNameImport, keyNameBack,
+	keyScroll, keyReview, keyDiscard, keyRename, keyRenameAll, keyCheckNames, keySkipExisting, keySwitchState,
+	keyPlanMove, keyPlanScroll, keyPlanOpen, keyPlanAccept, keyReportCSV, keyReportJSON, keyPlanClose, keyPlanBack,
+	keyStatusScroll, keyStatusBack,
+	keyChoose, keyConfirm, keyStart, keyConfirmBack, keyFailureLimit, keyEditTags, keyTagsSave, keyTagsCancel, keyTypedStart, keyBreakLock, keyTypedBack,
+	keyPause, keyCancelTripped, keyWorkers, keyRate,
+	keyScrollLog, keyAnother, keyStartOver, keyUndo, keyRetryFailed, keyResults, keyCopySummary, keyReport, keyQRCodes,
+	keyResultsMove, keyResultsFilter, keyResultsOrder, keyResultsSave, keyResultsEdit, keyResultsCorrected, keyResultsBack,
+	keyEditField, keyEditSubmit, keyEditCancel,
+	keyQRWrite, keyQRDone, keyQRBack,
+	keyUndoStart, keyUndoForce, keyUndoBack,
+	keyRuns, keyRunUndo, keyRunsBack,
+	keyCancelPrefetch,
+	keyRetry, keyLoadBack, keyChangeToken,
+	keyHelp, keyQuit, keyForceQuit,
+}
+
+// activeKeys implements help.KeyMap with the bindings active in m.
+type activeKeys struct {
+	m model
+}
+
+func (k activeKeys) bindings(short bool) []*binding {
+	var active []*binding
+	for _, b := range keyBindings {
+		if b.active(k.m) && (b.short || !short) {
+			active = append(active, b)
+		}
+	}
+	return active
+}
+
+func (k activeKeys) binding(b *binding) key.Binding {
+	kb := b.Binding
+	if b.help != nil {
+		kb.SetHelp(b.help(k.m))
+	}
+	return kb
+}
+
+// ShortHelp returns the bindings shown in the footer.
+func (k activeKeys) ShortHelp() []key.Binding {
+	var kbs []key.Binding
+	for _, b := range k.bindings(true) {
+		kbs = append(kbs, k.binding(b))
+	}
+	return kbs
+}
+
+// FullHelp returns every active binding, grouped into the overlay's columns.
+func (k activeKeys) FullHelp() [][]key.Binding {
+	groups := make([][]key.Binding, groupGeneral+1)
+	for _, b := range k.bindings(false) {
+		groups[b.group] = append(groups[b.group], k.binding(b))
+	}
+	return groups
+}
+
+// helpView renders the footer of the current screen.
+func (m model) helpView() string {
+	m.help.Width = m.width
+	// The help adds every key when there's no room left for its ellipsis.
+	return ansi.Truncate(m.help.ShortHelpView(activeKeys{m}.ShortHelp()), m.width, "…")
+}
+
+// helpOverlayView lists every key of the current screen.
+func (m model) helpOverlayView() string {
+	m.help.Width = m.width
+	closeKey := key.NewBinding(key.WithKeys("?", "esc"), key.WithHelp("?/esc", "close help"))
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("Keys"),
+		m.help.FullHelpView(activeKeys{m}.FullHelp()),
+		m.help.ShortHelpView([]key.Binding{closeKey}),
+	)
+}
+
+// updateHelpOverlay handles keys while the help overlay is shown.
+func (m model) updateHelpOverlay(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case key.Matches(msg, keyHelp.Binding), msg.String() == "esc":
+		m.showHelp = false
+	}
+	return m, nil
+}
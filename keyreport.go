@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// findKeyless returns the devices that have no root keys and have never been
+// seen, so they can't have joined: the units to re-key before a deployment.
+// Devices that have been seen are left out without asking for their keys.
+// Keys are read listLookups devices at a time and only read, so a read-only
+// API key will do. progress, if not nil, is called after each device with
+// the number checked so far and the total.
+func findKeyless(ctx context.Context, client api.DeviceServiceClient, devices []*api.DeviceListItem, progress func(done, total int)) ([]*api.DeviceListItem, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keyless := make([]bool, len(devices))
+	var mu sync.Mutex
+	var firstErr error
+	done := 0
+	importer.ForEachParallel(len(devices), func(i int) {
+		d := devices[i]
+		var err error
+		if d.LastSeenAt == nil {
+			_, err = client.GetKeys(ctx, &api.GetDeviceKeysRequest{DevEui: d.DevEui})
+			if status.Code(err) == codes.NotFound {
+				keyless[i], err = true, nil
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil && firstErr == nil {
+			// Checking the rest is pointless, e.g. when the token can't
+			// read keys at all.
+			firstErr = fmt.Errorf("reading the keys of %s: %w", d.DevEui, err)
+			cancel()
+		}
+		done++
+		if progress != nil {
+			progress(done, len(devices))
+		}
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var missing []*api.DeviceListItem
+	for i, d := range devices {
+		if keyless[i] {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// writeKeylessReport writes the devices missing keys as CSV, one per line.
+func writeKeylessReport(w io.Writer, devices []*api.DeviceListItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"dev_eui", "name", "description", "device_profile", "created_at"})
+	for _, d := range devices {
+		cw.Write([]string{d.DevEui, d.Name, d.Description, d.DeviceProfileName, formatTimestamp(d.CreatedAt)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// saveKeylessReport writes the report to path, refusing to overwrite an
+// existing file.
+func saveKeylessReport(path string, devices []*api.DeviceListItem) error {
+	return createFile(path, func(w io.Writer) error {
+		return writeKeylessReport(w, devices)
+	})
+}
+
+// keylessFileName suggests a file name for the report of the named
+// application, e.g. "water-meters-missing-keys-20240131.csv".
+func keylessFileName(appName string, now time.Time) string {
+	return appFileName(appName, "missing-keys", ".csv", now)
+}
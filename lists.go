@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// tenantDescription summarizes a tenant for the selection list. The device
+// and gateway counts come from the summaries the web interface uses and are
+// left out when the token isn't allowed to read them.
+func tenantDescription(ctx context.Context, client api.InternalServiceClient, t *api.TenantListItem) string {
+	var parts []string
+
+	if ds, err := client.GetDevicesSummary(ctx, &api.GetDevicesSummaryRequest{TenantId: t.Id}); err == nil {
+		devices := fmt.Sprintf("%d devices", ds.ActiveCount+ds.InactiveCount+ds.NeverSeenCount)
+		if t.MaxDeviceCount > 0 {
+			devices += fmt.Sprintf(" of max %d", t.MaxDeviceCount)
+		}
+		parts = append(parts, devices)
+	} else if t.MaxDeviceCount > 0 {
+		parts = append(parts, fmt.Sprintf("max %d devices", t.MaxDeviceCount))
+	}
+
+	if !t.CanHaveGateways {
+		parts = append(parts, "no gateways allowed")
+	} else if gs, err := client.GetGatewaysSummary(ctx, &api.GetGatewaysSummaryRequest{TenantId: t.Id}); err == nil {
+		parts = append(parts, fmt.Sprintf("%d gateways", gs.OnlineCount+gs.OfflineCount+gs.NeverSeenCount))
+	}
+
+	if len(parts) == 0 {
+		return "No device limit"
+	}
+	return strings.Join(parts, " • ")
+}
+
+// applicationDescription appends the number of devices in app to its
+// description. The count is left out if it can't be fetched.
+func applicationDescription(ctx context.Context, client api.DeviceServiceClient, app *api.ApplicationListItem) string {
+	parts := []string{}
+	if app.Description != "" {
+		parts = append(parts, app.Description)
+	}
+	// A zero limit returns only the total count.
+	if resp, err := client.List(ctx, &api.ListDevicesRequest{ApplicationId: app.Id, Limit: 0}); err == nil {
+		parts = append(parts, fmt.Sprintf("%d devices", resp.TotalCount))
+	}
+	return strings.Join(parts, " • ")
+}
+
+// profileDescription shows the region, LoRaWAN version and device classes of
+// a device profile, e.g. "EU868 • LoRaWAN 1.0.3 • OTAA • Class A/C".
+func profileDescription(p *api.DeviceProfileListItem) string {
+	classes := "Class A"
+	if p.SupportsClassB {
+		classes += "/B"
+	}
+	if p.SupportsClassC {
+		classes += "/C"
+	}
+	activation := "ABP"
+	if p.SupportsOtaa {
+		activation = "OTAA"
+	}
+	return strings.Join([]string{p.Region.String(), importer.MACVersionName(p.MacVersion), activation, classes}, " • ")
+}
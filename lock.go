@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// defaultLockTTL is how long a lock on an application holds unless
+// --lock-ttl says otherwise; an import still running after it can be
+// broken.
+const defaultLockTTL = 6 * time.Hour
+
+// appLock marks an import into an application as running, so that a second
+// import into it from this machine, which would only trip over the devices
+// of the first, refuses to start. The lock is a file in the data directory
+// named after the server and application; it is created exclusively and
+// removed when the import ends.
+type appLock struct {
+	Server        string    `json:"server"`
+	ApplicationID string    `json:"application_id"`
+	Holder        string    `json:"holder"` // user@host
+	Host          string    `json:"host"`
+	PID           int       `json:"pid"`
+	StartedAt     time.Time `json:"started_at"`
+
+	path string
+}
+
+// lockHeld is returned by lockApplication when another import holds the
+// lock. A stale lock can be broken, see breakLock.
+type lockHeld struct {
+	lock  *appLock
+	stale string // why the lock is stale, empty while it holds
+}
+
+func (e *lockHeld) Error() string {
+	l := e.lock
+	if l.Holder == "" {
+		return fmt.Sprintf("application %s on %s is locked by a lock file that can't be read (%s); the lock is stale", l.ApplicationID, l.Server, l.path)
+	}
+	msg := fmt.Sprintf("application %s on %s is locked by %s (pid %d) since %s, %s ago",
+		l.ApplicationID, l.Server, l.Holder, l.PID, l.StartedAt.Local().Format("2006-01-02 15:04"),
+		formatElapsed(time.Since(l.StartedAt)))
+	if e.stale != "" {
+		msg += "; the lock is stale, " + e.stale
+	}
+	return msg
+}
+
+func lockPath(server, applicationID string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(server + "\x00" + applicationID))
+	return filepath.Join(dir, "locks", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// lockApplication locks applicationID on server for an import. It returns
+// a *lockHeld if another import holds the lock, stale or not.
+func lockApplication(server, applicationID string, ttl time.Duration) (*appLock, error) {
+	path, err := lockPath(server, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	holder := host
+	if u, err := user.Current(); err == nil {
+		holder = u.Username + "@" + host
+	}
+	l := &appLock{Server: server, ApplicationID: applicationID, Holder: holder, Host: host, PID: os.Getpid(), StartedAt: time.Now().UTC(), path: path}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, heldLock(l, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return l, f.Close()
+}
+
+// heldLock reads the lock that want found at its path for the error
+// telling who holds it.
+func heldLock(want *appLock, ttl time.Duration) error {
+	data, err := os.ReadFile(want.path)
+	if err != nil {
+		return fmt.Errorf("reading the lock: %w", err)
+	}
+	l := &appLock{Server: want.Server, ApplicationID: want.ApplicationID, path: want.path}
+	if err := json.Unmarshal(data, l); err != nil || l.Holder == "" {
+		// A lock that can't be read is left from a crash mid-write.
+		l.Holder = ""
+		return &lockHeld{lock: l, stale: "its file is damaged"}
+	}
+
+	held := &lockHeld{lock: l}
+	host, _ := os.Hostname()
+	switch {
+	case time.Since(l.StartedAt) > ttl:
+		held.stale = fmt.Sprintf("older than %s", ttl)
+	case l.Host == host && !processAlive(l.PID):
+		held.stale = fmt.Sprintf("process %d isn't running", l.PID)
+	}
+	return held
+}
+
+// processAlive reports whether the process pid runs on this host. Windows
+// has no signal to check it with, so there a process is taken to run if
+// it can be found.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// breakLock removes the stale lock of held and takes the lock in its place.
+// A lock that holds isn't broken.
+func breakLock(held *lockHeld, ttl time.Duration) (*appLock, error) {
+	if held.stale == "" {
+		return nil, held
+	}
+	if err := os.Remove(held.lock.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("breaking the lock: %w", err)
+	}
+	return lockApplication(held.lock.Server, held.lock.ApplicationID, ttl)
+}
+
+// release removes the lock. A nil lock releases nothing.
+func (l *appLock) release() {
+	if l == nil {
+		return
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to remove the lock of the application", "application", l.ApplicationID, "err", err)
+	}
+}
+
+// locksApplication reports whether an import into the application takes
+// its lock: every one that writes to it.
+func (m model) locksApplication() bool {
+	return !m.cfg.Gateways && !m.cfg.dryRun && !m.cfg.Mode.ReadOnly()
+}
+
+// breakable reports whether the lock that kept the import from starting is
+// stale and can be broken.
+func (m model) breakable() bool {
+	return m.state == stateConfirm && m.lockHeld != nil && m.lockHeld.stale != ""
+}
+
+// takeLock locks the selected application before an import starts. The
+// import doesn't start while another holds it: the confirmation stays up
+// saying who, and a stale lock can be broken from there.
+func (m model) takeLock(breaking bool) (model, bool) {
+	if !m.locksApplication() {
+		return m, true
+	}
+	var err error
+	if breaking && m.lockHeld != nil {
+		m.lock, err = breakLock(m.lockHeld, m.cfg.lockTTL)
+	} else {
+		m.lock, err = lockApplication(m.serverAddr, m.selectedApp, m.cfg.lockTTL)
+	}
+	m.lockHeld = nil
+	var held *lockHeld
+	switch {
+	case errors.As(err, &held):
+		m.lockHeld = held
+		return m, false
+	case err != nil:
+		// The lock is a courtesy to other imports; one that can't be
+		// written doesn't keep this one from running.
+		slog.Warn("Not locking the application", "application", m.selectedApp, "err", err)
+	}
+	return m, true
+}
+
+// releaseLock releases the lock of the import that just ended.
+func (m *model) releaseLock() {
+	m.lock.release()
+	m.lock = nil
+}
+
+// lockView explains why the import didn't start, for the confirmation.
+func (m model) lockView() string {
+	if m.lockHeld == nil {
+		return ""
+	}
+	view := m.theme.warning.Render("⚠ " + m.lockHeld.Error())
+	if m.lockHeld.stale != "" {
+		view += "\n" + m.theme.help.Render("Press ctrl+b to break it and start anyway")
+	}
+	return view + "\n\n"
+}
+
+// breakStaleLock breaks the stale lock that kept the import from starting
+// and starts it.
+func (m model) breakStaleLock() (tea.Model, tea.Cmd) {
+	m, ok := m.takeLock(true)
+	if !ok {
+		return m, nil
+	}
+	return m.startCreate()
+}
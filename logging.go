@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// logOptions are how records are logged, from --log-level and --log-format.
+type logOptions struct {
+	level slog.Level
+	json  bool // one JSON object per record rather than key=value text
+}
+
+// parseLogOptions parses --log-level, one of error, warn, info and debug,
+// and --log-format, text or json.
+func parseLogOptions(level, format string) (logOptions, error) {
+	var o logOptions
+	switch strings.ToLower(level) {
+	case "error":
+		o.level = slog.LevelError
+	case "warn", "warning":
+		o.level = slog.LevelWarn
+	case "info", "":
+		o.level = slog.LevelInfo
+	case "debug":
+		o.level = slog.LevelDebug
+	default:
+		return o, fmt.Errorf("unknown --log-level %q: use error, warn, info or debug", level)
+	}
+	switch strings.ToLower(format) {
+	case "text", "":
+	case "json":
+		o.json = true
+	default:
+		return o, fmt.Errorf("unknown --log-format %q: use text or json", format)
+	}
+	return o, nil
+}
+
+// handler returns a handler writing the records of level and above to w in
+// the format of o, with the secrets in them masked.
+func (o logOptions) handler(w io.Writer, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if o.json {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// redactAttr masks a secret in the value of a, or the whole value if its
+// key sounds like a secret; see redact.Field.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, redact.Field(a.Key, v))
+	case error:
+		return slog.String(a.Key, redact.Secrets(v.Error()))
+	}
+	return a
+}
+
+// paneHandler passes warnings and errors on to the log pane of the
+// interactive UI. Records about a row are left out, as the pane shows the
+// outcome of every row already.
+type paneHandler struct {
+	send  func(tea.Msg)
+	attrs []slog.Attr
+}
+
+// logRecordMsg is a warning or error for the log pane.
+type logRecordMsg struct {
+	level slog.Level
+	text  string
+}
+
+func (h paneHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (h paneHandler) Handle(_ context.Context, r slog.Record) error {
+	text := r.Message
+	about := func(a slog.Attr) bool {
+		switch a.Key {
+		case "dev_eui", "gateway_id":
+			return true
+		case "err":
+			text += ": " + a.Value.String()
+		}
+		return false
+	}
+	for _, a := range h.attrs {
+		if about(a) {
+			return nil
+		}
+	}
+	skip := false
+	r.Attrs(func(a slog.Attr) bool {
+		skip = about(a)
+		return !skip
+	})
+	if !skip {
+		// Not from within Update, which would wait for itself.
+		go h.send(logRecordMsg{r.Level, redact.Secrets(text)})
+	}
+	return nil
+}
+
+func (h paneHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	return h
+}
+
+func (h paneHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// teeHandler passes records on to every handler that takes them.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if e := h.Handle(ctx, r.Clone()); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make(teeHandler, len(t))
+	for i, h := range t {
+		hs[i] = h.WithAttrs(attrs)
+	}
+	return hs
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	hs := make(teeHandler, len(t))
+	for i, h := range t {
+		hs[i] = h.WithGroup(name)
+	}
+	return hs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// logPaneEntries caps how many results the log pane keeps in memory. The
+// log file has the full record.
+const logPaneEntries = 1000
+
+// rowLog is the outcome of one row, as shown in the log pane.
+type rowLog struct {
+	source string // file the row is from
+	pos    importer.RowPos
+	devEUI string
+	name   string
+	err    error
+
+	logged *logRecordMsg // a warning or error logged apart from the rows
+}
+
+// String renders the entry, e.g. "✓ 70b3d57ed0000001 meter-0042" or
+// "✗ 70b3d57ed0000002 already registered (maybe under another
+// application or tenant) – delete it first, or run a sync to update it".
+func (l rowLog) String() string {
+	var note importer.RowNote
+	switch {
+	case l.logged != nil && l.logged.level >= slog.LevelError:
+		return "✗ " + l.logged.text
+	case l.logged != nil:
+		return "⚠ " + l.logged.text
+	case l.err == nil:
+		return fmt.Sprintf("✓ %s %s", l.devEUI, l.name)
+	case errors.As(l.err, &note):
+		return fmt.Sprintf("⚠ %s %s", l.devEUI, redact.Secrets(string(note)))
+	}
+	return fmt.Sprintf("✗ %s %s", l.devEUI, importer.DescribeError(l.err))
+}
+
+// defaultLogFile returns where the interactive UI logs to unless --log-file
+// is given.
+func defaultLogFile() string {
+	dir, err := dataDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "device-adder.log")
+}
+
+// openLogFile opens the log file at path for appending, so that nothing is
+// logged over the interactive UI. It returns nil if path is empty.
+func openLogFile(path string) (*os.File, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+}
+
+// appendLog adds an entry to the log pane, dropping the oldest beyond
+// logPaneEntries, and keeps the pane scrolled to the end.
+func (m *model) appendLog(l rowLog) {
+	m.logEntries = append(m.logEntries, l)
+	if len(m.logEntries) > logPaneEntries {
+		m.logEntries = m.logEntries[len(m.logEntries)-logPaneEntries:]
+	}
+	m.logView.SetContent(m.renderLog())
+	m.logView.GotoBottom()
+}
+
+func (m model) renderLog() string {
+	lines := make([]string, len(m.logEntries))
+	for i, l := range m.logEntries {
+		line := ansi.Truncate(l.String(), m.logView.Width, "…")
+		if l.err != nil || l.logged != nil && l.logged.level >= slog.LevelError {
+			line = m.theme.failure.Render(line)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resizeLog fits the log pane to the terminal and the current screen.
+func (m *model) resizeLog() {
+	m.logView.Width = m.width - 4
+	if m.state == stateComplete {
+		m.logView.Height = max(m.height/3, 5)
+	} else {
+		// Header, progress bar, status and help
+		m.logView.Height = max(m.height-12, 3)
+	}
+	m.logView.SetContent(m.renderLog())
+}
+
+func (m model) logPaneView() string {
+	if len(m.logEntries) == 0 {
+		return ""
+	}
+	return m.theme.pane.Render(m.logView.View())
+}
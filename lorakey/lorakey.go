@@ -0,0 +1,73 @@
+// Package lorakey normalizes and checks the EUIs and root keys of LoRaWAN
+// devices, and generates keys.
+package lorakey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// NormalizeEUI lower-cases an EUI and removes the separators and prefix
+// spreadsheets commonly add, e.g. "0x70-B3-D5-7E-D0-00-00-01".
+func NormalizeEUI(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "0x")
+	return strings.NewReplacer(":", "", "-", "", " ", "").Replace(s)
+}
+
+// NormalizeKey normalizes a root key like NormalizeEUI. A key that isn't
+// hex but is 16 bytes in base64, as some vendors ship them, is converted to
+// hex. A hex key of the wrong length is left as it is, to be reported as
+// such, even when it happens to decode as base64 too.
+func NormalizeKey(s string) string {
+	key := NormalizeEUI(s)
+	if key == "" || IsHex(key) {
+		return key
+	}
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && len(b) == 16 {
+			return hex.EncodeToString(b)
+		}
+	}
+	return key
+}
+
+// HexProblem describes what is wrong with s as a value of n hex digits, or
+// returns an empty string, e.g. "is 31 hex characters, must be 32".
+func HexProblem(s string, n int) string {
+	if i := strings.IndexFunc(s, func(c rune) bool { return !IsHex(string(c)) }); i >= 0 {
+		c, _ := utf8.DecodeRuneInString(s[i:])
+		return fmt.Sprintf("has %q, which isn't a hex character", c)
+	}
+	if len(s) != n {
+		return fmt.Sprintf("is %d hex characters, must be %d", len(s), n)
+	}
+	return ""
+}
+
+// IsHex reports whether s is a non-empty string of hex digits.
+func IsHex(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewKey returns a random 128-bit root key in hex.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
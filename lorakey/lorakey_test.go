@@ -0,0 +1,76 @@
+package lorakey
+
+import "testing"
+
+func TestNormalizeEUI(t *testing.T) {
+	for in, want := range map[string]string{
+		"70B3D57ED0000001":            "70b3d57ed0000001",
+		" 0x70-B3-D5-7E-D0-00-00-01 ": "70b3d57ed0000001",
+		"70:b3:d5:7e:d0:00:00:01":     "70b3d57ed0000001",
+		"70 B3 D5 7E D0 00 00 01":     "70b3d57ed0000001",
+		"":                            "",
+	} {
+		if got := NormalizeEUI(in); got != want {
+			t.Errorf("NormalizeEUI(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"00112233445566778899AABBCCDDEEFF":                  "00112233445566778899aabbccddeeff",
+		"0x00-11-22-33-44-55-66-77-88-99-aa-bb-cc-dd-ee-ff": "00112233445566778899aabbccddeeff",
+		"ABEiM0RVZneImaq7zN3u/w==":                          "00112233445566778899aabbccddeeff",
+		"ABEiM0RVZneImaq7zN3u_w":                            "00112233445566778899aabbccddeeff",
+		"0011":                                              "0011",
+		"0123456789abcdef012345":                            "0123456789abcdef012345",
+		"":                                                  "",
+	} {
+		if got := NormalizeKey(in); got != want {
+			t.Errorf("NormalizeKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHexProblem(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"70b3d57ed0000001", 16, ""},
+		{"70b3d57ed000001", 16, "is 15 hex characters, must be 16"},
+		{"70b3d57ed000000g", 16, `has 'g', which isn't a hex character`},
+		{"", 4, "is 0 hex characters, must be 4"},
+		{NormalizeKey("0123456789abcdef012345"), 32, "is 22 hex characters, must be 32"},
+	} {
+		if got := HexProblem(tc.s, tc.n); got != tc.want {
+			t.Errorf("HexProblem(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestIsHex(t *testing.T) {
+	for s, want := range map[string]bool{"0123456789abcdefABCDEF": true, "": false, "0x12": false, "12 34": false} {
+		if got := IsHex(s); got != want {
+			t.Errorf("IsHex(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	a, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HexProblem(a, 32) != "" || a != NormalizeKey(a) {
+		t.Errorf("NewKey() = %q, want 32 lower-case hex characters", a)
+	}
+	if a == b {
+		t.Errorf("NewKey() returned %q twice", a)
+	}
+}
@@ -2,39 +2,34 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
 
-	// ChirpStack API imports
 	"github.com/chirpstack/chirpstack/api/go/v4/api"
-)
 
-// Styles
-var (
-	titleStyle = lipgloss.NewStyle().
-			MarginLeft(2).
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4")).
-			Padding(0, 1)
-
-	statusStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#F25D94")).
-			Padding(0, 1).
-			MarginTop(1)
-
-	helpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
 )
 
 // Application states
@@ -42,53 +37,290 @@ type state int
 
 const (
 	stateConnecting state = iota
+	stateLoading          // waiting for a list from the server
+	stateLoadFailed       // fetching a list failed, offering a retry
 	stateTenantSelect
+	stateCreateTenant // on a server without tenants
 	stateApplicationSelect
+	stateCreateApplication
+	stateExport       // exporting the devices of an application
+	stateBrowse       // browsing the devices of an application
+	stateDeviceDetail // one device of the browser
 	stateDeviceProfileSelect
+	stateTemplateSelect  // device-profile template to create a profile from
+	stateMulticastSelect // multicast group the created devices join
+	stateCreateMulticast // multicast group created when the import starts
 	stateFileSelect
+	stateColumnMapping
+	statePreview
+	stateSyncPlan // what a sync will change, before confirming it
+	stateCompare  // how the list compares with the server, in compare mode
+	stateStatus   // whether the listed devices are alive, in status mode
+	stateConfirm
 	stateProcessing
 	stateComplete
+	stateResults // every row of the last run, in a table
+	stateUndo    // undoing the import just completed
+	stateQRCodes // writing the QR codes of devices, see qrScreen
+	stateRuns    // the previous imports, see runsScreen
 	stateError
 )
 
+// config holds the command-line options.
+type config struct {
+	server        string
+	token         string
+	applicationID string
+	profileID     string
+	tenantID      string // tenant to import gateways into or export them from (headless mode)
+
+	multicastGroup string // multicast group, by name or ID, for rows without one (headless mode)
+
+	// mirrors are the servers imported into after server, from repeated
+	// --server and --token flags (headless mode); see runMirrored
+	mirrors []target
+	// mirror names the server of a run in the files it writes when several
+	// servers are imported into, see mirrorPath
+	mirror string
+
+	headless     bool
+	input        string // path of the device list, "-" for stdin
+	failuresFile string // where to write failed rows, overrides the default
+
+	// selection, if set, picks the devices of the application to run over
+	// by their tags instead of a list (headless mode)
+	selection *tagFilter
+
+	// ListOptions are how the device lists are read and checked.
+	importer.ListOptions
+
+	dryRun bool // check the rows against the server without changing anything
+	yes    bool // accept the prompts of headless mode
+	// destructiveOK, from --yes-destructive, deletes devices and replaces
+	// keys in headless mode without the confirmation --yes doesn't give.
+	destructiveOK bool
+
+	syncDelete bool   // let a sync delete devices that aren't in the list
+	overQuota  string // what a headless run exceeding the tenant's device limit does: abort, proceed or truncate
+	report     string // where to write the report in headless compare or status mode
+	qrCodes    string // where headless mode writes the QR codes of created or, with --mode qr, listed devices
+
+	checkServerNames bool // also check names against the devices of the application
+
+	overwriteKeys bool         // replace the keys of devices that exist already
+	noAutoSelect  noAutoSelect // selection screens kept even with a single choice
+	verify        bool         // read the created devices back after an import
+
+	downlink importer.Downlink // enqueued for every created device, if it has a payload
+
+	startDir     string // directory the file picker opens in instead of the last one used
+	noHistory    bool   // don't remember selections and files between runs, nor keep a record of runs
+	historyLimit int    // runs kept in the history, older ones are pruned
+	plain        bool   // render without colors or other ANSI styling
+
+	maxFailures importer.FailureLimit // stops an import once so many rows have failed
+
+	breakerThreshold int  // identical failures in a row that pause an import, 0 for never
+	breakerProbe     bool // resume an import the breaker paused once the server answers
+	chunkSize        int  // rows after which an import flushes its records and reports progress
+
+	concurrency int     // rows an import works on at once; adjustable while it runs
+	rate        float64 // rows an import starts per second at most, 0 for no limit; adjustable while it runs
+
+	migrate migration // devices to copy from another server instead of reading a list (headless mode)
+
+	audit *importer.AuditLog // records every write to the server, nil if disabled
+	link  *link              // keeps the connection alive and waits for it when lost
+	debug *slog.Logger       // logs every call to the server, from --debug; nil if disabled
+
+	notify notifyOptions // how the end of an import is announced
+
+	lockTTL   time.Duration // after which the lock of an import into an application can be broken
+	breakLock bool          // break a stale lock instead of refusing to start (headless mode)
+}
+
 // List item for selections
 type item struct {
 	title, desc, id string
+	create          bool   // opens a form to create a new entry instead
+	lorawan11       bool   // a device profile for LoRaWAN 1.1 devices
+	region          string // of a device profile
 }
 
-func (i item) FilterValue() string { return i.title }
+func (i item) FilterValue() string { return i.title + " " + i.desc }
 func (i item) Title() string       { return i.title }
 func (i item) Description() string { return i.desc }
 
 // Model represents our application state
 type model struct {
-	state         state
-	client        *grpc.ClientConn
-	tenantClient  api.TenantServiceClient
-	appClient     api.ApplicationServiceClient
-	deviceClient  api.DeviceServiceClient
-	profileClient api.DeviceProfileServiceClient
-
-	// API Token and server
-	apiToken   string
-	serverAddr string
+	state           state
+	client          *grpc.ClientConn
+	tenantClient    api.TenantServiceClient
+	appClient       api.ApplicationServiceClient
+	deviceClient    api.DeviceServiceClient
+	profileClient   api.DeviceProfileServiceClient
+	templateClient  api.DeviceProfileTemplateServiceClient
+	internalClient  api.InternalServiceClient
+	multicastClient api.MulticastGroupServiceClient
+
+	// Command-line options
+	cfg config
+
+	// Styles of the views
+	theme theme
+
+	// API Token and server, and the ChirpStack version it runs once known
+	apiToken       string
+	serverAddr     string
+	server         importer.Version
+	versionWarning string
+
+	// What the token may do, probed once connected; denied says why it
+	// can't run the import being confirmed
+	access tokenAccess
+	denied error
 
 	// Terminal dimensions
 	width  int
 	height int
 
 	// Selection lists
-	tenantList  list.Model
-	appList     list.Model
-	profileList list.Model
+	tenantList    list.Model
+	appList       list.Model
+	profileList   list.Model
+	templateList  list.Model
+	multicastList list.Model
+
+	// Device profiles of the tenant, by region and name, and the region the
+	// profile list shows; "" for all
+	profiles      []item
+	profileRegion string
+
+	// A device profile is being created from the highlighted template
+	creatingProfile bool
+
+	// Searching the tenants and applications on the server, see listSearch
+	tenantSearch listSearch
+	appSearch    listSearch
 
 	// Selected items
 	selectedTenant  string
 	selectedApp     string
 	selectedProfile string
+	selectedGroup   string // multicast group the devices join, empty for none
+
+	// newGroup is created when the import starts for the devices to join,
+	// instead of selectedGroup, see createGroup. groupWarning says why it
+	// couldn't be.
+	newGroup     *api.MulticastGroup
+	groupWarning string
+
+	// Device limit of the selected tenant, nil if it has none or can't be
+	// read
+	quota *tenantQuota
+
+	// Names of the selected items, for display
+	tenantName  string
+	appName     string
+	profileName string
+	groupName   string
 
 	// File picker
-	filepicker filepicker.Model
+	filepicker filePicker
+
+	// Files marked for import in the file picker
+	marked []string
+
+	// Forms for creating a tenant on an empty server, an application from the
+	// application list and a multicast group from the multicast group list
+	tenantForm *tenantForm
+	appForm    *applicationForm
+	groupForm  *groupForm
+
+	// Export of an application's devices, started from the application list
+	export *exportScreen
+
+	// Read-only device browser, started from the application list
+	browser *deviceBrowser
+
+	// Column mapping for a file with unrecognized headers
+	mapping *mappingScreen
+
+	// URL input shown instead of the file picker
+	enteringURL bool
+	urlInput    textinput.Model
+
+	// Path input shown instead of the file picker
+	enteringPath bool
+	pathInput    textinput.Model
+
+	// Tag filter input shown instead of the file picker, to select the
+	// devices of the application instead of a list
+	enteringFilter bool
+	filterInput    textinput.Model
+	filterPrefix   bool       // values of the filter are prefixes
+	selection      *tagFilter // what selected the previewed devices, nil for lists
+
+	// Device list piped to stdin, if any
+	stdin []byte
+
+	// Parsed device lists awaiting confirmation
+	inputs        []*importer.Input
+	preview       table.Model
+	plan          *syncPlan         // changes of a sync, once compared with the server
+	comparison    *comparison       // the list compared with the server, in compare mode
+	deviceStatus  *statusReport     // the status of the listed devices, in status mode
+	statusTable   table.Model       // of deviceStatus
+	planCursor    int               // highlighted category of the plan or comparison
+	planOpen      bool              // showing the devices of that category
+	planDetail    viewport.Model    // the devices of that category
+	confirmChoice int               // highlighted button on the confirmation screen
+	createLimit   int               // devices to create at most, to fit the tenant's limit; 0 for all
+	typed         *typedConfirm     // asks to type a phrase before deleting devices or replacing keys
+	consent       *importer.Consent // given on typed for the run, and its retries
+	tagsInput     textinput.Model   // where the global tags are edited
+	editingTags   bool
+
+	// Import progress
+	events   chan tea.Msg
+	progress progress.Model
+	done     int
+	total    int
+	current  string // file being imported
+	clock    *throughput
+	chunks   []importer.ChunkTiming // finished so far
+
+	// Reading the created devices back, the second phase of the progress
+	verifying bool
+
+	// Stopping the import on a signal or ctrl+c, see shutdown
+	stopRun  context.CancelCauseFunc
+	stopping bool // waiting for the import to stop before quitting
+	exitCode int
+
+	// Pausing the import in progress, see togglePause, also by the breaker
+	pause    *importer.PauseGate
+	paused   bool
+	held     bool              // the import has stopped starting rows for the pause
+	tripped  *importer.Tripped // why the breaker paused the import, if it did
+	probeErr error             // of the last probe of the server since
+
+	// Whether calls are waiting for the lost connection to come back, see
+	// link
+	reconnecting bool
+
+	// Workers and rate limit of the device import in progress, see
+	// adjustWorkers and adjustRate
+	workers *importer.WorkerPool
+	pace    *importer.Pacer
+
+	// Footer and overlay listing the keys, see keymap.go
+	help     help.Model
+	showHelp bool
+
+	// Recent results, shown below the progress bar
+	logEntries []rowLog
+	logView    viewport.Model
 
 	// Text input for API token
 	tokenInput textinput.Model
@@ -98,27 +330,520 @@ type model struct {
 	err    error
 
 	// Results
-	devicesCreated int
+	results  []importer.FileResult
+	unlisted importer.Result // devices a sync deleted because no list has them
+
+	// Outcome of every row of the last run, and the table listing them
+	report       []rowLog
+	resultsTable *resultsScreen
+
+	// Retrying the failed rows of the last run, see startRetry
+	retrying    bool
+	retries     int
+	reportIndex map[reportKey]int
+	tried       map[string]map[importer.RowPos]bool // by source, the rows retried so far
+
+	// Rows corrected on the results table, by source, and the corrected
+	// copies of their lists written so far
+	corrections map[string][]correction
+	corrected   map[string]bool
+
+	// Lock on the application while an import writes to it, and the lock
+	// of another import that kept one from starting
+	lock     *appLock
+	lockHeld *lockHeld
+
+	// Where the summary of the last run was copied or written, see
+	// copySummary
+	shared string
+
+	// Undo of the last import, started from its summary
+	undo *undoScreen
+
+	// QR codes of the devices of the last import, or of the previewed
+	// lists in qr mode
+	qrCodes *qrScreen
+
+	// ID of the last run and its record in the run history, and the list of
+	// previous imports
+	runID string
+	run   *runHeader
+	runs  *runsScreen
+
+	// Selections and files remembered between runs
+	history history
+
+	// List being fetched, see startLoading
+	spinner  spinner.Model
+	loading  string  // what is being loaded, for display
+	retry    tea.Cmd // fetches the list again after a failure
+	loadFrom state   // where esc goes back to after a failure
+	prefetch *prefetch
 }
 
 // Messages
 type (
-	connectMsg        struct{}
-	tenantsLoadedMsg  []item
-	appsLoadedMsg     []item
+	connectMsg       struct{}
+	tenantsLoadedMsg struct {
+		items []item
+		total int
+	}
+	appsLoadedMsg struct {
+		items []item
+		total int
+	}
 	profilesLoadedMsg []item
-	devicesCreatedMsg int
-	errorMsg          error
+	loadFailedMsg     struct{ err error } // not an error, or every error message would match its case
+	inputsReadMsg     []*importer.Input
+	needMappingMsg    struct {
+		err   *importer.HeaderError
+		paths []string
+	}
+	importProgressMsg struct {
+		done, total int
+		current     string
+		row         *rowLog // outcome of the row just processed, if any
+	}
+	devicesCreatedMsg struct {
+		results  []importer.FileResult
+		unlisted importer.Result // devices a sync deleted
+	}
+	errorMsg error
 )
 
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	var servers, tokens stringList
+	flag.Var(&servers, "server", "ChirpStack gRPC API address, host:port or unix:///path/to/socket (default: localhost:8081), reached through grpc_proxy or HTTPS_PROXY if set; repeat it, each with its own --token, to import the same list into several servers in headless mode")
+	flag.Var(&tokens, "token", "API token, one for each --server (default: $CHIRPSTACK_API_TOKEN)")
+	application := flag.String("application", "", "application ID to import into (headless mode)")
+	profile := flag.String("profile", "", "device profile ID for new devices (headless mode)")
+	tenant := flag.String("tenant", "", "tenant ID to import gateways into, or to export them from (headless mode); the tenant of a tenant API key")
+	multicastGroup := flag.String("multicast-group", "", "multicast group, by name or ID, to add the imported devices to; rows can name their own in a multicast_group column (headless mode)")
+	headless := flag.Bool("headless", false, "import without the interactive UI")
+	watch := flag.String("watch", "", "import every CSV dropped into this directory until stopped, moving each to done/ or failed/ with a report")
+	gateways := flag.Bool("gateways", false, "import gateways (gateway_id, name, description, latitude, longitude, altitude) instead of devices")
+	defaultLocation := flag.String("default-location", "", `coordinates given to imported gateways without their own, as "latitude,longitude[,altitude]"; use semicolons to separate them when writing decimal commas`)
+	modeFlag := flag.String("mode", "import", "what to do with the listed devices: import, delete, sync (create and update to match the list), compare (report the differences, read-only), toggle (enable or disable), update (change the names, descriptions and tags the list has values for), move (to another application), status (report whether the devices exist, have joined and when they were last seen, read-only), rotate (replace their root keys with new ones, saved next to the list) or qr (write their TR005 QR codes to --qr-codes, without the server)")
+	allDevices := flag.Bool("all-devices", false, "with --mode delete, toggle, move or rotate, run over every device of --application instead of --csv")
+	var selectTags stringList
+	flag.Var(&selectTags, "select-tag", `with --mode delete, toggle, move or rotate, run over the devices of --application with this tag, "key=value" (repeatable), instead of --csv`)
+	tagPrefix := flag.Bool("tag-prefix", false, "with --select-tag, match devices whose tag values start with the given ones")
+	toApplication := flag.String("to-application", "", "with --mode move, the application (name or ID) to move the devices of rows without a target_application column to")
+	updateInvasive := flag.Bool("update-invasive", false, "let --mode update also change device profiles, variables and is_disabled")
+	enable := flag.Bool("enable", false, "with --mode toggle, enable the devices of rows without an is_disabled value")
+	disable := flag.Bool("disable", false, "with --mode toggle, disable the devices of rows without an is_disabled value")
+	dryRun := flag.Bool("dry-run", false, "check every row against the server without changing anything")
+	validateOnly := flag.Bool("validate-only", false, "only validate the lists, without connecting to a server: parse them, map their columns and check every row, exiting with 1 if one is invalid")
+	yes := flag.Bool("yes", false, "accept the prompts of headless mode; deleting devices and replacing keys need --yes-destructive instead")
+	yesDestructive := flag.Bool("yes-destructive", false, "delete devices (--mode delete, --sync-delete, --undo) and replace keys (--overwrite-keys) in headless mode without confirmation")
+	syncDelete := flag.Bool("sync-delete", false, "in sync mode, also delete devices of the application that aren't in the list")
+	overQuota := flag.String("over-quota", "abort", "what a headless import that would exceed the tenant's device limit does: abort, proceed or truncate (import only as many as fit)")
+	chunkSize := flag.Int("chunk-size", defaultChunkSize, "rows per chunk of an import; after each the undo journal, audit log and failed rows are flushed to disk and its timing is reported")
+	concurrency := flag.Int("concurrency", 1, fmt.Sprintf("rows an import works on at once, up to %d; + and - change it while the import runs and the last value is kept for the next interactive session", importer.MaxWorkers))
+	rate := flag.Float64("rate", 0, "rows an import starts per second at most, 0 for no limit; [ and ] change it while the import runs and the last value is kept for the next interactive session")
+	breakerThreshold := flag.Int("breaker", defaultBreakerThreshold, "pause an import after this many rows in a row failed with the same server error, 0 to never pause; headless imports stop instead unless --breaker-probe is given")
+	breakerProbe := flag.Bool("breaker-probe", false, "when --breaker pauses an import, check the server every 30s and resume once it answers")
+	keepaliveTime := flag.Duration("keepalive", defaultKeepalive, "ping the server after this long without activity, so that load balancers keep the connection open; 0 to never ping")
+	keepaliveTimeout := flag.Duration("keepalive-timeout", defaultKeepaliveTimeout, "how long a ping may go unanswered before the connection is considered lost")
+	reconnectTimeout := flag.Duration("reconnect-timeout", defaultReconnectTimeout, "how long calls wait for a lost connection to come back before their rows fail; 0 to fail them right away")
+	maxFailures := flag.String("max-failures", "", `stop an import after this many failed rows, or this percentage of the rows, e.g. 20 or "5%"; existing devices don't count`)
+	stopOnError := flag.Bool("stop-on-error", false, "stop an import at the first failed row, same as --max-failures 1")
+	qrCodes := flag.String("qr-codes", "", "write the TR005 QR codes of the created devices, or with --mode qr of every listed device, to this directory as PNG files named by DevEUI, or to this .csv file as payloads")
+	report := flag.String("report", "", "in headless compare or status mode, write the report to this file: JSON if it ends in .json, CSV otherwise")
+	input := flag.String("csv", "", `device list to import, "-" for stdin; skips the file picker in the interactive UI`)
+	useStdin := flag.Bool("stdin", false, `read the device list from stdin, same as --csv -`)
+	failures := flag.String("failures", "", "file to write failed rows to (default: next to the input, or stderr for stdin)")
+	var headers, tags, profileMap, ignoreColumns, allowExt stringList
+	noAuto := make(noAutoSelect)
+	flag.Var(noAuto, "no-auto-select", `keep the tenant, application and device profile screens when they have a single choice, or only those listed, e.g. "tenant,profile"`)
+	migrateFrom := flag.String("migrate-from", "", "ChirpStack gRPC API address to migrate the devices of --migrate-application from, into --application (headless mode)")
+	migrateToken := flag.String("migrate-token", os.Getenv("CHIRPSTACK_SOURCE_API_TOKEN"), "API token of the server migrated from (default: $CHIRPSTACK_SOURCE_API_TOKEN)")
+	migrateApp := flag.String("migrate-application", "", "ID of the application to migrate the devices of")
+	migrateKeys := flag.Bool("migrate-keys", false, "also copy the root keys of the migrated devices")
+	flag.Var(&profileMap, "profile-map", `device profile for migrated devices of another profile, "source name=name or ID" (repeatable); by default the profile of the same name`)
+	flag.Var(&tags, "tag", `tag for every imported device, "key=value" (repeatable); a row's own tags take precedence`)
+	description := flag.String("description", "", "description of imported devices without one; {date} and {filename} are replaced")
+	flag.Var(&headers, "http-header", `extra header for downloads, "Name: value" (repeatable)`)
+	httpTimeout := flag.Duration("http-timeout", importer.DefaultHTTPTimeout, "timeout for downloading a device list")
+	undo := flag.Bool("undo", false, "delete the devices created by the last import and exit")
+	force := flag.Bool("force", false, "with --undo, also delete devices that have been seen since the import")
+	export := flag.String("export", "", "write the devices of --application to this CSV file and exit")
+	exportGateways := flag.String("export-gateways", "", "write the gateways of --tenant to this CSV file and exit")
+	missingKeys := flag.String("missing-keys", "", "write the devices of --application that have no keys and have never joined to this CSV file and exit")
+	template := flag.String("generate-template", "", "write a template CSV with every supported column to this path and exit")
+	duplicateNames := flag.String("duplicate-names", namesWarn, "what to do about device names used more than once: warn, allow or suffix (rename to e.g. \"meter-12 (2)\")")
+	checkServerNames := flag.Bool("check-server-names", false, "also check device names against the devices of the application")
+	skipExisting := flag.Bool("skip-existing", false, "list the devices of the application first and skip the rows of those that exist already")
+	nameTmpl := flag.String("name-template", "", "name for rows without one, e.g. meter-{eui_last4} or sensor-{row:04d} (default: the DevEUI)")
+	euiNamePrefix := flag.String("eui-name-prefix", "", "prefix of the names of devices named after their DevEUI, for rows without a name and without --name-template")
+	euiNameUpper := flag.Bool("eui-name-upper", false, "upper-case the DevEUI of devices named after it")
+	delimiter := flag.String("delimiter", "", "CSV field delimiter: comma, semicolon, tab or pipe (default: detect)")
+	enc := flag.String("encoding", "utf-8", "input file encoding: utf-8, latin-1 or windows-1252")
+	sheet := flag.String("sheet", "", "XLSX sheet to import (default: first sheet)")
+	mappingFlag := flag.String("mapping", "", "column mapping preset to read every file with, by name or as a JSON file")
+	lenient := flag.Bool("lenient", false, "ignore header columns that don't map to a field instead of rejecting the file")
+	flag.Var(&allowExt, "allow-ext", `extra file type to offer for import, e.g. ".dat" (repeatable); its format is told from the content`)
+	flag.Var(&ignoreColumns, "ignore-column", "header column that maps to no field but is expected, such as a bookkeeping column (repeatable)")
+	generateKeys := flag.Bool("generate-keys", false, "generate and provision a random AppKey for rows without one, saving them to <input>.keys.csv")
+	overwriteKeys := flag.Bool("overwrite-keys", false, "replace the keys of devices that exist already; a device that has joined with its old keys is cut off")
+	downlinkHex := flag.String("downlink", "", "hex payload to enqueue for every created device, e.g. a configuration command; rows can have their own in a downlink_payload column")
+	downlinkFPort := flag.Uint("downlink-fport", 1, "FPort of the enqueued downlinks, unless a row sets downlink_fport")
+	downlinkConfirmed := flag.Bool("downlink-confirmed", false, "enqueue the downlinks as confirmed")
+	logFile := flag.String("log-file", defaultLogFile(), "file the interactive UI logs to, in the format of --log-format, and --debug every gRPC call in any mode")
+	logLevel := flag.String("log-level", "info", "least severe records logged: error, warn, info or debug; the log pane of the interactive UI shows warnings and errors only")
+	logFormat := flag.String("log-format", "text", "format of the log: text, as key=value pairs, or json, one object per line")
+	debug := flag.Bool("debug", false, `log every gRPC call to the server to --log-file, with its duration, status, metadata keys and messages with secrets masked, as debug records with the message "grpc"`)
+	auditFile := flag.String("audit-log", defaultAuditFile(), `file every write to the server is appended to as a JSON line, "" to disable`)
+	operator := flag.String("operator", "", "who to name in the audit log (default: the name or ID of the API key)")
+	noColor := flag.Bool("no-color", false, "render without colors or other styling (also enabled by $NO_COLOR)")
+	noVerify := flag.Bool("no-verify", false, "don't read the created devices back to check them after an import")
+	notify := flag.Bool("notify", false, "ring the terminal bell and show a desktop notification where the terminal supports it when an import ends")
+	notifyURL := flag.String("notify-url", "", "webhook the summary of an import is posted to as JSON when it ends")
+	notifyFormat := flag.String("notify-format", notifyJSON, "payload posted to --notify-url: json or slack")
+	lockTTL := flag.Duration("lock-ttl", defaultLockTTL, "age after which the lock another import holds on the application can be broken")
+	breakLock := flag.Bool("break-lock", false, "break a stale lock on the application instead of refusing to start (headless mode)")
+	noHistory := flag.Bool("no-history", false, "don't remember the server, selections and recent files between runs, nor keep a record of each run")
+	startDir := flag.String("start-dir", "", "directory the file picker opens in (default: the directory of the last file imported, or the home directory)")
+	showSecretsFlag := flag.Bool("show-secrets", false, "show keys, tokens and other secrets in full in the UI, logs, audit log and reports instead of masking them as a1b2…c3d4; for debugging only")
+	historyLimit := flag.Int("history-limit", defaultHistoryLimit, "number of runs kept in the history of previous imports; older ones are removed")
+	flag.Parse()
+	redact.Show = *showSecretsFlag
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	cfg := config{
+		server:         "localhost:8081",
+		token:          os.Getenv("CHIRPSTACK_API_TOKEN"),
+		applicationID:  *application,
+		profileID:      *profile,
+		tenantID:       *tenant,
+		multicastGroup: *multicastGroup,
+		headless:       *headless,
+		input:          *input,
+		failuresFile:   *failures,
+		dryRun:         *dryRun,
+		yes:            *yes,
+		destructiveOK:  *yesDestructive,
+		syncDelete:     *syncDelete,
+		overQuota:      *overQuota,
+		report:         *report,
+		qrCodes:        *qrCodes,
+		overwriteKeys:  *overwriteKeys,
+		noHistory:      *noHistory,
+		historyLimit:   *historyLimit,
+		lockTTL:        *lockTTL,
+		breakLock:      *breakLock,
+		noAutoSelect:   noAuto,
+		verify:         !*noVerify,
+		plain:          *noColor || os.Getenv("NO_COLOR") != "",
+		ListOptions: importer.ListOptions{
+			Gateways:       *gateways,
+			ValidateOnly:   *validateOnly,
+			HTTPHeaders:    headers,
+			HTTPTimeout:    *httpTimeout,
+			Sheet:          *sheet,
+			Lenient:        *lenient,
+			EUINamePrefix:  *euiNamePrefix,
+			EUINameUpper:   *euiNameUpper,
+			GenerateKeys:   *generateKeys,
+			DuplicateNames: *duplicateNames,
+		},
+	}
+	if *useStdin {
+		cfg.input = "-"
+	}
+	var err error
+	if cfg.Mode, err = importer.ParseMode(*modeFlag); err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case *enable && *disable:
+		log.Fatal("--enable and --disable can't be used together")
+	case (*enable || *disable) && cfg.Mode != importer.ModeToggle:
+		log.Fatal("--enable and --disable need --mode toggle")
+	case *enable || *disable:
+		cfg.Disable = disable
+	}
+	cfg.UpdateInvasive = *updateInvasive
+	if cfg.DefaultLocation, err = importer.ParseDefaultLocation(*defaultLocation); err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case (*allDevices || len(selectTags) > 0) && !cfg.Mode.Selectable():
+		log.Fatal("--all-devices and --select-tag need --mode delete, toggle, move or rotate")
+	case *allDevices && len(selectTags) > 0:
+		log.Fatal("--all-devices and --select-tag can't be used together")
+	case *tagPrefix && len(selectTags) == 0:
+		log.Fatal("--tag-prefix needs --select-tag")
+	case *allDevices || len(selectTags) > 0:
+		filter, err := parseTagFilter(selectTags, *tagPrefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.selection = &filter
+	}
+	if *toApplication != "" && cfg.Mode != importer.ModeMove {
+		log.Fatal("--to-application needs --mode move")
+	}
+	cfg.TargetApplication = *toApplication
+	if cfg.Delimiter, err = importer.ParseDelimiter(*delimiter); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Encoding, err = importer.ParseEncoding(*enc); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.NameTemplate, err = importer.ParseNameTemplate(*nameTmpl); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.server, cfg.token, cfg.mirrors, err = parseTargets(cfg.server, cfg.token, servers, tokens); err != nil {
+		log.Fatal(err)
+	}
+	if len(cfg.mirrors) > 0 && !cfg.headless {
+		log.Fatal("several --server can only be imported into with --headless")
+	}
+	cfg.migrate = migration{server: *migrateFrom, token: *migrateToken, applicationID: *migrateApp, keys: *migrateKeys}
+	if cfg.migrate.profiles, err = parseProfileMap(profileMap); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.migrate.server != "" {
+		cfg.headless = true
+	}
+	if cfg.Tags, err = importer.ParseTags(tags); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Description, err = importer.ParseDescriptionTemplate(*description); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.downlink, err = importer.ParseDownlink(*downlinkHex, *downlinkFPort, *downlinkConfirmed); err != nil {
+		log.Fatal(err)
+	}
+	switch cfg.DuplicateNames {
+	case namesWarn, importer.NamesAllow, importer.NamesSuffix:
+	default:
+		log.Fatal("--duplicate-names must be warn, allow or suffix")
+	}
+	for _, c := range ignoreColumns {
+		cfg.IgnoreColumns = append(cfg.IgnoreColumns, importer.NormalizeHeader(c))
+	}
+	for _, ext := range allowExt {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			log.Fatal("--allow-ext must be a file extension, e.g. .dat")
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		cfg.AllowExt = append(cfg.AllowExt, ext)
+	}
+	if cfg.historyLimit < 1 {
+		log.Fatal("--history-limit must be at least 1")
+	}
+	if cfg.breakerThreshold, cfg.breakerProbe = *breakerThreshold, *breakerProbe; cfg.breakerThreshold < 0 {
+		log.Fatal("--breaker must not be negative")
+	}
+	if cfg.chunkSize = *chunkSize; cfg.chunkSize < 1 {
+		log.Fatal("--chunk-size must be at least 1")
+	}
+	if cfg.concurrency = *concurrency; cfg.concurrency < 1 || cfg.concurrency > importer.MaxWorkers {
+		log.Fatalf("--concurrency must be between 1 and %d", importer.MaxWorkers)
+	}
+	if cfg.rate = *rate; cfg.rate < 0 {
+		log.Fatal("--rate must not be negative")
+	}
+	switch {
+	case *keepaliveTime != 0 && *keepaliveTime < 10*time.Second:
+		// gRPC raises shorter intervals to 10s anyway.
+		log.Fatal("--keepalive must be 0 or at least 10s")
+	case *keepaliveTimeout <= 0:
+		log.Fatal("--keepalive-timeout must be positive")
+	case *reconnectTimeout < 0:
+		log.Fatal("--reconnect-timeout must not be negative")
+	}
+	if *reconnectTimeout > 0 || *keepaliveTime > 0 {
+		cfg.link = newLink(*keepaliveTime, *keepaliveTimeout, *reconnectTimeout)
+	}
+	if *startDir != "" {
+		cfg.startDir = expandHome(*startDir)
+		if fi, err := os.Stat(cfg.startDir); err != nil || !fi.IsDir() {
+			slog.Warn("--start-dir isn't a directory, starting in the working directory", "path", *startDir)
+			cfg.startDir = "."
+		}
+		if abs, err := filepath.Abs(cfg.startDir); err == nil {
+			cfg.startDir = abs
+		}
+	}
+	cfg.checkServerNames = *checkServerNames
+	cfg.SkipExisting = *skipExisting
+	if cfg.maxFailures, err = importer.ParseFailureLimit(*maxFailures); err != nil {
 		log.Fatal(err)
 	}
+	if *stopOnError {
+		cfg.maxFailures = importer.FailureLimit{Count: 1}
+	}
+	if cfg.notify, err = parseNotifyOptions(*notify, *notifyURL, *notifyFormat); err != nil {
+		log.Fatal(err)
+	}
+	logOpts, err := parseLogOptions(*logLevel, *logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Headless runs and watch mode log to stderr; the interactive UI moves
+	// the log to the log file once it starts.
+	slog.SetDefault(slog.New(logOpts.handler(os.Stderr, logOpts.level)))
+	if cfg.audit, err = importer.OpenAudit(*auditFile, *operator); err != nil {
+		log.Fatalf("Opening the audit log: %v", err)
+	}
+	defer cfg.audit.Close()
+	if *debug && *logFile == "" {
+		log.Fatal("--debug logs to --log-file, which is empty")
+	}
+	if *debug {
+		df, err := openLogFile(*logFile)
+		if err != nil {
+			log.Fatalf("Opening the log file for --debug: %v", err)
+		}
+		defer df.Close()
+		cfg.debug = slog.New(logOpts.handler(df, slog.LevelDebug))
+	}
+	if cfg.Mappings, err = loadMappings(); err != nil {
+		slog.Warn("Ignoring saved column mappings", "err", err)
+	}
+	if *mappingFlag != "" {
+		if cfg.Mapping, err = resolveMapping(*mappingFlag, cfg.Mappings); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *template != "" {
+		if err := importer.SaveTemplate(*template); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Template written to %s\n", *template)
+		return
+	}
+
+	if *export != "" {
+		os.Exit(runExport(cfg, *export))
+	}
+	if *missingKeys != "" {
+		os.Exit(runKeylessReport(cfg, *missingKeys))
+	}
+	if *exportGateways != "" {
+		os.Exit(runGatewayExport(cfg, *exportGateways))
+	}
+
+	if *undo {
+		os.Exit(runUndo(cfg, *force))
+	}
+
+	if *watch != "" {
+		ctx, stop := notifyShutdown(context.Background())
+		code := runWatch(ctx, cfg, *watch)
+		stop(nil)
+		os.Exit(code)
+	}
+
+	if cfg.headless {
+		ctx, stop := notifyShutdown(context.Background())
+		code := exitCode(ctx, runHeadless(ctx, cfg))
+		stop(nil)
+		os.Exit(code)
+	}
+
+	// Keep log output from drawing over the UI: it goes to the log file,
+	// and warnings and errors to the log pane too.
+	lf, err := openLogFile(*logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not logging to %s: %v\n", *logFile, err)
+	} else if lf != nil {
+		defer lf.Close()
+	}
+
+	// The last session's server and pace are for picking up where it left
+	// off; scripted runs and the other commands go by their flags alone.
+	var hist history
+	if !cfg.noHistory {
+		if hist, err = loadHistory(); err != nil {
+			slog.Warn("Ignoring saved history", "err", err)
+		}
+		if hist.Server != "" && !flagGiven("server") {
+			cfg.server = hist.Server
+		}
+		if hist.Concurrency > 0 && !flagGiven("concurrency") {
+			cfg.concurrency = min(hist.Concurrency, importer.MaxWorkers)
+		}
+		if hist.Rate > 0 && !flagGiven("rate") {
+			cfg.rate = hist.Rate
+		}
+	}
+
+	m := initialModel(cfg, hist)
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	if stdinPiped() {
+		// Keep the piped device list and read keys from the terminal instead.
+		if m.stdin, err = io.ReadAll(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, tea.WithInputTTY())
+	}
+
+	// Signals go through the same shutdown as ctrl+c, see shutdown.
+	opts = append(opts, tea.WithoutSignalHandler())
+	p := tea.NewProgram(m, opts...)
+	handlers := teeHandler{paneHandler{send: p.Send}}
+	if lf != nil {
+		handlers = append(handlers, logOpts.handler(lf, logOpts.level))
+	}
+	slog.SetDefault(slog.New(handlers))
+	if cfg.link != nil {
+		cfg.link.notify(func(down bool) { p.Send(reconnectingMsg(down)) })
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, shutdownSignals...)
+	go func() {
+		for sig := range sigs {
+			p.Send(shutdownMsg{sig})
+		}
+	}()
+
+	final, err := p.Run()
+	signal.Stop(sigs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if fm := final.(model); fm.exitCode != 0 {
+		fm.printInterrupted()
+		if lf != nil {
+			lf.Close()
+		}
+		os.Exit(fm.exitCode)
+	}
 }
 
-func initialModel() model {
+// stringList is a flag.Value collecting every occurrence of a flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// flagGiven reports whether the named flag was set on the command line.
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	return given
+}
+
+// stdinPiped reports whether standard input is a pipe or file rather than a
+// terminal.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+func initialModel(cfg config, hist history) model {
+	th := newTheme(cfg.plain)
+
 	// Initialize token input
 	ti := textinput.New()
 	ti.Placeholder = "Enter ChirpStack API token"
@@ -127,23 +852,85 @@ func initialModel() model {
 	ti.Width = 50
 	ti.EchoMode = textinput.EchoPassword
 
+	// Initialize URL input
+	ui := textinput.New()
+	ui.Placeholder = "https://example.com/devices.csv"
+	ui.CharLimit = 2048
+	ui.Width = 60
+
+	// Initialize path input
+	pi := textinput.New()
+	pi.Placeholder = "/path/to/devices.csv"
+	pi.CharLimit = 4096
+	pi.Width = 60
+
+	// Initialize tag filter input
+	fi := textinput.New()
+	fi.Placeholder = "site=north, floor=2"
+	fi.CharLimit = 1024
+	fi.Width = 60
+
+	// Initialize global tags input
+	tgi := textinput.New()
+	tgi.Placeholder = "po=2024-117, installer=acme"
+	tgi.CharLimit = 1024
+	tgi.Width = 60
+
 	// Initialize file picker
-	fp := filepicker.New()
-	fp.AllowedTypes = []string{".csv"}
-	fp.CurrentDirectory, _ = os.UserHomeDir()
+	dir := cfg.startDir
+	if dir == "" {
+		dir = hist.lastDirectory()
+	}
+	if dir == "" {
+		dir = startDirectory()
+	}
+	fp := newFilePicker(dir, cfg.Extensions())
+	fp.newest = hist.NewestFirst
+	fp.setHeight(24 - filepickerChrome - recentLines(hist))
 
 	return model{
-		state:      stateConnecting,
-		tokenInput: ti,
-		filepicker: fp,
-		serverAddr: "localhost:8081", // Default ChirpStack gRPC address
-		status:     "Enter your ChirpStack API token",
-		width:      80, // Default width
-		height:     24, // Default height
+		cfg:         cfg,
+		history:     hist,
+		state:       stateConnecting,
+		tokenInput:  ti,
+		urlInput:    ui,
+		pathInput:   pi,
+		filterInput: fi,
+		tagsInput:   tgi,
+		filepicker:  fp,
+		theme:       th,
+		help:        help.New(),
+		logView:     viewport.New(76, 10),
+		progress:    th.newProgress(),
+		spinner:     spinner.New(spinner.WithSpinner(spinner.Dot)),
+		serverAddr:  cfg.server,
+		status:      "Enter your ChirpStack API token",
+		width:       80, // Default width
+		height:      24, // Default height
+	}
+}
+
+// filepickerChrome is the number of lines the file selection screen needs
+// besides the picker itself: header, file info, filter, marked files, status
+// and help.
+const filepickerChrome = 11
+
+// startDirectory returns the directory the file picker opens in: the home
+// directory, or the working directory if there is no home.
+func startDirectory() string {
+	if dir, err := os.UserHomeDir(); err == nil {
+		return dir
 	}
+	if dir, err := os.Getwd(); err == nil {
+		return dir
+	}
+	return "."
 }
 
 func (m model) Init() tea.Cmd {
+	if m.cfg.ValidateOnly {
+		return func() tea.Msg { return offlineMsg{} }
+	}
 	return textinput.Blink
 }
 
@@ -163,135 +950,960 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.profileList.Items() != nil {
 			m.profileList.SetSize(msg.Width-4, msg.Height-8)
 		}
+		if m.templateList.Items() != nil {
+			m.templateList.SetSize(msg.Width-4, msg.Height-8)
+		}
+		if m.multicastList.Items() != nil {
+			m.multicastList.SetSize(msg.Width-4, msg.Height-8)
+		}
+		if m.browser != nil {
+			m.browser.list.SetSize(msg.Width-4, msg.Height-8)
+		}
+		if m.runs != nil {
+			m.runs.list.SetSize(msg.Width-4, msg.Height-8)
+		}
+		m.filepicker.setHeight(max(msg.Height-filepickerChrome-recentLines(m.history), 3))
+		m.resizeLog()
+		if m.state == statePreview {
+			m.preview = newPreviewTable(m.inputs, msg.Width, msg.Height)
+		}
+		if m.resultsTable != nil {
+			m.fillResults()
+		}
 		return m, nil
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			if m.client != nil {
-				m.client.Close()
+		if m.showHelp {
+			return m.updateHelpOverlay(msg)
+		}
+		if keyHelp.matches(m, msg) {
+			m.showHelp = true
+			return m, nil
+		}
+		if m.state == stateLoading {
+			// Don't let keys pile up against the list that is on its way.
+			switch {
+			case keyForceQuit.matches(m, msg):
+				return m, tea.Quit
+			case keyCancelPrefetch.matches(m, msg):
+				return m.cancelPrefetch()
 			}
-			return m, tea.Quit
-		case "enter":
+			return m, nil
+		}
+		if m.state == stateLoadFailed {
+			return m.updateLoadFailed(msg)
+		}
+		if m.enteringURL {
+			return m.updateURLInput(msg)
+		}
+		if m.enteringPath {
+			return m.updatePathInput(msg)
+		}
+		if m.enteringFilter {
+			return m.updateFilterInput(msg)
+		}
+		if m.state == stateColumnMapping {
+			return m.updateMapping(msg)
+		}
+		if m.state == stateCreateTenant {
+			return m.updateTenantForm(msg)
+		}
+		if m.state == stateCreateApplication {
+			return m.updateAppForm(msg)
+		}
+		if m.state == stateCreateMulticast {
+			return m.updateGroupForm(msg)
+		}
+		if m.state == stateExport {
+			return m.updateExport(msg)
+		}
+		if m.state == stateSyncPlan {
+			return m.updatePlan(msg)
+		}
+		if m.state == stateCompare {
+			return m.updateCompare(msg)
+		}
+		if m.state == stateStatus {
+			return m.updateStatus(msg)
+		}
+		if m.state == stateUndo {
+			return m.updateUndo(msg)
+		}
+		if m.state == stateQRCodes {
+			return m.updateQRCodes(msg)
+		}
+		if m.state == stateResults {
+			return m.updateResults(msg)
+		}
+		if m.state == stateConfirm && m.editingTags {
+			return m.updateTagsInput(msg)
+		}
+		if m.state == stateConfirm {
+			return m.updateConfirm(msg)
+		}
+
+		switch {
+		case keyQuit.matches(m, msg) && m.state == stateProcessing, keyForceQuit.matches(m, msg) && m.state == stateProcessing:
+			return m.shutdown(interrupted{os.Interrupt})
+		case keyPause.matches(m, msg):
+			m.tripped = nil
+			return m.togglePause()
+		case keyCancelTripped.matches(m, msg):
+			return m.cancelTripped()
+		case keyWorkers.matches(m, msg):
+			return m.adjustWorkers(msg.String() != "-")
+		case keyRate.matches(m, msg):
+			return m.adjustRate(msg.String() == "]")
+		case keyQuit.matches(m, msg), keyForceQuit.matches(m, msg):
+			return m.quit()
+		case keyConnect.matches(m, msg), keySelect.matches(m, msg):
 			return m.handleEnter()
+		case keyTemplateBack.matches(m, msg):
+			m.state = stateDeviceProfileSelect
+			return m, nil
+		case keyBrowse.matches(m, msg):
+			return m.openBrowser()
+		case keyBrowseBack.matches(m, msg):
+			m.browser = nil
+			m.state = stateApplicationSelect
+			return m, nil
+		case keyDetailBack.matches(m, msg):
+			m.state = stateBrowse
+			return m, nil
+		case keyRegion.matches(m, msg):
+			m.showRegion(m.nextRegion())
+			return m, nil
+		case keyGateways.matches(m, msg):
+			m.cfg.Gateways = !m.cfg.Gateways
+			m.cfg.Mode = importer.ModeImport
+			m.results = nil
+			m.tenantList.Title = m.tenantTitle()
+			return m, nil
+		case keyExportGateways.matches(m, msg):
+			it := m.tenantList.SelectedItem().(item)
+			m.export = newGatewayExportScreen(it.id, it.title, m.filepicker.dir)
+			m.state = stateExport
+			return m, textinput.Blink
+		case keyExport.matches(m, msg), keyKeyless.matches(m, msg):
+			it := m.appList.SelectedItem().(item)
+			m.export = newExportScreen(it.id, it.title, m.filepicker.dir, keyKeyless.matches(m, msg))
+			m.state = stateExport
+			return m, textinput.Blink
+		case keyStdin.matches(m, msg):
+			return m.startImport([]string{"-"})
+		case keySelectTags.matches(m, msg):
+			m.enteringFilter = true
+			m.status = ""
+			return m, m.filterInput.Focus()
+		case keyOfflineBack.matches(m, msg):
+			return m.leaveOffline()
+		case keyTemplate.matches(m, msg):
+			path := filepath.Join(m.filepicker.dir, "devices-template.csv")
+			if err := importer.SaveTemplate(path); err != nil {
+				m.status = fmt.Sprintf("Writing template failed: %v", err)
+			} else {
+				m.status = "Template written to " + path
+			}
+			return m, m.filepicker.list()
+		case keyReview.matches(m, msg):
+			switch m.cfg.Mode {
+			case importer.ModeSync:
+				return m.startLoading(fmt.Sprintf("Comparing with the devices of %s…", m.appName), m.loadSyncPlan())
+			case importer.ModeCompare:
+				return m.startLoading(fmt.Sprintf("Comparing with the devices of %s…", m.appName), m.loadComparison())
+			case importer.ModeStatus:
+				return m.startLoading(fmt.Sprintf("Checking the status of %d devices…", m.previewTotal()), m.loadStatus())
+			case importer.ModeQR:
+				rows, err := scanRows(context.Background(), m.inputs, m.cfg)
+				if err != nil {
+					m.status = err.Error()
+					return m, nil
+				}
+				return m.openQRCodes(rows, statePreview)
+			}
+			return m.confirm()
+		case keyRename.matches(m, msg):
+			return m.renameSelected()
+		case keyRenameAll.matches(m, msg):
+			return m.renameAll()
+		case keyCheckNames.matches(m, msg):
+			return m.startLoading(fmt.Sprintf("Checking names against the devices of %s…", m.appName), m.loadServerNames())
+		case keySwitchState.matches(m, msg):
+			return m.switchState()
+		case keySkipExisting.matches(m, msg):
+			m.cfg.SkipExisting = true
+			return m.startPrefetch()
+		case keyDiscard.matches(m, msg):
+			m.inputs = nil
+			m.state = stateFileSelect
+			return m, m.filepicker.list()
+		case keyTypePath.matches(m, msg):
+			m.enteringPath = true
+			m.status = ""
+			m.pathInput.SetValue(m.filepicker.dir + string(filepath.Separator))
+			m.pathInput.CursorEnd()
+			return m, m.pathInput.Focus()
+		case keyRecent.matches(m, msg):
+			if i := int(msg.String()[0] - '1'); i < len(m.history.RecentFiles) {
+				path := m.history.RecentFiles[i]
+				if _, err := os.Stat(path); err != nil {
+					m.status = fmt.Sprintf("Can't open %s: %v", path, err)
+					return m, nil
+				}
+				return m.startImport([]string{path})
+			}
+		case keyHidden.matches(m, msg):
+			m.filepicker.showHidden = !m.filepicker.showHidden
+			cmd := m.filepicker.reload()
+			return m, cmd
+		case keySortFiles.matches(m, msg):
+			m.filepicker.newest = !m.filepicker.newest
+			m.history.NewestFirst = m.filepicker.newest
+			m.remember()
+			cmd := m.filepicker.reload()
+			return m, cmd
+		case keyAllFiles.matches(m, msg):
+			if m.filepicker.allowed == nil {
+				m.filepicker.allowed = m.cfg.Extensions()
+			} else {
+				m.filepicker.allowed = nil
+			}
+			cmd := m.filepicker.reload()
+			return m, cmd
+		case keyFetchURL.matches(m, msg):
+			m.enteringURL = true
+			m.status = ""
+			return m, m.urlInput.Focus()
+		case keyAnother.matches(m, msg):
+			return m.importAnother()
+		case keyStartOver.matches(m, msg):
+			return m.startOver()
+		case keyRetryFailed.matches(m, msg):
+			return m.startRetry()
+		case keyResults.matches(m, msg):
+			return m.openResults()
+		case keyCopySummary.matches(m, msg):
+			return m, m.copySummary()
+		case keyReport.matches(m, msg):
+			m.shared = m.writeReport()
+			return m, nil
+		case keyQRCodes.matches(m, msg):
+			return m.openQRCodes(createdRows(m.results), stateComplete)
+		case keyUndo.matches(m, msg):
+			m.undo = newUndoScreen(m.serverAddr, m.runID, m.appName, stateComplete)
+			m.state = stateUndo
+			return m, textinput.Blink
+		case keyRevealToken.matches(m, msg):
+			return m.toggleToken()
+		case keyRuns.matches(m, msg):
+			return m.openRuns()
+		case keyValidateOffline.matches(m, msg):
+			return m.validateOffline()
+		case keyRunUndo.matches(m, msg):
+			return m.undoRun()
+		case keyRunsBack.matches(m, msg):
+			m.state = m.runs.from
+			m.runs = nil
+			return m, nil
+		case keyMode.matches(m, msg):
+			return m.switchMode()
+		case keyLastResult.matches(m, msg):
+			m.state = stateComplete
+			return m, nil
 		}
 
 	case connectMsg:
 		return m.handleConnect()
 
+	case dirListedMsg:
+		var cmd tea.Cmd
+		m.filepicker, cmd = m.filepicker.listed(msg)
+		return m, cmd
+
+	case linesCountedMsg:
+		m.filepicker.counted(msg)
+		return m, nil
+
+	case spinner.TickMsg:
+		if m.state != stateLoading && (m.appForm == nil || !m.appForm.pending) && (m.tenantForm == nil || !m.tenantForm.pending) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case loadFailedMsg:
+		m.err = msg.err
+		m.state = stateLoadFailed
+		return m, nil
+
 	case tenantsLoadedMsg:
-		items := make([]list.Item, len(msg))
-		for i, v := range msg {
+		items := make([]list.Item, len(msg.items))
+		for i, v := range msg.items {
 			items[i] = v
 		}
+		if msg.total == 0 {
+			items = []list.Item{newTenantItem}
+		}
+		m.tenantSearch = listSearch{total: msg.total}
 		m.tenantList = list.New(items, list.NewDefaultDelegate(), m.width-4, m.height-8)
-		m.tenantList.Title = "Select Tenant"
+		m.tenantList.Title = m.tenantTitle()
+		m.tenantList.SetShowHelp(false) // see helpView
+		selectID(&m.tenantList, m.history.TenantID)
 		m.state = stateTenantSelect
-		return m, nil
+		if msg.total == 0 || m.access.kind == tokenTenantKey {
+			// A fresh server, where there is nothing to select yet, or the
+			// one tenant of an API key
+			return m.handleEnter()
+		}
+		return m.autoSelect()
 
 	case appsLoadedMsg:
-		items := make([]list.Item, len(msg))
-		for i, v := range msg {
-			items[i] = v
+		items := make([]list.Item, len(msg.items)+1)
+		items[0] = newApplicationItem
+		for i, v := range msg.items {
+			items[i+1] = v
 		}
+		m.appSearch = listSearch{total: msg.total}
 		m.appList = list.New(items, list.NewDefaultDelegate(), m.width-4, m.height-8)
-		m.appList.Title = "Select Application"
+		m.appList.Title = "Select Application" + m.appSearch.titleHint()
+		m.appList.SetShowHelp(false) // see helpView
+		selectID(&m.appList, m.history.ApplicationID)
 		m.state = stateApplicationSelect
+		return m.autoSelect()
+
+	case searchTickMsg, searchedMsg:
+		return m.updateSearch(msg)
+
+	case summarySharedMsg:
+		m.shared = msg.status
+		return m, nil
+
+	case browsePageMsg:
+		return m.updateBrowsePage(msg)
+
+	case deviceDetailMsg:
+		if m.state == stateDeviceDetail {
+			m.browser.detail = &msg
+		}
+		return m, nil
+
+	case applicationCreatedMsg:
+		m.appForm = nil
+		m.state = stateApplicationSelect
+		m.appList.InsertItem(1, item(msg))
+		m.appList.Select(1)
+		m.selectedApp = msg.id
+		m.appName = msg.title
+		return m.startLoading(fmt.Sprintf("Loading device profiles for tenant %s…", m.tenantName), m.loadDeviceProfiles())
+
+	case tenantCreatedMsg:
+		m.tenantForm = nil
+		m.state = stateTenantSelect
+		m.tenantList.SetItems([]list.Item{item(msg)})
+		m.tenantList.Select(0)
+		return m.handleEnter()
+
+	case tenantFailedMsg:
+		if m.tenantForm != nil {
+			m.tenantForm.pending = false
+			m.tenantForm.status = tenantCreateError(msg.err)
+		}
+		return m, nil
+
+	case applicationFailedMsg:
+		if m.appForm != nil {
+			m.appForm.pending = false
+			m.appForm.status = "Creating application failed: " + createErrorMessage(msg.err)
+		}
 		return m, nil
 
 	case profilesLoadedMsg:
-		items := make([]list.Item, len(msg))
-		for i, v := range msg {
-			items[i] = v
+		m.profiles = msg
+		sortProfiles(m.profiles)
+		m.cfg.ProfileRegions = make(map[string]string, 2*len(msg))
+		for _, p := range msg {
+			m.cfg.ProfileRegions[p.title] = p.region
+			m.cfg.ProfileRegions[p.id] = p.region
 		}
-		m.profileList = list.New(items, list.NewDefaultDelegate(), m.width-4, m.height-8)
-		m.profileList.Title = "Select Device Profile"
+		m.profileList = list.New(nil, list.NewDefaultDelegate(), m.width-4, m.height-8)
+		m.profileList.SetShowHelp(false) // see helpView
+		m.showRegion("")
+		selectID(&m.profileList, m.history.ProfileID)
+		m.state = stateDeviceProfileSelect
+		return m.autoSelect()
+
+	case templatesLoadedMsg:
+		return m.openTemplates(msg)
+
+	case profileCreatedMsg:
+		m.creatingProfile = false
+		m.profiles = append(m.profiles, item(msg))
+		sortProfiles(m.profiles)
+		m.cfg.ProfileRegions[msg.title] = msg.region
+		m.cfg.ProfileRegions[msg.id] = msg.region
+		m.showRegion("")
+		selectID(&m.profileList, msg.id)
 		m.state = stateDeviceProfileSelect
+		return m.handleEnter()
+
+	case profileCreateFailedMsg:
+		m.creatingProfile = false
+		return m, m.templateList.NewStatusMessage("Creating device profile failed: " + createErrorMessage(msg.err))
+
+	case quotaLoadedMsg:
+		if msg.tenantID == m.selectedTenant && msg.quota.max > 0 {
+			m.quota = &msg.quota
+		}
+		return m, nil
+
+	case multicastGroupsLoadedMsg:
+		return m.chooseMulticastGroup(msg)
+
+	case groupCreatedMsg:
+		m.newGroup = nil
+		m.selectedGroup, m.groupName = msg.id, msg.title
+		return m, waitForEvent(m.events)
+
+	case groupFailedMsg:
+		m.groupWarning = fmt.Sprintf("⚠ Multicast group %s couldn't be created, the devices are imported without it: %s", msg.name, importer.DescribeError(msg.err))
+		return m, waitForEvent(m.events)
+
+	case exportProgressMsg:
+		m.export.done, m.export.total, m.export.checking = msg.done, msg.total, msg.checking
+		return m, waitForEvent(m.events)
+
+	case exportDoneMsg:
+		m.export.running = false
+		m.export.path, m.export.count = msg.path, msg.count
 		return m, nil
 
+	case exportFailedMsg:
+		m.export.running = false
+		m.export.status = "Export failed: " + msg.err.Error()
+		return m, m.export.input.Focus()
+
+	case syncPlannedMsg:
+		m.plan = msg
+		m.planCursor, m.planOpen = planCreate, false
+		m.state = stateSyncPlan
+		return m, nil
+
+	case undoProgressMsg:
+		m.undo.done, m.undo.total = msg.done, msg.total
+		return m, waitForEvent(m.events)
+
+	case undoDoneMsg:
+		m.undo.running, m.undo.finished = false, true
+		m.undo.result = importer.Result(msg)
+		return m, nil
+
+	case statusCheckedMsg:
+		m.deviceStatus = msg
+		m.statusTable = newStatusTable(msg, m.width, m.height)
+		m.status = ""
+		m.state = stateStatus
+		return m, nil
+
+	case comparedMsg:
+		m.comparison = msg
+		m.planCursor, m.planOpen = 0, false
+		m.status = ""
+		m.state = stateCompare
+		return m, nil
+
+	case inputsReadMsg:
+		m.inputs = msg
+		m.plan, m.comparison, m.deviceStatus = nil, nil, nil
+		if m.cfg.Gateways {
+			m.preview = newGatewayPreviewTable(msg, m.width, m.height)
+		} else {
+			m.preview = newPreviewTable(msg, m.width, m.height)
+		}
+		m.state = statePreview
+		if m.prefetching() {
+			return m.startPrefetch()
+		}
+		if m.cfg.checkServerNames && m.checkingNames() {
+			return m.startLoading(fmt.Sprintf("Checking names against the devices of %s…", m.appName), m.loadServerNames())
+		}
+		return m, nil
+
+	case serverNamesMsg:
+		m.cfg.ServerNames = msg
+		return m.readPaths(m.inputPaths())
+
+	case prefetchProgressMsg, prefetchedMsg:
+		return m.updatePrefetch(msg)
+
+	case needMappingMsg:
+		m.mapping = newMappingScreen(msg.err, msg.paths)
+		m.state = stateColumnMapping
+		return m, nil
+
+	case importProgressMsg:
+		m.done, m.total, m.current = msg.done, msg.total, msg.current
+		if m.clock != nil {
+			m.clock.update(m.done, time.Now())
+		}
+		if msg.row != nil {
+			m.appendLog(*msg.row)
+			m.record(*msg.row)
+		}
+		return m, waitForEvent(m.events)
+
+	case logRecordMsg:
+		m.appendLog(rowLog{logged: &msg})
+		return m, nil
+
+	case breakerTrippedMsg:
+		return m.tripBreaker(importer.Tripped(msg))
+
+	case probeTickMsg:
+		return m, m.probeServer()
+
+	case probedMsg:
+		return m.probed(msg)
+
+	case importer.RunStarted:
+		m.done, m.total, m.current = 0, msg.Total, ""
+		return m, waitForEvent(m.events)
+
+	case importer.RowFinished:
+		m.done, m.current = msg.Done, msg.Source
+		if m.clock != nil {
+			m.clock.update(m.done, time.Now())
+		}
+		m.appendLog(rowLog{source: msg.Source, pos: msg.Row.Pos, devEUI: msg.Row.DevEUI, name: msg.Row.Name, err: msg.Err})
+		return m, waitForEvent(m.events)
+
+	case importer.ChunkCommitted:
+		m.chunks = append(m.chunks, importer.ChunkTiming(msg))
+		return m, waitForEvent(m.events)
+
+	case importer.RunPaused:
+		m.held = msg.Held
+		return m, waitForEvent(m.events)
+
+	case importer.RunFinished:
+		if msg.Err != nil {
+			return m.Update(errorMsg(msg.Err))
+		}
+		for _, l := range reportLogs(msg.Report, msg.Results) {
+			m.record(l)
+			if m.retrying {
+				if m.tried[l.source] == nil {
+					m.tried[l.source] = make(map[importer.RowPos]bool)
+				}
+				m.tried[l.source][l.pos] = true
+			}
+		}
+		if m.retrying {
+			return m.Update(retriedMsg{msg.Results, m.tried})
+		}
+		return m.Update(devicesCreatedMsg{msg.Results, msg.Unlisted})
+
+	case verifyProgressMsg:
+		m.verifying = true
+		m.done, m.total, m.current = msg.done, msg.total, ""
+		return m, waitForEvent(m.events)
+
 	case devicesCreatedMsg:
-		m.devicesCreated = int(msg)
+		m.results, m.unlisted = msg.results, msg.unlisted
+		m.verifying = false
+		for _, fr := range m.results {
+			for _, f := range fr.Input.Rejected {
+				m.report = append(m.report, rowLog{source: fr.Input.Source, pos: f.Row.Pos, devEUI: f.Row.DevEUI, name: f.Row.Name, err: f.Err})
+			}
+			for _, row := range fr.Input.Exists {
+				m.report = append(m.report, rowLog{source: fr.Input.Source, pos: row.Pos, devEUI: row.DevEUI, name: row.Name, err: importer.ExistsNote})
+			}
+		}
+		markMismatches(m.report, m.results)
+		m.releaseLock()
+		if m.clock != nil {
+			m.clock.stop(time.Now())
+		}
+		if !m.cfg.Gateways && m.clock != nil {
+			m.run = newRunHeader(m.runID, m.clock.start, m.serverAddr, m.selectedApp, m.appName, m.cfg, m.inputs)
+			m.run.Seconds = m.clock.elapsed(time.Now()).Seconds()
+			m.run.Chunks = chunkSeconds(m.chunks)
+			m.recordRun()
+		}
+		if m.quota != nil {
+			for _, fr := range m.results {
+				m.quota.used += fr.Result.Created - len(fr.Result.Removed)
+			}
+			m.quota.used -= len(m.unlisted.Removed)
+		}
 		m.state = stateComplete
+		m.resizeLog()
+		if a := m.abortedBy(); a != nil {
+			return m.endRun(a)
+		}
+		return m.endRun(nil)
+
+	case retriedMsg:
+		m.mergeRetry(msg)
+		m.verifying = false
+		markMismatches(m.report, m.results)
+		m.retrying, m.reportIndex, m.tried = false, nil, nil
+		if m.clock != nil {
+			m.clock.stop(time.Now())
+		}
+		if m.run != nil && m.clock != nil {
+			m.run.Seconds += m.clock.elapsed(time.Now()).Seconds()
+			m.recordRun()
+		}
+		m.state = stateComplete
+		m.resizeLog()
+		if m.resultsTable != nil {
+			// Back to the table the row was corrected on
+			m.state = stateResults
+			m.fillResults()
+		}
+		if m.stopping {
+			return m.quit()
+		}
 		return m, nil
 
 	case errorMsg:
+		importing := m.state == stateProcessing
+		m.releaseLock()
 		m.err = msg
 		m.state = stateError
+		if m.clock != nil {
+			m.clock.stop(time.Now())
+		}
+		if importing {
+			return m.endRun(msg)
+		}
+		if m.stopping {
+			return m.quit()
+		}
+		return m, nil
+
+	case shutdownMsg:
+		return m.shutdown(interrupted{msg.sig})
+
+	case offlineMsg:
+		return m.validateOffline()
+
+	case accessMsg:
+		// Tenants are loaded next, which retrying does from now on.
+		m.access = msg.access
+		m.loading = fmt.Sprintf("Loading tenants from %s…", m.serverAddr)
+		m.retry = m.loadTenants()
+		return m, m.retry
+
+	case accessCheckedMsg:
+		m.denied = msg.err
+		return m, nil
+
+	case reconnectingMsg:
+		m.reconnecting = bool(msg)
+		if m.reconnecting {
+			slog.Warn("Lost the connection to the server, reconnecting")
+		}
 		return m, nil
+
+	case versionMsg:
+		m.server = msg.v
+		if m.versionWarning = versionWarning(msg.v, msg.err); m.versionWarning != "" {
+			slog.Warn(m.versionWarning)
+		}
+		return m, nil
+
+	case shutdownTimeoutMsg:
+		return m.quit()
 	}
 
-	// Handle state-specific updates
-	switch m.state {
-	case stateConnecting:
+	// Handle state-specific updates
+	switch m.state {
+	case stateConnecting:
+		var cmd tea.Cmd
+		m.tokenInput, cmd = m.tokenInput.Update(msg)
+		return m, cmd
+
+	case stateTenantSelect:
+		var cmd tea.Cmd
+		m.tenantList, cmd = m.tenantList.Update(msg)
+		return m, tea.Batch(cmd, m.searchChanged())
+
+	case stateApplicationSelect:
+		var cmd tea.Cmd
+		m.appList, cmd = m.appList.Update(msg)
+		return m, tea.Batch(cmd, m.searchChanged())
+
+	case stateDeviceProfileSelect:
+		var cmd tea.Cmd
+		m.profileList, cmd = m.profileList.Update(msg)
+		return m, cmd
+
+	case stateTemplateSelect:
+		var cmd tea.Cmd
+		m.templateList, cmd = m.templateList.Update(msg)
+		return m, cmd
+
+	case stateBrowse:
+		var cmd tea.Cmd
+		m.browser.list, cmd = m.browser.list.Update(msg)
+		return m, tea.Batch(cmd, m.searchChanged(), m.fetchMore())
+
+	case stateRuns:
 		var cmd tea.Cmd
-		m.tokenInput, cmd = m.tokenInput.Update(msg)
+		m.runs.list, cmd = m.runs.list.Update(msg)
 		return m, cmd
 
-	case stateTenantSelect:
+	case stateMulticastSelect:
 		var cmd tea.Cmd
-		m.tenantList, cmd = m.tenantList.Update(msg)
+		m.multicastList, cmd = m.multicastList.Update(msg)
 		return m, cmd
 
-	case stateApplicationSelect:
+	case statePreview:
 		var cmd tea.Cmd
-		m.appList, cmd = m.appList.Update(msg)
+		m.preview, cmd = m.preview.Update(msg)
 		return m, cmd
 
-	case stateDeviceProfileSelect:
+	case stateComplete:
 		var cmd tea.Cmd
-		m.profileList, cmd = m.profileList.Update(msg)
+		m.logView, cmd = m.logView.Update(msg)
 		return m, cmd
 
 	case stateFileSelect:
-		var cmd tea.Cmd
-		m.filepicker, cmd = m.filepicker.Update(msg)
-		if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
-			return m, m.processCSV(path)
+		msg, ok := msg.(tea.KeyMsg)
+		if !ok {
+			return m, nil
+		}
+		if path, ok := m.filepicker.chosen(msg); ok {
+			if msg.String() == " " {
+				m.toggleMarked(path)
+				return m, nil
+			}
+			if len(m.marked) == 0 {
+				return m.startImport([]string{path})
+			}
 		}
+		// Enter on a directory navigates into it even when files are marked.
+		if e, ok := m.filepicker.highlighted(); msg.String() == "enter" && len(m.marked) > 0 && !(ok && e.isDir) {
+			return m.startImport(m.marked)
+		}
+		var cmd tea.Cmd
+		m.filepicker, cmd = m.filepicker.update(msg)
 		return m, cmd
 	}
 
 	return m, nil
 }
 
+// selectID moves the cursor of l to the item with the given ID, if present.
+func selectID(l *list.Model, id string) {
+	if id == "" {
+		return
+	}
+	for i, li := range l.Items() {
+		if it, ok := li.(item); ok && it.id == id {
+			l.Select(i)
+			return
+		}
+	}
+}
+
+// remember saves the history unless --no-history was given. Failing to save
+// it isn't worth interrupting an import for, so errors are ignored.
+func (m model) remember() {
+	if !m.cfg.noHistory {
+		saveHistory(m.history)
+	}
+}
+
+// recentLines is how many lines the recent files take above the file picker.
+func recentLines(h history) int {
+	if len(h.RecentFiles) == 0 {
+		return 0
+	}
+	return len(h.RecentFiles) + 2
+}
+
+// recentView lists the recent files with the keys that import them.
+func (m model) recentView() string {
+	if len(m.history.RecentFiles) == 0 {
+		return ""
+	}
+	lines := []string{"Recent files:"}
+	for i, path := range m.history.RecentFiles {
+		lines = append(lines, ansi.Truncate(fmt.Sprintf("  %d: %s", i+1, path), m.width, "…"))
+	}
+	return m.theme.help.Render(strings.Join(lines, "\n")) + "\n\n"
+}
+
+// currentList returns the selection list of the current state, or nil.
+func (m *model) currentList() *list.Model {
+	switch m.state {
+	case stateTenantSelect:
+		return &m.tenantList
+	case stateApplicationSelect:
+		return &m.appList
+	case stateDeviceProfileSelect:
+		return &m.profileList
+	case stateTemplateSelect:
+		return &m.templateList
+	case stateMulticastSelect:
+		return &m.multicastList
+	case stateBrowse:
+		return &m.browser.list
+	case stateRuns:
+		return &m.runs.list
+	}
+	return nil
+}
+
+// filtering reports whether a filter query is being typed into the current
+// selection list.
+func (m model) filtering() bool {
+	l := m.currentList()
+	return l != nil && l.FilterState() == list.Filtering
+}
+
 func (m model) handleEnter() (tea.Model, tea.Cmd) {
 	switch m.state {
 	case stateConnecting:
-		if m.tokenInput.Value() != "" {
-			m.apiToken = m.tokenInput.Value()
-			return m, func() tea.Msg { return connectMsg{} }
+		if m.tokenInput.Value() == "" {
+			m.status = "An API token is needed; create one under API keys in ChirpStack"
+			return m, nil
 		}
+		m.apiToken = m.tokenInput.Value()
+		m.tokenInput.EchoMode = textinput.EchoPassword
+		m.status = ""
+		return m, func() tea.Msg { return connectMsg{} }
 
 	case stateTenantSelect:
 		if item, ok := m.tenantList.SelectedItem().(item); ok {
+			if item.create {
+				m.tenantForm = newTenantForm()
+				m.state = stateCreateTenant
+				return m, textinput.Blink
+			}
 			m.selectedTenant = item.id
-			return m, m.loadApplications()
+			m.tenantName = item.title
+			m.quota = nil
+			if m.readOnlyToken() && !m.cfg.Mode.ReadOnly() {
+				m.cfg.Mode = importer.ModeCompare
+				m.status = "This token can only read the devices of this tenant, so only the read-only modes are offered"
+			}
+			if m.cfg.Gateways {
+				return m.chooseFiles()
+			}
+			next, cmd := m.startLoading(fmt.Sprintf("Loading applications for tenant %s…", item.title), m.loadApplications())
+			return next, tea.Batch(cmd, m.loadQuota(item.id))
 		}
 
 	case stateApplicationSelect:
 		if item, ok := m.appList.SelectedItem().(item); ok {
+			if item.create {
+				m.appForm = newApplicationForm()
+				m.state = stateCreateApplication
+				return m, textinput.Blink
+			}
 			m.selectedApp = item.id
-			return m, m.loadDeviceProfiles()
+			m.appName = item.title
+			if !m.cfg.Mode.NeedsProfile() {
+				return m.chooseFiles()
+			}
+			return m.startLoading(fmt.Sprintf("Loading device profiles for tenant %s…", m.tenantName), m.loadDeviceProfiles())
 		}
 
 	case stateDeviceProfileSelect:
 		if item, ok := m.profileList.SelectedItem().(item); ok {
+			if item.create {
+				return m.startLoading("Loading device-profile templates…", m.loadTemplates())
+			}
 			m.selectedProfile = item.id
-			m.state = stateFileSelect
-			return m, m.filepicker.Init()
+			m.profileName = item.title
+			m.cfg.LoRaWAN11 = item.lorawan11
+			m.cfg.ProfileRegion = item.region
+			return m.startLoading(fmt.Sprintf("Loading multicast groups of %s…", m.appName), m.loadMulticastGroups())
+		}
+
+	case stateTemplateSelect:
+		return m.selectTemplate()
+
+	case stateBrowse:
+		return m.openDevice()
+
+	case stateRuns:
+		return m.openRun()
+
+	case stateMulticastSelect:
+		if item, ok := m.multicastList.SelectedItem().(item); ok {
+			if item.create {
+				m.groupForm = newGroupForm(m.cfg.ProfileRegion)
+				m.state = stateCreateMulticast
+				return m, textinput.Blink
+			}
+			m.selectedGroup, m.newGroup = item.id, nil
+			m.groupName = ""
+			if item.id != "" {
+				m.groupName = item.title
+			}
+			return m.chooseFiles()
+		}
+	}
+
+	return m, nil
+}
+
+// chooseFiles moves on to the file picker once the selections are complete,
+// remembering them for the next run. A device list given on the command line
+// skips the picker.
+func (m model) chooseFiles() (tea.Model, tea.Cmd) {
+	m.state = stateFileSelect
+
+	m.history.Server = m.serverAddr
+	m.history.TenantID = m.selectedTenant
+	if m.selectedApp != "" {
+		m.history.ApplicationID = m.selectedApp
+	}
+	if m.selectedProfile != "" {
+		m.history.ProfileID = m.selectedProfile
+	}
+	m.remember()
+
+	if m.cfg.input != "" {
+		paths, err := importer.ExpandInput(expandHome(m.cfg.input), m.cfg.Extensions())
+		if err != nil {
+			m.err = err
+			m.state = stateError
+			return m, nil
 		}
+		return m.startImport(paths)
 	}
+	return m, m.filepicker.list()
+}
 
+// switchMode moves on to the next mode. Importing and syncing need a device
+// profile, which is asked for first if deleting skipped it.
+func (m model) switchMode() (tea.Model, tea.Cmd) {
+	// The summary of the last run is rendered for the current mode.
+	m.results = nil
+	m.cfg.Mode = m.cfg.Mode.Next()
+	for m.readOnlyToken() && !m.cfg.Mode.ReadOnly() {
+		m.cfg.Mode = m.cfg.Mode.Next()
+	}
+	if m.cfg.Mode.NeedsProfile() && m.selectedProfile == "" && !m.cfg.ValidateOnly {
+		return m.startLoading(fmt.Sprintf("Loading device profiles for tenant %s…", m.tenantName), m.loadDeviceProfiles())
+	}
 	return m, nil
 }
 
 func (m model) handleConnect() (tea.Model, tea.Cmd) {
-	// Connect to ChirpStack gRPC API using insecure connection (as per docker-compose config)
-	conn, err := grpc.Dial(m.serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if m.client != nil {
+		// Reconnecting after going back to the token input.
+		m.client.Close()
+	}
+	conn, err := dial(m.serverAddr, m.cfg.audit, m.cfg.link, m.cfg.debug)
 	if err != nil {
-		return m, func() tea.Msg {
-			return errorMsg(fmt.Errorf("failed to connect to ChirpStack at %s: %v\nMake sure ChirpStack gRPC API is running on this address", m.serverAddr, err))
-		}
+		return m, func() tea.Msg { return errorMsg(err) }
 	}
 
 	m.client = conn
@@ -299,76 +1911,87 @@ func (m model) handleConnect() (tea.Model, tea.Cmd) {
 	m.appClient = api.NewApplicationServiceClient(conn)
 	m.deviceClient = api.NewDeviceServiceClient(conn)
 	m.profileClient = api.NewDeviceProfileServiceClient(conn)
+	m.templateClient = api.NewDeviceProfileTemplateServiceClient(conn)
+	m.internalClient = api.NewInternalServiceClient(conn)
+	m.multicastClient = api.NewMulticastGroupServiceClient(conn)
+
+	m.server, m.versionWarning = importer.Version{}, ""
+	m.access = tokenAccess{}
+	next, cmd := m.startLoading("Checking what the token may do…", m.probeAccess())
+	return next, tea.Batch(cmd, m.loadVersion())
+}
+
+// startLoading shows a spinner labelled label while cmd fetches a list. The
+// fetch can be retried with the same cmd if it fails.
+func (m model) startLoading(label string, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	m.loadFrom = m.state
+	m.state = stateLoading
+	m.loading = label
+	m.retry = cmd
+	return m, tea.Batch(m.spinner.Tick, cmd)
+}
 
-	return m, m.loadTenants()
+// updateLoadFailed handles keys on the error view of a failed fetch.
+func (m model) updateLoadFailed(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyRetry.matches(m, msg):
+		m.err = nil
+		m.state = stateLoading
+		return m, tea.Batch(m.spinner.Tick, m.retry)
+	case keyLoadBack.matches(m, msg), keyChangeToken.matches(m, msg):
+		m.err = nil
+		m.state = m.loadFrom
+	}
+	return m, nil
 }
 
 func (m model) loadTenants() tea.Cmd {
+	if m.access.kind == tokenTenantKey {
+		return m.loadTenantOfKey()
+	}
 	return func() tea.Msg {
-		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+m.apiToken))
-
-		resp, err := m.tenantClient.List(ctx, &api.ListTenantsRequest{
-			Limit: 100,
-		})
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		items, total, err := m.fetchTenants(ctx, "")
 		if err != nil {
-			return errorMsg(err)
+			return loadFailedMsg{err}
 		}
-
-		var items []item
-		for _, tenant := range resp.Result {
-			items = append(items, item{
-				title: tenant.Name,
-				desc:  tenant.Name,
-				id:    tenant.Id,
-			})
-		}
-
-		return tenantsLoadedMsg(items)
+		return tenantsLoadedMsg{items, total}
 	}
 }
 
 func (m model) loadApplications() tea.Cmd {
 	return func() tea.Msg {
-		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+m.apiToken))
-
-		resp, err := m.appClient.List(ctx, &api.ListApplicationsRequest{
-			TenantId: m.selectedTenant,
-			Limit:    100,
-		})
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		items, total, err := m.fetchApplications(ctx, "")
 		if err != nil {
-			return errorMsg(err)
-		}
-
-		var items []item
-		for _, app := range resp.Result {
-			items = append(items, item{
-				title: app.Name,
-				desc:  app.Description,
-				id:    app.Id,
-			})
+			return loadFailedMsg{err}
 		}
-
-		return appsLoadedMsg(items)
+		return appsLoadedMsg{items, total}
 	}
 }
 
 func (m model) loadDeviceProfiles() tea.Cmd {
 	return func() tea.Msg {
-		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+m.apiToken))
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
 
-		resp, err := m.profileClient.List(ctx, &api.ListDeviceProfilesRequest{
-			TenantId: m.selectedTenant,
-			Limit:    100,
-		})
+		profiles, err := importer.ListDeviceProfiles(ctx, m.profileClient, m.selectedTenant)
 		if err != nil {
-			return errorMsg(err)
+			return loadFailedMsg{err}
 		}
+
 		var items []item
-		for _, profile := range resp.Result {
+		for _, profile := range profiles {
 			items = append(items, item{
-				title: profile.Name,
-				desc:  profile.Name,
-				id:    profile.Id,
+				title:     profile.Name,
+				desc:      profileDescription(profile),
+				id:        profile.Id,
+				lorawan11: importer.IsLoRaWAN11(profile.MacVersion),
+				region:    profile.Region.String(),
 			})
 		}
 
@@ -376,143 +1999,757 @@ func (m model) loadDeviceProfiles() tea.Cmd {
 	}
 }
 
-func (m model) processCSV(filepath string) tea.Cmd {
+// filepickerView renders the file picker, cutting long file names off at the
+// terminal width instead of letting them wrap and push the view off screen.
+func (m model) filepickerView() string {
+	lines := strings.Split(m.filepicker.view(m.theme), "\n")
+	lines = append(lines, m.theme.help.Render(m.filepicker.info()), m.theme.help.Render(m.pickerFilter()))
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, m.width, "…")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pickerFilter describes which files the file picker shows.
+func (m model) pickerFilter() string {
+	shown := "All files"
+	if m.filepicker.allowed != nil {
+		shown = "Showing " + strings.Join(m.filepicker.allowed, ", ")
+	}
+	if m.filepicker.showHidden {
+		shown += " • hidden files shown"
+	} else {
+		shown += " • hidden files hidden"
+	}
+	if m.filepicker.newest {
+		return shown + " • newest first"
+	}
+	return shown + " • by name"
+}
+
+// sortHelp describes keySortFiles by the order it switches to.
+func (m model) sortHelp() (string, string) {
+	if m.filepicker.newest {
+		return "o", "sort by name"
+	}
+	return "o", "newest first"
+}
+
+// hiddenHelp describes keyHidden by what it switches to.
+func (m model) hiddenHelp() (string, string) {
+	if m.filepicker.showHidden {
+		return ".", "hide hidden files"
+	}
+	return ".", "show hidden files"
+}
+
+// allFilesHelp describes keyAllFiles by what it switches to.
+func (m model) allFilesHelp() (string, string) {
+	if m.filepicker.allowed == nil {
+		return "*", "only device lists"
+	}
+	return "*", "show all files"
+}
+
+// updateURLInput handles keys while the URL input replaces the file picker.
+func (m model) updateURLInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyInputBack.matches(m, msg):
+		m.enteringURL = false
+		m.urlInput.Blur()
+		return m, nil
+	case keyDownload.matches(m, msg):
+		u := strings.TrimSpace(m.urlInput.Value())
+		if !importer.IsURL(u) {
+			m.status = "Enter an http:// or https:// URL"
+			return m, nil
+		}
+		m.enteringURL = false
+		m.urlInput.Blur()
+		return m.startImport([]string{u})
+	}
+
+	var cmd tea.Cmd
+	m.urlInput, cmd = m.urlInput.Update(msg)
+	return m, cmd
+}
+
+func (m *model) toggleMarked(path string) {
+	if i := slices.Index(m.marked, path); i >= 0 {
+		m.marked = slices.Delete(m.marked, i, i+1)
+	} else {
+		m.marked = append(m.marked, path)
+	}
+}
+
+// startImport switches to the processing screen and imports paths in the
+// background, reporting progress through m.events.
+func (m model) startImport(paths []string) (tea.Model, tea.Cmd) {
+	m.history.addRecent(paths)
+	m.remember()
+	m.cfg.ServerNames, m.cfg.Renames, m.cfg.ServerDevices = nil, nil, nil
+	m.selection = nil
+	return m.readPaths(paths)
+}
+
+// readPaths reads the device lists at paths for the preview.
+func (m model) readPaths(paths []string) (tea.Model, tea.Cmd) {
+	m.events = make(chan tea.Msg)
+	m.done, m.total, m.current = 0, 0, ""
+	m.state = stateProcessing
+	m.stopRun = nil
+	m.clock = nil
+	m.pause, m.paused = nil, false
+
+	go m.readBatch(paths, m.events)
+	return m, waitForEvent(m.events)
+}
+
+// inputPaths returns the sources of the inputs being previewed.
+func (m model) inputPaths() []string {
+	paths := make([]string, len(m.inputs))
+	for i, in := range m.inputs {
+		paths[i] = in.Source
+	}
+	return paths
+}
+
+func waitForEvent(events <-chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		file, err := os.Open(filepath)
-		if err != nil {
-			return errorMsg(err)
+		return <-events
+	}
+}
+
+// readProgressInterval is how many rows are read between progress updates
+// while validating device lists.
+const readProgressInterval = 500
+
+// readBatch validates paths and sends the result to events for the preview.
+func (m model) readBatch(paths []string, events chan<- tea.Msg) {
+	inputs := importer.NewInputs(paths)
+	for _, in := range inputs {
+		if in.Source == "-" {
+			in.Data = m.stdin
+		}
+		// Lists made up in memory, such as the devices of an application,
+		// have no file to read again.
+		for _, prev := range m.inputs {
+			if prev.Source == in.Source && prev.Data != nil && !importer.IsURL(prev.Source) {
+				in.Name, in.Data = prev.Name, prev.Data
+			}
+		}
+	}
+	m.previewInputs(inputs, paths, events)
+}
+
+// previewInputs reads the first rows of inputs for the preview. paths are
+// where they were read from, to ask for a column mapping with.
+func (m model) previewInputs(inputs []*importer.Input, paths []string, events chan<- tea.Msg) {
+	if m.cfg.Gateways {
+		if err := importer.ReadGatewayInputs(context.Background(), inputs, m.cfg.ListOptions, previewRows); err != nil {
+			events <- errorMsg(err)
+			return
 		}
-		defer file.Close()
+		events <- inputsReadMsg(inputs)
+		return
+	}
 
-		reader := csv.NewReader(file)
-		records, err := reader.ReadAll()
-		if err != nil {
-			return errorMsg(err)
+	read := 0
+	err := importer.ReadInputs(context.Background(), inputs, m.cfg.ListOptions, previewRows, func(in *importer.Input) {
+		if read++; read%readProgressInterval == 0 {
+			events <- importProgressMsg{done: read, current: in.Source}
 		}
+	})
+	var hErr *importer.HeaderError
+	if errors.As(err, &hErr) {
+		events <- needMappingMsg{err: hErr, paths: paths}
+		return
+	} else if err != nil {
+		events <- errorMsg(err)
+		return
+	}
+
+	events <- inputsReadMsg(inputs)
+}
+
+// importAnother returns to the file picker after an import, keeping the
+// connection and the selected application and profile. The summary of the
+// last import stays available until the next one starts.
+func (m model) importAnother() (tea.Model, tea.Cmd) {
+	m.state = stateFileSelect
+	m.err = nil
+	m.status = ""
+	m.marked = nil
+	m.inputs = nil
+	m.plan = nil
+	m.undo = nil
+	m.done, m.total, m.current = 0, 0, ""
+	return m, m.filepicker.list()
+}
 
-		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+m.apiToken))
+// startOver returns to tenant selection after an import, keeping the
+// connection and token. The tenants are fetched again so that their device
+// counts include the import.
+func (m model) startOver() (tea.Model, tea.Cmd) {
+	m.err = nil
+	m.status = ""
+	m.marked = nil
+	m.inputs = nil
+	m.results = nil
+	m.plan, m.unlisted = nil, importer.Result{}
+	m.undo = nil
+	m.done, m.total, m.current = 0, 0, ""
+	m.selectedTenant, m.selectedApp, m.selectedProfile, m.selectedGroup = "", "", "", ""
+	m.newGroup = nil
+	m.tenantName, m.appName, m.profileName, m.groupName = "", "", "", ""
+	m.cfg.LoRaWAN11 = false
+	m.quota = nil
+
+	m.state = stateTenantSelect
+	return m.startLoading(fmt.Sprintf("Loading tenants from %s…", m.serverAddr), m.loadTenants())
+}
 
-		created := 0
-		// Skip header row if exists
-		start := 0
-		if len(records) > 0 && !isHexString(records[0][0]) {
-			start = 1
+// startCreate switches to the processing screen and creates the devices of
+// the previewed inputs in the background.
+func (m model) startCreate() (tea.Model, tea.Cmd) {
+	if m.denied != nil {
+		// The token can't, as the confirmation says.
+		return m, nil
+	}
+	if m.lock == nil {
+		var ok bool
+		if m, ok = m.takeLock(false); !ok {
+			return m, nil
 		}
+	}
+	m.results = nil
+	m.undo = nil
+	m.runID, m.run = newRunID(time.Now()), nil
+	m.events = make(chan tea.Msg)
+	m.done, m.total, m.current = 0, 0, ""
+	m.state = stateProcessing
+	m.logEntries, m.report = nil, nil
+	m.retrying, m.retries, m.reportIndex = false, 0, nil
+	m.corrections, m.corrected = nil, nil
+	m.shared = ""
+	m.groupWarning = ""
+	m.resizeLog()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	m.stopRun = cancel
+	m.clock, m.chunks = newThroughput(time.Now()), nil
+	m.pause, m.paused, m.held = &importer.PauseGate{}, false, false
+	m.workers, m.pace = importer.NewWorkerPool(m.cfg.concurrency), importer.NewPacer(m.cfg.rate)
+	go m.createDevices(ctx, m.inputs, m.events)
+	return m, waitForEvent(m.events)
+}
 
-		for i := start; i < len(records); i++ {
-			record := records[i]
-			if len(record) < 2 {
-				continue // Skip invalid records
-			}
+// createDevices imports inputs, sending progress and the final result to
+// events. Failed rows are written next to each source file, or to the
+// current directory for a list that was piped in or downloaded. Cancelling
+// ctx stops the import after the row in flight.
+func (m model) createDevices(ctx context.Context, inputs []*importer.Input, events chan<- tea.Msg) {
+	if m.cfg.Gateways {
+		m.createGateways(ctx, inputs, events)
+		return
+	}
 
-			devEui := record[0]
-			name := record[1]
-			description := ""
-			if len(record) > 2 {
-				description = record[2]
-			}
+	total := 0
+	for _, in := range inputs {
+		total += in.Count
+	}
+	var unlisted []*api.DeviceListItem
+	if m.cfg.Mode == importer.ModeSync && m.cfg.syncDelete {
+		unlisted = m.plan.remove
+		total += len(unlisted)
+	}
 
-			// Create device
-			_, err := m.deviceClient.Create(ctx, &api.CreateDeviceRequest{
-				Device: &api.Device{
-					DevEui:          devEui,
-					Name:            name,
-					Description:     description,
-					ApplicationId:   m.selectedApp,
-					DeviceProfileId: m.selectedProfile,
-					IsDisabled:      false,
-				},
-			})
+	imp := m.newImporter(total, events)
+	imp.Limit = m.createLimit
+	if m.cfg.Mode.Creates() {
+		imp.MulticastGroup = m.createGroup(ctx, events)
+	}
+	if m.cfg.Mode.Creates() && !m.cfg.dryRun {
+		j, err := createJournal(m.runID, m.serverAddr, m.selectedApp)
+		if err != nil {
+			slog.Error("Failed to create the undo journal", "run", m.runID, "err", err)
+		}
+		imp.Journal = j
+		defer j.Close()
+	}
+	results, err := imp.ImportFiles(ctx, inputs, importer.NewBatch(m.cfg.ListOptions, inputs).Scan, m.failuresPath)
+	if err != nil {
+		imp.Events.Finish(importer.RunFinished{Err: err})
+		return
+	}
+	imp.Events.Flush()
+	m.verifyDevices(ctx, imp, results, events)
+
+	var removed importer.Result
+	if ctx.Err() == nil {
+		if removed, err = imp.RemoveUnlisted(context.Background(), unlisted); err != nil {
+			imp.Events.Finish(importer.RunFinished{Err: err})
+			return
+		}
+	}
+	imp.Events.Finish(importer.RunFinished{Results: results, Report: imp.Report(), Unlisted: removed})
+}
 
-			if err != nil {
-				// Log error but continue with other devices
-				log.Printf("Failed to create device %s: %v", devEui, err)
-			} else {
-				created++
+// eventBuffer is how many events the interactive UI lets wait while it
+// draws. Rows beyond it only drop out of the progress; the report of the
+// run comes with importer.RunFinished.
+const eventBuffer = 64
+
+// newImporter returns an importer for the selections and options of m,
+// whose events are passed on to events, starting with a RunStarted for total
+// rows; the caller ends the stream with importer.RunFinished and the report
+// of the importer.
+func (m model) newImporter(total int, events chan<- tea.Msg) *importer.Importer {
+	logger := slog.With("run", m.runID)
+	stream := importer.NewEventStream(eventBuffer, func(e importer.Event) { events <- e })
+	stream.Emit(importer.RunStarted{Total: total})
+	return &importer.Importer{
+		Log:               logger,
+		Devices:           m.deviceClient,
+		Apps:              m.appClient,
+		Profiles:          m.profileClient,
+		Server:            m.server,
+		Multicast:         m.multicastClient,
+		Token:             m.apiToken,
+		TenantID:          m.selectedTenant,
+		ApplicationID:     m.selectedApp,
+		ProfileID:         m.selectedProfile,
+		MulticastGroup:    m.selectedGroup,
+		Downlink:          m.cfg.downlink,
+		GenerateKeys:      m.cfg.GenerateKeys,
+		OverwriteKeys:     m.cfg.overwriteKeys,
+		TargetApplication: m.cfg.TargetApplication,
+		Mode:              m.cfg.Mode,
+		DryRun:            m.cfg.dryRun,
+		Consent:           m.consent,
+		Audit:             m.cfg.audit,
+		Pause:             m.pause,
+		Pool:              m.workers,
+		Pace:              m.pace,
+		MaxFailures:       m.cfg.maxFailures,
+		ChunkSize:         m.cfg.chunkSize,
+		Breaker:           importer.NewBreaker(m.cfg.breakerThreshold),
+		OnTrip: func(_ context.Context, t importer.Tripped) error {
+			m.pause.Pause()
+			events <- breakerTrippedMsg(t)
+			return nil
+		},
+		OnRow: func(source string, row importer.Row, err error) {
+			if err == nil && !m.cfg.dryRun {
+				logger.Info(m.cfg.Mode.PastTense()+" the device", append(importer.RowAttrs(row), "name", row.Name, "source", source)...)
 			}
-		}
+		},
+		Existing: m.existing(),
+		Events:   stream,
+	}
+}
 
-		return devicesCreatedMsg(created)
+// failuresPath returns where the failed rows of source are written: next to
+// the file, or in the current directory for a list that was piped in or
+// downloaded.
+func (m model) failuresPath(source string) string {
+	if path := failuresPath(source, m.cfg.failuresFile); path != "" {
+		return path
+	}
+	if importer.IsURL(source) {
+		return "download.failures.csv"
 	}
+	return "stdin.failures.csv"
 }
 
-func isHexString(s string) bool {
-	if len(s) == 0 {
-		return false
+// header renders the title of a screen above a breadcrumb of the server and
+// the selections made so far, so they stay visible on every later screen.
+func (m model) header(title string) string {
+	parts := []string{m.serverAddr}
+	switch {
+	case m.cfg.ValidateOnly:
+		parts[0] = "Offline, validation only"
+	case m.server.Known():
+		parts[0] += " (ChirpStack " + m.server.String() + ")"
 	}
-	for _, c := range s {
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
-			return false
+	if m.tenantName != "" {
+		tenant := "Tenant: " + m.tenantName
+		if m.readOnlyToken() {
+			tenant += " (read-only)"
 		}
+		parts = append(parts, tenant)
+	}
+	if m.cfg.Gateways {
+		parts = append(parts, "Gateways")
+	}
+	if m.appName != "" {
+		parts = append(parts, "App: "+m.appName)
 	}
-	return true
+	if m.profileName != "" {
+		parts = append(parts, "Profile: "+m.profileName)
+	}
+	if m.groupName != "" {
+		parts = append(parts, "Group: "+m.groupName)
+	}
+
+	crumbs := ansi.Truncate(strings.Join(parts, " ▸ "), m.width-m.theme.breadcrumb.GetHorizontalFrameSize()-2, "…")
+	return m.theme.title.Render(title) + "\n" + m.theme.breadcrumb.Render(crumbs)
 }
 
 func (m model) View() string {
+	if m.showHelp {
+		return m.helpOverlayView()
+	}
+
 	switch m.state {
 	case stateConnecting:
 		return fmt.Sprintf(
-			"%s\n\n%s\n\n%s",
-			titleStyle.Render("ChirpStack Device Manager"),
+			"%s\n\n%s\n\n%s\n\n%s",
+			m.header("ChirpStack Device Manager"),
 			m.tokenInput.View(),
-			helpStyle.Render("Press Enter to connect • Press q to quit"),
+			m.theme.help.Render(m.status),
+			m.helpView(),
 		)
 
 	case stateTenantSelect:
+		var warning string
+		if m.versionWarning != "" {
+			warning = m.theme.warning.Render("⚠ "+m.versionWarning) + "\n\n"
+		}
 		return fmt.Sprintf(
-			"%s\n\n%s\n\n%s",
-			titleStyle.Render("ChirpStack Device Manager"),
+			"%s\n\n%s%s\n\n%s",
+			m.header("ChirpStack Device Manager"),
+			warning,
 			m.tenantList.View(),
-			helpStyle.Render("↑/↓: navigate • Enter: select • q: quit"),
+			m.helpView(),
 		)
 
 	case stateApplicationSelect:
 		return fmt.Sprintf(
 			"%s\n\n%s\n\n%s",
-			titleStyle.Render("ChirpStack Device Manager"),
+			m.header("ChirpStack Device Manager"),
 			m.appList.View(),
-			helpStyle.Render("↑/↓: navigate • Enter: select • q: quit"),
+			m.helpView(),
 		)
 
 	case stateDeviceProfileSelect:
 		return fmt.Sprintf(
 			"%s\n\n%s\n\n%s",
-			titleStyle.Render("ChirpStack Device Manager"),
+			m.header("ChirpStack Device Manager"),
 			m.profileList.View(),
-			helpStyle.Render("↑/↓: navigate • Enter: select • q: quit"),
+			m.helpView(),
 		)
 
-	case stateFileSelect:
+	case stateBrowse:
+		return m.browseView()
+
+	case stateDeviceDetail:
+		return m.deviceDetailView()
+
+	case stateRuns:
+		return m.runsView()
+
+	case stateTemplateSelect:
 		return fmt.Sprintf(
 			"%s\n\n%s\n\n%s",
-			titleStyle.Render("Select CSV File"),
-			m.filepicker.View(),
-			helpStyle.Render("Navigate and press Enter to select • Press q to quit"),
+			m.header("ChirpStack Device Manager"),
+			m.templateList.View(),
+			m.helpView(),
+		)
+
+	case stateMulticastSelect:
+		return fmt.Sprintf(
+			"%s\n\n%s\n\n%s",
+			m.header("ChirpStack Device Manager"),
+			m.multicastList.View(),
+			m.helpView(),
+		)
+
+	case stateFileSelect:
+		if m.enteringPath {
+			var status string
+			if m.status != "" {
+				status = "\n\n" + m.theme.help.Render(m.status)
+			}
+			return fmt.Sprintf(
+				"%s\n\n%s%s\n\n%s",
+				m.header("Open File"),
+				m.pathInput.View(),
+				status,
+				m.helpView(),
+			)
+		}
+		if m.enteringFilter {
+			return m.filterInputView()
+		}
+		if m.enteringURL {
+			var status string
+			if m.status != "" {
+				status = "\n\n" + m.theme.status.Render(m.status)
+			}
+			return fmt.Sprintf(
+				"%s\n\n%s%s\n\n%s",
+				m.header("Fetch from URL"),
+				m.urlInput.View(),
+				status,
+				m.helpView(),
+			)
+		}
+
+		title := "Select CSV File"
+		switch m.cfg.Mode {
+		case importer.ModeDelete:
+			title = "Select Devices to Delete"
+		case importer.ModeSync:
+			title = "Select Devices to Sync"
+		case importer.ModeCompare:
+			title = "Select Devices to Compare"
+		case importer.ModeStatus:
+			title = "Select Devices to Check"
+		case importer.ModeToggle:
+			title = "Select Devices to Enable or Disable"
+		case importer.ModeUpdate:
+			title = "Select Devices to Update"
+		case importer.ModeMove:
+			title = "Select Devices to Move"
+		case importer.ModeRotate:
+			title = "Select Devices to Rotate Keys"
+		case importer.ModeQR:
+			title = "Select Devices for QR Codes"
+		}
+		if m.cfg.Gateways {
+			title = "Select Gateway List"
+		}
+		var marked string
+		if len(m.marked) > 0 {
+			names := make([]string, len(m.marked))
+			for i, path := range m.marked {
+				names[i] = filepath.Base(path)
+			}
+			marked = "\n" + m.theme.status.Render(fmt.Sprintf("Marked %d: %s", len(m.marked), strings.Join(names, ", ")))
+		}
+		if m.status != "" {
+			marked += "\n" + m.theme.help.Render(m.status)
+		}
+		return fmt.Sprintf(
+			"%s\n\n%s%s\n\n%s",
+			m.header(title),
+			m.recentView()+m.filepickerView(),
+			marked,
+			m.helpView(),
 		)
 
+	case stateColumnMapping:
+		return m.mappingView()
+
+	case stateCreateTenant:
+		return m.tenantFormView()
+
+	case stateCreateApplication:
+		return m.appFormView()
+
+	case stateCreateMulticast:
+		return m.groupFormView()
+
+	case stateExport:
+		return m.exportView()
+
+	case statePreview:
+		return m.previewView()
+
+	case stateSyncPlan:
+		return m.planView()
+
+	case stateCompare:
+		return m.compareView()
+
+	case stateStatus:
+		return m.statusView()
+
+	case stateConfirm:
+		return m.confirmView()
+
 	case stateProcessing:
+		status := "Reading device lists..."
+		if m.done > 0 && m.total == 0 {
+			status = fmt.Sprintf("Reading device lists: row %d", m.done)
+			if m.current != "" {
+				status += " • " + filepath.Base(m.current)
+			}
+		}
+		if m.total > 0 {
+			verb := m.cfg.Mode.Gerund()
+			if m.cfg.dryRun {
+				verb = "Checking"
+			}
+			status = fmt.Sprintf("%s %s: %d/%d", verb, m.noun(), m.done, m.total) + m.rateView() + m.tuningView() + m.chunkView()
+			if m.current != "" {
+				status += " • " + filepath.Base(m.current)
+			}
+		}
+		if m.verifying {
+			status = fmt.Sprintf("Verifying %d devices: %d/%d", m.total, m.done, m.total)
+		}
+		if m.paused {
+			status = fmt.Sprintf("PAUSED — %d/%d", m.done, m.total)
+			if !m.held {
+				status += ", finishing the rows in flight…"
+			}
+		}
+		if m.stopping {
+			status = fmt.Sprintf("Stopping after %d/%d %s, writing the failed rows and undo journal…", m.done, m.total, m.noun())
+		}
+		percent := 0.0
+		if m.total > 0 {
+			percent = float64(m.done) / float64(m.total)
+		}
 		return fmt.Sprintf(
-			"%s\n\n%s",
-			titleStyle.Render("Processing..."),
-			statusStyle.Render("Creating devices from CSV file..."),
+			"%s\n\n%s\n\n%s\n%s\n\n%s",
+			m.header("Processing..."),
+			m.progress.ViewAs(percent),
+			m.reconnectingView()+m.trippedView()+m.theme.status.Render(status),
+			m.logPaneView(),
+			m.helpView(),
 		)
 
 	case stateComplete:
+		title := "Complete!"
+		if m.abortedBy() != nil {
+			title = "Aborted"
+		}
 		return fmt.Sprintf(
 			"%s\n\n%s\n\n%s",
-			titleStyle.Render("Complete!"),
-			statusStyle.Render(fmt.Sprintf("Successfully created %d devices", m.devicesCreated)),
-			helpStyle.Render("Press q to quit"),
+			m.header(title),
+			m.abortView()+m.summaryView()+m.timingView()+m.chunksView()+m.auditView()+m.sharedView()+"\n"+m.logPaneView(),
+			m.helpView(),
+		)
+
+	case stateResults:
+		return m.resultsView()
+
+	case stateUndo:
+		return m.undoView()
+
+	case stateQRCodes:
+		return m.qrCodesView()
+
+	case stateLoading:
+		return fmt.Sprintf(
+			"%s\n\n%s %s\n\n%s",
+			m.header("ChirpStack Device Manager"),
+			m.spinner.View(),
+			m.loading,
+			m.helpView(),
+		)
+
+	case stateLoadFailed:
+		return fmt.Sprintf(
+			"%s\n\n%s\n%s\n\n%s",
+			m.header("Error"),
+			strings.TrimSuffix(m.loading, "…")+" failed:",
+			m.theme.status.Render(redact.Secrets(m.err.Error())),
+			m.helpView(),
 		)
 
 	case stateError:
 		return fmt.Sprintf(
 			"%s\n\n%s\n\n%s",
-			titleStyle.Render("Error"),
-			statusStyle.Render(fmt.Sprintf("Error: %v", m.err)),
-			helpStyle.Render("Press q to quit"),
+			m.header("Error"),
+			m.theme.status.Render("Error: "+importer.DescribeError(m.err)),
+			m.helpView(),
 		)
 	}
 
 	return ""
 }
+
+// summaryView renders the outcome of the last import, broken down per file
+// when several files were imported.
+func (m model) summaryView() string {
+	switch m.cfg.Mode {
+	case importer.ModeDelete:
+		return m.deleteSummaryView()
+	case importer.ModeToggle:
+		return m.toggleSummaryView()
+	case importer.ModeUpdate:
+		return m.updateSummaryView()
+	case importer.ModeMove:
+		return m.moveSummaryView()
+	case importer.ModeRotate:
+		return m.rotateSummaryView()
+	case importer.ModeSync:
+		return m.syncSummaryView() + m.degradedSummary() + m.groupSummary() + m.downlinkSummary() + m.verifySummary()
+	}
+
+	var created, failed, invalid, rekeyed, skipped int
+	var details, keyFiles []string
+	for _, fr := range m.results {
+		created += fr.Result.Created
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+		rekeyed += fr.Result.KeysUpdated
+		skipped += len(fr.Result.Skipped)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+			details = append(details, fmt.Sprintf("%s%d created, %d failed, %d invalid",
+				prefix, fr.Result.Created, len(fr.Result.Failures), len(fr.Input.Invalid)))
+		}
+		details = append(details, m.theme.help.Render(prefix+"parsed as "+fr.Input.Format))
+
+		for _, w := range fr.Input.Warnings {
+			details = append(details, m.theme.help.Render("⚠ "+prefix+w))
+		}
+		for i, msg := range fr.Input.Invalid {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more invalid rows", prefix, len(fr.Input.Invalid)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render("✗ "+prefix+msg))
+		}
+		if fr.FailuresFile != "" {
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%d %s failed, see %s", prefix, len(fr.Result.Failures), m.noun(), fr.FailuresFile)))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %sstopped early: %s", prefix, importer.DescribeError(fr.Stopped))))
+		}
+		for i, f := range fr.Result.Skipped {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("⚠ %s…and %d more skipped rows", prefix, len(fr.Result.Skipped)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render(fmt.Sprintf("⚠ %s%s %s", prefix, f.Row.DevEUI, importer.DescribeError(f.Err))))
+		}
+		if fr.KeysFile != "" {
+			keyFiles = append(keyFiles, fmt.Sprintf("%s (%d keys)", fr.KeysFile, len(fr.Result.Keys)))
+		}
+	}
+
+	status := fmt.Sprintf("Successfully created %d %s", created, m.noun())
+	if m.cfg.dryRun {
+		status = fmt.Sprintf("Dry run: %d %s would be created", created, m.noun())
+	}
+	if rekeyed > 0 {
+		status += fmt.Sprintf(" • %d existing devices given their keys", rekeyed)
+	}
+	if skipped > 0 {
+		status += fmt.Sprintf(" • %d skipped", skipped)
+	}
+	if failed > 0 || invalid > 0 {
+		status += fmt.Sprintf(" • %d failed • %d invalid", failed, invalid)
+	}
+	if m.retries > 0 {
+		status += fmt.Sprintf(" • failed rows retried %d×", m.retries)
+	}
+	view := m.theme.status.Render(status) + "\n\n" + strings.Join(details, "\n") + m.degradedSummary() + m.groupSummary() + m.downlinkSummary() + m.verifySummary()
+
+	if len(keyFiles) > 0 {
+		view += "\n\n" + m.theme.warning.Render("⚠ GENERATED APPKEYS ARE SECRETS") + "\n" +
+			"Generated AppKeys were written in plain text to:\n  " + strings.Join(keyFiles, "\n  ") + "\n" +
+			"Load them into your key store and onto the devices, then delete the file."
+	}
+	return view
+}
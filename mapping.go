@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// appDirName is the directory used under the user's config and data dirs.
+const appDirName = "chirpstack-device-adder"
+
+// mappingsDir returns the directory of the mapping presets, one JSON file
+// each, so that they can be shared and kept under version control.
+func mappingsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName, "mappings"), nil
+}
+
+// mappingFileName returns the name of the file of the preset called name.
+func mappingFileName(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, strings.TrimSpace(name))
+	return strings.Trim(slug, ".") + ".json"
+}
+
+// loadMappingFile reads the preset at path. A preset without a name is
+// named after its file.
+func loadMappingFile(path string) (importer.ColumnMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return importer.ColumnMapping{}, err
+	}
+	var cm importer.ColumnMapping
+	if err := json.Unmarshal(data, &cm); err != nil {
+		return importer.ColumnMapping{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if cm.Name == "" {
+		cm.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	cm.Path = path
+	return cm, nil
+}
+
+// loadMappings reads the saved mapping presets, sorted by name. A missing
+// directory is not an error.
+func loadMappings() ([]importer.ColumnMapping, error) {
+	dir, err := mappingsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var mappings []importer.ColumnMapping
+	for _, path := range paths {
+		cm, err := loadMappingFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, cm)
+	}
+	slices.SortFunc(mappings, func(a, b importer.ColumnMapping) int { return strings.Compare(a.Name, b.Name) })
+	return mappings, nil
+}
+
+// saveMapping saves cm as a preset, replacing any preset with the same name
+// or header signature.
+func saveMapping(cm importer.ColumnMapping) error {
+	mappings, err := loadMappings()
+	if err != nil {
+		return err
+	}
+	dir, err := mappingsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, m := range mappings {
+		if m.Name == cm.Name || m.Signature == cm.Signature {
+			if err := os.Remove(m.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return writeMapping(filepath.Join(dir, mappingFileName(cm.Name)), cm)
+}
+
+func writeMapping(path string, cm importer.ColumnMapping) error {
+	data, err := json.MarshalIndent(cm, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// resolveMapping returns the preset --mapping names: a file, or a saved
+// preset by name.
+func resolveMapping(arg string, saved []importer.ColumnMapping) (*importer.ColumnMapping, error) {
+	if fi, err := os.Stat(arg); err == nil && !fi.IsDir() {
+		cm, err := loadMappingFile(arg)
+		return &cm, err
+	}
+	names := make([]string, len(saved))
+	for i, cm := range saved {
+		if cm.Name == arg {
+			return &cm, nil
+		}
+		names[i] = cm.Name
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no mapping preset or file %q, and no presets are saved", arg)
+	}
+	return nil, fmt.Errorf("no mapping preset or file %q (saved presets: %s)", arg, strings.Join(names, ", "))
+}
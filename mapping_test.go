@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+func TestSaveMapping(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir, err := mappingsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vendor := importer.ColumnMapping{Name: "Vendor A", Signature: "serial|label", Columns: map[string]string{"dev_eui": "Serial", "name": "Label"}}
+	other := importer.ColumnMapping{Name: "Vendor B", Signature: "eui|title", Columns: map[string]string{"dev_eui": "EUI", "name": "Title"}}
+	for _, cm := range []importer.ColumnMapping{vendor, other} {
+		if err := saveMapping(cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A preset of the same header replaces the one saved under another name.
+	renamed := vendor
+	renamed.Name = "Vendor A v2"
+	if err := saveMapping(renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	mappings, err := loadMappings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, cm := range mappings {
+		names = append(names, cm.Name)
+		if filepath.Dir(cm.Path) != dir {
+			t.Errorf("%s loaded from %q, want a file in %s", cm.Name, cm.Path, dir)
+		}
+	}
+	if strings.Join(names, ", ") != "Vendor A v2, Vendor B" {
+		t.Errorf("presets = %q, want Vendor A v2 and Vendor B", names)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "vendor-b.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), dir) {
+		t.Errorf("preset file has its own path:\n%s", data)
+	}
+}
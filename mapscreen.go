@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// mappingScreen lets the user assign the columns of a file with unrecognized
+// headers to device fields.
+type mappingScreen struct {
+	err    *importer.HeaderError
+	paths  []string // the batch to re-import once the mapping is saved
+	assign []int    // column index per entry of importer.ColumnDefs, -1 for none
+	cursor int
+	preset int // saved preset last applied, -1 for none
+
+	naming    bool // asking for the name to save the mapping under
+	nameInput textinput.Model
+	status    string
+}
+
+func newMappingScreen(err *importer.HeaderError, paths []string) *mappingScreen {
+	ms := &mappingScreen{err: err, paths: paths, assign: make([]int, len(importer.ColumnDefs)), preset: -1}
+	for i := range ms.assign {
+		ms.assign[i] = -1
+	}
+
+	ms.nameInput = textinput.New()
+	ms.nameInput.Placeholder = "e.g. erp-export"
+	ms.nameInput.CharLimit = 64
+	ms.nameInput.Width = 40
+	return ms
+}
+
+// mapping returns the column mapping as currently assigned.
+func (ms *mappingScreen) mapping() importer.ColumnMapping {
+	cm := importer.ColumnMapping{
+		Name:      strings.TrimSpace(ms.nameInput.Value()),
+		Signature: importer.HeaderSignature(ms.err.Header),
+		Columns:   make(map[string]string),
+	}
+	for i, col := range ms.assign {
+		if col >= 0 {
+			cm.Columns[importer.ColumnDefs[i].Name] = strings.TrimSpace(ms.err.Header[col])
+		}
+	}
+	return cm
+}
+
+// applyPreset assigns the columns as the next of the saved presets does,
+// by their header names, and offers to save the mapping under its name.
+func (ms *mappingScreen) applyPreset(presets []importer.ColumnMapping) {
+	ms.preset = (ms.preset + 1) % len(presets)
+	cm := presets[ms.preset]
+	for i, def := range importer.ColumnDefs {
+		ms.assign[i] = -1
+		if h, ok := cm.Columns[def.Name]; ok {
+			ms.assign[i] = slices.IndexFunc(ms.err.Header, func(col string) bool { return strings.TrimSpace(col) == h })
+		}
+	}
+	ms.nameInput.SetValue(cm.Name)
+	ms.status = fmt.Sprintf("Preset %q applied; enter saves it for files with these columns", cm.Name)
+}
+
+// presetHelp describes keyMapPreset with the preset it applies.
+func (m model) presetHelp() (string, string) {
+	if ms := m.mapping; ms != nil && len(m.cfg.Mappings) > 0 {
+		return "p", fmt.Sprintf("apply preset %q", m.cfg.Mappings[(ms.preset+1)%len(m.cfg.Mappings)].Name)
+	}
+	return "p", "apply a saved preset"
+}
+
+// updateMapping handles keys on the column-mapping screen.
+func (m model) updateMapping(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	ms := m.mapping
+
+	if ms.naming {
+		switch {
+		case keyForceQuit.matches(m, msg):
+			return m, tea.Quit
+		case keyNameBack.matches(m, msg):
+			ms.naming = false
+			ms.nameInput.Blur()
+			return m, nil
+		case keyNameImport.matches(m, msg):
+			cm := ms.mapping()
+			if cm.Name == "" {
+				ms.status = "Enter a name for the mapping"
+				return m, nil
+			}
+			if err := saveMapping(cm); err != nil {
+				ms.status = fmt.Sprintf("Saving mapping failed: %v", err)
+				return m, nil
+			}
+			if mappings, err := loadMappings(); err == nil {
+				m.cfg.Mappings = mappings
+			} else {
+				m.cfg.Mappings = append(m.cfg.Mappings, cm)
+			}
+			m.mapping = nil
+			return m.startImport(ms.paths)
+		}
+
+		var cmd tea.Cmd
+		ms.nameInput, cmd = ms.nameInput.Update(msg)
+		return m, cmd
+	}
+
+	columns := len(ms.err.Header)
+	switch {
+	case keyQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyMapBack.matches(m, msg):
+		m.mapping = nil
+		m.state = stateFileSelect
+		return m, m.filepicker.list()
+	case keyMapField.matches(m, msg):
+		switch msg.String() {
+		case "up", "k":
+			if ms.cursor > 0 {
+				ms.cursor--
+			}
+		default:
+			if ms.cursor < len(importer.ColumnDefs)-1 {
+				ms.cursor++
+			}
+		}
+	case keyMapColumn.matches(m, msg):
+		switch msg.String() {
+		case "right", "l":
+			// Cycle through the columns and back to "not mapped".
+			ms.assign[ms.cursor]++
+			if ms.assign[ms.cursor] >= columns {
+				ms.assign[ms.cursor] = -1
+			}
+		default:
+			ms.assign[ms.cursor]--
+			if ms.assign[ms.cursor] < -1 {
+				ms.assign[ms.cursor] = columns - 1
+			}
+		}
+	case keyMapPreset.matches(m, msg):
+		ms.applyPreset(m.cfg.Mappings)
+	case keySaveMap.matches(m, msg):
+		for i, def := range importer.ColumnDefs {
+			if def.Required && ms.assign[i] < 0 {
+				ms.status = fmt.Sprintf("%s must be mapped to a column", def.Name)
+				return m, nil
+			}
+		}
+		ms.status = ""
+		ms.naming = true
+		return m, ms.nameInput.Focus()
+	}
+	return m, nil
+}
+
+func (m model) mappingView() string {
+	ms := m.mapping
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Columns of %s: %s\n\n", filepath.Base(ms.err.Source), strings.Join(ms.err.Header, ", "))
+
+	width := 0
+	for _, def := range importer.ColumnDefs {
+		width = max(width, len(def.Name)+1)
+	}
+	for i, def := range importer.ColumnDefs {
+		cursor := "  "
+		if i == ms.cursor {
+			cursor = "> "
+		}
+
+		column, preview := "—", ""
+		if col := ms.assign[i]; col >= 0 {
+			column = ms.err.Header[col]
+			if col < len(ms.err.Sample) {
+				preview = m.theme.help.Render(fmt.Sprintf("  e.g. %q", ms.err.Sample[col]))
+			}
+		}
+
+		name := def.Name
+		if def.Required {
+			name += "*"
+		}
+		fmt.Fprintf(&b, "%s%-*s ◂ %s ▸%s\n", cursor, width, name, column, preview)
+	}
+
+	if ms.naming {
+		b.WriteString("\nSave mapping as: " + ms.nameInput.View() + "\n")
+	}
+	if ms.status != "" {
+		b.WriteString("\n" + m.theme.status.Render(ms.status) + "\n")
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s",
+		m.header("Map Columns"),
+		b.String(),
+		m.helpView(),
+	)
+}
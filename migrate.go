@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+	"github.com/chirpstack/chirpstack/api/go/v4/common"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// migration copies the devices of an application on another ChirpStack
+// server, see migrationInput.
+type migration struct {
+	server        string
+	token         string
+	applicationID string
+	keys          bool              // copy the root keys too
+	profiles      map[string]string // source profile name -> destination profile, by name or ID
+}
+
+// parseProfileMap reads --profile-map, "source name=destination name or ID".
+func parseProfileMap(list []string) (map[string]string, error) {
+	profiles := make(map[string]string)
+	for _, s := range list {
+		from, to, ok := strings.Cut(s, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("--profile-map %q must be source=destination", s)
+		}
+		profiles[from] = to
+	}
+	return profiles, nil
+}
+
+// migrationInput lists the devices of the source application of cfg.migrate
+// and returns them as a device list in the importer's own CSV format, so
+// that they are validated, created and reported like any other list. The
+// device profile of each is the destination profile of the same name, or
+// the one it is mapped to; see mapProfiles. Devices whose keys can't be
+// read are listed without them, with a warning.
+func migrationInput(ctx context.Context, cfg config, dest *grpc.ClientConn) (*importer.Input, error) {
+	conn, err := dial(cfg.migrate.server, nil, cfg.link, cfg.debug)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	src := importer.AuthContext(ctx, cfg.migrate.token)
+	devices := api.NewDeviceServiceClient(conn)
+
+	app, err := api.NewApplicationServiceClient(conn).Get(src, &api.GetApplicationRequest{Id: cfg.migrate.applicationID})
+	if err != nil {
+		return nil, fmt.Errorf("looking up application %s on %s: %w", cfg.migrate.applicationID, cfg.migrate.server, err)
+	}
+	list, err := importer.ListDevices(src, devices, cfg.migrate.applicationID, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\rListing the devices of %s: %d/%d", app.Application.Name, done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("listing the devices of %s: %w", app.Application.Name, err)
+	}
+
+	profiles, err := mapProfiles(ctx, cfg, dest, list)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceProfiles := api.NewDeviceProfileServiceClient(conn)
+	macVersions := make(map[string]common.MacVersion)
+	var rows []*api.Device
+	keys := make(map[string]*api.DeviceKeys)
+	for i, d := range list {
+		fmt.Fprintf(os.Stderr, "\rReading devices: %d/%d", i+1, len(list))
+		to, ok := profiles[d.DeviceProfileName]
+		if !ok {
+			continue // skipped on the mapping screen
+		}
+		resp, err := devices.Get(src, &api.GetDeviceRequest{DevEui: d.DevEui})
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return nil, fmt.Errorf("reading device %s: %w", d.DevEui, err)
+		}
+		dev := resp.Device
+		dev.DeviceProfileId = to
+		rows = append(rows, dev)
+
+		if !cfg.migrate.keys {
+			continue
+		}
+		k, err := devices.GetKeys(src, &api.GetDeviceKeysRequest{DevEui: d.DevEui})
+		switch {
+		case status.Code(err) == codes.NotFound:
+			// The device has no keys, e.g. an ABP device.
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "\nwarning: %s: can't read the root keys (%s), the device is created without them\n",
+				d.DevEui, importer.DescribeError(err))
+		default:
+			v, ok := macVersions[d.DeviceProfileId]
+			if !ok {
+				p, err := sourceProfiles.Get(src, &api.GetDeviceProfileRequest{Id: d.DeviceProfileId})
+				if err != nil {
+					fmt.Fprintln(os.Stderr)
+					return nil, fmt.Errorf("looking up device profile %s: %w", d.DeviceProfileName, err)
+				}
+				v = p.DeviceProfile.MacVersion
+				macVersions[d.DeviceProfileId] = v
+			}
+			if !importer.IsLoRaWAN11(v) {
+				// The single root key of a LoRaWAN 1.0.x device is kept in
+				// the NwkKey field, see rootKeys.
+				k.DeviceKeys.AppKey, k.DeviceKeys.NwkKey = k.DeviceKeys.NwkKey, ""
+			}
+			keys[d.DevEui] = k.DeviceKeys
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	var buf bytes.Buffer
+	if err := writeMigration(&buf, rows, keys); err != nil {
+		return nil, err
+	}
+	name := appFileName(app.Application.Name, "migration", ".csv", time.Now())
+	return &importer.Input{Source: name, Name: name, Data: buf.Bytes()}, nil
+}
+
+// writeMigration writes devices, and the root keys of those in keys, as a
+// device list.
+func writeMigration(buf *bytes.Buffer, devices []*api.Device, keys map[string]*api.DeviceKeys) error {
+	var tagKeys, varKeys []string
+	for _, d := range devices {
+		tagKeys = append(tagKeys, slices.Collect(maps.Keys(d.Tags))...)
+		varKeys = append(varKeys, slices.Collect(maps.Keys(d.Variables))...)
+	}
+	slices.Sort(tagKeys)
+	slices.Sort(varKeys)
+	tagKeys, varKeys = slices.Compact(tagKeys), slices.Compact(varKeys)
+
+	header := []string{"dev_eui", "name", "description", "join_eui", "app_key", "nwk_key", "device_profile", "is_disabled", "skip_fcnt_check"}
+	for _, k := range tagKeys {
+		header = append(header, importer.TagPrefix+k)
+	}
+	for _, k := range varKeys {
+		header = append(header, importer.VarPrefix+k)
+	}
+
+	cw := csv.NewWriter(buf)
+	cw.Write(header)
+	for _, d := range devices {
+		var appKey, nwkKey string
+		if k := keys[d.DevEui]; k != nil {
+			appKey, nwkKey = k.AppKey, k.NwkKey
+		}
+		record := []string{d.DevEui, d.Name, d.Description, d.JoinEui, appKey, nwkKey, d.DeviceProfileId,
+			strconv.FormatBool(d.IsDisabled), strconv.FormatBool(d.SkipFcntCheck)}
+		for _, k := range tagKeys {
+			record = append(record, d.Tags[k])
+		}
+		for _, k := range varKeys {
+			record = append(record, d.Variables[k])
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// mapProfiles returns the ID of the destination device profile of each
+// source profile used by devices: the one given by --profile-map, else the
+// one of the same name. The others are chosen from a list when run in a
+// terminal; without one they get --profile if given, or the migration
+// fails before anything is written. Profiles left out on the list are
+// missing from the result, and their devices aren't migrated.
+func mapProfiles(ctx context.Context, cfg config, dest *grpc.ClientConn, devices []*api.DeviceListItem) (map[string]string, error) {
+	dctx := importer.AuthContext(ctx, cfg.token)
+	app, err := api.NewApplicationServiceClient(dest).Get(dctx, &api.GetApplicationRequest{Id: cfg.applicationID})
+	if err != nil {
+		return nil, fmt.Errorf("looking up application %s: %w", cfg.applicationID, err)
+	}
+	var available []*api.DeviceProfileListItem
+	for offset := uint32(0); ; offset += importer.ListPageSize {
+		resp, err := api.NewDeviceProfileServiceClient(dest).List(dctx, &api.ListDeviceProfilesRequest{
+			TenantId: app.Application.TenantId,
+			Limit:    importer.ListPageSize,
+			Offset:   offset,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing device profiles: %w", err)
+		}
+		available = append(available, resp.Result...)
+		if len(resp.Result) < importer.ListPageSize {
+			break
+		}
+	}
+	byName := make(map[string]string)
+	for _, p := range available {
+		byName[p.Name] = p.Id
+	}
+
+	used := make(map[string]int) // source profile name -> devices
+	for _, d := range devices {
+		used[d.DeviceProfileName]++
+	}
+
+	profiles := make(map[string]string)
+	var missing []string
+	var answers *bufio.Scanner
+	for _, name := range slices.Sorted(maps.Keys(used)) {
+		to := name
+		if mapped, ok := cfg.migrate.profiles[name]; ok {
+			to = mapped
+		}
+		switch id, ok := byName[to]; {
+		case ok:
+			profiles[name] = id
+		case importer.LooksLikeUUID(to) && to != name:
+			profiles[name] = to
+		case !stdinPiped():
+			if answers == nil {
+				answers = bufio.NewScanner(os.Stdin)
+			}
+			if id := chooseProfile(answers, name, used[name], available); id != "" {
+				profiles[name] = id
+			}
+		case cfg.profileID != "":
+			fmt.Fprintf(os.Stderr, "warning: no device profile %q here, its %d devices get --profile\n", name, used[name])
+			profiles[name] = cfg.profileID
+		default:
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no device profile here for %q; map them with --profile-map or give --profile", missing)
+	}
+	return profiles, nil
+}
+
+// chooseProfile asks which destination profile the devices of the source
+// profile called name get, reading the answer from answers, and returns its
+// ID, or "" to leave them out.
+func chooseProfile(answers *bufio.Scanner, name string, devices int, available []*api.DeviceProfileListItem) string {
+	fmt.Fprintf(os.Stderr, "\nThere is no device profile %q here for its %d devices. Use:\n", name, devices)
+	for i, p := range available {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, p.Name)
+	}
+	fmt.Fprintln(os.Stderr, "  0) none, leave these devices out")
+
+	for {
+		fmt.Fprintf(os.Stderr, "Choice [0-%d]: ", len(available))
+		if !answers.Scan() {
+			return ""
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(answers.Text()))
+		switch {
+		case err != nil || n < 0 || n > len(available):
+			continue
+		case n == 0:
+			fmt.Fprintf(os.Stderr, "warning: the %d devices of %q are left out\n", devices, name)
+			return ""
+		}
+		return available[n-1].Id
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// moveWarning is shown before a move: the device keeps its frame counters
+// and history, but whatever is attached to the old application doesn't
+// follow it.
+const moveWarning = "Integrations, multicast groups and API keys of the old application stop receiving data of the moved devices"
+
+// moveSummaryView renders the outcome of the last move, listing the
+// devices that were moved with their old and new application.
+func (m model) moveSummaryView() string {
+	var moved []importer.MovedDevice
+	var skipped, failed, invalid int
+	var details []string
+	for _, fr := range m.results {
+		moved = append(moved, fr.Result.Moved...)
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+		}
+		for i, f := range fr.Result.Failures {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more failed rows", prefix, len(fr.Result.Failures)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%s: %s", prefix, f.Row.Pos.Field("dev_eui"), importer.DescribeError(f.Err))))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %sstopped early: %v", prefix, fr.Stopped)))
+		}
+	}
+
+	status := fmt.Sprintf("Moved %d devices", len(moved))
+	if m.cfg.dryRun {
+		status = fmt.Sprintf("Dry run: %d devices would be moved", len(moved))
+	}
+	status += fmt.Sprintf(" • %d already in their target", skipped)
+	if failed > 0 || invalid > 0 {
+		status += fmt.Sprintf(" • %d failed • %d invalid", failed, invalid)
+	}
+
+	var lines []string
+	for i, mv := range moved {
+		if i == summaryRemoved {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(moved)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s → %s", strings.TrimSpace(mv.Row.DevEUI+" "+mv.Row.Name), mv.From, mv.To))
+	}
+
+	view := m.theme.status.Render(status)
+	if len(lines) > 0 {
+		view += "\n\n" + strings.Join(lines, "\n")
+	}
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
+
+// reportMoves prints the outcome of a move in a headless run, listing every
+// device moved with its old and new application, and returns the exit code.
+func reportMoves(cfg config, results []importer.FileResult) int {
+	moved := "moved"
+	if cfg.dryRun {
+		moved = "would move"
+	}
+	var total, skipped, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, already in their target %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, moved, len(fr.Result.Moved), len(fr.Result.Skipped),
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		for _, mv := range fr.Result.Moved {
+			fmt.Printf("  %s: %s → %s\n", strings.TrimSpace(mv.Row.DevEUI+" "+mv.Row.Name), mv.From, mv.To)
+		}
+		for _, f := range fr.Result.Failures {
+			fmt.Printf("  %s: %s: %s\n", f.Row.Pos.Field("dev_eui"), f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %v\n", fr.Stopped)
+		}
+		total += len(fr.Result.Moved)
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, already in their target %d, failed %d, invalid %d\n", moved, total, skipped, failed, invalid)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
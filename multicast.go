@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// groupedTotals sums the multicast group outcome of results.
+func groupedTotals(results []importer.FileResult) (grouped int, failures []importer.RowFailure) {
+	for _, fr := range results {
+		grouped += fr.Result.Grouped
+		failures = append(failures, fr.Result.GroupFailures...)
+	}
+	return grouped, failures
+}
+
+// groupSummary renders how many devices joined their multicast group and
+// which failed to, or nothing if no group was requested.
+func (m model) groupSummary() string {
+	grouped, failures := groupedTotals(m.results)
+	if m.groupWarning != "" && grouped == 0 && len(failures) == 0 {
+		return "\n\n" + m.theme.warning.Render(m.groupWarning)
+	}
+	if grouped == 0 && len(failures) == 0 {
+		return ""
+	}
+
+	line := fmt.Sprintf("Added %d devices to a multicast group", grouped)
+	if m.cfg.dryRun {
+		line = fmt.Sprintf("Dry run: %d devices would be added to a multicast group", grouped)
+	}
+	if len(failures) > 0 {
+		line += fmt.Sprintf(" • %d failed to join", len(failures))
+	}
+	lines := []string{m.theme.status.Render(line)}
+	if m.groupWarning != "" {
+		lines = append([]string{m.theme.warning.Render(m.groupWarning)}, lines...)
+	}
+	for i, f := range failures {
+		if i == 10 {
+			lines = append(lines, m.theme.help.Render(fmt.Sprintf("✗ …and %d more", len(failures)-i)))
+			break
+		}
+		lines = append(lines, m.theme.help.Render("✗ "+f.Row.DevEUI+" "+importer.DescribeError(f.Err)))
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
+
+// printGroupFailures prints the multicast group outcome of a headless run and
+// returns how many devices failed to join their group.
+func printGroupFailures(results []importer.FileResult, dryRun bool) int {
+	grouped, failures := groupedTotals(results)
+	if grouped == 0 && len(failures) == 0 {
+		return 0
+	}
+
+	added := "added"
+	if dryRun {
+		added = "would add"
+	}
+	fmt.Printf("Multicast group: %s %d, failed %d\n", added, grouped, len(failures))
+	for _, f := range failures {
+		fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+	}
+	return len(failures)
+}
+
+// multicastGroupsLoadedMsg carries the multicast groups of the selected
+// application.
+type multicastGroupsLoadedMsg []item
+
+func (m model) loadMulticastGroups() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+
+		resp, err := m.multicastClient.List(ctx, &api.ListMulticastGroupsRequest{
+			ApplicationId: m.selectedApp,
+			Limit:         100,
+		})
+		if err != nil {
+			return loadFailedMsg{err}
+		}
+
+		var items []item
+		for _, g := range resp.Result {
+			items = append(items, item{
+				title: g.Name,
+				desc:  fmt.Sprintf("%s • %s", g.Region, g.GroupType),
+				id:    g.Id,
+			})
+		}
+		return multicastGroupsLoadedMsg(items)
+	}
+}
+
+// chooseMulticastGroup offers the multicast groups of the application to add
+// the created devices to, or to create one for them. Applications without
+// groups skip the list unless devices are created.
+func (m model) chooseMulticastGroup(groups []item) (tea.Model, tea.Cmd) {
+	m.newGroup = nil
+	if len(groups) == 0 && !m.cfg.Mode.Creates() {
+		return m.chooseFiles()
+	}
+
+	items := []list.Item{item{title: "No multicast group", desc: "Only groups named by a multicast_group column are joined"}}
+	for _, g := range groups {
+		items = append(items, g)
+	}
+	if m.cfg.Mode.Creates() {
+		items = append(items, newGroupItem)
+	}
+	m.multicastList = list.New(items, list.NewDefaultDelegate(), m.width-4, m.height-8)
+	m.multicastList.Title = "Add Devices to Multicast Group"
+	m.multicastList.SetShowHelp(false) // see helpView
+	m.state = stateMulticastSelect
+	return m, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// What is done about device names used more than once, see --duplicate-names
+const (
+	namesWarn = "warn" // flag the rows and suggest a unique name
+)
+
+// serverNamesMsg carries the names of the devices of the selected
+// application, to check the names of the rows against.
+type serverNamesMsg map[string]string
+
+// loadServerNames lists the names of the devices of the selected
+// application, to check the names of the rows against them.
+func (m model) loadServerNames() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		devices, err := importer.ListDevices(ctx, m.deviceClient, m.selectedApp, nil)
+		if err != nil {
+			return loadFailedMsg{fmt.Errorf("listing the devices of %s: %w", m.appName, err)}
+		}
+		return serverNamesMsg(deviceNames(devices))
+	}
+}
+
+// deviceNames maps the names of devices to their DevEUIs.
+func deviceNames(devices []*api.DeviceListItem) map[string]string {
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.Name] = strings.ToLower(d.DevEui)
+	}
+	return names
+}
+
+// checkingNames reports whether the preview can check the names of the rows
+// against the devices of the application.
+func (m model) checkingNames() bool {
+	return m.state == statePreview && m.cfg.Mode.Creates() && !m.cfg.Gateways &&
+		m.cfg.DuplicateNames != importer.NamesAllow && m.cfg.ServerNames == nil && !m.cfg.ValidateOnly
+}
+
+// nameClashes returns how many rows of the preview have a name that is used
+// more than once.
+func (m model) nameClashes() int {
+	n := 0
+	for _, in := range m.inputs {
+		n += in.NameClashes
+	}
+	return n
+}
+
+// selectedRow returns the row under the cursor of the preview table.
+func (m model) selectedRow() (importer.Row, bool) {
+	i := m.preview.Cursor()
+	for _, in := range m.inputs {
+		if i < len(in.Rows) {
+			return in.Rows[i], i >= 0
+		}
+		i -= len(in.Rows)
+	}
+	return importer.Row{}, false
+}
+
+// renamable reports whether the row under the cursor of the preview has a
+// unique name to take.
+func (m model) renamable() bool {
+	row, ok := m.selectedRow()
+	return m.state == statePreview && ok && row.UniqueName != ""
+}
+
+// renameSelected gives the row under the cursor the unique name suggested
+// for it and reads the inputs again.
+func (m model) renameSelected() (tea.Model, tea.Cmd) {
+	row, _ := m.selectedRow()
+	if m.cfg.Renames == nil {
+		m.cfg.Renames = make(map[string]string)
+	}
+	m.cfg.Renames[row.DevEUI] = row.UniqueName
+	return m.readPaths(m.inputPaths())
+}
+
+// renameAll gives every row whose name is used more than once a unique name,
+// for the rest of the session, and reads the inputs again.
+func (m model) renameAll() (tea.Model, tea.Cmd) {
+	m.cfg.DuplicateNames = importer.NamesSuffix
+	return m.readPaths(m.inputPaths())
+}
+
+func (m model) renameHelp() (string, string) {
+	row, _ := m.selectedRow()
+	return "s", fmt.Sprintf("rename to %q", row.UniqueName)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// Payloads --notify-url can be sent
+const (
+	notifyJSON  = "json"  // runNotice as is
+	notifySlack = "slack" // a Slack incoming-webhook message
+)
+
+// notifyOptions say how the end of an import is announced.
+type notifyOptions struct {
+	desktop bool   // ring the terminal bell and show a desktop notification
+	url     string // webhook the summary is posted to, empty for none
+	format  string // notifyJSON or notifySlack
+}
+
+// How an import ended, for notifications
+const (
+	eventCompleted = "completed"
+	eventCancelled = "cancelled"
+	eventFailed    = "failed"
+)
+
+// runNotice is the summary of an import posted to --notify-url.
+type runNotice struct {
+	Event       string         `json:"event"`
+	Mode        string         `json:"mode"`
+	DryRun      bool           `json:"dry_run"`
+	Server      string         `json:"server"`
+	Application string         `json:"application"`
+	Files       []string       `json:"files,omitempty"`
+	Rows        map[string]int `json:"rows"` // by status, as in the results table
+	Seconds     float64        `json:"duration_seconds"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// String describes n in a line, e.g. "Import of Meters on localhost:8081
+// completed after 2m3s: 118 ok, 2 failed".
+func (n runNotice) String() string {
+	mode := strings.ToUpper(n.Mode[:1]) + n.Mode[1:]
+	if n.DryRun {
+		mode = "Dry-run " + n.Mode
+	}
+	s := fmt.Sprintf("%s of %s on %s %s after %s", mode, n.Application, n.Server, n.Event,
+		formatElapsed(time.Duration(n.Seconds*float64(time.Second))))
+	if counts := formatCounts(n.Rows); counts != "" {
+		s += ": " + counts
+	}
+	if n.Error != "" {
+		s += " (" + n.Error + ")"
+	}
+	return s
+}
+
+// countStatuses counts the rows of report by their status in the results
+// table.
+func countStatuses(report []rowLog) map[string]int {
+	counts := make(map[string]int)
+	for _, l := range report {
+		counts[rowStatus(l)]++
+	}
+	return counts
+}
+
+// formatCounts lists counts of rows by status, e.g. "118 ok, 2 failed".
+func formatCounts(counts map[string]int) string {
+	var parts []string
+	for _, s := range []string{"ok", "skipped", "failed", "mismatch", "invalid"} {
+		if counts[s] > 0 || s == "ok" {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// announce rings the bell of term and shows a desktop notification on it,
+// if asked to and term is a terminal, and posts n to the webhook. Neither
+// changes the outcome of the import: what fails is only logged.
+func announce(opts notifyOptions, n runNotice, term *os.File, timeout time.Duration) {
+	if opts.desktop && isTerminal(term) {
+		io.WriteString(term, desktopNotification("ChirpStack Device Manager", n.String()))
+	}
+	if opts.url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := postNotice(ctx, opts, n); err != nil {
+		slog.Warn("The notification wasn't delivered", "err", err)
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// desktopNotification returns the escape sequences of a desktop
+// notification in the terminal running the program, after a bell, which is
+// all terminals that don't know either sequence get.
+func desktopNotification(title, body string) string {
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r < ' ' || r == 0x7f || r == ';' {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	title, body = clean(title), clean(body)
+
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("WT_SESSION") != "":
+		return "\a\x1b]9;" + title + ": " + body + "\a"
+	case program == "ghostty" || strings.HasPrefix(term, "foot") || strings.Contains(term, "rxvt") || os.Getenv("VTE_VERSION") != "":
+		return "\a\x1b]777;notify;" + title + ";" + body + "\a"
+	}
+	return "\a"
+}
+
+// postNotice posts n to the webhook of opts, with the secrets its error
+// quotes masked. Its URL isn't part of the errors, as webhook URLs usually
+// carry their secret.
+func postNotice(ctx context.Context, opts notifyOptions, n runNotice) error {
+	n.Error = redact.Secrets(n.Error)
+	var payload any = n
+	if opts.format == notifySlack {
+		payload = map[string]string{"text": n.String()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, opts.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid --notify-url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if uerr := (*url.Error)(nil); errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	if err != nil {
+		return fmt.Errorf("posting to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("posting to %s: HTTP %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// parseNotifyOptions parses the --notify, --notify-url and --notify-format
+// flags.
+func parseNotifyOptions(desktop bool, webhook, format string) (notifyOptions, error) {
+	if format != notifyJSON && format != notifySlack {
+		return notifyOptions{}, fmt.Errorf("unknown --notify-format %q, expected %s or %s", format, notifyJSON, notifySlack)
+	}
+	if webhook != "" {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return notifyOptions{}, errors.New("--notify-url must be an http or https URL")
+		}
+	}
+	return notifyOptions{desktop: desktop, url: webhook, format: format}, nil
+}
+
+// notice summarizes the last import of the TUI for a notification.
+func (m model) notice(event string, err error) runNotice {
+	n := runNotice{
+		Event:       event,
+		Mode:        m.cfg.Mode.String(),
+		DryRun:      m.cfg.dryRun,
+		Server:      m.serverAddr,
+		Application: m.appName,
+		Rows:        countStatuses(m.report),
+	}
+	for _, fr := range m.results {
+		n.Files = append(n.Files, filepath.Base(fr.Input.Source))
+	}
+	if m.clock != nil {
+		n.Seconds = m.clock.elapsed(time.Now()).Seconds()
+	}
+	if err != nil {
+		n.Error = redact.Secrets(err.Error())
+	}
+	return n
+}
+
+// endRun announces the end of the last import, which the program quits
+// after when it is shutting down; the notification goes out first.
+func (m model) endRun(err error) (tea.Model, tea.Cmd) {
+	event := eventCompleted
+	switch {
+	case m.stopping:
+		event = eventCancelled
+	case err != nil:
+		event = eventFailed
+	}
+	notice := m.announceRun(event, err)
+	if m.stopping {
+		mm, quit := m.quit()
+		return mm, tea.Sequence(notice, quit)
+	}
+	return m, notice
+}
+
+// announceRun announces the end of the last import, see announce, unless
+// no notification was asked for.
+func (m model) announceRun(event string, err error) tea.Cmd {
+	opts := m.cfg.notify
+	if !opts.desktop && opts.url == "" {
+		return nil
+	}
+	n, timeout := m.notice(event, err), m.cfg.HTTPTimeout
+	return func() tea.Msg {
+		announce(opts, n, os.Stdout, timeout)
+		return nil
+	}
+}
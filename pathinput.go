@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// expandHome replaces a leading "~" in path with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// completePath completes the last element of path against the directory
+// entries it may refer to. Entries are limited to directories and device
+// lists, those with one of exts. It returns the completed path and the
+// candidates when more than one entry matches.
+func completePath(path string, exts []string) (string, []string) {
+	dir, prefix := filepath.Split(path)
+	base := expandHome(dir)
+	if base == "" {
+		base = "."
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return path, nil
+	}
+
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			matches = append(matches, name+string(filepath.Separator))
+		} else if slices.Contains(exts, strings.ToLower(filepath.Ext(name))) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return path, nil
+	case 1:
+		return dir + matches[0], nil
+	}
+
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return dir + common, matches
+}
+
+// updatePathInput handles keys while the path input replaces the file picker.
+func (m model) updatePathInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyInputBack.matches(m, msg), keyPathToggle.matches(m, msg):
+		m.enteringPath = false
+		m.pathInput.Blur()
+		m.status = ""
+		return m, nil
+	case keyComplete.matches(m, msg):
+		completed, candidates := completePath(m.pathInput.Value(), m.cfg.Extensions())
+		m.pathInput.SetValue(completed)
+		m.pathInput.CursorEnd()
+		m.status = ""
+		if len(candidates) > 0 {
+			const max = 8
+			if len(candidates) > max {
+				candidates = append(candidates[:max], fmt.Sprintf("…%d more", len(candidates)-max))
+			}
+			m.status = strings.Join(candidates, "  ")
+		}
+		return m, nil
+	case keyOpenPath.matches(m, msg):
+		path := expandHome(strings.TrimSpace(m.pathInput.Value()))
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+			m.status = fmt.Sprintf("Can't open %s: %v", path, err)
+			return m, nil
+		case fi.IsDir():
+			// Browse the directory in the picker.
+			m.enteringPath = false
+			m.pathInput.Blur()
+			m.status = ""
+			cmd := m.filepicker.openDir(path)
+			return m, cmd
+		case !slices.Contains(m.cfg.Extensions(), strings.ToLower(filepath.Ext(path))):
+			m.status = fmt.Sprintf("Unsupported file type, expected one of %s", strings.Join(m.cfg.Extensions(), ", "))
+			return m, nil
+		}
+		m.enteringPath = false
+		m.pathInput.Blur()
+		m.status = ""
+		return m.startImport([]string{path})
+	}
+
+	var cmd tea.Cmd
+	m.pathInput, cmd = m.pathInput.Update(msg)
+	return m, cmd
+}
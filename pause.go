@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pausable reports whether the import in progress can be paused or resumed.
+func (m model) pausable() bool {
+	return m.state == stateProcessing && m.pause != nil && !m.stopping
+}
+
+// togglePause pauses or resumes the import in progress. The clock doesn't
+// count the time spent paused.
+func (m model) togglePause() (tea.Model, tea.Cmd) {
+	m.paused = !m.paused
+	if m.paused {
+		m.pause.Pause()
+		m.clock.pause(time.Now())
+	} else {
+		m.pause.Resume()
+		m.clock.resume(time.Now())
+	}
+	return m, nil
+}
+
+func (m model) pauseHelp() (string, string) {
+	if m.paused {
+		return "space", "resume"
+	}
+	return "space", "pause"
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// countLimit is the size up to which the file picker counts the lines of
+// the highlighted file; larger files would keep the disk busy for a number
+// nobody waits for.
+const countLimit = 16 << 20
+
+// filePicker browses the directories for device lists. It replaces the file
+// picker of bubbles, which keeps the highlighted entry to itself, so that the
+// screen can describe the file under the cursor.
+type filePicker struct {
+	dir        string   // directory shown
+	allowed    []string // extensions of the files that can be chosen, nil for any
+	showHidden bool
+	newest     bool // files sorted by modification time, most recent first, rather than by name
+
+	entries []pickerEntry
+	err     error // why dir couldn't be listed
+	cursor  int
+	offset  int // first entry shown
+	height  int
+	focus   string // entry to highlight once the directory is listed
+
+	lines map[fileKey]int // line counts of files highlighted before, or one of the below
+}
+
+// Line counts of files not counted (yet)
+const (
+	linesCounting   = -1
+	linesUnreadable = -2
+)
+
+// pickerEntry is a file or directory in the file picker.
+type pickerEntry struct {
+	name    string
+	isDir   bool // also for links to directories
+	size    int64
+	modTime time.Time
+}
+
+// fileKey identifies a version of a file, so that a count of its lines is
+// redone once the file changes.
+type fileKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// dirListedMsg carries the entries of a directory the file picker read.
+type dirListedMsg struct {
+	dir     string
+	entries []pickerEntry
+	err     error
+}
+
+// linesCountedMsg carries the number of lines of a file the file picker
+// highlighted.
+type linesCountedMsg struct {
+	file  fileKey
+	lines int
+}
+
+// Keys of the file picker, which keyPickerMove and keyPickerDir describe
+var (
+	pickerUp       = key.NewBinding(key.WithKeys("up", "k"))
+	pickerDown     = key.NewBinding(key.WithKeys("down", "j"))
+	pickerPageUp   = key.NewBinding(key.WithKeys("pgup", "K"))
+	pickerPageDown = key.NewBinding(key.WithKeys("pgdown", "J"))
+	pickerTop      = key.NewBinding(key.WithKeys("home", "g"))
+	pickerBottom   = key.NewBinding(key.WithKeys("end", "G"))
+	pickerBack     = key.NewBinding(key.WithKeys("left", "h", "backspace", "esc"))
+	pickerOpen     = key.NewBinding(key.WithKeys("right", "l", "enter", " "))
+	pickerSelect   = key.NewBinding(key.WithKeys("enter", " "))
+)
+
+func newFilePicker(dir string, allowed []string) filePicker {
+	return filePicker{dir: dir, allowed: allowed, lines: make(map[fileKey]int)}
+}
+
+// list reads the directory shown.
+func (p filePicker) list() tea.Cmd {
+	dir, hidden, newest := p.dir, p.showHidden, p.newest
+	return func() tea.Msg {
+		entries, err := readPickerDir(dir, hidden, newest)
+		return dirListedMsg{dir, entries, err}
+	}
+}
+
+// readPickerDir lists dir with the directories first, sorted by name, and
+// then the files, sorted by name or with the newest first.
+func readPickerDir(dir string, hidden, newest bool) ([]pickerEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []pickerEntry
+	for _, de := range des {
+		if !hidden && strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		// Stat follows links, which are shown like what they point to.
+		fi, err := os.Stat(filepath.Join(dir, de.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, pickerEntry{name: de.Name(), isDir: fi.IsDir(), size: fi.Size(), modTime: fi.ModTime()})
+	}
+	slices.SortFunc(entries, func(a, b pickerEntry) int {
+		if a.isDir != b.isDir {
+			if a.isDir {
+				return -1
+			}
+			return 1
+		}
+		if newest && !a.isDir {
+			if c := b.modTime.Compare(a.modTime); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return entries, nil
+}
+
+// listed shows the entries of msg if they're of the directory shown, and
+// counts the lines of the file now highlighted.
+func (p filePicker) listed(msg dirListedMsg) (filePicker, tea.Cmd) {
+	if msg.dir != p.dir {
+		return p, nil
+	}
+	p.entries, p.err = msg.entries, msg.err
+	if i := slices.IndexFunc(p.entries, func(e pickerEntry) bool { return e.name == p.focus }); i >= 0 {
+		p.cursor = i
+	}
+	p.focus = ""
+	p.moveTo(p.cursor)
+	return p, p.count()
+}
+
+// counted records the line count of msg.
+func (p filePicker) counted(msg linesCountedMsg) {
+	p.lines[msg.file] = msg.lines
+}
+
+func (p *filePicker) setHeight(height int) {
+	p.height = height
+	p.moveTo(p.cursor)
+}
+
+// moveTo moves the cursor to entry i, scrolling it into view.
+func (p *filePicker) moveTo(i int) {
+	p.cursor = max(min(i, len(p.entries)-1), 0)
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.height > 0 && p.cursor >= p.offset+p.height {
+		p.offset = p.cursor - p.height + 1
+	}
+}
+
+// highlighted returns the entry under the cursor.
+func (p filePicker) highlighted() (pickerEntry, bool) {
+	if p.cursor >= len(p.entries) {
+		return pickerEntry{}, false
+	}
+	return p.entries[p.cursor], true
+}
+
+// selectable reports whether the entry e can be chosen for an import.
+func (p filePicker) selectable(e pickerEntry) bool {
+	return !e.isDir && (p.allowed == nil || slices.Contains(p.allowed, strings.ToLower(filepath.Ext(e.name))))
+}
+
+// chosen returns the path of the highlighted file if msg chooses it, that
+// is opens an entry that can be imported.
+func (p filePicker) chosen(msg tea.KeyMsg) (string, bool) {
+	e, ok := p.highlighted()
+	if !ok || !key.Matches(msg, pickerSelect) || !p.selectable(e) {
+		return "", false
+	}
+	return filepath.Join(p.dir, e.name), true
+}
+
+// update moves the cursor and between directories.
+func (p filePicker) update(msg tea.KeyMsg) (filePicker, tea.Cmd) {
+	switch {
+	case key.Matches(msg, pickerUp):
+		p.moveTo(p.cursor - 1)
+	case key.Matches(msg, pickerDown):
+		p.moveTo(p.cursor + 1)
+	case key.Matches(msg, pickerPageUp):
+		p.moveTo(p.cursor - max(p.height, 1))
+	case key.Matches(msg, pickerPageDown):
+		p.moveTo(p.cursor + max(p.height, 1))
+	case key.Matches(msg, pickerTop):
+		p.moveTo(0)
+	case key.Matches(msg, pickerBottom):
+		p.moveTo(len(p.entries) - 1)
+	case key.Matches(msg, pickerBack):
+		parent := filepath.Dir(p.dir)
+		if parent == p.dir {
+			return p, nil
+		}
+		// Back on the directory just left
+		p.focus = filepath.Base(p.dir)
+		p.dir, p.entries, p.cursor, p.offset = parent, nil, 0, 0
+		return p, p.list()
+	case key.Matches(msg, pickerOpen):
+		e, ok := p.highlighted()
+		if !ok || !e.isDir {
+			return p, nil
+		}
+		p.dir, p.entries, p.cursor, p.offset = filepath.Join(p.dir, e.name), nil, 0, 0
+		return p, p.list()
+	default:
+		return p, nil
+	}
+	return p, p.count()
+}
+
+// openDir shows dir from the top.
+func (p *filePicker) openDir(dir string) tea.Cmd {
+	p.dir, p.entries, p.cursor, p.offset = dir, nil, 0, 0
+	return p.list()
+}
+
+// reload lists the directory shown again, keeping the highlighted entry, e.g.
+// after the filter has changed.
+func (p *filePicker) reload() tea.Cmd {
+	if e, ok := p.highlighted(); ok {
+		p.focus = e.name
+	}
+	return p.list()
+}
+
+// count counts the lines of the highlighted file in the background unless
+// they've been counted or it's too large or not a text list.
+func (p filePicker) count() tea.Cmd {
+	e, ok := p.highlighted()
+	if !ok || !p.countable(e) {
+		return nil
+	}
+	file := fileKey{filepath.Join(p.dir, e.name), e.size, e.modTime}
+	if _, ok := p.lines[file]; ok {
+		return nil
+	}
+	p.lines[file] = linesCounting
+	return func() tea.Msg {
+		return linesCountedMsg{file, countLines(file.path)}
+	}
+}
+
+// countable reports whether the lines of e are worth counting: it's a
+// delimited list or JSON Lines and small enough.
+func (p filePicker) countable(e pickerEntry) bool {
+	if e.isDir || e.size > countLimit {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(e.name)) {
+	case ".csv", ".tsv", ".txt", ".jsonl", ".ndjson":
+		return true
+	}
+	return false
+}
+
+// countLines returns the number of lines of the file at path, or
+// linesUnreadable if it can't be read.
+func countLines(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return linesUnreadable
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32<<10)
+	lines, last := 0, byte('\n')
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return linesUnreadable
+		}
+	}
+	if last != '\n' {
+		lines++ // the last line has no line break
+	}
+	return lines
+}
+
+// view renders the entries of the directory, one line each with the size of
+// files, padded to the height of the picker.
+func (p filePicker) view(th theme) string {
+	lines := make([]string, 0, p.height)
+	switch {
+	case p.err != nil:
+		lines = append(lines, th.status.Render(fmt.Sprintf("Can't read %s: %v", p.dir, p.err)))
+	case len(p.entries) == 0:
+		lines = append(lines, th.help.Render("No files in "+p.dir))
+	}
+
+	dir := lipgloss.NewStyle().Foreground(accent)
+	for i := p.offset; i < len(p.entries) && i < p.offset+p.height; i++ {
+		e := p.entries[i]
+		size, name := "", e.name
+		switch {
+		case e.isDir:
+			name = dir.Render(name + string(filepath.Separator))
+		case p.selectable(e):
+			size = formatSize(e.size)
+		default:
+			size, name = formatSize(e.size), th.help.Render(name)
+		}
+		line := fmt.Sprintf("  %8s  %s", size, name)
+		if i == p.cursor {
+			line = lipgloss.NewStyle().Foreground(highlight).Bold(true).Render(fmt.Sprintf("> %8s  %s", size, name))
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < p.height {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// info describes the highlighted file: its size, when it was last changed
+// and, for a text list that isn't too large, its number of lines.
+func (p filePicker) info() string {
+	e, ok := p.highlighted()
+	if !ok || e.isDir {
+		return ""
+	}
+	parts := []string{e.name, formatSize(e.size), "modified " + e.modTime.Format("2006-01-02 15:04")}
+	if p.countable(e) {
+		switch n := p.lines[fileKey{filepath.Join(p.dir, e.name), e.size, e.modTime}]; n {
+		case linesCounting:
+			parts = append(parts, "counting lines…")
+		case linesUnreadable:
+		case 1:
+			parts = append(parts, "1 line")
+		default:
+			parts = append(parts, fmt.Sprintf("%d lines", n))
+		}
+	}
+	return strings.Join(parts, " • ")
+}
+
+// formatSize returns a byte count in the largest unit that keeps it at
+// least 1, e.g. "12.3 kB".
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, prefix := float64(n)/unit, 0
+	for f >= unit && prefix < 4 {
+		f /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", f, "kMGTP"[prefix])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rateSteps are the rates [ and ] step through, in rows per second. Above
+// the last there is no limit.
+var rateSteps = []float64{1, 2, 5, 10, 20, 50, 100, 200}
+
+// stepRate returns the step of rateSteps after rate, or before it unless up
+// is set.
+func stepRate(rate float64, up bool) float64 {
+	switch {
+	case rate <= 0 && up:
+		return 0
+	case rate <= 0:
+		return rateSteps[len(rateSteps)-1]
+	case up:
+		for _, s := range rateSteps {
+			if s > rate {
+				return s
+			}
+		}
+		return 0
+	}
+	for _, s := range slices.Backward(rateSteps) {
+		if s < rate {
+			return s
+		}
+	}
+	return rateSteps[0]
+}
+
+// formatRate describes a rate limit, e.g. "10/s" or "no limit".
+func formatRate(rate float64) string {
+	if rate <= 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("%g/s", rate)
+}
+
+// tunable reports whether the workers and rate limit of the import in
+// progress can be changed. Gateways are still imported one at a time.
+func (m model) tunable() bool {
+	return m.pausable() && m.workers != nil && !m.cfg.Gateways
+}
+
+// adjustWorkers adds a worker to the import in progress, or takes one away
+// unless more is set, and keeps the number for the next import.
+func (m model) adjustWorkers(more bool) (tea.Model, tea.Cmd) {
+	n := m.workers.Workers() - 1
+	if more {
+		n += 2
+	}
+	m.cfg.concurrency = m.workers.Resize(n)
+	m.history.Concurrency = m.cfg.concurrency
+	m.remember()
+	return m, nil
+}
+
+// adjustRate moves the rate limit of the import in progress a step up, or
+// down unless up is set, and keeps it for the next import.
+func (m model) adjustRate(up bool) (tea.Model, tea.Cmd) {
+	m.cfg.rate = m.pace.SetRate(stepRate(m.pace.Limit(), up))
+	m.history.Rate = m.cfg.rate
+	m.remember()
+	return m, nil
+}
+
+// tuningView renders the workers and rate limit next to the rate of the
+// processing screen, e.g. " · 4 workers · limit 10/s".
+func (m model) tuningView() string {
+	if m.workers == nil || m.cfg.Gateways {
+		return ""
+	}
+	view := " · 1 worker"
+	if n := m.workers.Workers(); n != 1 {
+		view = fmt.Sprintf(" · %d workers", n)
+	}
+	if rate := m.pace.Limit(); rate > 0 {
+		view += " · limit " + formatRate(rate)
+	}
+	return view
+}
+
+// concurrencyDescription describes the workers and rate limit an import
+// starts with, for the confirmation screen.
+func (m model) concurrencyDescription() string {
+	if m.cfg.Gateways {
+		return "1 request at a time, no rate limit"
+	}
+	n := "1 request"
+	if m.cfg.concurrency > 1 {
+		n = fmt.Sprintf("%d requests", m.cfg.concurrency)
+	}
+	return fmt.Sprintf("%s at a time, %s (+/- and [/] change them while it runs)", n, formatRate(m.cfg.rate))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// previewRows is how many parsed rows the preview table shows.
+const previewRows = 50
+
+// newPreviewTable builds a table of the first rows of inputs as the importer
+// will send them.
+func newPreviewTable(inputs []*importer.Input, width, height int) table.Model {
+	multi := len(inputs) > 1
+
+	columns := []table.Column{
+		{Title: "Line", Width: 6},
+		{Title: "DevEUI", Width: 16},
+		{Title: "Name", Width: 20},
+		{Title: "Description", Width: 24},
+		{Title: "Tags", Width: 24},
+	}
+	if multi {
+		columns = append([]table.Column{{Title: "File", Width: 16}}, columns...)
+	}
+
+	var rows []table.Row
+collect:
+	for _, in := range inputs {
+		for _, r := range in.Rows {
+			if len(rows) == previewRows {
+				break collect
+			}
+
+			name := r.Name
+			if r.NameGenerated {
+				name += " *"
+			}
+			if r.UniqueName != "" {
+				name += " !"
+			}
+			row := table.Row{lineLabel(r.Pos), r.DevEUI, name, r.Description, formatTags(r.Tags)}
+			if multi {
+				row = append(table.Row{filepath.Base(in.Source)}, row...)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	// Leave room for the title, summary and help lines.
+	tableHeight := height - 12
+	if tableHeight < 5 {
+		tableHeight = 5
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithHeight(tableHeight),
+		table.WithWidth(width-4),
+	)
+	return t
+}
+
+// formatTags renders tags as sorted key=value pairs.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// previewTotal returns the number of devices that would be created.
+func (m model) previewTotal() int {
+	total := 0
+	for _, in := range m.inputs {
+		total += in.Count
+	}
+	return total
+}
+
+func (m model) previewView() string {
+	var invalid, warnings, generated, keys, clashes int
+	var formats []string
+	for _, in := range m.inputs {
+		invalid += len(in.Invalid)
+		warnings += len(in.Warnings)
+		formats = append(formats, in.Format)
+		generated += in.Named
+		clashes += in.NameClashes
+		if m.cfg.GenerateKeys && m.cfg.Mode == importer.ModeImport {
+			keys += in.Keyless
+		}
+	}
+
+	total := m.previewTotal()
+	summary := fmt.Sprintf("%d %s to %s", total, m.noun(), m.cfg.Mode.Verb())
+	if m.cfg.ValidateOnly {
+		summary = fmt.Sprintf("%d valid %s", total, m.noun())
+	}
+	if len(m.inputs) > 1 {
+		summary += fmt.Sprintf(" from %d files", len(m.inputs))
+	}
+	if total > previewRows {
+		summary += fmt.Sprintf(" (showing the first %d)", previewRows)
+	}
+	switch {
+	case invalid > 0 && m.cfg.ValidateOnly:
+		summary += fmt.Sprintf(" • %d invalid rows", invalid)
+	case invalid > 0:
+		summary += fmt.Sprintf(" • %d invalid rows will be skipped", invalid)
+	}
+	if n := m.existingRows(); n > 0 {
+		summary += fmt.Sprintf(" • %d existing devices will be skipped", n)
+	}
+	if warnings > 0 {
+		summary += fmt.Sprintf(" • %d warnings", warnings)
+	}
+	switch {
+	case generated > 0 && m.cfg.NameTemplate != "":
+		summary += fmt.Sprintf(" • %d names (*) generated from %q", generated, m.cfg.NameTemplate)
+	case generated > 0:
+		summary += fmt.Sprintf(" • %d names (*) taken from the DevEUI", generated)
+	}
+	switch {
+	case clashes > 0 && m.cfg.DuplicateNames == importer.NamesSuffix:
+		summary += fmt.Sprintf(" • %d duplicate names renamed", clashes)
+	case clashes > 0:
+		summary += fmt.Sprintf(" • %d duplicate names (!)", clashes)
+	}
+	if keys > 0 {
+		summary += fmt.Sprintf(" • %d AppKeys will be generated", keys)
+	}
+	if m.cfg.ValidateOnly {
+		summary += "\n" + m.theme.warning.Render("Validation only: go back to the file picker and connect to a server to import")
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s%s\n\n%s\n\n%s",
+		m.header("Preview"),
+		summary,
+		m.theme.help.Render("Parsed as "+strings.Join(formats, "; ")),
+		m.previewIssues(),
+		m.preview.View(),
+		m.helpView(),
+	)
+}
+
+// previewIssues lists the first few warnings, invalid rows and rows of
+// existing devices of the batch.
+func (m model) previewIssues() string {
+	const max = 5
+
+	var lines []string
+	for _, in := range m.inputs {
+		prefix := ""
+		if len(m.inputs) > 1 {
+			prefix = filepath.Base(in.Source) + ": "
+		}
+		for _, w := range in.Warnings {
+			lines = append(lines, "⚠ "+prefix+w)
+		}
+		for _, msg := range in.Invalid {
+			lines = append(lines, "✗ "+prefix+msg)
+		}
+		for _, row := range in.Exists {
+			lines = append(lines, fmt.Sprintf("– %s%s: %s %s", prefix, row.Pos.Field("dev_eui"), row.DevEUI, importer.ExistsNote))
+		}
+	}
+
+	if len(lines) > max {
+		lines = append(lines[:max], fmt.Sprintf("…and %d more", len(lines)-max))
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString("\n" + m.theme.help.Render(l))
+	}
+	return b.String()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"rsc.io/qr"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// tr005Payload returns the LoRa Alliance TR005 QR code payload of the device
+// of row, e.g. "LW:D0:70B3D57ED0000000:70B3D57ED0000001:0A1B0002", which
+// commissioning apps scan. The profile ID is the vendor ID followed by the
+// vendor's profile ID. A row without a field the payload needs gets a
+// importer.RowNote naming it.
+func tr005Payload(row importer.Row) (string, error) {
+	var missing []string
+	for _, f := range []struct{ name, value string }{
+		{"join_eui", row.JoinEUI},
+		{"vendor_id", row.VendorID},
+		{"vendor_profile_id", row.VendorProfileID},
+	} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", importer.RowNote("no " + strings.Join(missing, ", ") + " for a QR code")
+	}
+	return strings.ToUpper(fmt.Sprintf("LW:D0:%s:%s:%s%s", row.JoinEUI, row.DevEUI, row.VendorID, row.VendorProfileID)), nil
+}
+
+// qrOutcome is what writeQRCodes wrote.
+type qrOutcome struct {
+	path    string
+	png     bool // path is a directory of PNG files rather than a CSV file
+	written int
+	skipped []importer.RowFailure // rows without a code, and why
+}
+
+// qrPNG reports whether QR codes written to path are PNG files in a
+// directory; paths ending in .csv get a CSV of payloads.
+func qrPNG(path string) bool {
+	return !strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// writeQRCodes writes the TR005 QR codes of rows to path: a CSV of payloads
+// if it ends in .csv, otherwise PNG files named by DevEUI in the directory
+// path, which is created if need be. Rows without the fields of a code are
+// skipped, as are PNG files that exist already; an existing CSV file isn't
+// overwritten.
+func writeQRCodes(path string, rows []importer.Row) (qrOutcome, error) {
+	out := qrOutcome{path: path, png: qrPNG(path)}
+	type code struct {
+		row     importer.Row
+		payload string
+	}
+	var codes []code
+	for _, row := range rows {
+		payload, err := tr005Payload(row)
+		if err != nil {
+			out.skipped = append(out.skipped, importer.RowFailure{Row: row, Err: err})
+			continue
+		}
+		codes = append(codes, code{row, payload})
+	}
+
+	if !out.png {
+		err := createFile(path, func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"dev_eui", "name", "qr_payload"})
+			for _, c := range codes {
+				cw.Write([]string{c.row.DevEUI, c.row.Name, c.payload})
+			}
+			cw.Flush()
+			return cw.Error()
+		})
+		if err != nil {
+			return out, err
+		}
+		out.written = len(codes)
+		return out, nil
+	}
+
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return out, err
+	}
+	for _, c := range codes {
+		img, err := qr.Encode(c.payload, qr.M)
+		if err != nil {
+			out.skipped = append(out.skipped, importer.RowFailure{Row: c.row, Err: err})
+			continue
+		}
+		file := filepath.Join(path, c.row.DevEUI+".png")
+		err = createFile(file, func(w io.Writer) error {
+			_, err := w.Write(img.PNG())
+			return err
+		})
+		switch {
+		case errors.Is(err, fs.ErrExist):
+			out.skipped = append(out.skipped, importer.RowFailure{Row: c.row, Err: importer.RowNote(filepath.Base(file) + " exists already")})
+		case err != nil:
+			return out, err
+		default:
+			out.written++
+		}
+	}
+	return out, nil
+}
+
+// describe says how many codes were written where, for the QR screen and
+// headless mode.
+func (o qrOutcome) describe() string {
+	if o.png {
+		return fmt.Sprintf("%d QR codes written to %s as PNG files named by DevEUI", o.written, o.path)
+	}
+	return fmt.Sprintf("%d QR code payloads written to %s", o.written, o.path)
+}
+
+// createdRows returns the rows of the devices results created.
+func createdRows(results []importer.FileResult) []importer.Row {
+	var rows []importer.Row
+	for _, fr := range results {
+		for _, s := range fr.Result.Sent {
+			rows = append(rows, s.Row)
+		}
+	}
+	return rows
+}
+
+// scanRows reads every valid row of inputs.
+func scanRows(ctx context.Context, inputs []*importer.Input, cfg config) ([]importer.Row, error) {
+	var rows []importer.Row
+	b := importer.NewBatch(cfg.ListOptions, inputs)
+	for _, in := range inputs {
+		err := b.Scan(ctx, in, func(row importer.Row) error {
+			rows = append(rows, row)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", in.Source, err)
+		}
+	}
+	return rows, nil
+}
+
+// qrScreen asks where to write the QR codes of devices, those just created
+// or those of the previewed lists in qr mode, and shows what was written.
+type qrScreen struct {
+	rows   []importer.Row
+	input  textinput.Model
+	back   state      // the screen esc returns to
+	out    *qrOutcome // once written
+	status string     // why the last attempt failed
+}
+
+func newQRScreen(rows []importer.Row, dir, appName string, back state) *qrScreen {
+	return &qrScreen{
+		rows:  rows,
+		input: exportInput(filepath.Join(dir, appFileName(appName, "qr", "", time.Now()))),
+		back:  back,
+	}
+}
+
+// openQRCodes shows the QR screen for rows, returning to back.
+func (m model) openQRCodes(rows []importer.Row, back state) (tea.Model, tea.Cmd) {
+	m.qrCodes = newQRScreen(rows, m.filepicker.dir, m.appName, back)
+	m.state = stateQRCodes
+	return m, textinput.Blink
+}
+
+// editingQRPath reports whether the path of the QR codes is being entered.
+func (m model) editingQRPath() bool {
+	return m.state == stateQRCodes && m.qrCodes.out == nil
+}
+
+// updateQRCodes handles keys on the QR screen.
+func (m model) updateQRCodes(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	q := m.qrCodes
+
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyQRBack.matches(m, msg), keyQRDone.matches(m, msg):
+		m.state = q.back
+		m.qrCodes = nil
+		return m, nil
+	case keyQRWrite.matches(m, msg):
+		path := expandHome(strings.TrimSpace(q.input.Value()))
+		if path == "" {
+			q.status = "Enter a directory for PNG files, or a .csv file for the payloads"
+			return m, nil
+		}
+		out, err := writeQRCodes(path, q.rows)
+		if err != nil {
+			q.status = fmt.Sprintf("Writing QR codes failed: %v", err)
+			return m, nil
+		}
+		slog.Info(out.describe())
+		q.status = ""
+		q.out = &out
+		q.input.Blur()
+		return m, nil
+	}
+
+	if q.out != nil {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	q.input, cmd = q.input.Update(msg)
+	return m, cmd
+}
+
+func (m model) qrCodesView() string {
+	q := m.qrCodes
+
+	var body string
+	if q.out == nil {
+		body = fmt.Sprintf("Write the TR005 QR codes of %d devices to a directory of PNG files, or to a .csv file of payloads:\n\n%s", len(q.rows), q.input.View())
+		if q.status != "" {
+			body += "\n\n" + m.theme.status.Render(q.status)
+		}
+	} else {
+		body = m.theme.status.Render(q.out.describe())
+		if n := len(q.out.skipped); n > 0 {
+			lines := []string{m.theme.warning.Render(fmt.Sprintf("⚠ %d devices skipped", n))}
+			for i, f := range q.out.skipped {
+				if i == 10 {
+					lines = append(lines, m.theme.help.Render(fmt.Sprintf("- …and %d more", n-i)))
+					break
+				}
+				lines = append(lines, m.theme.help.Render(fmt.Sprintf("- %s: %s", f.Row.DevEUI, importer.DescribeError(f.Err))))
+			}
+			body += "\n\n" + strings.Join(lines, "\n")
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("QR Codes"),
+		body,
+		m.helpView(),
+	)
+}
+
+// writeHeadlessQRCodes writes the QR codes of rows to path for --qr-codes
+// and reports them, returning how many devices got none.
+func writeHeadlessQRCodes(path string, rows []importer.Row) (int, error) {
+	out, err := writeQRCodes(path, rows)
+	if err != nil {
+		return 0, fmt.Errorf("writing QR codes: %w", err)
+	}
+	fmt.Println(out.describe())
+	for _, f := range out.skipped {
+		fmt.Fprintf(os.Stderr, "warning: no QR code for %s: %v\n", f.Row.DevEUI, f.Err)
+	}
+	return len(out.skipped), nil
+}
+
+// runQRCodes writes the QR codes of the devices of cfg.input to --qr-codes,
+// for --mode qr, without connecting to the server. It returns 1 if a device
+// got no code.
+func runQRCodes(ctx context.Context, cfg config) int {
+	switch {
+	case cfg.input == "":
+		return usageError("--csv is required in headless mode")
+	case cfg.qrCodes == "":
+		return usageError("--mode qr needs --qr-codes")
+	}
+	paths, err := importer.ExpandInput(cfg.input, cfg.Extensions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	inputs := importer.NewInputs(paths)
+	if err := importer.ReadInputs(ctx, inputs, cfg.ListOptions, 0, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	invalid := 0
+	for _, in := range inputs {
+		for _, msg := range in.Invalid {
+			fmt.Fprintf(os.Stderr, "invalid: %s: %s\n", in.Source, msg)
+		}
+		invalid += len(in.Invalid)
+	}
+
+	rows, err := scanRows(ctx, inputs, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	skipped, err := writeHeadlessQRCodes(cfg.qrCodes, rows)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	if skipped > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// tenantQuota is the device limit of a tenant and how much of it is used.
+type tenantQuota struct {
+	max  int // 0 when the tenant has no limit
+	used int
+}
+
+// remaining returns how many more devices the tenant can have, or -1 if it
+// has no limit.
+func (q tenantQuota) remaining() int {
+	if q.max == 0 {
+		return -1
+	}
+	return max(q.max-q.used, 0)
+}
+
+// over returns by how many devices creating n would exceed the limit, or 0.
+func (q tenantQuota) over(n int) int {
+	if r := q.remaining(); r >= 0 && n > r {
+		return n - r
+	}
+	return 0
+}
+
+// loadQuota reads the device limit of a tenant and its device count, which
+// comes from the summary the web interface uses.
+func loadQuota(ctx context.Context, tenants api.TenantServiceClient, internal api.InternalServiceClient, tenantID string) (tenantQuota, error) {
+	resp, err := tenants.Get(ctx, &api.GetTenantRequest{Id: tenantID})
+	if err != nil {
+		return tenantQuota{}, fmt.Errorf("looking up tenant %s: %w", tenantID, err)
+	}
+	q := tenantQuota{max: int(resp.Tenant.MaxDeviceCount)}
+	if q.max == 0 {
+		return q, nil
+	}
+
+	ds, err := internal.GetDevicesSummary(ctx, &api.GetDevicesSummaryRequest{TenantId: tenantID})
+	if err != nil {
+		return tenantQuota{}, fmt.Errorf("counting the devices of tenant %s: %w", tenantID, err)
+	}
+	q.used = int(ds.ActiveCount + ds.InactiveCount + ds.NeverSeenCount)
+	return q, nil
+}
+
+// quotaLoadedMsg carries the device limit of the selected tenant. Tokens that
+// can't read it get no quota check.
+type quotaLoadedMsg struct {
+	tenantID string
+	quota    tenantQuota
+}
+
+func (m model) loadQuota(tenantID string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		q, err := loadQuota(ctx, m.tenantClient, m.internalClient, tenantID)
+		if err != nil {
+			return nil
+		}
+		return quotaLoadedMsg{tenantID, q}
+	}
+}
+
+// creating returns how many devices the run about to be confirmed creates.
+func (m model) creating() int {
+	switch {
+	case m.cfg.Gateways || !m.cfg.Mode.Creates():
+		return 0
+	case m.cfg.Mode == importer.ModeSync && m.plan != nil:
+		return len(m.plan.create)
+	}
+	return m.previewTotal()
+}
+
+// overQuota returns by how many devices the run about to be confirmed would
+// exceed the device limit of the tenant, or 0.
+func (m model) overQuota() int {
+	if m.quota == nil || m.cfg.dryRun {
+		return 0
+	}
+	return m.quota.over(m.creating())
+}
+
+// truncatable reports whether the confirmation offers to import only as many
+// devices as the tenant has room for.
+func (m model) truncatable() bool {
+	return m.overQuota() > 0 && m.cfg.Mode == importer.ModeImport && m.quota.remaining() > 0
+}
+
+// quotaWarning explains by how much the run would exceed the device limit.
+func (m model) quotaWarning() string {
+	return fmt.Sprintf("This %s would exceed the device limit of tenant %s by %d devices (%d of %d used)",
+		m.cfg.Mode, m.tenantName, m.overQuota(), m.quota.used, m.quota.max)
+}
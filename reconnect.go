@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults of --keepalive, --keepalive-timeout and --reconnect-timeout
+const (
+	defaultKeepalive        = 30 * time.Second
+	defaultKeepaliveTimeout = 10 * time.Second
+	defaultReconnectTimeout = 2 * time.Minute
+)
+
+// maxReconnects is how often a call is sent again after the connection it
+// went over was lost.
+const maxReconnects = 3
+
+// link keeps the connection to the server usable through a long import. It
+// pings the server while the connection is idle, so that load balancers
+// don't close it, and a call that fails because the connection was lost
+// waits for it to come back and is sent again, rather than failing its row
+// and every row after it. A connection that never got through isn't waited
+// for, as its address is more likely wrong than the server away. A nil
+// *link does neither.
+type link struct {
+	keepalive keepalive.ClientParameters
+	timeout   time.Duration // how long a call waits for the connection to come back
+
+	mu       sync.Mutex
+	up       map[*grpc.ClientConn]bool // connections a call got through on
+	waiting  int                       // calls waiting for the connection
+	onChange func(down bool)           // called when the first call starts waiting and the last stops
+}
+
+func newLink(ping, pingTimeout, timeout time.Duration) *link {
+	return &link{
+		keepalive: keepalive.ClientParameters{Time: ping, Timeout: pingTimeout, PermitWithoutStream: true},
+		timeout:   timeout,
+		up:        make(map[*grpc.ClientConn]bool),
+	}
+}
+
+// dialOptions returns the keepalive and retrying of l for dial.
+func (l *link) dialOptions() []grpc.DialOption {
+	if l == nil {
+		return nil
+	}
+	opts := []grpc.DialOption{grpc.WithChainUnaryInterceptor(l.interceptor)}
+	if l.keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(l.keepalive))
+	}
+	return opts
+}
+
+// notify sets what is called when the connection is lost and back.
+func (l *link) notify(onChange func(down bool)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = onChange
+}
+
+// connectionLost reports whether err is a call failing because the
+// connection it went over was lost or couldn't be made.
+func connectionLost(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// interceptor sends a call again once the connection is back, when it
+// failed because the connection was lost. Only reads are sent again: a
+// create or enqueue may have been carried out before the connection went,
+// and sending it again would fail as already existing or queue the downlink
+// twice, so such a call fails with its row once the connection is back.
+func (l *link) interceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	for i := 0; l.timeout > 0 && i < maxReconnects && connectionLost(err) && l.wasUp(cc) && ctx.Err() == nil; i++ {
+		if !l.reconnect(ctx, cc) || !idempotent(method) {
+			break
+		}
+		err = invoker(context.WithValue(ctx, attemptKey{}, i+2), method, req, reply, cc, opts...)
+	}
+	if !connectionLost(err) {
+		l.mu.Lock()
+		l.up[cc] = true
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// idempotent reports whether the call method, a full method name such as
+// "/api.DeviceService/Get", can be sent again without changing more than
+// sending it once.
+func idempotent(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	return strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List")
+}
+
+// wasUp reports whether a call got through on cc before.
+func (l *link) wasUp(cc *grpc.ClientConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.up[cc]
+}
+
+// reconnect waits up to l.timeout for cc to be ready again, and reports
+// whether it is.
+func (l *link) reconnect(ctx context.Context, cc *grpc.ClientConn) bool {
+	l.wait(1)
+	defer l.wait(-1)
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	for {
+		s := cc.GetState()
+		switch s {
+		case connectivity.Ready:
+			return true
+		case connectivity.Shutdown:
+			return false
+		case connectivity.Idle:
+			cc.Connect()
+		}
+		if !cc.WaitForStateChange(ctx, s) {
+			return false
+		}
+	}
+}
+
+// wait counts a call that starts or stops waiting for the connection.
+func (l *link) wait(delta int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before := l.waiting
+	l.waiting += delta
+	if (before == 0) == (l.waiting == 0) {
+		return
+	}
+	down := l.waiting > 0
+	if l.onChange != nil {
+		l.onChange(down)
+	} else if down {
+		fmt.Fprintf(os.Stderr, "warning: lost the connection to the server; waiting up to %s for it to come back\n", l.timeout)
+	}
+}
+
+// reconnectingMsg says that the connection to the server was lost, or is
+// back or given up on.
+type reconnectingMsg bool
+
+// reconnectingView shows that rows are held while the connection is down.
+func (m model) reconnectingView() string {
+	if !m.reconnecting {
+		return ""
+	}
+	return m.theme.warning.Render(fmt.Sprintf("⟳ Lost the connection to the server; reconnecting… (up to %s)", m.cfg.link.timeout)) + "\n\n"
+}
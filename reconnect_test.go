@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/internal/chirpstacktest"
+)
+
+// linked connects to srv through a link that waits up to timeout, and
+// returns the changes of the connection it reports.
+func linked(t *testing.T, srv *chirpstacktest.Server, timeout time.Duration) (*grpc.ClientConn, func() []bool) {
+	t.Helper()
+	l := newLink(0, 0, timeout)
+	var mu sync.Mutex
+	var changes []bool
+	l.notify(func(down bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, down)
+	})
+	// Reconnect quickly rather than after the default second.
+	fast := grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, MaxDelay: 50 * time.Millisecond},
+		MinConnectTimeout: time.Second,
+	})
+	conn := srv.Dial(t, append(l.dialOptions(), fast)...)
+	return conn, func() []bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(changes)
+	}
+}
+
+func TestLinkResendsUnavailable(t *testing.T) {
+	srv := chirpstacktest.NewServer(t)
+	conn, changes := linked(t, srv, 5*time.Second)
+	client := api.NewInternalServiceClient(conn)
+	ctx := context.Background()
+
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Fail(api.InternalService_GetVersion_FullMethodName, status.Error(codes.Unavailable, "connection reset"), status.Error(codes.Unavailable, "connection reset"))
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("GetVersion = %v, want it sent again until it got through", err)
+	}
+	if n := len(srv.Calls(api.InternalService_GetVersion_FullMethodName)); n != 4 {
+		t.Errorf("GetVersion received %d times, want 4", n)
+	}
+	if got := changes(); !slices.Equal(got, []bool{true, false, true, false}) {
+		t.Errorf("connection changes = %v, want down and back twice", got)
+	}
+
+	srv.Fail(api.InternalService_GetVersion_FullMethodName, status.Error(codes.PermissionDenied, "no"))
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetVersion = %v, want other errors returned as they are", err)
+	}
+}
+
+func TestLinkGivesUp(t *testing.T) {
+	srv := chirpstacktest.NewServer(t)
+	conn, _ := linked(t, srv, 5*time.Second)
+	client := api.NewInternalServiceClient(conn)
+	ctx := context.Background()
+
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	unavailable := status.Error(codes.Unavailable, "connection reset")
+	srv.Fail(api.InternalService_GetVersion_FullMethodName, slices.Repeat([]error{unavailable}, maxReconnects+1)...)
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("GetVersion = %v, want Unavailable after %d reconnects", err, maxReconnects)
+	}
+	if n := len(srv.Calls(api.InternalService_GetVersion_FullMethodName)); n != maxReconnects+2 {
+		t.Errorf("GetVersion received %d times, want %d", n, maxReconnects+2)
+	}
+}
+
+func TestLinkReconnects(t *testing.T) {
+	srv := chirpstacktest.NewServer(t)
+	conn, changes := linked(t, srv, 5*time.Second)
+	client := api.NewInternalServiceClient(conn)
+	ctx := context.Background()
+
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Stop()
+	time.AfterFunc(200*time.Millisecond, srv.Start)
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("GetVersion = %v, want it sent again once the server was back", err)
+	}
+	if got := changes(); !slices.Equal(got, []bool{true, false}) {
+		t.Errorf("connection changes = %v, want down and back", got)
+	}
+}
+
+func TestLinkNeverUp(t *testing.T) {
+	srv := chirpstacktest.NewServer(t)
+	conn, changes := linked(t, srv, 5*time.Second)
+	srv.Stop()
+
+	start := time.Now()
+	if _, err := api.NewInternalServiceClient(conn).GetVersion(context.Background(), &emptypb.Empty{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("GetVersion = %v, want Unavailable", err)
+	}
+	if time.Since(start) > time.Second || len(changes()) > 0 {
+		t.Error("waited for a connection that never got through")
+	}
+}
+
+func TestLinkKeepsCreates(t *testing.T) {
+	srv := chirpstacktest.NewServer(t)
+	conn, changes := linked(t, srv, 5*time.Second)
+	client := api.NewDeviceServiceClient(conn)
+	ctx := context.Background()
+
+	appID := srv.AddApplication(&api.Application{Name: "app"})
+	profileID := srv.AddProfile(&api.DeviceProfile{Name: "profile"})
+	if _, err := api.NewInternalServiceClient(conn).GetVersion(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	lost := status.Error(codes.Unavailable, "connection reset")
+	srv.FailAfter(api.DeviceService_Create_FullMethodName, lost)
+	dev := &api.Device{DevEui: "70b3d57ed0000001", Name: "sensor", ApplicationId: appID, DeviceProfileId: profileID}
+	if _, err := client.Create(ctx, &api.CreateDeviceRequest{Device: dev}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Create = %v, want Unavailable rather than sent again", err)
+	}
+	if n := len(srv.Calls(api.DeviceService_Create_FullMethodName)); n != 1 {
+		t.Errorf("Create received %d times, want 1", n)
+	}
+	if srv.Device(dev.DevEui) == nil {
+		t.Error("device not created")
+	}
+	if got := changes(); !slices.Equal(got, []bool{true, false}) {
+		t.Errorf("connection changes = %v, want the connection waited for before failing", got)
+	}
+
+	srv.FailAfter(api.DeviceService_Get_FullMethodName, lost)
+	if _, err := client.Get(ctx, &api.GetDeviceRequest{DevEui: dev.DevEui}); err != nil {
+		t.Errorf("Get = %v, want it sent again", err)
+	}
+	if n := len(srv.Calls(api.DeviceService_Get_FullMethodName)); n != 2 {
+		t.Errorf("Get received %d times, want 2", n)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// revealable reports whether the token being typed can be shown, to check
+// a long pasted one character by character.
+func (m model) revealable() bool {
+	return m.state == stateConnecting && m.tokenInput.Value() != ""
+}
+
+func (m model) revealHelp() (string, string) {
+	if m.tokenInput.EchoMode == textinput.EchoNormal {
+		return "ctrl+r", "hide token"
+	}
+	return "ctrl+r", "show token"
+}
+
+// toggleToken shows the token being typed, or hides it again. It is hidden
+// once it's used to connect.
+func (m model) toggleToken() (tea.Model, tea.Cmd) {
+	if m.tokenInput.EchoMode == textinput.EchoNormal {
+		m.tokenInput.EchoMode = textinput.EchoPassword
+	} else {
+		m.tokenInput.EchoMode = textinput.EchoNormal
+	}
+	return m, nil
+}
@@ -0,0 +1,73 @@
+// Package redact masks the secrets, such as AppKeys and API tokens, in what
+// is shown, logged or written to disk.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Show turns redaction off, from --show-secrets. It is a package
+// variable rather than an option because the standard logger, error
+// strings and the audit log are redacted too, far from any options.
+var Show bool
+
+// secretValue matches what is redacted wherever it turns up in free text:
+// values of 32 hex characters, the size of AppKeys and NwkKeys, and JWTs
+// such as API tokens.
+var secretValue = regexp.MustCompile(`\b[0-9A-Fa-f]{32}\b|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+
+// secretNames are parts of field names, e.g. of variables, whose values
+// are redacted whatever they look like.
+var secretNames = []string{"key", "secret", "token", "password", "passwd"}
+
+// maskSecret shortens a secret to its first and last 4 characters, e.g.
+// "a1b2…c3d4", enough to tell two apart without giving either away.
+func maskSecret(s string) string {
+	if Show {
+		return s
+	}
+	if len(s) < 12 {
+		return "…"
+	}
+	return s[:4] + "…" + s[len(s)-4:]
+}
+
+// Secrets masks the secrets in s, such as an AppKey quoted in an error
+// message.
+func Secrets(s string) string {
+	if Show {
+		return s
+	}
+	return secretValue.ReplaceAllStringFunc(s, maskSecret)
+}
+
+// Field returns the value of the field name for display: masked if
+// the name sounds like a secret, e.g. a variable "api_key", and with the
+// secrets in it masked otherwise.
+func Field(name, value string) string {
+	lower := strings.ToLower(name)
+	for _, n := range secretNames {
+		if strings.Contains(lower, n) && value != "" {
+			return maskSecret(value)
+		}
+	}
+	return Secrets(value)
+}
+
+// Writer masks the secrets in what is written through it, for the
+// standard logger. Each write is a whole log line.
+type Writer struct{ w io.Writer }
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) Writer {
+	return Writer{w: w}
+}
+
+func (r Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Secrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+)
+
+// profileRegions maps the names and IDs of profiles to their regions, for
+// checking the profile columns of a list, see regionWarning.
+func profileRegions(profiles []*api.DeviceProfileListItem) map[string]string {
+	regions := make(map[string]string, 2*len(profiles))
+	for _, p := range profiles {
+		regions[p.Name] = p.Region.String()
+		regions[p.Id] = p.Region.String()
+	}
+	return regions
+}
+
+// sortProfiles orders profile items by region, then by name.
+func sortProfiles(items []item) {
+	slices.SortStableFunc(items, func(a, b item) int {
+		return cmp.Or(cmp.Compare(a.region, b.region), cmp.Compare(strings.ToLower(a.title), strings.ToLower(b.title)))
+	})
+}
+
+// regions returns the regions of the loaded device profiles, sorted.
+func (m model) regions() []string {
+	var regions []string
+	for _, p := range m.profiles {
+		if !slices.Contains(regions, p.region) {
+			regions = append(regions, p.region)
+		}
+	}
+	slices.Sort(regions)
+	return regions
+}
+
+// regionFilterable reports whether the profile list can be filtered by
+// region, which takes profiles of more than one.
+func (m model) regionFilterable() bool {
+	return m.state == stateDeviceProfileSelect && m.listState() && len(m.regions()) > 1
+}
+
+// nextRegion returns the region the profile list switches to, "" for all.
+func (m model) nextRegion() string {
+	regions := append([]string{""}, m.regions()...)
+	i := slices.Index(regions, m.profileRegion)
+	return regions[(i+1)%len(regions)]
+}
+
+// regionHelp describes keyRegion with the region it switches to.
+func (m model) regionHelp() (string, string) {
+	if next := m.nextRegion(); next != "" {
+		return "tab", "show " + next + " only"
+	}
+	return "tab", "show all regions"
+}
+
+// showRegion lists the profiles of region, or all for "", after the entry
+// creating one from a template.
+func (m *model) showRegion(region string) {
+	m.profileRegion = region
+	items := []list.Item{newProfileItem}
+	for _, p := range m.profiles {
+		if region == "" || p.region == region {
+			items = append(items, p)
+		}
+	}
+	m.profileList.SetItems(items)
+	m.profileList.ResetSelected()
+	m.profileList.Title = "Select Device Profile"
+	if region != "" {
+		m.profileList.Title += " • " + region
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// Orders of the results table
+const (
+	orderProcessed = iota // as the rows were processed
+	orderStatus           // failures first
+	orderDevEUI
+	orderCount
+)
+
+var orderNames = [orderCount]string{"processing order", "status", "DevEUI"}
+
+// resultsScreen lists every row of the last run with its outcome. The table
+// only holds the rows shown, built from m.report when the screen opens or
+// its filter or order changes, and renders just those in view.
+type resultsScreen struct {
+	table        table.Model
+	failuresOnly bool
+	order        int
+	multi        bool       // rows come from several files
+	status       string     // where the table was saved, or why it wasn't
+	editor       *rowEditor // correcting the highlighted row, see editRow
+
+	// A run opened from the history, listed read-only instead of the last
+	// run, and its rows
+	run  *runHeader
+	rows []rowLog
+}
+
+// tableRows returns the rows the results table lists: those of the run
+// opened from the history, or m.report.
+func (m model) tableRows() []rowLog {
+	if m.resultsTable.run != nil {
+		return m.resultsTable.rows
+	}
+	return m.report
+}
+
+// rowStatus names the outcome of l in the results table.
+func rowStatus(l rowLog) string {
+	var note importer.RowNote
+	switch {
+	case l.err == nil:
+		return "ok"
+	case errors.As(l.err, &note):
+		return "skipped"
+	case errors.As(l.err, new(importer.InvalidRow)):
+		return "invalid"
+	case errors.As(l.err, new(importer.Mismatch)):
+		return "mismatch"
+	}
+	return "failed"
+}
+
+// rowMessage explains why l failed or was skipped, if it did.
+func rowMessage(l rowLog) string {
+	var note importer.RowNote
+	switch {
+	case l.err == nil:
+		return ""
+	case errors.As(l.err, &note):
+		return redact.Secrets(string(note))
+	}
+	return importer.DescribeError(l.err)
+}
+
+// lineLabel returns where a row is in its file, e.g. "12" or "[42]" for a
+// JSON entry.
+func lineLabel(p importer.RowPos) string {
+	if p.Line == 0 {
+		return fmt.Sprintf("[%d]", p.Index)
+	}
+	return fmt.Sprint(p.Line)
+}
+
+// openResults shows the results table of the last run.
+func (m model) openResults() (tea.Model, tea.Cmd) {
+	sources := make(map[string]bool)
+	for _, l := range m.report {
+		sources[l.source] = true
+	}
+	m.resultsTable = &resultsScreen{multi: len(sources) > 1}
+	m.resultsTable.table = table.New(table.WithFocused(true))
+	m.fillResults()
+	m.state = stateResults
+	return m, nil
+}
+
+// shownResults returns the rows of tableRows the results table shows, in
+// its order.
+func (m model) shownResults() []rowLog {
+	r := m.resultsTable
+	var rows []rowLog
+	for _, l := range m.tableRows() {
+		if !r.failuresOnly || l.err != nil {
+			rows = append(rows, l)
+		}
+	}
+	switch r.order {
+	case orderStatus:
+		rank := map[string]int{"failed": 0, "mismatch": 1, "invalid": 2, "skipped": 3, "ok": 4}
+		slices.SortStableFunc(rows, func(a, b rowLog) int { return cmp.Compare(rank[rowStatus(a)], rank[rowStatus(b)]) })
+	case orderDevEUI:
+		slices.SortStableFunc(rows, func(a, b rowLog) int { return cmp.Compare(a.devEUI, b.devEUI) })
+	}
+	return rows
+}
+
+// fillResults sizes the results table to the terminal and fills it with
+// the rows shown.
+func (m *model) fillResults() {
+	r := m.resultsTable
+	width := m.width - 4
+
+	// The error takes what is left of the width, narrowing the name on
+	// small terminals before it gets narrower itself.
+	columns := []table.Column{
+		{Title: "Line", Width: 6},
+		{Title: m.idTitle(), Width: 16},
+		{Title: "Name", Width: 20},
+		{Title: "Status", Width: 7},
+		{Title: "Error"},
+	}
+	if r.multi {
+		columns = append([]table.Column{{Title: "File", Width: 16}}, columns...)
+	}
+	name, errCol := &columns[len(columns)-3], &columns[len(columns)-1]
+	avail := width
+	for _, c := range columns {
+		avail -= 2 // cell padding
+		if c.Title != "Name" && c.Title != "Error" {
+			avail -= c.Width
+		}
+	}
+	name.Width = min(name.Width, max(avail-20, 8))
+	errCol.Width = max(avail-name.Width, 10)
+
+	shown := m.shownResults()
+	rows := make([]table.Row, len(shown))
+	for i, l := range shown {
+		row := table.Row{lineLabel(l.pos), l.devEUI, l.name, rowStatus(l), rowMessage(l)}
+		if r.multi {
+			row = append(table.Row{filepath.Base(l.source)}, row...)
+		}
+		rows[i] = row
+	}
+
+	r.table.SetColumns(columns)
+	r.table.SetRows(rows)
+	r.table.SetWidth(width)
+	// Leave room for the title, summary and help lines.
+	r.table.SetHeight(max(m.height-10, 5))
+}
+
+// resultsBackHelp describes keyResultsBack with where it goes back to.
+func (m model) resultsBackHelp() (string, string) {
+	if m.resultsTable != nil && m.resultsTable.run != nil {
+		return "esc", "back to previous imports"
+	}
+	return "esc", "back to summary"
+}
+
+// idTitle is the title of the DevEUI column, which holds gateway IDs when
+// gateways were imported.
+func (m model) idTitle() string {
+	if m.cfg.Gateways {
+		return "Gateway ID"
+	}
+	return "DevEUI"
+}
+
+// failuresOnlyHelp describes keyResultsFilter.
+func (m model) failuresOnlyHelp() (string, string) {
+	if m.resultsTable != nil && m.resultsTable.failuresOnly {
+		return "f", "show all rows"
+	}
+	return "f", "show failures only"
+}
+
+// orderHelp describes keyResultsOrder with the order it switches to.
+func (m model) orderHelp() (string, string) {
+	next := 0
+	if m.resultsTable != nil {
+		next = (m.resultsTable.order + 1) % orderCount
+	}
+	return "o", "sort by " + orderNames[next]
+}
+
+// updateResults handles keys on the results table.
+func (m model) updateResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	r := m.resultsTable
+	if r.editor != nil {
+		return m.updateRowEditor(msg)
+	}
+	switch {
+	case keyQuit.matches(m, msg), keyForceQuit.matches(m, msg):
+		return m.quit()
+	case keyResultsBack.matches(m, msg):
+		m.state = stateComplete
+		if r.run != nil {
+			m.state = stateRuns
+		}
+		m.resultsTable = nil
+		return m, nil
+	case keyResultsFilter.matches(m, msg):
+		r.failuresOnly = !r.failuresOnly
+		r.status = ""
+		m.fillResults()
+		r.table.GotoTop()
+		return m, nil
+	case keyResultsOrder.matches(m, msg):
+		r.order = (r.order + 1) % orderCount
+		r.status = ""
+		m.fillResults()
+		r.table.GotoTop()
+		return m, nil
+	case keyResultsSave.matches(m, msg):
+		app := m.appName
+		if r.run != nil {
+			app = cmp.Or(r.run.Application, r.run.ApplicationID)
+		}
+		path := filepath.Join(m.filepicker.dir, appFileName(app, "results", ".csv", time.Now()))
+		rows := m.shownResults()
+		if err := createFile(path, func(w io.Writer) error { return writeResults(w, rows) }); err != nil {
+			r.status = fmt.Sprintf("Writing the results failed: %v", err)
+		} else {
+			r.status = fmt.Sprintf("%d rows written to %s", len(rows), path)
+		}
+		return m, nil
+	case keyResultsEdit.matches(m, msg):
+		return m.editRow()
+	case keyResultsCorrected.matches(m, msg):
+		paths, err := m.writeCorrected()
+		switch {
+		case err != nil:
+			r.status = fmt.Sprintf("Writing the corrected list failed: %v", err)
+		default:
+			r.status = "Corrected list written to " + strings.Join(paths, ", ")
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	r.table, cmd = r.table.Update(msg)
+	return m, cmd
+}
+
+// writeResults writes rows as CSV, as they are listed in the results table.
+func writeResults(w io.Writer, rows []rowLog) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "line", "id", "name", "status", "error"})
+	for _, l := range rows {
+		cw.Write([]string{l.source, lineLabel(l.pos), l.devEUI, l.name, rowStatus(l), rowMessage(l)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (m model) resultsView() string {
+	r := m.resultsTable
+	if r.editor != nil {
+		return m.rowEditorView()
+	}
+	var failed int
+	rows := m.tableRows()
+	for _, l := range rows {
+		if l.err != nil {
+			failed++
+		}
+	}
+	summary := fmt.Sprintf("%d rows, %d failed, invalid or skipped • sorted by %s", len(rows), failed, orderNames[r.order])
+	if r.failuresOnly {
+		summary += " • showing failures only"
+	}
+	if r.status != "" {
+		summary += "\n" + r.status
+	}
+	title := "Results"
+	if r.run != nil {
+		title = "Results of " + runItem(r.run).title
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s\n\n%s",
+		m.header(title),
+		m.theme.status.Render(summary),
+		r.table.View(),
+		m.helpView(),
+	)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// retriedMsg carries the outcome of importing rows of the last run again,
+// to be merged into its results.
+type retriedMsg struct {
+	results []importer.FileResult
+	tried   map[string]map[importer.RowPos]bool // by source, the rows that were imported again
+}
+
+// reportKey identifies a row of m.report, so that the outcome of its retry
+// replaces the earlier one.
+type reportKey struct {
+	source string
+	pos    importer.RowPos
+}
+
+// failedRows counts the rows of the last run that the server rejected. A
+// retry attempts these again; invalid rows aren't among them, as they'd
+// fail the same way until the list is fixed.
+func (m model) failedRows() int {
+	n := 0
+	for _, fr := range m.results {
+		n += len(fr.Result.Failures)
+	}
+	return n
+}
+
+// retryable reports whether the failed rows of the last run can be retried.
+// Gateways aren't, and neither are the rows of an import that was undone.
+func (m model) retryable() bool {
+	return m.state == stateComplete && !m.cfg.Gateways && m.failedRows() > 0 && (m.undo == nil || !m.undo.finished)
+}
+
+// retryHelp describes keyRetryFailed with the number of rows it retries.
+func (m model) retryHelp() (string, string) {
+	return "R", fmt.Sprintf("retry %d failed rows", m.failedRows())
+}
+
+// startRetry imports the failed rows of the last run again.
+func (m model) startRetry() (tea.Model, tea.Cmd) {
+	rows := make(map[string][]importer.Row)
+	for _, fr := range m.results {
+		for _, f := range fr.Result.Failures {
+			rows[fr.Input.Source] = append(rows[fr.Input.Source], f.Row)
+		}
+	}
+	return m.retryRows(rows)
+}
+
+// retryRows imports rows, by the source they're from, again in the background,
+// with the same selections and options as the last run.
+func (m model) retryRows(rows map[string][]importer.Row) (tea.Model, tea.Cmd) {
+	byInput := make(map[*importer.Input][]importer.Row)
+	var inputs []*importer.Input
+	for _, fr := range m.results {
+		if len(rows[fr.Input.Source]) == 0 {
+			continue
+		}
+		in := *fr.Input
+		in.Count = len(rows[in.Source])
+		inputs = append(inputs, &in)
+		byInput[&in] = rows[in.Source]
+	}
+
+	m.reportIndex = make(map[reportKey]int, len(m.report))
+	for i, l := range m.report {
+		m.reportIndex[reportKey{l.source, l.pos}] = i
+	}
+	m.retrying, m.tried = true, make(map[string]map[importer.RowPos]bool)
+	m.events = make(chan tea.Msg)
+	m.done, m.total, m.current = 0, 0, ""
+	m.state = stateProcessing
+	m.logEntries = nil
+	m.shared = ""
+	m.resizeLog()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	m.stopRun = cancel
+	m.clock, m.chunks = newThroughput(time.Now()), nil
+	m.pause, m.paused, m.held = &importer.PauseGate{}, false, false
+	m.workers, m.pace = importer.NewWorkerPool(m.cfg.concurrency), importer.NewPacer(m.cfg.rate)
+	go m.retryDevices(ctx, inputs, byInput, m.events)
+	return m, waitForEvent(m.events)
+}
+
+// retryDevices imports the given rows of inputs like createDevices, adding
+// the devices created to the undo journal of the last run.
+func (m model) retryDevices(ctx context.Context, inputs []*importer.Input, rows map[*importer.Input][]importer.Row, events chan<- tea.Msg) {
+	total := 0
+	for _, in := range inputs {
+		total += in.Count
+	}
+
+	imp := m.newImporter(total, events)
+	if m.createLimit > 0 && m.quota != nil {
+		imp.Limit = m.quota.remaining()
+	}
+	if m.cfg.Mode.Creates() && !m.cfg.dryRun {
+		j, err := reopenJournal(m.runID, m.serverAddr, m.selectedApp)
+		if err != nil {
+			slog.Error("Failed to open the undo journal", "run", m.runID, "err", err)
+		}
+		imp.Journal = j
+		defer j.Close()
+	}
+	results, err := imp.ImportFiles(ctx, inputs, func(_ context.Context, in *importer.Input, emit func(row importer.Row) error) error {
+		for _, row := range rows[in] {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, m.failuresPath)
+	if err != nil {
+		imp.Events.Finish(importer.RunFinished{Err: err})
+		return
+	}
+	imp.Events.Flush()
+	m.verifyDevices(ctx, imp, results, events)
+	imp.Events.Finish(importer.RunFinished{Results: results, Report: imp.Report()})
+}
+
+// record adds the outcome of a row to the report of the run, replacing the
+// earlier outcome of a row being retried.
+func (m *model) record(l rowLog) {
+	if i, ok := m.reportIndex[reportKey{l.source, l.pos}]; ok && m.retrying {
+		m.report[i] = l
+		return
+	}
+	m.report = append(m.report, l)
+}
+
+// reportLogs returns the rows of rep as entries of the report of the run,
+// in the order of the lists of results and of the rows in them; the
+// devices no list has come last.
+func reportLogs(rep importer.Report, results []importer.FileResult) []rowLog {
+	order := make(map[string]int, len(results))
+	for i, fr := range results {
+		order[fr.Input.Source] = i
+	}
+	var rows []importer.RowResult
+	for _, rs := range [][]importer.RowResult{rep.Created, rep.Updated, rep.Skipped, rep.Failed, rep.Removed} {
+		rows = append(rows, rs...)
+	}
+	slices.SortStableFunc(rows, func(a, b importer.RowResult) int {
+		ia, ok := order[a.Source]
+		if !ok {
+			ia = len(results)
+		}
+		ib, ok := order[b.Source]
+		if !ok {
+			ib = len(results)
+		}
+		return cmp.Or(cmp.Compare(ia, ib), cmp.Compare(a.Row.Pos.Line, b.Row.Pos.Line), cmp.Compare(a.Row.Pos.Index, b.Row.Pos.Index))
+	})
+	logs := make([]rowLog, len(rows))
+	for i, r := range rows {
+		logs[i] = rowLog{source: r.Source, pos: r.Row.Pos, devEUI: r.Row.DevEUI, name: r.Row.Name, err: r.Err}
+	}
+	return logs
+}
+
+// mergeRetry adds the outcome of a retry to the results of the files it
+// retried rows of. The rows tried again are no longer failed or invalid
+// unless they failed again. The failures file is rewritten with the rows
+// still failing, or removed if there are none left.
+func (m *model) mergeRetry(msg retriedMsg) {
+	for _, r := range msg.results {
+		tried := msg.tried[r.Input.Source]
+		for i := range m.results {
+			fr := &m.results[i]
+			if fr.Input.Source != r.Input.Source {
+				continue
+			}
+			res, got := &fr.Result, r.Result
+			retried := func(f importer.RowFailure) bool { return tried[f.Row.Pos] }
+			res.Failures = slices.DeleteFunc(res.Failures, retried)
+			res.Add(got)
+
+			for _, f := range fr.Input.Rejected {
+				if retried(f) {
+					if j := slices.Index(fr.Input.Invalid, f.Err.Error()); j >= 0 {
+						fr.Input.Invalid = slices.Delete(fr.Input.Invalid, j, j+1)
+					}
+				}
+			}
+			fr.Input.Rejected = slices.DeleteFunc(fr.Input.Rejected, retried)
+
+			if r.KeysFile != "" {
+				fr.KeysFile = r.KeysFile
+			}
+			switch {
+			case len(res.Failures) == 0 && fr.FailuresFile != "":
+				if err := os.Remove(fr.FailuresFile); err != nil && !os.IsNotExist(err) {
+					slog.Error("Failed to remove the failed rows", "path", fr.FailuresFile, "err", err)
+				}
+				fr.FailuresFile = ""
+			case len(res.Failures) > 0 && !m.cfg.dryRun:
+				fr.FailuresFile = m.failuresPath(r.Input.Source)
+				if err := importer.SaveFailures(fr.FailuresFile, res.Failures); err != nil {
+					slog.Error("Failed to write the failed rows", "path", fr.FailuresFile, "err", err)
+				}
+			}
+			if r.Stopped != nil {
+				fr.Stopped = r.Stopped
+			}
+			if m.quota != nil {
+				m.quota.used += got.Created - len(got.Removed)
+			}
+		}
+	}
+	m.retries++
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// rotateWarning is shown wherever keys are rotated: devices keep working on
+// their current session, but can't join again until they have the new keys.
+const rotateWarning = "Devices must be re-provisioned with their new keys before they next join; until then a rejoin fails"
+
+// rotateSummaryView renders the outcome of the last key rotation. Devices
+// with a session are listed apart, since they keep working on their old
+// session keys until they next join, and that join fails without the new
+// keys.
+func (m model) rotateSummaryView() string {
+	var rotated, sessions []importer.Row
+	var skipped, failed, invalid int
+	var details, keyFiles []string
+	for _, fr := range m.results {
+		rotated = append(rotated, fr.Result.Rotated...)
+		sessions = append(sessions, fr.Result.Sessions...)
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+		}
+		for i, f := range fr.Result.Failures {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more failed rows", prefix, len(fr.Result.Failures)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%s: %s", prefix, f.Row.Pos.Field("dev_eui"), importer.DescribeError(f.Err))))
+		}
+		for _, f := range fr.Result.Skipped {
+			details = append(details, m.theme.help.Render(fmt.Sprintf("- %s%s: %s", prefix, f.Row.DevEUI, importer.DescribeError(f.Err))))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %sstopped early: %v", prefix, fr.Stopped)))
+		}
+		if fr.KeysFile != "" {
+			keyFiles = append(keyFiles, fr.KeysFile)
+		}
+	}
+
+	counts := []string{fmt.Sprintf("%d rotated", len(rotated)), fmt.Sprintf("%d without keys", skipped)}
+	if failed > 0 || invalid > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", failed), fmt.Sprintf("%d invalid", invalid))
+	}
+	status := "Keys rotated: " + strings.Join(counts, " • ")
+	if m.cfg.dryRun {
+		status = "Dry run, no keys generated or changed: " + strings.Join(counts, " • ")
+	}
+
+	view := m.theme.status.Render(status)
+	if len(rotated) > 0 && !m.cfg.dryRun {
+		view += "\n\n" + m.theme.warning.Render("⚠ "+rotateWarning)
+	}
+	for _, f := range keyFiles {
+		view += "\n" + m.theme.warning.Render(fmt.Sprintf("⚠ New keys written to %s; this file contains secrets", f))
+	}
+	if m.cfg.dryRun && len(rotated) > 0 {
+		view += "\n\n" + m.theme.help.Render("Would rotate: "+rowList(rotated, summaryRemoved))
+	}
+	if len(sessions) > 0 {
+		active := "%d devices have an active session, which the rotation doesn't end: they keep working until they rejoin"
+		if m.cfg.dryRun {
+			active = "%d devices have an active session, which a rotation wouldn't end"
+		}
+		view += "\n\n" + m.theme.warning.Render(fmt.Sprintf(active, len(sessions))) + "\n" + m.theme.help.Render(rowList(sessions, summaryRemoved))
+	}
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
+
+// rowList lists the DevEUIs of rows, at most max of them.
+func rowList(rows []importer.Row, max int) string {
+	var euis []string
+	for i, r := range rows {
+		if i == max {
+			euis = append(euis, fmt.Sprintf("…and %d more", len(rows)-i))
+			break
+		}
+		euis = append(euis, r.DevEUI)
+	}
+	return strings.Join(euis, ", ")
+}
+
+// reportRotations prints the outcome of rotating keys in a headless run and
+// returns the exit code. On a dry run every device that would be rotated is
+// listed.
+func reportRotations(cfg config, results []importer.FileResult) int {
+	rotated := "rotated"
+	if cfg.dryRun {
+		rotated = "would rotate"
+	}
+	var total, skipped, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, without keys %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, rotated, len(fr.Result.Rotated), len(fr.Result.Skipped),
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		if cfg.dryRun {
+			for _, row := range fr.Result.Rotated {
+				fmt.Printf("  %s\n", row.DevEUI)
+			}
+		}
+		for _, row := range fr.Result.Sessions {
+			fmt.Printf("  %s: active session, not ended by the rotation\n", row.DevEUI)
+		}
+		for _, f := range fr.Result.Skipped {
+			fmt.Printf("  %s: skipped: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		for _, f := range fr.Result.Failures {
+			fmt.Printf("  %s: %s: %s\n", f.Row.Pos.Field("dev_eui"), f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %v\n", fr.Stopped)
+		}
+		if fr.KeysFile != "" {
+			fmt.Fprintf(os.Stderr, "warning: %d new root keys written to %s; this file contains secrets\n",
+				len(fr.Result.Keys), fr.KeysFile)
+		}
+		total += len(fr.Result.Rotated)
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, without keys %d, failed %d, invalid %d\n", rotated, total, skipped, failed, invalid)
+	}
+	if total > 0 && !cfg.dryRun {
+		fmt.Fprintln(os.Stderr, "warning:", rotateWarning)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
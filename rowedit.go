@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/lorakey"
+)
+
+// Fields of the row editor, which are also the columns a corrected copy of
+// the list changes
+var editFields = []string{"dev_eui", "name", "description", "app_key"}
+
+// rowEditor corrects a failed or invalid row of the results table before it
+// is imported again.
+type rowEditor struct {
+	source string
+	row    importer.Row
+	inputs []textinput.Model // see editFields
+	focus  int
+	status string // why the row can't be submitted
+}
+
+// correction is a row corrected in the row editor, to be written back to a
+// copy of its list.
+type correction struct {
+	pos    importer.RowPos
+	values []string // see editFields
+}
+
+// selectedResult returns the row highlighted in the results table.
+func (m model) selectedResult() (rowLog, bool) {
+	if m.resultsTable == nil {
+		return rowLog{}, false
+	}
+	shown := m.shownResults()
+	i := m.resultsTable.table.Cursor()
+	if i < 0 || i >= len(shown) {
+		return rowLog{}, false
+	}
+	return shown[i], true
+}
+
+// failedRow returns the row behind l if it failed or was invalid.
+func (m model) failedRow(l rowLog) (importer.Row, bool) {
+	for _, fr := range m.results {
+		if fr.Input.Source != l.source {
+			continue
+		}
+		for _, f := range slices.Concat(fr.Result.Failures, fr.Input.Rejected) {
+			if f.Row.Pos == l.pos {
+				return f.Row, true
+			}
+		}
+	}
+	return importer.Row{}, false
+}
+
+// browsingResults reports whether the results table has the keys.
+func (m model) browsingResults() bool {
+	return m.state == stateResults && m.resultsTable.editor == nil
+}
+
+// editingRow reports whether the row editor has the keys.
+func (m model) editingRow() bool {
+	return m.state == stateResults && m.resultsTable.editor != nil
+}
+
+// editable reports whether the highlighted row can be corrected and
+// imported again.
+func (m model) editable() bool {
+	if !m.browsingResults() || m.resultsTable.run != nil || m.cfg.Gateways || (m.undo != nil && m.undo.finished) {
+		return false
+	}
+	l, ok := m.selectedResult()
+	if !ok {
+		return false
+	}
+	_, ok = m.failedRow(l)
+	return ok
+}
+
+// editRow opens the row editor on the highlighted row.
+func (m model) editRow() (tea.Model, tea.Cmd) {
+	l, _ := m.selectedResult()
+	row, _ := m.failedRow(l)
+
+	e := &rowEditor{source: l.source, row: row}
+	for i, v := range []string{row.DevEUI, row.Name, row.Description, row.AppKey} {
+		in := textinput.New()
+		in.Prompt = ""
+		in.Width = 50
+		in.CharLimit = 200
+		in.SetValue(v)
+		if i == 0 {
+			in.Focus()
+		}
+		e.inputs = append(e.inputs, in)
+	}
+	e.status = rowMessage(l)
+	m.resultsTable.editor = e
+	return m, textinput.Blink
+}
+
+// updateRowEditor handles keys while a row is being corrected.
+func (m model) updateRowEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	e := m.resultsTable.editor
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m.quit()
+	case keyEditCancel.matches(m, msg):
+		m.resultsTable.editor = nil
+		return m, nil
+	case keyEditField.matches(m, msg):
+		e.inputs[e.focus].Blur()
+		if msg.String() == "shift+tab" || msg.String() == "up" {
+			e.focus = (e.focus + len(e.inputs) - 1) % len(e.inputs)
+		} else {
+			e.focus = (e.focus + 1) % len(e.inputs)
+		}
+		return m, e.inputs[e.focus].Focus()
+	case keyEditSubmit.matches(m, msg):
+		return m.submitRow()
+	}
+
+	var cmd tea.Cmd
+	e.inputs[e.focus], cmd = e.inputs[e.focus].Update(msg)
+	return m, cmd
+}
+
+// submitRow validates the corrected row like a row of the list and imports
+// it again.
+func (m model) submitRow() (tea.Model, tea.Cmd) {
+	e := m.resultsTable.editor
+	values := make([]string, len(e.inputs))
+	for i, in := range e.inputs {
+		values[i] = strings.TrimSpace(in.Value())
+	}
+
+	row := e.row
+	row.DevEUI, row.Name, row.Description, row.AppKey = lorakey.NormalizeEUI(values[0]), values[1], values[2], lorakey.NormalizeKey(values[3])
+	row.UniqueName = ""
+	if msg := importer.ValidateRow(row, m.cfg.ListOptions); msg != "" {
+		e.status = msg
+		return m, nil
+	}
+
+	if m.corrections == nil {
+		m.corrections = make(map[string][]correction)
+	}
+	m.corrections[e.source] = append(m.corrections[e.source], correction{pos: row.Pos, values: values})
+	m.resultsTable.editor = nil
+	return m.retryRows(map[string][]importer.Row{e.source: {row}})
+}
+
+func (m model) rowEditorView() string {
+	e := m.resultsTable.editor
+	labels := []string{"DevEUI:", "Name:", "Description:", "AppKey:"}
+
+	var b strings.Builder
+	where := "line " + lineLabel(e.row.Pos)
+	if e.row.Pos.Line == 0 {
+		where = "entry " + lineLabel(e.row.Pos)
+	}
+	fmt.Fprintf(&b, "%s, %s\n\n", filepath.Base(e.source), where)
+	for i, in := range e.inputs {
+		fmt.Fprintf(&b, "%-13s %s\n", labels[i], in.View())
+	}
+	if e.status != "" {
+		b.WriteString("\n" + m.theme.status.Render(e.status) + "\n")
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s",
+		m.header("Correct Row"),
+		b.String(),
+		m.helpView(),
+	)
+}
+
+// correctedPath returns where the corrected copy of the list at source is
+// written, e.g. "devices.corrected.csv" next to "devices.csv".
+func correctedPath(source string) string {
+	switch {
+	case source == "" || source == "-":
+		return "stdin.corrected.csv"
+	case importer.IsURL(source):
+		return "download.corrected.csv"
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".corrected" + filepath.Ext(source)
+}
+
+// writeCorrected writes a copy of each list with corrected rows, with the
+// corrections applied, and returns the paths written.
+func (m *model) writeCorrected() ([]string, error) {
+	var paths []string
+	if m.corrected == nil {
+		m.corrected = make(map[string]bool)
+	}
+	for _, fr := range m.results {
+		fixes := m.corrections[fr.Input.Source]
+		if len(fixes) == 0 {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(fr.Input.Name)) {
+		case ".json", ".jsonl", ".ndjson", ".xlsx":
+			return paths, fmt.Errorf("%s: %w", filepath.Base(fr.Input.Source), errNotDelimited)
+		}
+		path := correctedPath(fr.Input.Source)
+		if m.corrected[path] {
+			// Written before with fewer corrections
+			os.Remove(path)
+		}
+		err := createFile(path, func(w io.Writer) error { return m.correctList(w, fr.Input, fixes) })
+		if err != nil {
+			return paths, fmt.Errorf("%s: %w", path, err)
+		}
+		m.corrected[path] = true
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// errNotDelimited is returned for lists that can't be corrected in a copy.
+var errNotDelimited = errors.New("only CSV and other delimited lists can be corrected in a copy")
+
+// correctList copies the delimited list in to w with fixes applied to the
+// columns of editFields, which a headerless list only has the first three
+// of. The copy is UTF-8 and leaves out comment lines.
+func (m model) correctList(w io.Writer, in *importer.Input, fixes []correction) error {
+	r, err := in.Open(context.Background(), m.cfg.ListOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	byLine := make(map[int][]string)
+	for _, f := range fixes {
+		byLine[f.pos.Line] = f.values
+	}
+
+	reader, format := importer.NewDelimitedReader(r, m.cfg.ListOptions)
+	cw := csv.NewWriter(w)
+	cw.Comma = format.Delimiter
+	columns := []int{0, 1, 2, -1} // of editFields, in a headerless list
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first && !lorakey.IsHex(record[0]) {
+			header, _, ok := importer.FindHeader(record, m.cfg.Mappings, m.cfg.Mapping)
+			if !ok {
+				return fmt.Errorf("no DevEUI column in the header")
+			}
+			columns = []int{-1, -1, -1, -1}
+			for i, c := range header {
+				for j, field := range editFields {
+					if c.Name == field && c.Set != nil {
+						columns[j] = i
+					}
+				}
+			}
+		} else if values, ok := byLine[line]; ok {
+			for j, col := range columns {
+				if col >= 0 && col < len(record) {
+					record[col] = values[j]
+				}
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
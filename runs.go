@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// defaultHistoryLimit is how many runs the history keeps unless
+// --history-limit says otherwise.
+const defaultHistoryLimit = 50
+
+// Every run has files in runsDir named after its ID: the record of the run
+// and, for an import that created devices, its undo journal.
+const (
+	runSuffix     = ".run.jsonl"
+	journalSuffix = ".undo.jsonl"
+)
+
+// A run record is JSON lines: a runHeader, then a runRow per row of the
+// run, as the results table lists them.
+
+// runHeader describes a completed run.
+type runHeader struct {
+	ID            string         `json:"id"`
+	StartedAt     time.Time      `json:"started_at"`
+	Server        string         `json:"server"`
+	ApplicationID string         `json:"application_id"`
+	Application   string         `json:"application,omitempty"`
+	Mode          string         `json:"mode"`
+	DryRun        bool           `json:"dry_run,omitempty"`
+	Files         []runFile      `json:"files"`
+	Rows          map[string]int `json:"rows"` // by status, as in the results table
+	Seconds       float64        `json:"duration_seconds"`
+	Chunks        []float64      `json:"chunk_seconds,omitempty"` // duration of each chunk of rows
+}
+
+// runFile is a list imported by a run. Lists piped in or downloaded have
+// no hash unless their content was kept.
+type runFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// runRow is the outcome of a row of a run.
+type runRow struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Index  int    `json:"index,omitempty"`
+	DevEUI string `json:"dev_eui"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runsDir returns the directory of the run history.
+func runsDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runs"), nil
+}
+
+// newRunID returns the ID of a run started at t. IDs sort in the order the
+// runs started.
+func newRunID(t time.Time) string {
+	return t.UTC().Format("20060102-150405.000000")
+}
+
+// runIDs returns the IDs of the runs with files in the history, newest
+// first. An empty history is not an error.
+func runIDs() ([]string, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		for _, suffix := range []string{runSuffix, journalSuffix} {
+			if id, ok := strings.CutSuffix(e.Name(), suffix); ok && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+	return ids, nil
+}
+
+// newRunHeader describes a run of inputs, hashing the lists that can be
+// read again.
+func newRunHeader(id string, started time.Time, server, applicationID, application string, cfg config, inputs []*importer.Input) *runHeader {
+	h := &runHeader{
+		ID:            id,
+		StartedAt:     started.UTC(),
+		Server:        server,
+		ApplicationID: applicationID,
+		Application:   application,
+		Mode:          cfg.Mode.String(),
+		DryRun:        cfg.dryRun,
+	}
+	for _, in := range inputs {
+		f := runFile{Path: in.Source}
+		if abs, err := filepath.Abs(in.Source); err == nil && in.Source != "-" && !importer.IsURL(in.Source) {
+			f.Path = abs
+		}
+		f.SHA256 = inputHash(in)
+		h.Files = append(h.Files, f)
+	}
+	return h
+}
+
+// inputHash returns the SHA-256 of the content of in, or an empty string if
+// it can't be read again.
+func inputHash(in *importer.Input) string {
+	sum := sha256.New()
+	switch {
+	case in.Data != nil:
+		sum.Write(in.Data)
+	case in.Source == "-" || importer.IsURL(in.Source):
+		return ""
+	default:
+		f, err := os.Open(in.Source)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		if _, err := io.Copy(sum, f); err != nil {
+			return ""
+		}
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// saveRun writes the record of the run h with the rows of report,
+// replacing an earlier record of it, then prunes the history to limit runs.
+func saveRun(h *runHeader, report []rowLog, limit int) error {
+	dir, err := runsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	h.Rows = countStatuses(report)
+
+	// Written aside and renamed into place, so that a retry updating the
+	// record never leaves half of one.
+	f, err := os.CreateTemp(dir, ".run-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.Encode(h)
+	for _, l := range report {
+		enc.Encode(runRow{
+			File:   l.source,
+			Line:   l.pos.Line,
+			Index:  l.pos.Index,
+			DevEUI: l.devEUI,
+			Name:   l.name,
+			Status: rowStatus(l),
+			Error:  rowMessage(l),
+		})
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, h.ID+runSuffix)); err != nil {
+		return err
+	}
+	return pruneRuns(limit)
+}
+
+// pruneRuns removes the files of all but the newest limit runs.
+func pruneRuns(limit int) error {
+	ids, err := runIDs()
+	if err != nil || len(ids) <= limit {
+		return err
+	}
+	dir, err := runsDir()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range ids[limit:] {
+		for _, suffix := range []string{runSuffix, journalSuffix} {
+			if err := os.Remove(filepath.Join(dir, id+suffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadRuns reads the headers of the runs in the history, newest first.
+// Records that can't be read are skipped with a warning.
+func loadRuns() ([]*runHeader, error) {
+	ids, err := runIDs()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	var runs []*runHeader
+	for _, id := range ids {
+		f, err := os.Open(filepath.Join(dir, id+runSuffix))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // a journal of a run still going, or of one that crashed
+		}
+		if err != nil {
+			slog.Warn("Failed to read the run", "run", id, "err", err)
+			continue
+		}
+		var h runHeader
+		err = json.NewDecoder(bufio.NewReader(f)).Decode(&h)
+		f.Close()
+		if err != nil {
+			slog.Warn("Failed to read the run", "run", id, "err", err)
+			continue
+		}
+		runs = append(runs, &h)
+	}
+	return runs, nil
+}
+
+// loadRunReport reads the rows of the run id back as the report the results
+// table lists.
+func loadRunReport(id string) ([]rowLog, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, id+runSuffix)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err := dec.Decode(new(runHeader)); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var report []rowLog
+	for {
+		var r runRow
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		report = append(report, rowLog{
+			source: r.File,
+			pos:    importer.RowPos{Line: r.Line, Index: r.Index},
+			devEUI: r.DevEUI,
+			name:   r.Name,
+			err:    storedError(r.Status, r.Error),
+		})
+	}
+	return report, nil
+}
+
+// storedError turns the status and message of a stored row back into an
+// error rowStatus and rowMessage describe the same way.
+func storedError(status, msg string) error {
+	switch status {
+	case "ok":
+		return nil
+	case "skipped":
+		return importer.RowNote(msg)
+	case "invalid":
+		return importer.InvalidRow(msg)
+	case "mismatch":
+		return importer.Mismatch(msg)
+	}
+	return errors.New(msg)
+}
+
+// runsScreen lists the runs in the history.
+type runsScreen struct {
+	list list.Model
+	runs map[string]*runHeader // by ID
+	from state                 // the screen the list was opened from
+}
+
+// runItem describes run h in the list of previous imports.
+func runItem(h *runHeader) item {
+	mode := h.Mode
+	if h.DryRun {
+		mode = "dry-run " + mode
+	}
+	app := h.Application
+	if app == "" {
+		app = h.ApplicationID
+	}
+	files := make([]string, len(h.Files))
+	for i, f := range h.Files {
+		files[i] = filepath.Base(f.Path)
+	}
+	return item{
+		title: fmt.Sprintf("%s · %s into %s", h.StartedAt.Local().Format("2006-01-02 15:04"), mode, app),
+		desc: fmt.Sprintf("%s · %s · %s · %s", h.Server, strings.Join(files, ", "), formatCounts(h.Rows),
+			formatElapsed(time.Duration(h.Seconds*float64(time.Second)))),
+		id: h.ID,
+	}
+}
+
+// openRuns lists the previous imports.
+func (m model) openRuns() (tea.Model, tea.Cmd) {
+	runs, err := loadRuns()
+	items := make([]list.Item, len(runs))
+	byID := make(map[string]*runHeader, len(runs))
+	for i, h := range runs {
+		items[i] = runItem(h)
+		byID[h.ID] = h
+	}
+	l := list.New(items, list.NewDefaultDelegate(), m.width-4, m.height-8)
+	l.Title = fmt.Sprintf("Previous imports (%d)", len(runs))
+	l.SetShowHelp(false) // see helpView
+	m.runs = &runsScreen{list: l, runs: byID, from: m.state}
+	m.state = stateRuns
+
+	var cmd tea.Cmd
+	if err != nil {
+		cmd = l.NewStatusMessage("Reading the history failed: " + err.Error())
+	}
+	return m, cmd
+}
+
+// selectedRun returns the highlighted run of the history.
+func (m model) selectedRun() (*runHeader, bool) {
+	it, ok := m.runs.list.SelectedItem().(item)
+	if !ok {
+		return nil, false
+	}
+	h, ok := m.runs.runs[it.id]
+	return h, ok
+}
+
+// openRun shows the rows of the highlighted run in the results table.
+func (m model) openRun() (tea.Model, tea.Cmd) {
+	h, ok := m.selectedRun()
+	if !ok {
+		return m, nil
+	}
+	report, err := loadRunReport(h.ID)
+	if err != nil {
+		return m, m.runs.list.NewStatusMessage("Reading the run failed: " + err.Error())
+	}
+	sources := make(map[string]bool)
+	for _, l := range report {
+		sources[l.source] = true
+	}
+	m.resultsTable = &resultsScreen{multi: len(sources) > 1, run: h, rows: report}
+	m.resultsTable.table = table.New(table.WithFocused(true))
+	m.fillResults()
+	m.state = stateResults
+	return m, nil
+}
+
+// runUndoable reports whether the highlighted run can be undone: it
+// created devices on the server connected to.
+func (m model) runUndoable() bool {
+	if m.state != stateRuns || !m.listState(list.Unfiltered) || m.client == nil {
+		return false
+	}
+	h, ok := m.selectedRun()
+	if !ok {
+		return false
+	}
+	md, err := importer.ParseMode(h.Mode)
+	return err == nil && md.Creates() && !h.DryRun && h.Server == m.serverAddr
+}
+
+// undoRun opens the undo of the highlighted run.
+func (m model) undoRun() (tea.Model, tea.Cmd) {
+	h, _ := m.selectedRun()
+	u := newUndoScreen(m.serverAddr, h.ID, h.Application, stateRuns)
+	u.prev = m.undo
+	m.undo = u
+	m.state = stateUndo
+	return m, textinput.Blink
+}
+
+// recordRun saves the record of the last run of the TUI to the history,
+// unless it keeps none.
+func (m model) recordRun() {
+	if m.run == nil || m.cfg.noHistory {
+		return
+	}
+	if err := saveRun(m.run, m.report, m.cfg.historyLimit); err != nil {
+		slog.Warn("Failed to save the run to the history", "run", m.run.ID, "err", err)
+	}
+}
+
+func (m model) runsView() string {
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("ChirpStack Device Manager"),
+		m.runs.list.View(),
+		m.helpView(),
+	)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// searchDelay is how long typing into the filter of a long list has to
+// pause before the server is searched.
+const searchDelay = 300 * time.Millisecond
+
+// listSearch searches the tenants, applications or devices on the server
+// when there are more than a list holds, as filtering the fetched ones would
+// miss the rest. Lists holding every item are only filtered locally.
+type listSearch struct {
+	total int    // items on the server, without a query
+	query string // filter the items were last requested for
+	seq   int    // changes of the query, to drop ticks of superseded ones
+}
+
+// partial reports whether the server has more items than a list holds.
+func (s listSearch) partial() bool {
+	return s.total > importer.ListPageSize
+}
+
+// titleHint tells that a partial list is searched on the server.
+func (s listSearch) titleHint() string {
+	if !s.partial() {
+		return ""
+	}
+	return fmt.Sprintf(" (%d of %d, / searches the server)", importer.ListPageSize, s.total)
+}
+
+// Messages of the server-side search
+type (
+	searchTickMsg struct {
+		state state
+		seq   int
+	}
+	searchedMsg struct {
+		state state
+		query string
+		items []item
+		err   error
+	}
+)
+
+// fetchTenants lists the tenants matching search, or the first ones without
+// a search, and returns how many there are in total.
+func (m model) fetchTenants(ctx context.Context, search string) ([]item, int, error) {
+	resp, err := m.tenantClient.List(ctx, &api.ListTenantsRequest{
+		Limit:  importer.ListPageSize,
+		Search: search,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]item, len(resp.Result))
+	importer.ForEachParallel(len(resp.Result), func(i int) {
+		tenant := resp.Result[i]
+		items[i] = item{
+			title: tenant.Name,
+			desc:  tenantDescription(ctx, m.internalClient, tenant),
+			id:    tenant.Id,
+		}
+	})
+	return items, int(resp.TotalCount), nil
+}
+
+// fetchApplications is fetchTenants for the applications of the selected
+// tenant.
+func (m model) fetchApplications(ctx context.Context, search string) ([]item, int, error) {
+	resp, err := m.appClient.List(ctx, &api.ListApplicationsRequest{
+		TenantId: m.selectedTenant,
+		Limit:    importer.ListPageSize,
+		Search:   search,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]item, len(resp.Result))
+	importer.ForEachParallel(len(resp.Result), func(i int) {
+		app := resp.Result[i]
+		items[i] = item{
+			title: app.Name,
+			desc:  applicationDescription(ctx, m.deviceClient, app),
+			id:    app.Id,
+		}
+	})
+	return items, int(resp.TotalCount), nil
+}
+
+// currentSearch returns the search of the current selection list, or nil
+// for lists that aren't searched on the server.
+func (m *model) currentSearch() *listSearch {
+	switch m.state {
+	case stateTenantSelect:
+		return &m.tenantSearch
+	case stateApplicationSelect:
+		return &m.appSearch
+	case stateBrowse:
+		return &m.browser.search
+	}
+	return nil
+}
+
+// searchChanged starts the delay before searching the server once the
+// filter of a partial list has changed.
+func (m *model) searchChanged() tea.Cmd {
+	s, l := m.currentSearch(), m.currentList()
+	if s == nil || !s.partial() || l.FilterValue() == s.query {
+		return nil
+	}
+	s.query = l.FilterValue()
+	s.seq++
+	tick := searchTickMsg{state: m.state, seq: s.seq}
+	return tea.Tick(searchDelay, func(time.Time) tea.Msg { return tick })
+}
+
+// search fetches the items of the list shown in st that match query.
+func (m model) search(st state, query string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		var items []item
+		var err error
+		if st == stateTenantSelect {
+			items, _, err = m.fetchTenants(ctx, query)
+		} else {
+			items, _, err = m.fetchApplications(ctx, query)
+		}
+		return searchedMsg{state: st, query: query, items: items, err: err}
+	}
+}
+
+// updateSearch handles the messages of the server-side search. Results of
+// a query that has since changed are dropped, so the items listed, and the
+// one selected, always belong to the current query.
+func (m model) updateSearch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	s, l := m.currentSearch(), m.currentList()
+	switch msg := msg.(type) {
+	case searchTickMsg:
+		if s == nil || msg.state != m.state || msg.seq != s.seq {
+			return m, nil
+		}
+		if m.state == stateBrowse {
+			m.browser.loading = true
+			return m, m.fetchDevicePage(s.query, 0)
+		}
+		return m, m.search(m.state, s.query)
+
+	case searchedMsg:
+		if s == nil || msg.state != m.state || msg.query != s.query {
+			return m, nil
+		}
+		if msg.err != nil {
+			return m, l.NewStatusMessage("Search failed: " + importer.DescribeError(msg.err))
+		}
+		var items []list.Item
+		if m.state == stateApplicationSelect {
+			items = append(items, newApplicationItem)
+		}
+		for _, it := range msg.items {
+			items = append(items, it)
+		}
+		return m, l.SetItems(items)
+	}
+	return m, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/internal/chirpstacktest"
+)
+
+const testToken = "secret"
+
+// connected returns a model connected to a fake ChirpStack as handleConnect
+// leaves it, with the server.
+func connected(t *testing.T) (model, *chirpstacktest.Server) {
+	t.Helper()
+	srv := chirpstacktest.NewServer(t)
+	conn := srv.Dial(t)
+	m := initialModel(config{server: "chirpstack:8080", plain: true, noHistory: true, startDir: t.TempDir()}, history{})
+	m.client = conn
+	m.tenantClient = api.NewTenantServiceClient(conn)
+	m.appClient = api.NewApplicationServiceClient(conn)
+	m.deviceClient = api.NewDeviceServiceClient(conn)
+	m.profileClient = api.NewDeviceProfileServiceClient(conn)
+	m.internalClient = api.NewInternalServiceClient(conn)
+	m.multicastClient = api.NewMulticastGroupServiceClient(conn)
+	m.apiToken = testToken
+	m.status = ""
+	return m, srv
+}
+
+func TestLoadTenants(t *testing.T) {
+	m, srv := connected(t)
+	for i := 1; i <= 150; i++ {
+		srv.AddTenant(&api.Tenant{Name: fmt.Sprintf("tenant %03d", i), CanHaveGateways: true})
+	}
+	limited := srv.AddTenant(&api.Tenant{Name: "limited", MaxDeviceCount: 10})
+	appID := srv.AddApplication(&api.Application{TenantId: limited, Name: "app"})
+	for _, eui := range []string{"70b3d57ed0000001", "70b3d57ed0000002"} {
+		srv.AddDevice(&api.Device{DevEui: eui, ApplicationId: appID}, nil)
+	}
+
+	msg, ok := m.loadTenants()().(tenantsLoadedMsg)
+	if !ok {
+		t.Fatalf("loadTenants returned %T", msg)
+	}
+	if len(msg.items) != importer.ListPageSize || msg.total != 151 {
+		t.Fatalf("loaded %d tenants of %d, want a page of %d of 151", len(msg.items), msg.total, importer.ListPageSize)
+	}
+	if msg.items[0].title != "tenant 001" || msg.items[0].desc != "0 devices • 0 gateways" {
+		t.Errorf("first tenant = %+v", msg.items[0])
+	}
+	s := listSearch{total: msg.total}
+	if want := " (100 of 151, / searches the server)"; s.titleHint() != want {
+		t.Errorf("titleHint = %q, want %q", s.titleHint(), want)
+	}
+
+	ctx := importer.AuthContext(context.Background(), testToken)
+	items, total, err := m.fetchTenants(ctx, "TENANT 14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 10 || total != 10 {
+		t.Errorf("search found %d tenants of %d, want 10", len(items), total)
+	}
+	items, _, err = m.fetchTenants(ctx, "limited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].id != limited || items[0].desc != "2 devices of max 10 • no gateways allowed" {
+		t.Errorf("search for limited = %+v", items)
+	}
+
+	for _, c := range srv.Calls("") {
+		if c.Auth != "Bearer "+testToken {
+			t.Errorf("%s sent with authorization %q", c.Method, c.Auth)
+		}
+	}
+	for _, c := range srv.Calls(api.TenantService_List_FullMethodName) {
+		if limit := c.Req.(*api.ListTenantsRequest).Limit; limit != importer.ListPageSize {
+			t.Errorf("tenants listed %d at a time, want %d", limit, importer.ListPageSize)
+		}
+	}
+}
+
+func TestLoadTenantOfKey(t *testing.T) {
+	m, srv := connected(t)
+	srv.AddTenant(&api.Tenant{Name: "other"})
+	id := srv.AddTenant(&api.Tenant{Name: "mine", MaxDeviceCount: 5})
+	m.access.kind = tokenTenantKey
+
+	if msg, ok := m.loadTenants()().(loadFailedMsg); !ok || msg.err == nil {
+		t.Errorf("loadTenants without a tenant ID = %v, want it to fail", msg)
+	}
+
+	m.cfg.tenantID = id
+	msg, ok := m.loadTenants()().(tenantsLoadedMsg)
+	if !ok {
+		t.Fatalf("loadTenants returned %T", msg)
+	}
+	if len(msg.items) != 1 || msg.items[0].id != id || msg.total != 1 {
+		t.Errorf("loaded %+v of %d, want only the tenant of the key", msg.items, msg.total)
+	}
+	if n := len(srv.Calls(api.TenantService_List_FullMethodName)); n != 0 {
+		t.Errorf("tenants listed %d times with a tenant key", n)
+	}
+}
+
+func TestLoadDeviceProfiles(t *testing.T) {
+	m, srv := connected(t)
+	m.selectedTenant = srv.AddTenant(&api.Tenant{Name: "tenant"})
+	for i := 1; i <= 150; i++ {
+		srv.AddProfile(&api.DeviceProfile{TenantId: m.selectedTenant, Name: fmt.Sprintf("profile %03d", i)})
+	}
+
+	msg, ok := m.loadDeviceProfiles()().(profilesLoadedMsg)
+	if !ok {
+		t.Fatalf("loadDeviceProfiles returned %T", msg)
+	}
+	if len(msg) != 150 {
+		t.Errorf("loaded %d profiles, want all 150", len(msg))
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// topReasons is how many failure reasons the shared summary lists.
+const topReasons = 5
+
+// summarySharedMsg reports where the summary of the last run went: the
+// clipboard, or a file when there is none.
+type summarySharedMsg struct {
+	status string
+}
+
+// reason is why rows failed, with how many did.
+type reason struct {
+	message string
+	count   int
+}
+
+// failureReasons returns why the rows of the last run failed, the most
+// common first. Skipped rows didn't fail.
+func (m model) failureReasons() []reason {
+	counts := make(map[string]int)
+	for _, l := range m.report {
+		if s := rowStatus(l); s != "ok" && s != "skipped" {
+			counts[rowMessage(l)]++
+		}
+	}
+	reasons := make([]reason, 0, len(counts))
+	for msg, n := range counts {
+		reasons = append(reasons, reason{message: msg, count: n})
+	}
+	slices.SortFunc(reasons, func(a, b reason) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.message, b.message))
+	})
+	return reasons
+}
+
+// runFacts returns what the shared summary and report say about the last
+// run before its failures, as label and value.
+func (m model) runFacts() [][2]string {
+	title := m.cfg.Mode.Title()
+	if m.cfg.dryRun {
+		title += " (dry run)"
+	}
+	if m.abortedBy() != nil {
+		title += ", aborted"
+	}
+	facts := [][2]string{
+		{"Run", title},
+		{"Server", m.serverAddr},
+	}
+	if m.tenantName != "" {
+		facts = append(facts, [2]string{"Tenant", m.tenantName})
+	}
+	if m.appName != "" {
+		facts = append(facts, [2]string{"Application", m.appName})
+	}
+	var files []string
+	for _, fr := range m.results {
+		files = append(files, filepath.Base(fr.Input.Source))
+	}
+	if len(files) > 0 {
+		facts = append(facts, [2]string{"Files", strings.Join(files, ", ")})
+	}
+	facts = append(facts, [2]string{"Rows", fmt.Sprintf("%d: %s", len(m.report), formatCounts(countStatuses(m.report)))})
+	if m.clock != nil {
+		facts = append(facts, [2]string{"Took", formatElapsed(m.clock.elapsed(time.Now()))})
+	}
+	return facts
+}
+
+// plainSummary renders the last run for pasting into a chat.
+func (m model) plainSummary() string {
+	var b strings.Builder
+	b.WriteString("ChirpStack Device Manager\n")
+	for _, f := range m.runFacts() {
+		fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+	}
+	reasons := m.failureReasons()
+	if len(reasons) > 0 {
+		b.WriteString("Top failure reasons:\n")
+	}
+	for i, r := range reasons {
+		if i == topReasons {
+			fmt.Fprintf(&b, "…and %d more\n", len(reasons)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %d× %s\n", r.count, r.message)
+	}
+	return b.String()
+}
+
+// markdownReport renders the last run as Markdown for attaching to a
+// ticket, with a table of every row that failed or was skipped.
+func (m model) markdownReport() string {
+	var b strings.Builder
+	b.WriteString("# ChirpStack Device Manager report\n\n")
+	for _, f := range m.runFacts() {
+		fmt.Fprintf(&b, "- **%s:** %s\n", f[0], markdownCell(f[1]))
+	}
+
+	if reasons := m.failureReasons(); len(reasons) > 0 {
+		b.WriteString("\n## Failure reasons\n\n")
+		for _, r := range reasons {
+			fmt.Fprintf(&b, "- %d× %s\n", r.count, markdownCell(r.message))
+		}
+	}
+
+	var rows []rowLog
+	for _, l := range m.report {
+		if l.err != nil {
+			rows = append(rows, l)
+		}
+	}
+	if len(rows) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n## Failed and skipped rows\n\n")
+	fmt.Fprintf(&b, "| File | Line | %s | Name | Status | Error |\n", m.idTitle())
+	b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, l := range rows {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", markdownCell(filepath.Base(l.source)), lineLabel(l.pos),
+			markdownCell(l.devEUI), markdownCell(l.name), rowStatus(l), markdownCell(rowMessage(l)))
+	}
+	return b.String()
+}
+
+// markdownCell escapes s for a Markdown table cell or list item.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// copySummary copies the summary of the last run to the clipboard. Without
+// one, as on a server reached over SSH, the summary is written to a file
+// next to the list instead.
+func (m model) copySummary() tea.Cmd {
+	summary := m.plainSummary()
+	path := filepath.Join(m.filepicker.dir, appFileName(m.appName, "summary", ".txt", time.Now()))
+	return func() tea.Msg {
+		var err error
+		switch {
+		case os.Getenv("SSH_CONNECTION") != "":
+			err = errors.New("over SSH")
+		case clipboard.Unsupported:
+			err = errors.New("no clipboard tool found")
+		default:
+			err = clipboard.WriteAll(summary)
+		}
+		if err == nil {
+			return summarySharedMsg{status: "Summary copied to the clipboard"}
+		}
+		if werr := os.WriteFile(path, []byte(summary), 0o644); werr != nil {
+			return summarySharedMsg{status: fmt.Sprintf("No clipboard (%v), and writing the summary failed: %v", err, werr)}
+		}
+		return summarySharedMsg{status: fmt.Sprintf("No clipboard (%v), summary written to %s", err, path)}
+	}
+}
+
+// writeReport writes the Markdown report of the last run next to the list
+// and returns where it went, or why it didn't.
+func (m model) writeReport() string {
+	path := filepath.Join(m.filepicker.dir, appFileName(m.appName, "report", ".md", time.Now()))
+	report := m.markdownReport()
+	if err := os.WriteFile(path, []byte(report), 0o644); err != nil {
+		return fmt.Sprintf("Writing the report failed: %v", err)
+	}
+	return "Report written to " + path
+}
+
+// sharedView renders where the summary or report of the last run went.
+func (m model) sharedView() string {
+	if m.shared == "" {
+		return ""
+	}
+	return "\n" + m.theme.help.Render(m.shared)
+}
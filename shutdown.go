@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// shutdownSignals stop the program gracefully: ctrl+c outside the TUI,
+// systemd stopping a unit and the terminal being closed.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// shutdownGrace is how long the TUI waits for an import to stop after the
+// row in flight before quitting anyway.
+const shutdownGrace = 5 * time.Second
+
+// interrupted is the cause of an import stopped by a signal or ctrl+c.
+type interrupted struct {
+	sig os.Signal
+}
+
+func (i interrupted) Error() string { return "the import was interrupted" }
+
+// exitCode follows the shell's convention of 128 plus the signal number,
+// e.g. 130 for ctrl+c, so scripts can tell an interrupted import from a
+// failed one.
+func (i interrupted) exitCode() int {
+	if s, ok := i.sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// notifyShutdown returns a copy of ctx that is cancelled, with an
+// interrupted cause, when one of shutdownSignals arrives. Calling cancel
+// stops listening.
+func notifyShutdown(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, shutdownSignals...)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case sig := <-sigs:
+			cancel(interrupted{sig})
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// exitCode returns code, the exit code of a run, or that of the signal
+// which interrupted ctx.
+func exitCode(ctx context.Context, code int) int {
+	var i interrupted
+	if errors.As(context.Cause(ctx), &i) {
+		return i.exitCode()
+	}
+	return code
+}
+
+// shutdownMsg is a shutdown signal received while the TUI runs.
+type shutdownMsg struct {
+	sig os.Signal
+}
+
+// shutdownTimeoutMsg ends the wait for an interrupted import to stop.
+type shutdownTimeoutMsg struct{}
+
+// shutdown quits on a signal or ctrl+c. An import in progress is stopped
+// after the row in flight, so that its failed rows, generated keys and undo
+// journal are written, and the program quits once it has. A second signal,
+// or shutdownGrace passing, quits without waiting any longer.
+func (m model) shutdown(cause interrupted) (tea.Model, tea.Cmd) {
+	m.exitCode = cause.exitCode()
+	if m.stopping || m.state != stateProcessing || m.stopRun == nil {
+		return m.quit()
+	}
+	m.stopping = true
+	m.stopRun(cause)
+	return m, tea.Tick(shutdownGrace, func(time.Time) tea.Msg { return shutdownTimeoutMsg{} })
+}
+
+// quit closes the connection to the server and ends the program.
+func (m model) quit() (tea.Model, tea.Cmd) {
+	if m.client != nil {
+		m.client.Close()
+	}
+	return m, tea.Quit
+}
+
+// printInterrupted tells what an interrupted import got done and where its
+// files are, once the terminal has been restored.
+func (m model) printInterrupted() {
+	if !m.stopping {
+		return
+	}
+	if m.results == nil {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d of %d %s before the import could stop; the log file lists those processed\n",
+			m.done, m.total, m.noun())
+		return
+	}
+
+	created, failed := 0, 0
+	for _, fr := range m.results {
+		created += fr.Result.Created
+		failed += len(fr.Result.Failures)
+	}
+	fmt.Fprintf(os.Stderr, "Interrupted after %d of %d %s: %s %d, failed %d\n",
+		m.done, m.total, m.noun(), strings.ToLower(m.cfg.Mode.PastTense()), created, failed)
+	for _, fr := range m.results {
+		if fr.FailuresFile != "" {
+			fmt.Fprintf(os.Stderr, "  %s: failed rows written to %s\n", filepath.Base(fr.Input.Source), fr.FailuresFile)
+		}
+		if fr.KeysFile != "" {
+			fmt.Fprintf(os.Stderr, "  %s: generated keys written to %s; this file contains secrets\n", filepath.Base(fr.Input.Source), fr.KeysFile)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// statusEntry is whether one listed device is alive, in a status report.
+// Battery and margin are nil when the device hasn't reported them.
+type statusEntry struct {
+	DevEUI        string   `json:"dev_eui"`
+	Exists        bool     `json:"exists"`
+	Joined        bool     `json:"joined"`
+	Name          string   `json:"name,omitempty"`
+	ApplicationID string   `json:"application_id,omitempty"`
+	LastSeenAt    string   `json:"last_seen_at,omitempty"`
+	BatteryLevel  *float32 `json:"battery_level,omitempty"` // percent
+	ExternalPower bool     `json:"external_power,omitempty"`
+	Margin        *int32   `json:"margin,omitempty"` // dB, of the last link check
+	Error         string   `json:"error,omitempty"`
+}
+
+// statusReport is the status of the devices of device lists. Making it only
+// reads devices, so it is safe with a read-only API key.
+type statusReport struct {
+	CheckedAt string        `json:"checked_at"`
+	Devices   []statusEntry `json:"devices"`
+}
+
+// checkDevice looks up whether the device devEUI exists, has joined and
+// when it was last seen. A device that doesn't exist is reported as such
+// rather than failed; other errors are kept in the entry.
+func checkDevice(ctx context.Context, client api.DeviceServiceClient, devEUI string) statusEntry {
+	e := statusEntry{DevEUI: devEUI}
+	resp, err := client.Get(ctx, &api.GetDeviceRequest{DevEui: devEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return e
+	case err != nil:
+		e.Error = redact.Secrets(createErrorMessage(err))
+		return e
+	}
+
+	e.Exists = true
+	e.Name = resp.Device.GetName()
+	e.ApplicationID = resp.Device.GetApplicationId()
+	e.LastSeenAt = formatTimestamp(resp.LastSeenAt)
+	if s := resp.DeviceStatus; s != nil {
+		e.Margin = &s.Margin
+		e.ExternalPower = s.ExternalPowerSource
+		// A level below 0 means the device couldn't measure it.
+		if !s.ExternalPowerSource && s.BatteryLevel >= 0 {
+			e.BatteryLevel = &s.BatteryLevel
+		}
+	}
+
+	act, err := client.GetActivation(ctx, &api.GetDeviceActivationRequest{DevEui: devEUI})
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		e.Error = redact.Secrets(createErrorMessage(err))
+	default:
+		e.Joined = act.DeviceActivation.GetDevAddr() != ""
+	}
+	return e
+}
+
+// checkStatus reports the status of the devices of the rows of inputs, in
+// list order, checking as many at once as pool has workers. progress, if
+// not nil, is called after each device with the number checked so far.
+func checkStatus(ctx context.Context, client api.DeviceServiceClient, inputs []*importer.Input, cfg config, pool *importer.WorkerPool, progress func(done int)) (*statusReport, error) {
+	rows, err := scanRows(ctx, inputs, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &statusReport{CheckedAt: time.Now().UTC().Format(time.RFC3339), Devices: make([]statusEntry, len(rows))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := 0
+	for i, row := range rows {
+		pool.Acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pool.Release()
+			e := checkDevice(ctx, client, row.DevEUI)
+
+			mu.Lock()
+			defer mu.Unlock()
+			r.Devices[i] = e
+			done++
+			if progress != nil {
+				progress(done)
+			}
+		}()
+	}
+	wg.Wait()
+	return r, nil
+}
+
+// counts returns how many devices of r exist, have joined and couldn't be
+// checked.
+func (r *statusReport) counts() (exists, joined, failed int) {
+	for _, e := range r.Devices {
+		if e.Exists {
+			exists++
+		}
+		if e.Joined {
+			joined++
+		}
+		if e.Error != "" {
+			failed++
+		}
+	}
+	return exists, joined, failed
+}
+
+// yesNo formats b for a report.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// cells returns whether e exists and has joined for a report, "?" where
+// checking failed, and the battery level and margin, empty when the device
+// hasn't reported them.
+func (e statusEntry) cells() (exists, joined, battery, margin string) {
+	exists, joined = yesNo(e.Exists), yesNo(e.Joined)
+	if e.Error != "" {
+		joined = "?"
+		if !e.Exists {
+			exists = "?"
+		}
+	}
+	switch {
+	case e.ExternalPower:
+		battery = "external"
+	case e.BatteryLevel != nil:
+		battery = strconv.FormatFloat(float64(*e.BatteryLevel), 'f', -1, 32)
+	}
+	if e.Margin != nil {
+		margin = strconv.Itoa(int(*e.Margin))
+	}
+	return exists, joined, battery, margin
+}
+
+// writeStatusCSV writes r as CSV, one row per listed device.
+func writeStatusCSV(w io.Writer, r *statusReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"dev_eui", "exists", "joined", "name", "application_id", "last_seen_at", "battery_level", "margin", "error"})
+	for _, e := range r.Devices {
+		exists, joined, battery, margin := e.cells()
+		cw.Write([]string{e.DevEUI, exists, joined, e.Name, e.ApplicationID, e.LastSeenAt, battery, margin, e.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeStatusJSON writes r as indented JSON.
+func writeStatusJSON(w io.Writer, r *statusReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// saveStatus writes r to path, as JSON if the name ends in .json and as CSV
+// otherwise, refusing to overwrite an existing file.
+func saveStatus(path string, r *statusReport) error {
+	return createFile(path, func(w io.Writer) error {
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			return writeStatusJSON(w, r)
+		}
+		return writeStatusCSV(w, r)
+	})
+}
+
+// statusCheckedMsg carries the status of the previewed devices.
+type statusCheckedMsg *statusReport
+
+// loadStatus checks the status of the previewed devices.
+func (m model) loadStatus() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		r, err := checkStatus(ctx, m.deviceClient, m.inputs, m.cfg, importer.NewWorkerPool(m.cfg.concurrency), nil)
+		if err != nil {
+			return loadFailedMsg{err}
+		}
+		return statusCheckedMsg(r)
+	}
+}
+
+// newStatusTable lays out r as a table.
+func newStatusTable(r *statusReport, width, height int) table.Model {
+	var rows []table.Row
+	for _, e := range r.Devices {
+		exists, joined, battery, margin := e.cells()
+		lastSeen := e.LastSeenAt
+		if e.Exists && lastSeen == "" {
+			lastSeen = "never"
+		}
+		rows = append(rows, table.Row{e.DevEUI, exists, joined, lastSeen, battery, margin, e.Name, e.Error})
+	}
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "DevEUI", Width: 16},
+			{Title: "Exists", Width: 6},
+			{Title: "Joined", Width: 6},
+			{Title: "Last seen", Width: 20},
+			{Title: "Battery", Width: 8},
+			{Title: "Margin", Width: 6},
+			{Title: "Name", Width: 20},
+			{Title: "Error", Width: 30},
+		}),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithHeight(max(height-12, 5)),
+		table.WithWidth(width-4),
+	)
+}
+
+// updateStatus handles keys on the status screen.
+func (m model) updateStatus(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyReportCSV.matches(m, msg), keyReportJSON.matches(m, msg):
+		ext := ".csv"
+		if keyReportJSON.matches(m, msg) {
+			ext = ".json"
+		}
+		path := filepath.Join(m.filepicker.dir, appFileName(m.appName, "status", ext, time.Now()))
+		if err := saveStatus(path, m.deviceStatus); err != nil {
+			m.status = fmt.Sprintf("Writing report failed: %v", err)
+		} else {
+			m.status = "Report written to " + path
+		}
+		return m, nil
+	case keyStatusBack.matches(m, msg):
+		m.deviceStatus = nil
+		m.status = ""
+		m.state = statePreview
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.statusTable, cmd = m.statusTable.Update(msg)
+	return m, cmd
+}
+
+func (m model) statusView() string {
+	exists, joined, failed := m.deviceStatus.counts()
+	summary := fmt.Sprintf("%d devices checked, nothing was changed: %d exist, %d have joined",
+		len(m.deviceStatus.Devices), exists, joined)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d couldn't be checked", failed)
+	}
+
+	var status string
+	if m.status != "" {
+		status = "\n" + m.theme.status.Render(m.status) + "\n"
+	}
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s\n%s\n%s",
+		m.header("Device Status"),
+		summary,
+		m.statusTable.View(),
+		status,
+		m.helpView(),
+	)
+}
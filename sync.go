@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// syncPlan is what a sync will change to make an application match the
+// device lists.
+type syncPlan struct {
+	existing  map[string]*api.DeviceListItem // devices of the application by DevEUI
+	create    []importer.Row
+	update    []syncChange
+	unchanged int
+	remove    []*api.DeviceListItem // in the application but not in the lists, deleted with --sync-delete
+}
+
+// syncChange is a device whose fields differ from its row.
+type syncChange struct {
+	row     importer.Row
+	changes []string // e.g. `name: "a" → "b"`
+}
+
+// planSync compares the devices of an application with the rows of inputs.
+// The devices listed for --skip-existing are used rather than listed again.
+func planSync(ctx context.Context, client api.DeviceServiceClient, applicationID string, inputs []*importer.Input, cfg config) (*syncPlan, error) {
+	var devices []*api.DeviceListItem
+	if cfg.ServerDevices != nil {
+		devices = slices.SortedFunc(maps.Values(cfg.ServerDevices), func(a, b *api.DeviceListItem) int {
+			return strings.Compare(a.DevEui, b.DevEui)
+		})
+	} else {
+		var err error
+		if devices, err = importer.ListDevices(ctx, client, applicationID, nil); err != nil {
+			return nil, fmt.Errorf("listing devices: %w", err)
+		}
+	}
+
+	plan := &syncPlan{existing: serverDevices(devices)}
+
+	listed := make(map[string]bool)
+	b := importer.NewBatch(cfg.ListOptions, inputs)
+	for _, in := range inputs {
+		err := b.Scan(ctx, in, func(row importer.Row) error {
+			listed[row.DevEUI] = true
+			d, ok := plan.existing[row.DevEUI]
+			if !ok {
+				plan.create = append(plan.create, row)
+			} else if changes := importer.DiffDevice(d, row); len(changes) > 0 {
+				plan.update = append(plan.update, syncChange{row: row, changes: changes})
+			} else {
+				plan.unchanged++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", in.Source, err)
+		}
+	}
+
+	for _, d := range devices {
+		if !listed[strings.ToLower(d.DevEui)] {
+			plan.remove = append(plan.remove, d)
+		}
+	}
+	return plan, nil
+}
+
+// existing returns the devices the sync plan found in the application, or
+// nil when not syncing.
+func (m model) existing() map[string]*api.DeviceListItem {
+	if m.plan == nil {
+		return nil
+	}
+	return m.plan.existing
+}
+
+// Categories of the sync plan screen
+const (
+	planCreate = iota
+	planUpdate
+	planRemove
+)
+
+// syncPlannedMsg carries the plan computed for the previewed inputs.
+type syncPlannedMsg *syncPlan
+
+// loadSyncPlan computes the sync plan of the previewed inputs.
+func (m model) loadSyncPlan() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		plan, err := planSync(ctx, m.deviceClient, m.selectedApp, m.inputs, m.cfg)
+		if err != nil {
+			return loadFailedMsg{err}
+		}
+		return syncPlannedMsg(plan)
+	}
+}
+
+// count returns the number of devices in a category of the plan.
+func (p *syncPlan) count(category int) int {
+	switch category {
+	case planCreate:
+		return len(p.create)
+	case planUpdate:
+		return len(p.update)
+	}
+	return len(p.remove)
+}
+
+// lines lists the devices of a category of the plan, one per line.
+func (p *syncPlan) lines(category int) []string {
+	var lines []string
+	switch category {
+	case planCreate:
+		for _, row := range p.create {
+			lines = append(lines, row.DevEUI+" "+row.Name)
+		}
+	case planUpdate:
+		for _, c := range p.update {
+			lines = append(lines, c.row.DevEUI+" "+strings.Join(c.changes, ", "))
+		}
+	case planRemove:
+		for _, d := range p.remove {
+			lines = append(lines, d.DevEui+" "+d.Name)
+		}
+	}
+	return lines
+}
+
+// updatePlan handles keys on the sync plan screen.
+func (m model) updatePlan(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyPlanMove.matches(m, msg):
+		if msg.String() == "up" || msg.String() == "k" {
+			m.planCursor = (m.planCursor + 2) % 3
+		} else {
+			m.planCursor = (m.planCursor + 1) % 3
+		}
+	case keyPlanOpen.matches(m, msg):
+		m.planDetail = viewport.New(m.width-4, max(m.height-10, 5))
+		m.planDetail.SetContent(strings.Join(m.plan.lines(m.planCursor), "\n"))
+		m.planOpen = true
+	case keyPlanClose.matches(m, msg):
+		m.planOpen = false
+	case keyPlanAccept.matches(m, msg):
+		m.planOpen = false
+		return m.confirm()
+	case keyPlanBack.matches(m, msg):
+		m.plan = nil
+		m.state = statePreview
+	case m.planOpen:
+		var cmd tea.Cmd
+		m.planDetail, cmd = m.planDetail.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m model) planView() string {
+	p := m.plan
+	names := []string{"to create", "to update", "to delete"}
+	if !m.cfg.syncDelete {
+		names[planRemove] = "not in the list, kept"
+	}
+
+	if m.planOpen {
+		return fmt.Sprintf(
+			"%s\n\n%d devices %s\n\n%s\n\n%s",
+			m.header("Sync Plan"),
+			p.count(m.planCursor),
+			names[m.planCursor],
+			m.planDetail.View(),
+			m.helpView(),
+		)
+	}
+
+	var b strings.Builder
+	for i, name := range names {
+		cursor := "  "
+		if i == m.planCursor {
+			cursor = "> "
+		}
+		line := fmt.Sprintf("%s%6d %s", cursor, p.count(i), name)
+		if i == planRemove && !m.cfg.syncDelete {
+			line = m.theme.help.Render(line + " (--sync-delete deletes them)")
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "  %6d unchanged\n", p.unchanged)
+
+	return fmt.Sprintf(
+		"%s\n\nChanges to make %s match the list:\n\n%s\n%s",
+		m.header("Sync Plan"),
+		m.appName,
+		b.String(),
+		m.helpView(),
+	)
+}
+
+// syncSummaryView renders the outcome of the last sync, with a count per
+// kind of change.
+func (m model) syncSummaryView() string {
+	var created, updated, unchanged, failed, invalid int
+	var details []string
+	for _, fr := range m.results {
+		created += fr.Result.Created
+		updated += fr.Result.Updated
+		unchanged += fr.Result.Unchanged
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+		if fr.FailuresFile != "" {
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %d devices of %s failed, see %s",
+				len(fr.Result.Failures), filepath.Base(fr.Input.Source), fr.FailuresFile)))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %s: stopped early: %v", filepath.Base(fr.Input.Source), fr.Stopped)))
+		}
+	}
+	failed += len(m.unlisted.Failures)
+
+	counts := []string{
+		fmt.Sprintf("%d created", created),
+		fmt.Sprintf("%d updated", updated),
+		fmt.Sprintf("%d unchanged", unchanged),
+	}
+	if m.cfg.syncDelete {
+		counts = append(counts, fmt.Sprintf("%d deleted", len(m.unlisted.Removed)))
+	}
+	if failed > 0 || invalid > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", failed), fmt.Sprintf("%d invalid", invalid))
+	}
+
+	status := "Synced: " + strings.Join(counts, " • ")
+	if m.cfg.dryRun {
+		status = "Dry run, nothing changed: " + strings.Join(counts, " • ")
+	}
+	for _, f := range m.unlisted.Failures {
+		details = append(details, m.theme.help.Render(fmt.Sprintf("✗ deleting %s: %s", f.Row.DevEUI, importer.DescribeError(f.Err))))
+	}
+
+	view := m.theme.status.Render(status)
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// tagFilter selects the devices of an application by their tags, for the
+// modes that can run over such a selection instead of a list. A device
+// matches when it has every tag of the filter, with the same value or, with
+// prefix, a value starting with it. The zero filter matches every device.
+type tagFilter struct {
+	tags   map[string]string
+	prefix bool
+}
+
+// parseTagFilter parses filters such as "site=north, floor=2".
+func parseTagFilter(list []string, prefix bool) (tagFilter, error) {
+	tags, err := importer.ParseTags(list)
+	if err != nil {
+		return tagFilter{}, err
+	}
+	return tagFilter{tags: tags, prefix: prefix}, nil
+}
+
+// matches reports whether a device with tags is selected by f.
+func (f tagFilter) matches(tags map[string]string) bool {
+	for k, v := range f.tags {
+		have, ok := tags[k]
+		switch {
+		case !ok:
+			return false
+		case f.prefix && !strings.HasPrefix(have, v), !f.prefix && have != v:
+			return false
+		}
+	}
+	return true
+}
+
+// String describes f for messages, e.g. "site=north, floor=2*" where the
+// star marks a value prefix.
+func (f tagFilter) String() string {
+	if len(f.tags) == 0 {
+		return "any tags"
+	}
+	var pairs []string
+	for k, v := range f.tags {
+		pair := k + "=" + v
+		if f.prefix {
+			pair += "*"
+		}
+		pairs = append(pairs, pair)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// applicationInput lists the devices of an application that match filter as
+// a device list, to run mode md over them instead of over a file. The List
+// API doesn't filter by tag, so every device is listed and the filter is
+// applied here. name names the list, and the files written next to it such
+// as the keys file of a rotation, see importer.FileResult.KeysFile.
+// progress is passed on to importer.ListDevices.
+func applicationInput(ctx context.Context, client api.DeviceServiceClient, applicationID, name string, md importer.Mode, filter tagFilter, progress func(done, total int)) (*importer.Input, error) {
+	devices, err := importer.ListDevices(ctx, client, applicationID, progress)
+	if err != nil {
+		return nil, fmt.Errorf("listing the devices of %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"dev_eui", "name"})
+	matched := 0
+	for _, d := range devices {
+		if filter.matches(d.Tags) {
+			cw.Write([]string{d.DevEui, d.Name})
+			matched++
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(devices) == 0:
+		return nil, fmt.Errorf("%s has no devices", name)
+	case matched == 0:
+		return nil, fmt.Errorf("none of the %d devices of %s have %s", len(devices), name, filter)
+	}
+	source := appFileName(name, md.String(), ".csv", time.Now())
+	return &importer.Input{Source: source, Name: source, Data: buf.Bytes()}, nil
+}
+
+// selectDevices previews the devices of the selected application that match
+// filter, in place of a device list. Toggling them disables them unless
+// --enable was given; the preview can switch that.
+func (m model) selectDevices(filter tagFilter) (tea.Model, tea.Cmd) {
+	if m.cfg.Mode == importer.ModeMove && m.cfg.TargetApplication == "" {
+		m.status = "Moving devices selected by tag needs --to-application"
+		return m, nil
+	}
+	if m.cfg.Mode == importer.ModeToggle && m.cfg.Disable == nil {
+		disable := true
+		m.cfg.Disable = &disable
+	}
+
+	m.cfg.ServerNames, m.cfg.Renames, m.cfg.ServerDevices = nil, nil, nil
+	m.selection = &filter
+
+	m.events = make(chan tea.Msg)
+	m.done, m.total, m.current = 0, 0, ""
+	m.state = stateProcessing
+	m.stopRun = nil
+	m.clock = nil
+	m.pause, m.paused = nil, false
+
+	go func(events chan<- tea.Msg) {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+		in, err := applicationInput(ctx, m.deviceClient, m.selectedApp, m.appName, m.cfg.Mode, filter, func(done, total int) {
+			events <- importProgressMsg{done: done, total: total, current: "the devices of " + m.appName}
+		})
+		if err != nil {
+			events <- errorMsg(err)
+			return
+		}
+		// Next to the lists of the file picker, as are the files written
+		// next to a list, see failuresPath and importer.FileResult.KeysFile.
+		in.Source = filepath.Join(m.filepicker.dir, in.Source)
+		m.previewInputs([]*importer.Input{in}, nil, events)
+	}(m.events)
+	return m, waitForEvent(m.events)
+}
+
+// updateFilterInput handles keys while the tag filter input replaces the
+// file picker. An empty filter selects every device of the application.
+func (m model) updateFilterInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyInputBack.matches(m, msg):
+		m.enteringFilter = false
+		m.filterInput.Blur()
+		m.status = ""
+		return m, nil
+	case keyFilterPrefix.matches(m, msg):
+		m.filterPrefix = !m.filterPrefix
+		return m, nil
+	case keySelectDevices.matches(m, msg):
+		filter, err := parseTagFilter([]string{m.filterInput.Value()}, m.filterPrefix)
+		if err != nil {
+			m.status = err.Error()
+			return m, nil
+		}
+		m.enteringFilter = false
+		m.filterInput.Blur()
+		m.status = ""
+		return m.selectDevices(filter)
+	}
+
+	var cmd tea.Cmd
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	return m, cmd
+}
+
+// filterPrefixHelp describes keyFilterPrefix by what it switches to.
+func (m model) filterPrefixHelp() (string, string) {
+	if m.filterPrefix {
+		return "tab", "match values exactly"
+	}
+	return "tab", "match value prefixes"
+}
+
+func (m model) filterInputView() string {
+	match := "Values must match exactly"
+	if m.filterPrefix {
+		match = "Values must start with the ones given"
+	}
+	var status string
+	if m.status != "" {
+		status = "\n\n" + m.theme.status.Render(m.status)
+	}
+	return fmt.Sprintf(
+		"%s\n\nTags the devices of %s to %s must have, key=value separated by commas; none for every device:\n%s\n%s%s\n\n%s",
+		m.header("Select Devices by Tag"),
+		m.appName,
+		m.cfg.Mode.Verb(),
+		m.filterInput.View(),
+		m.theme.help.Render(match),
+		status,
+		m.helpView(),
+	)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// newProfileItem is the first entry of the device-profile list, listing the
+// device-profile templates to create one from.
+var newProfileItem = item{
+	title:  "➕ Create from a device-profile template…",
+	desc:   "Create a device profile in this tenant from the server's template repository",
+	create: true,
+}
+
+// Messages for the device-profile templates and the profile created from one
+type (
+	templatesLoadedMsg     []item
+	profileCreatedMsg      item
+	profileCreateFailedMsg struct{ err error } // see applicationFailedMsg
+)
+
+// loadTemplates fetches every device-profile template of the server, page
+// by page, as the repository can hold thousands and the API has no search.
+// The list filters them locally.
+func (m model) loadTemplates() tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+
+		var items []item
+		for {
+			resp, err := m.templateClient.List(ctx, &api.ListDeviceProfileTemplatesRequest{
+				Limit:  importer.ListPageSize,
+				Offset: uint32(len(items)),
+			})
+			if err != nil {
+				return loadFailedMsg{err}
+			}
+			for _, t := range resp.Result {
+				items = append(items, item{
+					title:     t.Name,
+					desc:      templateDescription(t),
+					id:        t.Id,
+					lorawan11: importer.IsLoRaWAN11(t.MacVersion),
+					region:    t.Region.String(),
+				})
+			}
+			if len(resp.Result) == 0 || len(items) >= int(resp.TotalCount) {
+				return templatesLoadedMsg(items)
+			}
+		}
+	}
+}
+
+// templateDescription is profileDescription for a template, led by its
+// vendor and firmware, which tell templates of the same name apart.
+func templateDescription(t *api.DeviceProfileTemplateListItem) string {
+	parts := []string{t.Vendor}
+	if t.Firmware != "" {
+		parts = append(parts, "firmware "+t.Firmware)
+	}
+	return strings.Join(append(parts, profileDescription(&api.DeviceProfileListItem{
+		Region:         t.Region,
+		MacVersion:     t.MacVersion,
+		SupportsOtaa:   t.SupportsOtaa,
+		SupportsClassB: t.SupportsClassB,
+		SupportsClassC: t.SupportsClassC,
+	})), " • ")
+}
+
+// openTemplates shows the list of templates just loaded.
+func (m model) openTemplates(items []item) (tea.Model, tea.Cmd) {
+	listItems := make([]list.Item, len(items))
+	for i, v := range items {
+		listItems[i] = v
+	}
+	m.templateList = list.New(listItems, list.NewDefaultDelegate(), m.width-4, m.height-8)
+	m.templateList.Title = "Create Device Profile from Template"
+	m.templateList.SetShowHelp(false) // see helpView
+	m.templateList.StatusMessageLifetime = 10 * time.Second
+	m.state = stateTemplateSelect
+	return m, nil
+}
+
+// createProfile creates a device profile in the selected tenant with the
+// settings of the template with id, named like it.
+func (m model) createProfile(id string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+
+		resp, err := m.templateClient.Get(ctx, &api.GetDeviceProfileTemplateRequest{Id: id})
+		if err != nil {
+			return profileCreateFailedMsg{err}
+		}
+		t := resp.DeviceProfileTemplate
+		p := &api.DeviceProfile{
+			TenantId:                  m.selectedTenant,
+			Name:                      t.Name,
+			Description:               t.Description,
+			Region:                    t.Region,
+			MacVersion:                t.MacVersion,
+			RegParamsRevision:         t.RegParamsRevision,
+			AdrAlgorithmId:            t.AdrAlgorithmId,
+			PayloadCodecRuntime:       t.PayloadCodecRuntime,
+			PayloadCodecScript:        t.PayloadCodecScript,
+			FlushQueueOnActivate:      t.FlushQueueOnActivate,
+			UplinkInterval:            t.UplinkInterval,
+			DeviceStatusReqInterval:   t.DeviceStatusReqInterval,
+			SupportsOtaa:              t.SupportsOtaa,
+			SupportsClassB:            t.SupportsClassB,
+			SupportsClassC:            t.SupportsClassC,
+			ClassBTimeout:             t.ClassBTimeout,
+			ClassBPingSlotPeriodicity: t.ClassBPingSlotPeriodicity,
+			ClassBPingSlotDr:          t.ClassBPingSlotDr,
+			ClassBPingSlotFreq:        t.ClassBPingSlotFreq,
+			ClassCTimeout:             t.ClassCTimeout,
+			AbpRx1Delay:               t.AbpRx1Delay,
+			AbpRx1DrOffset:            t.AbpRx1DrOffset,
+			AbpRx2Dr:                  t.AbpRx2Dr,
+			AbpRx2Freq:                t.AbpRx2Freq,
+			Tags:                      t.Tags,
+			Measurements:              t.Measurements,
+			AutoDetectMeasurements:    t.AutoDetectMeasurements,
+		}
+		created, err := m.profileClient.Create(ctx, &api.CreateDeviceProfileRequest{DeviceProfile: p})
+		if err != nil {
+			return profileCreateFailedMsg{err}
+		}
+		return profileCreatedMsg(item{
+			title: p.Name,
+			desc: profileDescription(&api.DeviceProfileListItem{
+				Region:         p.Region,
+				MacVersion:     p.MacVersion,
+				SupportsOtaa:   p.SupportsOtaa,
+				SupportsClassB: p.SupportsClassB,
+				SupportsClassC: p.SupportsClassC,
+			}),
+			id:        created.Id,
+			lorawan11: importer.IsLoRaWAN11(p.MacVersion),
+			region:    p.Region.String(),
+		})
+	}
+}
+
+// selectTemplate creates a device profile from the highlighted template. A
+// failure, e.g. because a profile of the name exists, is shown in the
+// list's status line, leaving the list as it was.
+func (m model) selectTemplate() (tea.Model, tea.Cmd) {
+	it, ok := m.templateList.SelectedItem().(item)
+	if !ok || m.creatingProfile {
+		return m, nil
+	}
+	m.creatingProfile = true
+	return m, tea.Batch(
+		m.templateList.NewStatusMessage("Creating device profile "+it.title+"…"),
+		m.createProfile(it.id),
+	)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// newTenantItem is the only entry of an empty tenant list, opening the form
+// to create one.
+var newTenantItem = item{
+	title:  "➕ Create new tenant…",
+	desc:   "The server has no tenants yet",
+	create: true,
+}
+
+// tenantForm asks for the settings of a new tenant, on a server that has
+// none yet. Focus past the text inputs is on the gateways toggle.
+type tenantForm struct {
+	inputs   []textinput.Model // name, description, max devices, max gateways
+	gateways bool              // the tenant can have gateways
+	focus    int
+	pending  bool   // waiting for the server
+	status   string // why the last attempt failed
+}
+
+func newTenantForm() *tenantForm {
+	name := textinput.New()
+	name.Placeholder = "Tenant name"
+	name.CharLimit = 100
+	name.Width = 50
+	name.Focus()
+
+	desc := textinput.New()
+	desc.Placeholder = "Description (optional)"
+	desc.CharLimit = 200
+	desc.Width = 50
+
+	limit := func(what string) textinput.Model {
+		in := textinput.New()
+		in.Placeholder = "0 for no limit on " + what
+		in.CharLimit = 10
+		in.Width = 50
+		return in
+	}
+	return &tenantForm{
+		inputs:   []textinput.Model{name, desc, limit("devices"), limit("gateways")},
+		gateways: true,
+	}
+}
+
+// togglingGateways reports whether the gateways toggle of the tenant form
+// has the focus.
+func (m model) togglingGateways() bool {
+	return m.state == stateCreateTenant && m.tenantForm.focus == len(m.tenantForm.inputs)
+}
+
+// Messages for the outcome of creating a tenant, see applicationFailedMsg
+type (
+	tenantCreatedMsg item
+	tenantFailedMsg  struct{ err error }
+)
+
+// updateTenantForm handles keys on the create-tenant form.
+func (m model) updateTenantForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := m.tenantForm
+	if f.pending {
+		if keyForceQuit.matches(m, msg) {
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+
+	switch {
+	case keyForceQuit.matches(m, msg):
+		return m, tea.Quit
+	case keyFormBack.matches(m, msg):
+		m.tenantForm = nil
+		m.state = stateTenantSelect
+		return m, nil
+	case keyNextField.matches(m, msg):
+		if f.focus < len(f.inputs) {
+			f.inputs[f.focus].Blur()
+		}
+		f.focus = (f.focus + 1) % (len(f.inputs) + 1)
+		if f.focus < len(f.inputs) {
+			return m, f.inputs[f.focus].Focus()
+		}
+		return m, nil
+	case keyToggleGateways.matches(m, msg):
+		f.gateways = !f.gateways
+		return m, nil
+	case keyCreateApp.matches(m, msg):
+		t := &api.Tenant{
+			Name:            strings.TrimSpace(f.inputs[0].Value()),
+			Description:     strings.TrimSpace(f.inputs[1].Value()),
+			CanHaveGateways: f.gateways,
+		}
+		if t.Name == "" {
+			f.status = "Enter a name for the tenant"
+			return m, nil
+		}
+		for i, field := range []*uint32{&t.MaxDeviceCount, &t.MaxGatewayCount} {
+			s := strings.TrimSpace(f.inputs[2+i].Value())
+			if s == "" {
+				continue
+			}
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				f.status = fmt.Sprintf("%q is not a number of %s", s, []string{"devices", "gateways"}[i])
+				return m, nil
+			}
+			*field = uint32(n)
+		}
+		f.status = ""
+		f.pending = true
+		return m, tea.Batch(m.spinner.Tick, m.createTenant(t))
+	}
+
+	if f.focus == len(f.inputs) {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return m, cmd
+}
+
+// createTenant creates t on the server, which takes an admin API key.
+func (m model) createTenant(t *api.Tenant) tea.Cmd {
+	return func() tea.Msg {
+		ctx := importer.AuthContext(context.Background(), m.apiToken)
+
+		resp, err := m.tenantClient.Create(ctx, &api.CreateTenantRequest{Tenant: t})
+		if err != nil {
+			return tenantFailedMsg{err}
+		}
+		desc := "No device limit"
+		if t.MaxDeviceCount > 0 {
+			desc = fmt.Sprintf("max %d devices", t.MaxDeviceCount)
+		}
+		return tenantCreatedMsg(item{title: t.Name, desc: desc, id: resp.Id})
+	}
+}
+
+// tenantCreateError explains why creating a tenant failed. Only admin API
+// keys can create tenants, which a tenant key is told about rather than
+// just denied.
+func tenantCreateError(err error) string {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.PermissionDenied {
+		return "This API token can't create tenants – only admin API keys can. " +
+			"Ask an administrator to create a tenant, or connect with an admin key."
+	}
+	return "Creating tenant failed: " + createErrorMessage(err)
+}
+
+func (m model) tenantFormView() string {
+	f := m.tenantForm
+
+	toggle := "[ ]"
+	if f.gateways {
+		toggle = "[x]"
+	}
+	if m.togglingGateways() {
+		toggle = "> " + toggle
+	} else {
+		toggle = "  " + toggle
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "New tenant on %s\n\n", m.serverAddr)
+	fmt.Fprintf(&b, "Name:          %s\n", f.inputs[0].View())
+	fmt.Fprintf(&b, "Description:   %s\n", f.inputs[1].View())
+	fmt.Fprintf(&b, "Max devices:   %s\n", f.inputs[2].View())
+	fmt.Fprintf(&b, "Max gateways:  %s\n", f.inputs[3].View())
+	fmt.Fprintf(&b, "Gateways:      %s can have gateways\n", toggle)
+
+	if f.pending {
+		b.WriteString("\n" + m.spinner.View() + " Creating tenant…\n")
+	} else if f.status != "" {
+		b.WriteString("\n" + m.theme.status.Render(f.status) + "\n")
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n%s",
+		m.header("Create Tenant"),
+		b.String(),
+		m.helpView(),
+	)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// theme holds the styles the views render with. Colors adapt to light and
+// dark terminal backgrounds; the plain theme emits no ANSI sequences at all
+// and marks emphasis with characters instead.
+type theme struct {
+	plain bool
+
+	title      lipgloss.Style
+	breadcrumb lipgloss.Style
+	status     lipgloss.Style // emphasized messages, including errors
+	help       lipgloss.Style
+	warning    lipgloss.Style // things the user must not miss
+	choice     lipgloss.Style // button
+	selected   lipgloss.Style // highlighted button
+	failure    lipgloss.Style // failed rows in the log pane
+	pane       lipgloss.Style // the log pane
+}
+
+var (
+	lightText  = lipgloss.AdaptiveColor{Light: "#FFFDF5", Dark: "#FAFAFA"}
+	accent     = lipgloss.AdaptiveColor{Light: "#5A3FD6", Dark: "#7D56F4"}
+	highlight  = lipgloss.AdaptiveColor{Light: "#C2185B", Dark: "#F25D94"}
+	danger     = lipgloss.AdaptiveColor{Light: "#B3152B", Dark: "#D7263D"}
+	subtleText = lipgloss.AdaptiveColor{Light: "#5C5C5C", Dark: "#8A8A8A"}
+	crumbText  = lipgloss.AdaptiveColor{Light: "#4B4B8F", Dark: "#A49FA5"}
+)
+
+// newTheme returns the colored theme, or the plain one when plain is set.
+// The plain theme also switches lipgloss to the ASCII profile, so that the
+// styles built into the bubbles components lose their colors too.
+func newTheme(plain bool) theme {
+	if plain {
+		lipgloss.SetColorProfile(termenv.Ascii)
+
+		base := lipgloss.NewStyle()
+		return theme{
+			plain:      true,
+			title:      base.MarginLeft(2).Transform(func(s string) string { return "== " + s + " ==" }),
+			breadcrumb: base.MarginLeft(2),
+			status:     base.Transform(func(s string) string { return "> " + s }),
+			help:       base,
+			warning:    base.Transform(func(s string) string { return "!! " + s + " !!" }),
+			choice:     base.Transform(func(s string) string { return "  " + s + "  " }),
+			selected:   base.Transform(func(s string) string { return "[ " + s + " ]" }),
+			failure:    base,
+			pane:       base.MarginTop(1),
+		}
+	}
+
+	choice := lipgloss.NewStyle().Padding(0, 2)
+	return theme{
+		title: lipgloss.NewStyle().
+			MarginLeft(2).
+			Foreground(lightText).
+			Background(accent).
+			Padding(0, 1),
+		breadcrumb: lipgloss.NewStyle().MarginLeft(2).Foreground(crumbText),
+		status: lipgloss.NewStyle().
+			Foreground(lightText).
+			Background(highlight).
+			Padding(0, 1).
+			MarginTop(1),
+		help: lipgloss.NewStyle().Foreground(subtleText),
+		warning: lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lightText).
+			Background(danger).
+			Padding(0, 1),
+		choice:   choice,
+		selected: choice.Foreground(lightText).Background(accent),
+		failure:  lipgloss.NewStyle().Foreground(danger),
+		pane:     lipgloss.NewStyle().MarginTop(1),
+	}
+}
+
+// newProgress returns a progress bar matching the theme.
+func (t theme) newProgress() progress.Model {
+	if t.plain {
+		return progress.New(progress.WithColorProfile(termenv.Ascii), progress.WithFillCharacters('#', '.'))
+	}
+	return progress.New(progress.WithDefaultGradient())
+}
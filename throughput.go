@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// rateWindow is the time constant of the moving average behind the rate and
+// ETA shown while importing, so that a burst of slow retries moves them
+// gradually rather than all at once.
+const rateWindow = 10 * time.Second
+
+// rateSample is the shortest interval the rate is measured over. Progress
+// arrives once per row, often many times within a millisecond.
+const rateSample = 250 * time.Millisecond
+
+// throughput measures how fast the rows of an import are processed, for
+// capacity planning.
+type throughput struct {
+	start time.Time
+	end   time.Time // zero while the import runs
+
+	pausedAt time.Time     // zero unless paused
+	paused   time.Duration // time spent paused before pausedAt
+
+	sampled time.Time // when the rate was last measured
+	done    int       // rows processed by then
+	rate    float64   // moving average, in rows per second; 0 until measured
+}
+
+func newThroughput(now time.Time) *throughput {
+	return &throughput{start: now, sampled: now}
+}
+
+// update records that done rows have been processed by now.
+func (t *throughput) update(done int, now time.Time) {
+	dt := now.Sub(t.sampled)
+	if !t.end.IsZero() || !t.pausedAt.IsZero() || dt < rateSample {
+		return
+	}
+	current := float64(done-t.done) / dt.Seconds()
+	if t.rate == 0 {
+		t.rate = current
+	} else {
+		t.rate += (1 - math.Exp(-dt.Seconds()/rateWindow.Seconds())) * (current - t.rate)
+	}
+	t.sampled, t.done = now, done
+}
+
+// pause stops the clock at now until resume.
+func (t *throughput) pause(now time.Time) {
+	if t.end.IsZero() && t.pausedAt.IsZero() {
+		t.pausedAt = now
+	}
+}
+
+// resume restarts the clock at now, leaving the pause out of the elapsed
+// time and the rate.
+func (t *throughput) resume(now time.Time) {
+	if t.pausedAt.IsZero() {
+		return
+	}
+	d := now.Sub(t.pausedAt)
+	t.paused += d
+	t.sampled = t.sampled.Add(d)
+	t.pausedAt = time.Time{}
+}
+
+// stop freezes the clock at now, once the import has finished or stopped.
+func (t *throughput) stop(now time.Time) {
+	if t.end.IsZero() {
+		t.resume(now)
+		t.end = now
+	}
+}
+
+// elapsed returns how long the import ran, or has been running by now, not
+// counting pauses.
+func (t *throughput) elapsed(now time.Time) time.Duration {
+	switch {
+	case !t.end.IsZero():
+		now = t.end
+	case !t.pausedAt.IsZero():
+		now = t.pausedAt
+	}
+	return now.Sub(t.start) - t.paused
+}
+
+// eta estimates how long the rest of total rows takes at the current rate.
+// ok is false until the rate has been measured.
+func (t *throughput) eta(done, total int) (d time.Duration, ok bool) {
+	if t.rate <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(total-done) / t.rate * float64(time.Second)), true
+}
+
+// averageRate returns the rows per second of n rows over elapsed.
+func averageRate(n int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// formatElapsed rounds d to whole seconds, e.g. "2m48s".
+func formatElapsed(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// rateView renders the rate and ETA of the processing screen, e.g.
+// " · 6.3 dev/s · ETA 2m48s", or nothing until they are known.
+func (m model) rateView() string {
+	if m.clock == nil || m.clock.rate <= 0 {
+		return ""
+	}
+	unit := "dev/s"
+	if m.cfg.Gateways {
+		unit = "gw/s"
+	}
+	view := fmt.Sprintf(" · %.1f %s", m.clock.rate, unit)
+	if eta, ok := m.clock.eta(m.done, m.total); ok {
+		view += " · ETA " + formatElapsed(eta)
+	}
+	return view
+}
+
+// timingView renders how long the last import took and its average rate
+// for the summary.
+func (m model) timingView() string {
+	if m.clock == nil {
+		return ""
+	}
+	elapsed := m.clock.elapsed(time.Now())
+	return "\n" + m.theme.help.Render(fmt.Sprintf("Took %s • %d %s at %.1f/s on average",
+		formatElapsed(elapsed), m.done, m.noun(), averageRate(m.done, elapsed)))
+}
+
+// printTiming prints how long a headless run took to process rows.
+func printTiming(rows int, elapsed time.Duration) {
+	fmt.Printf("Took %s, %d rows at %.1f/s on average\n", formatElapsed(elapsed), rows, averageRate(rows, elapsed))
+}
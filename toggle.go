@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// toggleSummaryView renders the outcome of the last run enabling or
+// disabling devices, listing the rows that failed by their line.
+func (m model) toggleSummaryView() string {
+	var toggled, skipped, failed, invalid int
+	var details []string
+	for _, fr := range m.results {
+		toggled += fr.Result.Updated
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+		}
+		for i, f := range fr.Result.Failures {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more failed rows", prefix, len(fr.Result.Failures)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%s: %s", prefix, f.Row.Pos.Field("dev_eui"), importer.DescribeError(f.Err))))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %sstopped early: %v", prefix, fr.Stopped)))
+		}
+	}
+
+	counts := []string{
+		fmt.Sprintf("%d toggled", toggled),
+		fmt.Sprintf("%d already in the requested state", skipped),
+	}
+	if failed > 0 || invalid > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", failed), fmt.Sprintf("%d invalid", invalid))
+	}
+
+	status := "Enabled or disabled: " + strings.Join(counts, " • ")
+	if m.cfg.dryRun {
+		status = "Dry run, nothing changed: " + strings.Join(counts, " • ")
+	}
+	view := m.theme.status.Render(status)
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
+
+// reportToggles prints the outcome of enabling or disabling devices in a
+// headless run and returns the exit code. Failed rows are listed by line,
+// so that a DevEUI that isn't on the server can be found in the list.
+func reportToggles(cfg config, results []importer.FileResult) int {
+	toggled := "toggled"
+	if cfg.dryRun {
+		toggled = "would toggle"
+	}
+	var total, skipped, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, already in the requested state %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, toggled, fr.Result.Updated, len(fr.Result.Skipped),
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		for _, f := range fr.Result.Failures {
+			fmt.Printf("  %s: %s: %s\n", f.Row.Pos.Field("dev_eui"), f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %v\n", fr.Stopped)
+		}
+		total += fr.Result.Updated
+		skipped += len(fr.Result.Skipped)
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, already in the requested state %d, failed %d, invalid %d\n", toggled, total, skipped, failed, invalid)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// toggling reports whether the preview can choose the state of rows without
+// an is_disabled value.
+func (m model) toggling() bool {
+	return m.state == statePreview && m.cfg.Mode == importer.ModeToggle
+}
+
+// switchState makes rows without an is_disabled value ask for the other
+// state, disabling them first, and reads the inputs again.
+func (m model) switchState() (tea.Model, tea.Cmd) {
+	disable := m.cfg.Disable == nil || !*m.cfg.Disable
+	m.cfg.Disable = &disable
+	return m.readPaths(m.inputPaths())
+}
+
+func (m model) switchStateHelp() (string, string) {
+	if m.cfg.Disable == nil || !*m.cfg.Disable {
+		return "d", "disable rows without is_disabled"
+	}
+	return "d", "enable rows without is_disabled"
+}
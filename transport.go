@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// unixPrefix starts a server address that is a Unix domain socket, e.g.
+// unix:///run/chirpstack/api.sock.
+const unixPrefix = "unix://"
+
+// route is how dial reaches the server: over a Unix domain socket, or over
+// TCP either directly or through an HTTP CONNECT proxy.
+type route struct {
+	network string   // "unix" or "tcp"
+	address string   // path of the socket, or host:port
+	proxy   *url.URL // nil to connect directly
+}
+
+// routeTo works out the route to the server at addr. Proxies are taken from
+// the environment as other gRPC clients do: grpc_proxy if set, otherwise
+// HTTPS_PROXY, and neither for the hosts of NO_PROXY.
+func routeTo(addr string) (route, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return route{}, fmt.Errorf("%s names no socket", addr)
+		}
+		return route{network: "unix", address: path}, nil
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		return route{}, fmt.Errorf("%s: give Unix sockets as %s/path/to/socket", addr, unixPrefix)
+	}
+
+	env := httpproxy.FromEnvironment()
+	if p := cmp.Or(os.Getenv("grpc_proxy"), os.Getenv("GRPC_PROXY")); p != "" {
+		env.HTTPSProxy = p
+	}
+	proxy, err := env.ProxyFunc()(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return route{}, fmt.Errorf("invalid proxy in the environment: %w", err)
+	}
+	if proxy != nil && proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return route{}, fmt.Errorf("proxy %s: only HTTP CONNECT proxies are supported", proxy.Redacted())
+	}
+	return route{network: "tcp", address: addr, proxy: proxy}, nil
+}
+
+// String describes r for connection errors, without the proxy's password.
+func (r route) String() string {
+	switch {
+	case r.network == "unix":
+		return "over the Unix socket " + r.address
+	case r.proxy != nil:
+		return fmt.Sprintf("to %s through the proxy %s", r.address, r.proxy.Redacted())
+	}
+	return "to " + r.address + " directly"
+}
+
+// target is what gRPC is given to dial: the address, or for a socket a
+// placeholder host the server is told it was reached by.
+func (r route) target() string {
+	if r.network == "unix" {
+		return "passthrough:///localhost"
+	}
+	return "passthrough:///" + r.address
+}
+
+// dial opens a connection along r, for grpc.WithContextDialer. The address
+// gRPC passes is the one of r.target, and not needed. Errors say which route
+// was tried, as gRPC passes them on in the status of the failed calls.
+func (r route) dial(ctx context.Context, _ string) (net.Conn, error) {
+	conn, err := r.open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connecting %s: %w", r, err)
+	}
+	return conn, nil
+}
+
+func (r route) open(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	if r.proxy == nil {
+		return d.DialContext(ctx, r.network, r.address)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddress(r.proxy))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the proxy: %w", err)
+	}
+	if r.proxy.Scheme == "https" {
+		tc := tls.Client(conn, &tls.Config{ServerName: r.proxy.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("connecting to the proxy: %w", err)
+		}
+		conn = tc
+	}
+	tunnel, err := r.connect(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connect asks the proxy at the other end of conn to tunnel it to the
+// server, and returns the tunnel.
+func (r route) connect(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: r.address},
+		Host:   r.address,
+		Header: http.Header{"User-Agent": {"grpc-go"}},
+	}
+	if u := r.proxy.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("asking the proxy for a tunnel: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("reading the proxy's answer: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the proxy refused the tunnel: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// What the server sent right behind the answer
+		return &bufferedConn{conn, br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection part of whose input was read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// proxyAddress returns the host:port of the proxy at u, on the default port
+// of its scheme if it names none.
+func proxyAddress(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
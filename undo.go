@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// Each import has its own undo journal, see importer.Journal, kept with
+// the run history, see runsDir.
+
+// undoJournal is a journal read back for undoing.
+type undoJournal struct {
+	importer.JournalHeader
+	devices []importer.JournalEntry
+	path    string
+}
+
+// journalPath returns where the journal of the run id goes.
+func journalPath(id string) (string, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+journalSuffix), nil
+}
+
+// createJournal starts the journal of the run id, an import into the given
+// server and application.
+func createJournal(id, server, applicationID string) (*importer.Journal, error) {
+	path, err := journalPath(id)
+	if err != nil {
+		return nil, err
+	}
+	return importer.NewJournal(path, server, applicationID)
+}
+
+// reopenJournal appends to the journal of the run id, so that undoing it
+// also deletes the devices a retry of its failed rows created. A new journal
+// is started if there is none.
+func reopenJournal(id, server, applicationID string) (*importer.Journal, error) {
+	path, err := journalPath(id)
+	if err != nil {
+		return nil, err
+	}
+	return importer.AppendJournal(path, server, applicationID)
+}
+
+// errNoJournal is returned by loadJournal when there is no import to undo.
+var errNoJournal = errors.New("no import to undo")
+
+// loadJournal reads the journal of the run id, or of the latest import
+// that has one for an empty id.
+func loadJournal(id string) (*undoJournal, error) {
+	var path string
+	var err error
+	if id == "" {
+		path, err = latestJournal()
+	} else {
+		path, err = journalPath(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoJournal
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	uj := undoJournal{path: path}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err := dec.Decode(&uj.JournalHeader); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for dec.More() {
+		var e importer.JournalEntry
+		if err := dec.Decode(&e); err != nil {
+			// The last line of an interrupted import may be cut short.
+			break
+		}
+		uj.devices = append(uj.devices, e)
+	}
+	if len(uj.devices) == 0 {
+		return nil, errNoJournal
+	}
+	return &uj, nil
+}
+
+// latestJournal returns the path of the newest journal, or errNoJournal
+// if no run has one.
+func latestJournal() (string, error) {
+	ids, err := runIDs()
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		path, err := journalPath(id)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errNoJournal
+}
+
+// discard removes the journal once an undo has been completed, so that it
+// can't be replayed.
+func (uj *undoJournal) discard() error {
+	return os.Remove(uj.path)
+}
+
+// checkTarget returns an error unless the journal's import went to server.
+func (uj *undoJournal) checkTarget(server string) error {
+	if uj.Server != server {
+		return fmt.Errorf("the last import went to %s, not %s", uj.Server, server)
+	}
+	return nil
+}
+
+// undoImport deletes the devices of the journal, which takes ok unless it's
+// a dry run. A device that has been seen since the import is kept unless
+// force is set, and one that has moved to another application is reported
+// as failed. onDevice, if set, is called after each device with the error
+// that made it fail, if any.
+func undoImport(ctx context.Context, client api.DeviceServiceClient, uj *undoJournal, force, dryRun bool, ok *importer.Consent, onDevice func(row importer.Row, err error)) (importer.Result, error) {
+	if !dryRun && ok == nil {
+		return importer.Result{}, importer.ErrUnconfirmed
+	}
+	var res importer.Result
+	for _, e := range uj.devices {
+		row := importer.Row{DevEUI: e.DevEUI}
+		err := undoDevice(ctx, client, e, &row, force, dryRun, &res)
+		if onDevice != nil {
+			onDevice(row, err)
+		}
+	}
+	return res, nil
+}
+
+// undoDevice deletes the device of e and records the outcome in res. row is
+// filled in with the device's name for display.
+func undoDevice(ctx context.Context, client api.DeviceServiceClient, e importer.JournalEntry, row *importer.Row, force, dryRun bool, res *importer.Result) error {
+	resp, err := client.Get(ctx, &api.GetDeviceRequest{DevEui: e.DevEUI})
+	if status.Code(err) == codes.NotFound {
+		res.Absent++
+		return nil
+	}
+	if err == nil {
+		row.Name = resp.Device.GetName()
+		if id := resp.Device.GetApplicationId(); id != e.ApplicationID {
+			err = fmt.Errorf("device belongs to application %s, not %s", id, e.ApplicationID)
+		}
+	}
+	if err == nil && resp.LastSeenAt != nil && !force {
+		res.Kept = append(res.Kept, *row)
+		return nil
+	}
+	if err == nil && !dryRun {
+		if _, err = client.Delete(ctx, &api.DeleteDeviceRequest{DevEui: e.DevEUI}); err != nil {
+			slog.Error("Failed to delete the device", "dev_eui", e.DevEUI, "rpc", api.DeviceService_Delete_FullMethodName, "err", err)
+		}
+	}
+	if err != nil {
+		res.Failures = append(res.Failures, importer.RowFailure{Row: *row, Err: err})
+		return err
+	}
+	res.Removed = append(res.Removed, *row)
+	return nil
+}
+
+// undoScreen asks to confirm undoing the last import, then shows its
+// progress and outcome.
+type undoScreen struct {
+	journal *undoJournal
+	err     error // why the journal can't be undone
+	typed   *typedConfirm
+	force   bool        // also delete devices seen since the import
+	id      string      // of the run undone, empty for the latest
+	back    state       // the screen the undo was opened from
+	prev    *undoScreen // the undo of the summary, while undoing from the run history
+
+	running     bool
+	finished    bool
+	done, total int
+	result      importer.Result
+}
+
+// undoBackHelp describes keyUndoBack with where it goes back to.
+func (m model) undoBackHelp() (string, string) {
+	if m.undo != nil && m.undo.back == stateRuns {
+		return "esc", "back to previous imports"
+	}
+	return "esc", "back to summary"
+}
+
+// newUndoScreen asks to undo the run id on server into the application
+// named app, if known, going back to the screen back.
+func newUndoScreen(server, id, app string, back state) *undoScreen {
+	u := &undoScreen{id: id, back: back}
+	u.journal, u.err = loadJournal(id)
+	if u.err == nil {
+		u.err = u.journal.checkTarget(server)
+	}
+	if u.err == nil {
+		application := u.journal.ApplicationID
+		if app != "" {
+			application = fmt.Sprintf("%s (%s)", app, application)
+		}
+		u.typed = newTypedConfirm(fmt.Sprintf("%d devices created by the import will be deleted", len(u.journal.devices)),
+			application, u.journal.Server, confirmPhrase(app))
+	}
+	return u
+}
+
+// confirming reports whether the undo waits for the typed confirmation.
+func (u *undoScreen) confirming() bool {
+	return u.err == nil && !u.running && !u.finished
+}
+
+// Messages for the progress and outcome of an undo
+type (
+	undoProgressMsg struct{ done, total int }
+	undoDoneMsg     importer.Result
+)
+
+// undoable reports whether the last run can be undone from its summary.
+func (m model) undoable() bool {
+	return m.state == stateComplete && m.cfg.Mode.Creates() && !m.cfg.Gateways && !m.cfg.dryRun && m.undo == nil
+}
+
+// updateUndo handles keys on the undo screen.
+func (m model) updateUndo(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	u := m.undo
+
+	switch {
+	case keyForceQuit.matches(m, msg), keyQuit.matches(m, msg):
+		if m.client != nil {
+			m.client.Close()
+		}
+		return m, tea.Quit
+	case keyUndoBack.matches(m, msg):
+		m.state = u.back
+		switch {
+		case u.back != stateComplete && u.finished && u.id == m.runID:
+			// The last run was undone from the run history.
+		case u.back != stateComplete:
+			// An undo from the run history leaves that of the summary.
+			m.undo = u.prev
+		case !u.finished:
+			m.undo = nil
+		}
+		return m, nil
+	case keyUndoForce.matches(m, msg):
+		u.force = !u.force
+		return m, nil
+	case keyUndoStart.matches(m, msg):
+		ok := u.typed.confirm()
+		if ok == nil {
+			return m, nil
+		}
+		u.running = true
+		u.total = len(u.journal.devices)
+		m.events = make(chan tea.Msg)
+		go m.undoDevices(u.journal, u.force, ok, m.events)
+		return m, waitForEvent(m.events)
+	}
+
+	if !u.confirming() {
+		return m, nil
+	}
+	return m, u.typed.update(msg)
+}
+
+// undoDevices deletes the devices of the journal, reporting progress through
+// events. The journal is discarded once every device is gone.
+func (m model) undoDevices(uj *undoJournal, force bool, ok *importer.Consent, events chan<- tea.Msg) {
+	ctx := importer.AuthContext(context.Background(), m.apiToken)
+	done := 0
+	res, err := undoImport(ctx, m.deviceClient, uj, force, false, ok, func(row importer.Row, err error) {
+		done++
+		if err == nil {
+			slog.Info("Undo: deleted the device", "dev_eui", row.DevEUI, "name", row.Name)
+		}
+		events <- undoProgressMsg{done, len(uj.devices)}
+	})
+	if err != nil {
+		events <- errorMsg(err)
+		return
+	}
+	if len(res.Failures) == 0 && len(res.Kept) == 0 {
+		if err := uj.discard(); err != nil {
+			slog.Error("Failed to remove the undo journal", "path", uj.path, "err", err)
+		}
+	}
+	events <- undoDoneMsg(res)
+}
+
+func (m model) undoView() string {
+	u := m.undo
+
+	var body string
+	switch {
+	case u.err != nil:
+		body = m.theme.status.Render("Can't undo: " + u.err.Error())
+	case u.finished:
+		r := u.result
+		body = m.theme.status.Render(fmt.Sprintf("Deleted %d devices • %d kept because they have been seen • %d already absent • %d failed",
+			len(r.Removed), len(r.Kept), r.Absent, len(r.Failures)))
+		var details []string
+		for _, row := range r.Kept {
+			details = append(details, "- kept "+row.DevEUI+" "+row.Name)
+		}
+		for _, f := range r.Failures {
+			details = append(details, m.theme.help.Render("✗ "+f.Row.DevEUI+" "+importer.DescribeError(f.Err)))
+		}
+		if len(details) > 0 {
+			body += "\n\n" + strings.Join(details, "\n")
+		}
+	case u.running:
+		percent := 0.0
+		if u.total > 0 {
+			percent = float64(u.done) / float64(u.total)
+		}
+		body = fmt.Sprintf("%s\n\n%s", m.progress.ViewAs(percent),
+			m.theme.status.Render(fmt.Sprintf("Deleting devices: %d/%d", u.done, u.total)))
+	default:
+		seen := "Devices that have sent uplinks since the import are kept (ctrl+f to delete them too)."
+		if u.force {
+			seen = "Devices that have sent uplinks since the import are deleted too (ctrl+f to keep them)."
+		}
+		body = fmt.Sprintf("Undo the import started %s.\n%s\n\n%s",
+			u.journal.StartedAt.Local().Format("2006-01-02 15:04"), seen, u.typed.view(m.theme))
+	}
+
+	return fmt.Sprintf(
+		"%s\n\n%s\n\n%s",
+		m.header("Undo Import"),
+		body,
+		m.helpView(),
+	)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+func TestUndoImport(t *testing.T) {
+	m, srv := connected(t)
+	for _, d := range []*api.Device{
+		{DevEui: "70b3d57ed0000001", Name: "created", ApplicationId: "app"},
+		{DevEui: "70b3d57ed0000002", Name: "seen", ApplicationId: "app"},
+		{DevEui: "70b3d57ed0000004", Name: "moved", ApplicationId: "other"},
+	} {
+		srv.AddDevice(d, nil)
+	}
+	srv.Seen("70b3d57ed0000002", time.Now())
+	uj := &undoJournal{JournalHeader: importer.JournalHeader{ApplicationID: "app"}}
+	for _, eui := range []string{"70b3d57ed0000001", "70b3d57ed0000002", "70b3d57ed0000003", "70b3d57ed0000004"} {
+		uj.devices = append(uj.devices, importer.JournalEntry{DevEUI: eui, ApplicationID: "app"})
+	}
+	ctx := importer.AuthContext(context.Background(), testToken)
+
+	if _, err := undoImport(ctx, m.deviceClient, uj, false, false, nil, nil); !errors.Is(err, importer.ErrUnconfirmed) {
+		t.Fatalf("undoImport without consent = %v, want ErrUnconfirmed", err)
+	}
+
+	res, err := undoImport(ctx, m.deviceClient, uj, false, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 1 || len(srv.Calls(api.DeviceService_Delete_FullMethodName)) != 0 {
+		t.Errorf("dry run removed %v with %d deletes", res.Removed, len(srv.Calls(api.DeviceService_Delete_FullMethodName)))
+	}
+
+	var done []string
+	res, err = undoImport(ctx, m.deviceClient, uj, false, false, &importer.Consent{}, func(row importer.Row, err error) {
+		done = append(done, row.DevEUI)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 1 || res.Removed[0].Name != "created" {
+		t.Errorf("Removed = %v, want the created device", res.Removed)
+	}
+	if len(res.Kept) != 1 || res.Kept[0].Name != "seen" {
+		t.Errorf("Kept = %v, want the device seen since", res.Kept)
+	}
+	if res.Absent != 1 {
+		t.Errorf("Absent = %d, want 1", res.Absent)
+	}
+	if len(res.Failures) != 1 || res.Failures[0].Row.Name != "moved" {
+		t.Errorf("Failures = %v, want the device moved to another application", res.Failures)
+	}
+	if len(done) != 4 {
+		t.Errorf("onDevice called for %q, want every device", done)
+	}
+	if got := srv.Devices(); !slices.Equal(got, []string{"70b3d57ed0000002", "70b3d57ed0000004"}) {
+		t.Errorf("devices on the server = %q", got)
+	}
+
+	res, err = undoImport(ctx, m.deviceClient, uj, true, false, &importer.Consent{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 1 || res.Removed[0].Name != "seen" || res.Absent != 2 {
+		t.Errorf("forced undo: Removed = %v, Absent = %d", res.Removed, res.Absent)
+	}
+}
+
+// TestLoadJournalNone checks that without a journal of a run there is
+// nothing to undo, even with the file older versions kept the last import's
+// journal in.
+func TestLoadJournalNone(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir, err := dataDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	old := `{"server":"chirpstack:8080"}` + "\n" + `{"dev_eui":"70b3d57ed0000001"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "last-import.jsonl"), []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJournal(""); !errors.Is(err, errNoJournal) {
+		t.Errorf("loadJournal = %v, want errNoJournal", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// updateSummaryView renders the outcome of the last update, listing the
+// rows that failed by their line.
+func (m model) updateSummaryView() string {
+	var updated, unchanged, failed, invalid int
+	var details []string
+	for _, fr := range m.results {
+		updated += fr.Result.Updated
+		unchanged += fr.Result.Unchanged
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+
+		prefix := ""
+		if len(m.results) > 1 {
+			prefix = filepath.Base(fr.Input.Source) + ": "
+		}
+		for i, f := range fr.Result.Failures {
+			if i == 10 {
+				details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s…and %d more failed rows", prefix, len(fr.Result.Failures)-i)))
+				break
+			}
+			details = append(details, m.theme.help.Render(fmt.Sprintf("✗ %s%s: %s", prefix, f.Row.Pos.Field("dev_eui"), importer.DescribeError(f.Err))))
+		}
+		if fr.Stopped != nil {
+			details = append(details, m.theme.warning.Render(fmt.Sprintf("⚠ %sstopped early: %v", prefix, fr.Stopped)))
+		}
+	}
+
+	counts := []string{
+		fmt.Sprintf("%d updated", updated),
+		fmt.Sprintf("%d unchanged", unchanged),
+	}
+	if failed > 0 || invalid > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", failed), fmt.Sprintf("%d invalid", invalid))
+	}
+
+	status := "Updated: " + strings.Join(counts, " • ")
+	if m.cfg.dryRun {
+		status = "Dry run, nothing changed: " + strings.Join(counts, " • ")
+	}
+	view := m.theme.status.Render(status)
+	if len(details) > 0 {
+		view += "\n\n" + strings.Join(details, "\n")
+	}
+	return view
+}
+
+// reportUpdates prints the outcome of an update in a headless run and
+// returns the exit code.
+func reportUpdates(cfg config, results []importer.FileResult) int {
+	updated := "updated"
+	if cfg.dryRun {
+		updated = "would update"
+	}
+	var total, unchanged, failed, invalid int
+	for _, fr := range results {
+		fmt.Printf("%s (%s): %s %d, unchanged %d, failed %d, invalid %d\n",
+			fr.Input.Source, fr.Input.Format, updated, fr.Result.Updated, fr.Result.Unchanged,
+			len(fr.Result.Failures), len(fr.Input.Invalid))
+		for _, f := range fr.Result.Failures {
+			fmt.Printf("  %s: %s: %s\n", f.Row.Pos.Field("dev_eui"), f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+		if fr.FailuresFile != "" {
+			fmt.Printf("  failed rows written to %s\n", fr.FailuresFile)
+		}
+		if fr.Stopped != nil {
+			fmt.Printf("  stopped early: %v\n", fr.Stopped)
+		}
+		total += fr.Result.Updated
+		unchanged += fr.Result.Unchanged
+		failed += len(fr.Result.Failures)
+		invalid += len(fr.Input.Invalid)
+	}
+	if len(results) > 1 {
+		fmt.Printf("Total: %s %d, unchanged %d, failed %d, invalid %d\n", updated, total, unchanged, failed, invalid)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return 1
+	}
+	return 0
+}
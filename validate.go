@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// offlineMsg starts offline validation, for --validate-only without
+// --headless.
+type offlineMsg struct{}
+
+// runValidation checks the lists of cfg.input as an import would, without
+// connecting to the server: they are parsed, their columns mapped and every
+// row validated, including the checks across rows such as duplicate
+// DevEUIs and names. It returns 1 if a row is invalid. Checks that need the
+// server, such as --skip-existing and --check-server-names, are left out.
+func runValidation(ctx context.Context, cfg config) int {
+	if cfg.input == "" {
+		return usageError("--csv is required to validate")
+	}
+	paths, err := importer.ExpandInput(cfg.input, cfg.Extensions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	inputs := importer.NewInputs(paths)
+	if cfg.Gateways {
+		err = importer.ReadGatewayInputs(ctx, inputs, cfg.ListOptions, 0)
+	} else {
+		err = importer.ReadInputs(ctx, inputs, cfg.ListOptions, 0, nil)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+
+	var valid, invalid, warnings int
+	for _, in := range inputs {
+		fmt.Printf("%s (%s): valid %d, invalid %d, warnings %d\n",
+			in.Source, in.Format, in.Count, len(in.Invalid), len(in.Warnings))
+		for _, w := range in.Warnings {
+			fmt.Printf("  warning: %s\n", w)
+		}
+		for _, msg := range in.Invalid {
+			fmt.Printf("  invalid: %s\n", msg)
+		}
+		valid += in.Count
+		invalid += len(in.Invalid)
+		warnings += len(in.Warnings)
+	}
+	if len(inputs) > 1 {
+		fmt.Printf("Total: valid %d, invalid %d, warnings %d\n", valid, invalid, warnings)
+	}
+	fmt.Println("Validation only: nothing was sent to a server")
+
+	if invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validateOffline opens the file picker to validate lists without a
+// server, from the token input or for --validate-only. The preview shows
+// what an import would make of them, but nothing can be imported from it:
+// leaving goes back to the token input, to connect first.
+func (m model) validateOffline() (tea.Model, tea.Cmd) {
+	m.cfg.ValidateOnly = true
+	m.tokenInput.Blur()
+	m.status = ""
+	m.state = stateFileSelect
+
+	if m.cfg.input != "" {
+		paths, err := importer.ExpandInput(expandHome(m.cfg.input), m.cfg.Extensions())
+		if err != nil {
+			m.err = err
+			m.state = stateError
+			return m, nil
+		}
+		return m.startImport(paths)
+	}
+	return m, m.filepicker.list()
+}
+
+// leaveOffline goes back from offline validation to the token input.
+func (m model) leaveOffline() (tea.Model, tea.Cmd) {
+	m.cfg.ValidateOnly = false
+	m.inputs = nil
+	m.status = ""
+	m.state = stateConnecting
+	return m, m.tokenInput.Focus()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// verifyDevices reads back the devices created for results unless
+// --no-verify was given, as a second phase of the progress sent to events.
+func (m model) verifyDevices(ctx context.Context, imp *importer.Importer, results []importer.FileResult, events chan<- tea.Msg) {
+	if !m.cfg.verify || m.cfg.dryRun || !m.cfg.Mode.Creates() {
+		return
+	}
+	imp.Verify(ctx, results, func(done, total int) {
+		events <- verifyProgressMsg{done: done, total: total}
+	})
+}
+
+// verifyProgressMsg reports the progress of verifyDevices.
+type verifyProgressMsg struct {
+	done, total int
+}
+
+// verifiedTotals sums the verification outcome of results.
+func verifiedTotals(results []importer.FileResult) (verified int, mismatches []importer.RowFailure) {
+	for _, fr := range results {
+		verified += fr.Result.Verified
+		mismatches = append(mismatches, fr.Result.Mismatches...)
+	}
+	return verified, mismatches
+}
+
+// verifySummary renders how many created devices read back as sent and
+// which didn't, or nothing if none were verified.
+func (m model) verifySummary() string {
+	verified, mismatches := verifiedTotals(m.results)
+	if verified == 0 && len(mismatches) == 0 {
+		return ""
+	}
+
+	line := fmt.Sprintf("Verified %d created devices", verified)
+	if len(mismatches) > 0 {
+		line += fmt.Sprintf(" • %d don't match what was sent", len(mismatches))
+	}
+	lines := []string{m.theme.status.Render(line)}
+	for i, f := range mismatches {
+		if i == 10 {
+			lines = append(lines, m.theme.help.Render(fmt.Sprintf("✗ …and %d more", len(mismatches)-i)))
+			break
+		}
+		lines = append(lines, m.theme.help.Render(fmt.Sprintf("✗ %s %v", f.Row.DevEUI, f.Err)))
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
+
+// markMismatches flags the rows of report whose devices didn't read back as
+// sent in results.
+func markMismatches(report []rowLog, results []importer.FileResult) {
+	for _, fr := range results {
+		for _, f := range fr.Result.Mismatches {
+			for i, l := range report {
+				if l.source == fr.Input.Source && l.pos == f.Row.Pos {
+					report[i].err = f.Err
+				}
+			}
+		}
+	}
+}
+
+// printVerification prints the devices that didn't read back as sent in a
+// headless run and returns how many there were.
+func printVerification(results []importer.FileResult) int {
+	verified, mismatches := verifiedTotals(results)
+	if verified == 0 && len(mismatches) == 0 {
+		return 0
+	}
+	fmt.Printf("Verified: match %d, mismatch %d\n", verified, len(mismatches))
+	for _, f := range mismatches {
+		fmt.Printf("  %s: %s\n", f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+	}
+	return len(mismatches)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// apiModule is the module of the ChirpStack API this tool is built against.
+const apiModule = "github.com/chirpstack/chirpstack/api/go/v4"
+
+// parseVersion parses versions such as "4.6.0", "v4.14.1" and
+// "4.7.0-test.1", ignoring what follows the release numbers.
+func parseVersion(s string) (importer.Version, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+ "); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return importer.Version{}, false
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return importer.Version{}, false
+		}
+		n[i] = v
+	}
+	return importer.Version{Major: n[0], Minor: n[1], Patch: n[2]}, true
+}
+
+// builtAgainst returns the version of the ChirpStack API this tool is
+// built against, or the zero version if the binary doesn't record it.
+func builtAgainst() importer.Version {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return importer.Version{}
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == apiModule {
+			v, _ := parseVersion(dep.Version)
+			return v
+		}
+	}
+	return importer.Version{}
+}
+
+// serverVersion asks the server which ChirpStack release it runs.
+func serverVersion(ctx context.Context, client api.InternalServiceClient) (importer.Version, error) {
+	resp, err := client.GetVersion(ctx, &emptypb.Empty{})
+	if err != nil {
+		return importer.Version{}, err
+	}
+	v, ok := parseVersion(resp.Version)
+	if !ok {
+		return importer.Version{}, fmt.Errorf("unknown version %q", resp.Version)
+	}
+	return v, nil
+}
+
+// versionWarning returns what to tell about the version v of the server, err
+// if it couldn't be determined, or "" if it is at least the version of the
+// API this tool is built against. Neither stops anything.
+func versionWarning(v importer.Version, err error) string {
+	if err != nil {
+		return fmt.Sprintf("can't tell which ChirpStack version the server runs (%s); fields it doesn't support may be dropped", importer.DescribeError(err))
+	}
+	if built := builtAgainst(); built.Known() && v.Less(built) {
+		return fmt.Sprintf("the server runs ChirpStack %s, older than the API %s this tool is built against; fields it doesn't support may be dropped", v, built)
+	}
+	return ""
+}
+
+// versionMsg carries the version of the server, asked once connected.
+type versionMsg struct {
+	v   importer.Version
+	err error
+}
+
+func (m model) loadVersion() tea.Cmd {
+	return func() tea.Msg {
+		v, err := serverVersion(importer.AuthContext(context.Background(), m.apiToken), m.internalClient)
+		return versionMsg{v, err}
+	}
+}
+
+// degradedSummary lists the created devices that lack a field the server
+// doesn't support, or nothing if there are none.
+func (m model) degradedSummary() string {
+	var degraded []importer.RowFailure
+	for _, fr := range m.results {
+		degraded = append(degraded, fr.Result.Degraded...)
+	}
+	if len(degraded) == 0 {
+		return ""
+	}
+
+	lines := []string{m.theme.warning.Render(fmt.Sprintf("⚠ %d devices without fields ChirpStack %s doesn't support", len(degraded), m.server))}
+	for i, f := range degraded {
+		if i == 10 {
+			lines = append(lines, m.theme.help.Render(fmt.Sprintf("- …and %d more", len(degraded)-i)))
+			break
+		}
+		lines = append(lines, m.theme.help.Render(fmt.Sprintf("- %s %s", f.Row.DevEUI, importer.DescribeError(f.Err))))
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
+
+// printDegraded warns about the created devices of a headless run that lack
+// a field the server doesn't support.
+func printDegraded(results []importer.FileResult) {
+	for _, fr := range results {
+		for _, f := range fr.Result.Degraded {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s %s\n", fr.Input.Source, f.Row.DevEUI, redact.Secrets(f.Err.Error()))
+		}
+	}
+}
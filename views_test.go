@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/golden"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chirpstack/chirpstack/api/go/v4/api"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/importer"
+)
+
+// sizes are the terminal sizes the screens are rendered at.
+var sizes = []tea.WindowSizeMsg{{Width: 80, Height: 24}, {Width: 120, Height: 40}}
+
+// forSizes runs test for each of sizes, named after the size, so that each
+// has its own golden file.
+func forSizes(t *testing.T, test func(t *testing.T, size tea.WindowSizeMsg)) {
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("%dx%d", size.Width, size.Height), func(t *testing.T) {
+			test(t, size)
+		})
+	}
+}
+
+// send has m handle msg and returns it with the command it returned.
+func send(t *testing.T, m model, msg tea.Msg) (model, tea.Cmd) {
+	t.Helper()
+	next, cmd := m.Update(msg)
+	return next.(model), cmd
+}
+
+// keys has m handle the keys typed as s, one at a time, and each filter of
+// a list that a key starts.
+func keys(t *testing.T, m model, s string) model {
+	t.Helper()
+	for _, r := range s {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}
+		switch r {
+		case '\n':
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case 0x1b:
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		var cmd tea.Cmd
+		m, cmd = send(t, m, msg)
+		m = filtered(t, m, cmd)
+	}
+	return m
+}
+
+// filtered has m handle the matches of a list filter among what cmd
+// returns, leaving out the rest, such as cursor blinks, which would wait.
+func filtered(t *testing.T, m model, cmd tea.Cmd) model {
+	t.Helper()
+	if cmd == nil {
+		return m
+	}
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+	var msg tea.Msg
+	select {
+	case msg = <-done:
+	case <-time.After(100 * time.Millisecond):
+		return m
+	}
+	switch msg := msg.(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			m = filtered(t, m, c)
+		}
+	case list.FilterMatchesMsg:
+		m, _ = send(t, m, msg)
+	}
+	return m
+}
+
+// screenModel returns a model of the given size that has connected and had
+// its tenant, application and device profile selected, with the file picker
+// open in a directory of the lists in testdata/lists and a few other files.
+func screenModel(t *testing.T, size tea.WindowSizeMsg) model {
+	t.Helper()
+	dir := t.TempDir()
+	lists, err := filepath.Glob(filepath.Join("testdata", "lists", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The picker shows when the highlighted file was modified, but the
+	// directory is highlighted.
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, path := range append(lists, "notes.pdf") {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			data = []byte("%PDF")
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		copied := filepath.Join(dir, filepath.Base(path))
+		if err := os.WriteFile(copied, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(copied, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{server: "chirpstack:8080", startDir: dir, plain: true, noHistory: true, concurrency: 1}
+	cfg.Mode = importer.ModeImport
+	m := initialModel(cfg, history{})
+	m, _ = send(t, m, size)
+	m.apiToken = testToken
+	m.tenantName, m.selectedTenant = "Acme", "52f14cd4-c6f1-4fbd-8f87-4025e1d49242"
+	m.appName, m.selectedApp = "Sensors", "3a9c6f5e-1b7d-4e0a-9f2b-8c4d5e6f7a8b"
+	m.profileName, m.selectedProfile = "EU868 OTAA", "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"
+	m.state, m.status = stateFileSelect, ""
+	m, _ = send(t, m, m.filepicker.list()())
+	return m
+}
+
+// read reads the device list name of testdata/lists as the file picker
+// does, and returns m with the message that ends the reading handled.
+func read(t *testing.T, m model, name string) model {
+	t.Helper()
+	next, cmd := m.readPaths([]string{filepath.Join("testdata", "lists", name)})
+	m = next.(model)
+	for {
+		msg := cmd()
+		m, cmd = send(t, m, msg)
+		switch msg.(type) {
+		case inputsReadMsg, needMappingMsg, errorMsg:
+			return m
+		}
+	}
+}
+
+func TestFilePickerView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := screenModel(t, size)
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+func TestMappingView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := read(t, screenModel(t, size), "unmapped.csv")
+		if m.state != stateColumnMapping {
+			t.Fatalf("state = %v after reading a list without known columns", m.state)
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+func TestConfirmView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := read(t, screenModel(t, size), "devices.csv")
+		if m.state != statePreview {
+			t.Fatalf("state = %v after reading a list", m.state)
+		}
+		next, _ := m.confirm()
+		m = next.(model)
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+func TestProcessingView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := read(t, screenModel(t, size), "devices.csv")
+		m.state = stateProcessing
+		m, _ = send(t, m, importer.RunStarted{Total: 2})
+		m, _ = send(t, m, importer.RowFinished{Source: m.inputs[0].Source, Row: m.inputs[0].Rows[0], Done: 1})
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+func TestSummaryView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := read(t, screenModel(t, size), "devices.csv")
+		m.state = stateProcessing
+		in := m.inputs[0]
+		failed := status.Error(codes.PermissionDenied, "not allowed")
+		m, _ = send(t, m, importer.RunStarted{Total: 2})
+		m, _ = send(t, m, importer.RowFinished{Source: in.Source, Row: in.Rows[0], Done: 1})
+		m, _ = send(t, m, importer.RowFinished{Source: in.Source, Row: in.Rows[1], Err: failed, Done: 2})
+		m, _ = send(t, m, importer.RunFinished{Results: []importer.FileResult{{
+			Input: in,
+			Result: importer.Result{
+				Created:  1,
+				Failures: []importer.RowFailure{{Row: in.Rows[1], Err: failed}},
+			},
+		}}, Report: importer.Report{
+			Created: []importer.RowResult{{Source: in.Source, Row: in.Rows[0], Status: importer.StatusCreated}},
+			Failed:  []importer.RowResult{{Source: in.Source, Row: in.Rows[1], Status: importer.StatusFailed, Err: failed}},
+		}})
+		if n := len(m.report) - len(in.Rejected); n != 2 {
+			t.Fatalf("report has %d imported rows, want both from RunFinished", n)
+		}
+		if m.state != stateComplete {
+			t.Fatalf("state = %v after the import finished", m.state)
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+func TestProcessingErrorView(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m := read(t, screenModel(t, size), "devices.csv")
+		m.state = stateProcessing
+		m, _ = send(t, m, importer.RunStarted{Total: 2})
+		m, _ = send(t, m, importer.RunFinished{Err: status.Error(codes.Unauthenticated, "invalid token")})
+		if m.state != stateError {
+			t.Fatalf("state = %v after the import failed", m.state)
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+// TestEmptyToken presses enter with no token typed, which stays on the
+// token input and says why.
+func TestEmptyToken(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		cfg := config{server: "chirpstack:8080", plain: true, noHistory: true, startDir: t.TempDir()}
+		m := initialModel(cfg, history{})
+		m, _ = send(t, m, size)
+		m, cmd := send(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+		if m.state != stateConnecting || cmd != nil {
+			t.Fatalf("enter on an empty token: state = %v, cmd = %v; want to stay on the token input", m.state, cmd)
+		}
+		if m.status == "" {
+			t.Error("enter on an empty token says nothing")
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+
+		m = keys(t, m, testToken+"\n")
+		if m.status != "" || m.apiToken != testToken {
+			t.Errorf("after connecting: status = %q, token = %q", m.status, m.apiToken)
+		}
+	})
+}
+
+// TestRevealToken checks that showing the token being typed and opening
+// the previous imports are keys of their own.
+func TestRevealToken(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cfg := config{server: "chirpstack:8080", plain: true, noHistory: true, startDir: t.TempDir()}
+	m := initialModel(cfg, history{})
+	m, _ = send(t, m, sizes[0])
+	m = keys(t, m, testToken)
+
+	m, _ = send(t, m, tea.KeyMsg{Type: tea.KeyCtrlR})
+	if m.state != stateConnecting || m.tokenInput.EchoMode != textinput.EchoNormal {
+		t.Fatalf("ctrl+r: state = %v, echo mode = %v; want the token shown", m.state, m.tokenInput.EchoMode)
+	}
+	m, _ = send(t, m, tea.KeyMsg{Type: tea.KeyCtrlR})
+	if m.tokenInput.EchoMode != textinput.EchoPassword {
+		t.Error("ctrl+r again didn't hide the token")
+	}
+
+	m, _ = send(t, m, tea.KeyMsg{Type: tea.KeyCtrlT})
+	if m.state != stateRuns {
+		t.Errorf("ctrl+t with a token typed: state = %v, want the previous imports", m.state)
+	}
+}
+
+// TestResizeBeforeLists resizes the window before any list has been
+// loaded, which the lists then have to be made at the new size.
+func TestResizeBeforeLists(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		cfg := config{server: "chirpstack:8080", plain: true, noHistory: true, startDir: t.TempDir()}
+		m := initialModel(cfg, history{})
+		m, _ = send(t, m, size)
+		var items []item
+		for _, name := range []string{"Acme", "Beta Labs", "Campus"} {
+			items = append(items, item{title: name, desc: "0 devices • 0 gateways", id: "id-" + name})
+		}
+		m, _ = send(t, m, tenantsLoadedMsg{items, len(items)})
+		if w, h := m.tenantList.Width(), m.tenantList.Height(); w != size.Width-4 || h != size.Height-8 {
+			t.Errorf("tenant list is %dx%d, want %dx%d", w, h, size.Width-4, size.Height-8)
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+	})
+}
+
+// TestSelectWhileFiltering presses enter while a filter is typed into the
+// tenant list, which applies the filter, and again to select the tenant it
+// leaves.
+func TestSelectWhileFiltering(t *testing.T) {
+	forSizes(t, func(t *testing.T, size tea.WindowSizeMsg) {
+		m, srv := connected(t)
+		m, _ = send(t, m, size)
+		var items []item
+		for _, name := range []string{"Acme", "Beta Labs", "Campus"} {
+			items = append(items, item{title: name, desc: "0 devices • 0 gateways", id: srv.AddTenant(&api.Tenant{Name: name})})
+		}
+		m, _ = send(t, m, tenantsLoadedMsg{items, len(items)})
+
+		m = keys(t, m, "/bet")
+		if !m.filtering() {
+			t.Fatal("not filtering after /")
+		}
+		golden.RequireEqual(t, []byte(m.View()))
+
+		m = keys(t, m, "\n")
+		if m.state != stateTenantSelect || m.filtering() || m.selectedTenant != "" {
+			t.Fatalf("enter while filtering: state = %v, filtering = %v, tenant = %q; want the filter applied", m.state, m.filtering(), m.selectedTenant)
+		}
+		m = keys(t, m, "\n")
+		if m.selectedTenant != items[1].id || m.tenantName != "Beta Labs" {
+			t.Errorf("selected %q (%s), want Beta Labs", m.tenantName, m.selectedTenant)
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/MyayKhway/chirpstack-grpc-device-adder/redact"
+)
+
+// A watched directory is listed when file system events say it changed,
+// and again watchSettle later while a list in it is still being written.
+// It is also listed every watchRescan, for network shares, where drops from
+// other machines raise no events, and every watchInterval where there are
+// no events to be had at all.
+const (
+	watchSettle   = 500 * time.Millisecond
+	watchRescan   = 30 * time.Second
+	watchInterval = 2 * time.Second
+)
+
+// Subdirectories of a watched directory: files being imported, and those
+// imported or not, each next to the report of its import
+const (
+	watchProcessing = "processing"
+	watchDone       = "done"
+	watchFailed     = "failed"
+)
+
+// watcher imports the device lists dropped into a directory, one at a time,
+// each by a headless run of this program with the flags it was started with.
+type watcher struct {
+	dir  string
+	args []string // flags for the headless runs
+
+	pending map[string]fileState // candidates, to see when they stop growing
+	names   map[string]bool      // names of the lists imported before
+	hashes  map[string]string    // content hash -> list imported before
+
+	process func(ctx context.Context, name string) error // importList unless set, for tests
+}
+
+// fileState is what a listing shows of a file, which stops changing once the
+// file has been written.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// runWatch imports the lists dropped into dir until ctx is cancelled. Lists
+// present at startup are imported too. A list whose name or content matches
+// one imported successfully before is moved to failed/ without importing it,
+// so that a file dropped twice doesn't create its devices twice.
+func runWatch(ctx context.Context, cfg config, dir string) int {
+	switch {
+	case cfg.token == "":
+		return usageError("--token (or CHIRPSTACK_API_TOKEN) is required to watch a directory")
+	case cfg.applicationID == "":
+		return usageError("--application is required to watch a directory")
+	case cfg.profileID == "" && cfg.Mode.NeedsProfile():
+		return usageError(fmt.Sprintf("--profile is required to %s", cfg.Mode))
+	case cfg.input != "" || cfg.failuresFile != "":
+		return usageError("--csv, --stdin and --failures can't be used with --watch")
+	case cfg.Mode.ReadOnly():
+		return usageError(fmt.Sprintf("--watch can't be used with --mode %s", cfg.Mode))
+	}
+
+	w := &watcher{
+		dir:     dir,
+		args:    watchArgs(os.Args[1:]),
+		pending: make(map[string]fileState),
+		names:   make(map[string]bool),
+		hashes:  make(map[string]string),
+	}
+	if err := w.init(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", redact.Secrets(err.Error()))
+		return 1
+	}
+	slog.Info("Watching for device lists", "dir", dir)
+	w.watch(ctx)
+	slog.Info("Stopped watching", "dir", dir)
+	return 0
+}
+
+// watch imports the lists dropped into the directory until ctx is
+// cancelled, listing it as the file system events say it changed, or every
+// watchInterval without them.
+func (w *watcher) watch(ctx context.Context) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	interval := watchRescan
+	fw, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = fw.Add(w.dir); err != nil {
+			fw.Close()
+		}
+	}
+	if err != nil {
+		slog.Warn("Polling the directory, file system events aren't available", "dir", w.dir, "err", err)
+		interval = watchInterval
+	} else {
+		defer fw.Close()
+		events, errs = fw.Events, fw.Errors
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var settle <-chan time.Time // the next listing, sooner than the ticker's
+	for {
+		if err := w.poll(ctx); err != nil {
+			slog.Error("Failed to list the directory", "dir", w.dir, "err", err)
+		}
+		settle = nil
+		if len(w.pending) > 0 {
+			settle = time.After(watchSettle)
+		}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-events:
+				if settle == nil {
+					settle = time.After(watchSettle)
+				}
+			case err := <-errs:
+				// Events were lost, so list the directory to see what they were.
+				slog.Warn("Missed file system events", "dir", w.dir, "err", err)
+				break wait
+			case <-settle:
+				break wait
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
+
+// watchArgs returns the command line for the headless runs: args without
+// --watch and its value.
+func watchArgs(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		switch {
+		case name == "watch":
+			i++ // its value
+		case strings.HasPrefix(name, "watch="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return append(out, "--headless")
+}
+
+// init creates the subdirectories and remembers the lists imported before.
+// A list left in processing/ by a run that was cut short is put back to be
+// imported again; its devices that were created fail as existing ones.
+func (w *watcher) init() error {
+	for _, sub := range []string{watchProcessing, watchDone, watchFailed} {
+		if err := os.MkdirAll(filepath.Join(w.dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	done, err := os.ReadDir(filepath.Join(w.dir, watchDone))
+	if err != nil {
+		return err
+	}
+	for _, e := range done {
+		if !isWatchedList(e) {
+			continue
+		}
+		hash, err := hashFile(filepath.Join(w.dir, watchDone, e.Name()))
+		if err != nil {
+			return err
+		}
+		w.names[e.Name()] = true
+		w.hashes[hash] = e.Name()
+	}
+
+	left, err := os.ReadDir(filepath.Join(w.dir, watchProcessing))
+	if err != nil {
+		return err
+	}
+	for _, e := range left {
+		if isWatchedList(e) {
+			slog.Warn("Importing the list again, its last import was interrupted", "list", e.Name())
+			if err := os.Rename(filepath.Join(w.dir, watchProcessing, e.Name()), filepath.Join(w.dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isWatchedList reports whether e is a device list to import, rather than
+// e.g. the failed rows or generated keys of one.
+func isWatchedList(e os.DirEntry) bool {
+	name := e.Name()
+	return e.Type().IsRegular() && !strings.HasPrefix(name, ".") &&
+		strings.EqualFold(filepath.Ext(name), ".csv") &&
+		!strings.HasSuffix(name, ".failures.csv") && !strings.HasSuffix(name, ".keys.csv")
+}
+
+// poll imports the lists that haven't changed since the last listing.
+func (w *watcher) poll(ctx context.Context) error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if !isWatchedList(e) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since the listing
+		}
+		name := e.Name()
+		seen[name] = true
+
+		state := fileState{info.Size(), info.ModTime()}
+		if last, ok := w.pending[name]; !ok || last != state {
+			w.pending[name] = state // still being written, or new
+			continue
+		}
+		delete(w.pending, name)
+		if ctx.Err() != nil {
+			return nil
+		}
+		process := w.process
+		if process == nil {
+			process = w.importList
+		}
+		if err := process(ctx, name); err != nil {
+			slog.Error("Failed to process the list", "list", name, "err", err)
+		}
+	}
+	for name := range w.pending {
+		if !seen[name] {
+			delete(w.pending, name)
+		}
+	}
+	return nil
+}
+
+// importList imports the list called name, or skips it if it was imported
+// before, and moves it to done/ or failed/ with its report.
+func (w *watcher) importList(ctx context.Context, name string) error {
+	path := filepath.Join(w.dir, watchProcessing, name)
+	if err := os.Rename(filepath.Join(w.dir, name), path); err != nil {
+		return err
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	var report []byte
+	ok := false
+	switch first, dup := w.hashes[hash]; {
+	case w.names[name]:
+		report = []byte("Skipped: a list of this name was imported before, see " + filepath.Join(watchDone, name) + "\n")
+	case dup:
+		report = []byte("Skipped: the same list was imported before as " + filepath.Join(watchDone, first) + "\n")
+	default:
+		slog.Info("Importing the list", "list", name)
+		cmd := w.command(ctx, path)
+		report, err = cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			// Imported again on the next start, see init.
+			return fmt.Errorf("import interrupted, left in %s", watchProcessing)
+		}
+		ok = err == nil
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			report = append(report, fmt.Sprintf("error: %s\n", redact.Secrets(err.Error()))...)
+		}
+	}
+
+	to := watchFailed
+	if ok {
+		to = watchDone
+		w.names[name] = true
+		w.hashes[hash] = name
+	}
+	dest, err := w.move(name, to)
+	if err != nil {
+		return err
+	}
+	slog.Info("Moved the list", "list", name, "to", dest)
+	return createFile(strings.TrimSuffix(dest, filepath.Ext(dest))+".report.txt", func(f io.Writer) error {
+		_, err := f.Write(report)
+		return err
+	})
+}
+
+// command returns the headless run importing path. It is interrupted along
+// with the watch, and killed if it doesn't stop in time.
+func (w *watcher) command(ctx context.Context, path string) *exec.Cmd {
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+	cmd := exec.CommandContext(ctx, self, append(w.args, "--csv", path)...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = shutdownGrace
+	return cmd
+}
+
+// move moves the list called name, and the failed rows and generated keys
+// written next to it, from processing/ to the subdirectory to. A list of
+// the same name there already is kept by giving the new one a timestamp.
+// It returns the new path of the list.
+func (w *watcher) move(name, to string) (string, error) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	stem := base
+	if _, err := os.Stat(filepath.Join(w.dir, to, name)); err == nil {
+		stem = base + "-" + time.Now().Format("20060102T150405")
+	}
+
+	var dest string
+	for _, suffix := range []string{filepath.Ext(name), ".failures.csv", ".keys.csv"} {
+		from := filepath.Join(w.dir, watchProcessing, base+suffix)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		path := filepath.Join(w.dir, to, stem+suffix)
+		if err := os.Rename(from, path); err != nil {
+			return "", err
+		}
+		if dest == "" {
+			dest = path
+		}
+	}
+	return dest, nil
+}
+
+// hashFile returns the SHA-256 of the content of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
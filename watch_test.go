@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWatchEvents checks that a dropped list is imported once it has been
+// written, and that the file system events have it noticed sooner than
+// listing the directory would.
+func TestWatchEvents(t *testing.T) {
+	dir := t.TempDir()
+	imported := make(chan string, 1)
+	w := &watcher{
+		dir:     dir,
+		pending: make(map[string]fileState),
+		process: func(_ context.Context, name string) error {
+			imported <- name
+			return os.Remove(filepath.Join(dir, name))
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		w.watch(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// Let the first listing pass before the drop.
+	time.Sleep(100 * time.Millisecond)
+	for _, name := range []string{"devices.failures.csv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("dev_eui\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := os.WriteFile(filepath.Join(dir, "devices.csv"), []byte("dev_eui\n70b3d57ed0000001\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-imported:
+		if name != "devices.csv" {
+			t.Errorf("imported %s, want devices.csv", name)
+		}
+		if d := time.Since(start); d >= watchInterval {
+			t.Errorf("the list was imported after %s, no sooner than by listing", d)
+		}
+	case <-time.After(watchRescan):
+		t.Fatal("the list wasn't imported")
+	}
+	select {
+	case name := <-imported:
+		t.Errorf("imported %s too", name)
+	case <-time.After(2 * watchSettle):
+	}
+}